@@ -17,6 +17,7 @@ import (
 	"cboard-go/internal/core/config"
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
 	"cboard-go/internal/services/geoip"
 	"cboard-go/internal/services/scheduler"
 	"cboard-go/internal/utils"
@@ -76,6 +77,9 @@ func main() {
 		log.Printf("初始化日志失败: %v", err)
 	}
 
+	// 将旧版订阅地址配置登记为节点源
+	config_update.NewConfigUpdateService().MigrateLegacySourceURLs()
+
 	// 初始化 GeoIP（如果数据库文件存在）
 	geoipPath := os.Getenv("GEOIP_DB_PATH")
 	if geoipPath == "" {
@@ -101,6 +105,10 @@ func main() {
 	} else {
 		log.Println("GeoIP 数据库已加载，地理位置解析功能已启用")
 	}
+	// ASN 数据库可选，用于节点导入时解析服务器所属网络
+	if err := geoip.InitASN(os.Getenv("GEOIP_ASN_DB_PATH")); err != nil {
+		log.Printf("ASN 数据库未加载（节点 ASN 解析已禁用）: %v", err)
+	}
 	defer geoip.Close()
 
 	// 启动定时任务（如果未禁用）
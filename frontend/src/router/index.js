@@ -46,6 +46,7 @@ const routes = [
       { path: 'custom-nodes', name: 'AdminCustomNodes', component: () => import('@/views/admin/CustomNodes.vue'), meta: { title: '专线节点管理', breadcrumb: [{ title: '管理后台', path: '/admin/dashboard' }, { title: '专线节点管理', path: '/admin/custom-nodes' }] } },
       { path: 'subscriptions', name: 'AdminSubscriptions', component: () => import('@/views/admin/Subscriptions.vue'), meta: { title: '订阅管理', breadcrumb: [{ title: '管理后台', path: '/admin/dashboard' }, { title: '订阅管理', path: '/admin/subscriptions' }] } },
       { path: 'orders', name: 'AdminOrders', component: () => import('@/views/admin/Orders.vue'), meta: { title: '订单管理', breadcrumb: [{ title: '管理后台', path: '/admin/dashboard' }, { title: '订单管理', path: '/admin/orders' }] } },
+      { path: 'bank-transfers', name: 'AdminBankTransfers', component: () => import('@/views/admin/BankTransfers.vue'), meta: { title: '转账审核', breadcrumb: [{ title: '管理后台', path: '/admin/dashboard' }, { title: '转账审核', path: '/admin/bank-transfers' }] } },
       { path: 'packages', name: 'AdminPackages', component: () => import('@/views/admin/Packages.vue'), meta: { title: '套餐管理', breadcrumb: [{ title: '管理后台', path: '/admin/dashboard' }, { title: '套餐管理', path: '/admin/packages' }] } },
       { path: 'payment-config', name: 'AdminPaymentConfig', component: () => import('@/views/admin/PaymentConfig.vue'), meta: { title: '支付配置', breadcrumb: [{ title: '管理后台', path: '/admin/dashboard' }, { title: '支付配置', path: '/admin/payment-config' }] } },
       { path: 'settings', name: 'AdminSettings', component: () => import('@/views/admin/Settings.vue'), meta: { title: '系统设置', breadcrumb: [{ title: '管理后台', path: '/admin/dashboard' }, { title: '系统设置', path: '/admin/settings' }] } },
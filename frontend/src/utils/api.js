@@ -396,7 +396,11 @@ export const nodeAPI = {
   importNodeLinks: (links) => api.post('/admin/nodes/import-links', { links }),
   updateNode: (id, data) => api.put(`/admin/nodes/${id}`, data),
   deleteNode: (id) => api.delete(`/admin/nodes/${id}`),
+  getNodeAgent: (id) => api.get(`/admin/nodes/${id}/agent`),
+  updateNodeAgent: (id, data) => api.put(`/admin/nodes/${id}/agent`, data),
   testNode: (id) => api.post(`/admin/nodes/${id}/test`),
+  getNodeHealth: (id, range = '24h') => api.get(`/admin/nodes/${id}/health`, { params: { range } }),
+  getNodesHealth: (params) => api.get('/admin/nodes/health', { params }),
   batchTestNodes: (nodeIds) => api.post('/admin/nodes/batch-test', { node_ids: nodeIds }),
   batchDeleteNodes: (nodeIds) => api.post('/admin/nodes/batch-delete', { node_ids: nodeIds })
 }
@@ -407,6 +411,12 @@ export const adminAPI = {
   getUsers: (params) => api.get('/admin/users', { params }),
   getUserStatistics: () => api.get('/admin/users/statistics'),
   getOrders: (params) => api.get('/admin/orders', { params }),
+  getBankTransfers: (params) => api.get('/admin/bank-transfers', { params }),
+  getBankTransferReceipt: (id) => api.get(`/admin/bank-transfers/${id}/receipt`, { responseType: 'blob' }),
+  approveBankTransfer: (id) => api.post(`/admin/bank-transfers/${id}/approve`),
+  rejectBankTransfer: (id, reason) => api.post(`/admin/bank-transfers/${id}/reject`, { reason }),
+  getCryptoPayments: (params) => api.get('/admin/crypto-payments', { params }),
+  resolveCryptoPayment: (id, credit) => api.post(`/admin/crypto-payments/${id}/resolve`, { credit }),
   createUser: (data) => api.post('/admin/users', data),
   getUser: (id) => api.get(`/admin/users/${id}`),
   updateUser: (id, data) => api.put(`/admin/users/${id}`, data),
@@ -527,6 +537,14 @@ export const paymentAPI = {
   getPaymentMethods: () => api.get('/payment-methods/active'),
   createPayment: (data) => api.post('/payment/', data),
   getPaymentStatus: (id) => api.get(`/payment/status/${id}`),
+  getCryptoPayment: (orderNo) => api.get(`/payment/crypto/${orderNo}`),
+  getBankTransfer: (orderNo) => api.get(`/payment/bank-transfer/${orderNo}`),
+  uploadBankTransferReceipt: (orderNo, file) => {
+    const formData = new FormData()
+    formData.append('file', file)
+    return api.post(`/payment/bank-transfer/${orderNo}/receipt`, formData, { headers: { 'Content-Type': 'multipart/form-data' } })
+  },
+  getBankTransferReceipt: (orderNo) => api.get(`/payment/bank-transfer/${orderNo}/receipt`, { responseType: 'blob' }),
   getPaymentConfigs: (params) => api.get('/payment-config/', { params }),
   createPaymentConfig: (data) => api.post('/payment-config/', data),
   updatePaymentConfig: (id, data) => api.put(`/payment-config/${id}`, data),
@@ -13,6 +13,8 @@ import (
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/middleware"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
+	"cboard-go/internal/services/traffic"
 	"cboard-go/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -509,6 +511,8 @@ func CreateUserLevel(c *gin.Context) {
 		IconURL        string  `json:"icon_url"`
 		Benefits       string  `json:"benefits"`
 		IsActive       bool    `json:"is_active"`
+
+		ClashTemplateID uint `json:"clash_template_id"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -546,6 +550,12 @@ func CreateUserLevel(c *gin.Context) {
 	if req.Benefits != "" {
 		userLevel.Benefits = database.NullString(req.Benefits)
 	}
+	templateID, err := resolveClashTemplateID(db, req.ClashTemplateID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	userLevel.ClashTemplateID = templateID
 
 	if err := db.Create(&userLevel).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "创建用户等级失败", err)
@@ -575,6 +585,8 @@ func UpdateUserLevel(c *gin.Context) {
 		IconURL        *string `json:"icon_url"` // 使用指针以区分空字符串和未传递
 		Benefits       *string `json:"benefits"` // 使用指针以区分空字符串和未传递
 		IsActive       *bool   `json:"is_active"`
+
+		ClashTemplateID *uint `json:"clash_template_id"` // 0 表示恢复为默认模板
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -623,11 +635,22 @@ func UpdateUserLevel(c *gin.Context) {
 	if req.IsActive != nil {
 		userLevel.IsActive = *req.IsActive
 	}
+	if req.ClashTemplateID != nil {
+		templateID, err := resolveClashTemplateID(db, *req.ClashTemplateID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		userLevel.ClashTemplateID = templateID
+	}
 
 	if err := db.Save(&userLevel).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "更新用户等级失败", err)
 		return
 	}
+	if req.ClashTemplateID != nil {
+		config_update.InvalidateSubscriptionCache()
+	}
 
 	utils.SuccessResponse(c, http.StatusOK, "更新成功", userLevel)
 }
@@ -676,6 +699,7 @@ func GetUserSubscription(c *gin.Context) {
 	timestamp := fmt.Sprintf("%d", utils.GetBeijingTime().Unix())
 	clashURL := fmt.Sprintf("%s/api/v1/subscriptions/clash/%s?t=%s", baseURL, subscription.SubscriptionURL, timestamp)         // 猫咪订阅（Clash YAML格式）
 	universalURL := fmt.Sprintf("%s/api/v1/subscriptions/universal/%s?t=%s", baseURL, subscription.SubscriptionURL, timestamp) // 通用订阅（Base64格式，适用于小火煎、v2ray等）
+	singboxURL := fmt.Sprintf("%s/api/v1/subscriptions/singbox/%s?t=%s", baseURL, subscription.SubscriptionURL, timestamp)     // sing-box 订阅（JSON格式）
 
 	// 计算到期时间
 	expiryDate := "未设置"
@@ -720,6 +744,7 @@ func GetUserSubscription(c *gin.Context) {
 		"subscription_url": subscription.SubscriptionURL,
 		"clash_url":        clashURL,
 		"universal_url":    universalURL, // 通用订阅（Base64格式）
+		"singbox_url":      singboxURL,   // sing-box 订阅（JSON格式）
 		"qrcode_url":       qrcodeURL,
 		"device_limit":     subscription.DeviceLimit,
 		"current_devices":  onlineDevices,
@@ -730,6 +755,16 @@ func GetUserSubscription(c *gin.Context) {
 		"remaining_days":   remainingDays,
 		"is_expired":       isExpired,
 		"created_at":       subscription.CreatedAt.Format("2006-01-02 15:04:05"),
+
+		"traffic_limit":      subscription.TrafficLimit,
+		"upload_traffic":     subscription.UploadTraffic,
+		"download_traffic":   subscription.DownloadTraffic,
+		"used_traffic":       subscription.UsedTraffic(),
+		"traffic_reset_mode": subscription.TrafficResetMode,
+		"traffic_exhausted":  subscription.IsTrafficExhausted(),
+	}
+	if next, ok := traffic.NextResetTime(&subscription); ok {
+		subscriptionData["traffic_next_reset"] = next.Format("2006-01-02 15:04:05")
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "", subscriptionData)
@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cboard-go/internal/core/config"
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/middleware"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/email"
+	"cboard-go/internal/services/notification"
+	orderServicePkg "cboard-go/internal/services/order"
+	"cboard-go/internal/services/payment"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 回执文件限制
+const maxReceiptSize = 5 << 20
+
+var receiptContentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// receiptDir 回执存储目录（上传目录下的 receipts，不通过静态路由公开）
+func receiptDir() string {
+	uploadDir := "uploads"
+	if config.AppConfig != nil && config.AppConfig.UploadDir != "" {
+		uploadDir = config.AppConfig.UploadDir
+	}
+	return filepath.Join(uploadDir, "receipts")
+}
+
+// buildBankTransferData 构建银行转账支付单数据（含收款信息）
+func buildBankTransferData(db *gorm.DB, transfer *models.BankTransfer) gin.H {
+	data := gin.H{
+		"id":                  transfer.ID,
+		"order_no":            transfer.OrderNo,
+		"amount":              transfer.Amount,
+		"reference_code":      transfer.ReferenceCode,
+		"status":              transfer.Status,
+		"has_receipt":         transfer.ReceiptFile != "",
+		"receipt_uploaded_at": transfer.ReceiptUploadedAt,
+		"reject_reason":       transfer.RejectReason,
+		"reviewed_at":         transfer.ReviewedAt,
+		"created_at":          transfer.CreatedAt,
+	}
+	var paymentConfig models.PaymentConfig
+	if err := db.First(&paymentConfig, transfer.PaymentConfigID).Error; err == nil {
+		if account, err := payment.ParseBankAccount(&paymentConfig); err == nil {
+			data["bank_account"] = account
+		}
+	}
+	return data
+}
+
+// GetBankTransfer 获取订单的银行转账说明（收款账户、金额、参考号）和审核状态
+func GetBankTransfer(c *gin.Context) {
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "未登录", nil)
+		return
+	}
+
+	db := database.GetDB()
+	transfer, err := payment.GetBankTransfer(db.Where("user_id = ?", user.ID), c.Param("orderNo"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "银行转账支付单不存在", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", buildBankTransferData(db, transfer))
+}
+
+// UploadBankTransferReceipt 上传转账回执图片，提交后进入管理员审核队列
+func UploadBankTransferReceipt(c *gin.Context) {
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "未登录", nil)
+		return
+	}
+
+	db := database.GetDB()
+	transfer, err := payment.GetBankTransfer(db.Where("user_id = ?", user.ID), c.Param("orderNo"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "银行转账支付单不存在", err)
+		return
+	}
+	if transfer.Status == payment.BankTransferApproved || transfer.Status == payment.BankTransferCancelled {
+		utils.ErrorResponse(c, http.StatusBadRequest, "该转账已处理，无需上传回执", nil)
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请选择回执图片", err)
+		return
+	}
+	if file.Size > maxReceiptSize {
+		utils.ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("回执图片不能超过 %d MB", maxReceiptSize>>20), nil)
+		return
+	}
+
+	// 按文件内容识别类型，不信任扩展名
+	src, err := file.Open()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "读取回执失败", err)
+		return
+	}
+	head := make([]byte, 512)
+	n, _ := src.Read(head)
+	src.Close()
+	ext, ok := receiptContentTypes[http.DetectContentType(head[:n])]
+	if !ok {
+		utils.ErrorResponse(c, http.StatusBadRequest, "回执仅支持 JPG、PNG、GIF、WEBP 图片", nil)
+		return
+	}
+
+	dir := receiptDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "系统错误", err)
+		return
+	}
+	fileName := fmt.Sprintf("%s_%d%s", transfer.ReferenceCode, utils.GetBeijingTime().UnixNano(), ext)
+	if err := c.SaveUploadedFile(file, filepath.Join(dir, fileName)); err != nil {
+		utils.LogError("UploadBankTransferReceipt: save file", err, nil)
+		utils.ErrorResponse(c, http.StatusInternalServerError, "保存回执失败", err)
+		return
+	}
+
+	oldFile := transfer.ReceiptFile
+	if err := payment.SubmitBankTransferReceipt(db, transfer, fileName); err != nil {
+		os.Remove(filepath.Join(dir, fileName))
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if oldFile != "" {
+		os.Remove(filepath.Join(dir, filepath.Base(oldFile)))
+	}
+
+	utils.CreateAuditLogSimple(c, "upload_bank_receipt", "bank_transfer", transfer.ID,
+		fmt.Sprintf("上传银行转账回执: %s (%s)", transfer.OrderNo, transfer.ReferenceCode))
+	go func() {
+		_ = notification.NewNotificationService().SendAdminNotification("bank_transfer", map[string]interface{}{
+			"title": "银行转账待审核",
+			"message": fmt.Sprintf("用户 %s 提交了银行转账回执\n订单号：%s\n金额：¥%.2f\n参考号：%s",
+				user.Username, transfer.OrderNo, transfer.Amount, transfer.ReferenceCode),
+		})
+	}()
+
+	utils.SuccessResponse(c, http.StatusOK, "回执已提交，请等待管理员审核", buildBankTransferData(db, transfer))
+}
+
+// GetBankTransferReceipt 查看自己上传的转账回执
+func GetBankTransferReceipt(c *gin.Context) {
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "未登录", nil)
+		return
+	}
+
+	transfer, err := payment.GetBankTransfer(database.GetDB().Where("user_id = ?", user.ID), c.Param("orderNo"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "银行转账支付单不存在", err)
+		return
+	}
+	serveReceipt(c, transfer)
+}
+
+// serveReceipt 返回回执图片
+func serveReceipt(c *gin.Context, transfer *models.BankTransfer) {
+	if transfer.ReceiptFile == "" {
+		utils.ErrorResponse(c, http.StatusNotFound, "尚未上传回执", nil)
+		return
+	}
+	path := filepath.Join(receiptDir(), filepath.Base(transfer.ReceiptFile))
+	if _, err := os.Stat(path); err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "回执文件不存在", err)
+		return
+	}
+	c.Header("Cache-Control", "private, no-store")
+	c.File(path)
+}
+
+// GetAdminBankTransfers 管理员获取银行转账审核队列（默认只显示待审核）
+func GetAdminBankTransfers(c *gin.Context) {
+	db := database.GetDB()
+	page, size := 1, 20
+	fmt.Sscanf(c.DefaultQuery("page", "1"), "%d", &page)
+	fmt.Sscanf(c.DefaultQuery("size", "20"), "%d", &size)
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	query := db.Model(&models.BankTransfer{})
+	status := c.DefaultQuery("status", payment.BankTransferPendingReview)
+	if status != "all" {
+		query = query.Where("status = ?", status)
+	}
+	if keyword := utils.SanitizeSearchKeyword(c.Query("keyword")); keyword != "" {
+		query = query.Where("order_no LIKE ? OR reference_code LIKE ? OR user_id IN (SELECT id FROM users WHERE username LIKE ? OR email LIKE ?)",
+			"%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var transfers []models.BankTransfer
+	// 待审核按提交时间先后处理
+	order := "receipt_uploaded_at ASC, id ASC"
+	if status != payment.BankTransferPendingReview {
+		order = "id DESC"
+	}
+	if err := query.Preload("User").Order(order).Offset((page - 1) * size).Limit(size).Find(&transfers).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取银行转账列表失败", err)
+		return
+	}
+
+	list := make([]gin.H, 0, len(transfers))
+	for i := range transfers {
+		item := buildBankTransferData(db, &transfers[i])
+		item["user_id"] = transfers[i].UserID
+		item["username"] = transfers[i].User.Username
+		item["email"] = transfers[i].User.Email
+		list = append(list, item)
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"transfers": list,
+		"total":     total,
+		"page":      page,
+		"size":      size,
+	})
+}
+
+// GetAdminBankTransferReceipt 管理员查看转账回执
+func GetAdminBankTransferReceipt(c *gin.Context) {
+	var transfer models.BankTransfer
+	if err := database.GetDB().First(&transfer, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "银行转账支付单不存在", err)
+		return
+	}
+	serveReceipt(c, &transfer)
+}
+
+// ApproveBankTransfer 审核通过银行转账：订单入账并开通套餐（充值单增加余额）
+func ApproveBankTransfer(c *gin.Context) {
+	admin, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "未登录", nil)
+		return
+	}
+
+	db := database.GetDB()
+	var transfer models.BankTransfer
+	if err := db.First(&transfer, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "银行转账支付单不存在", err)
+		return
+	}
+	if transfer.Status != payment.BankTransferPendingReview {
+		utils.ErrorResponse(c, http.StatusBadRequest, "只能审核待审核的转账", nil)
+		return
+	}
+
+	// 先入账再更新审核状态：入账失败时保留在审核队列，入账本身是幂等的
+	err := orderServicePkg.NewOrderService().CompletePayment(orderServicePkg.PaymentResult{
+		OrderNo: transfer.OrderNo,
+		TradeNo: transfer.ReferenceCode,
+		Amount:  transfer.Amount,
+		Raw: map[string]string{
+			"reference_code": transfer.ReferenceCode,
+			"reviewed_by":    admin.Username,
+		},
+	})
+	if err != nil {
+		if errors.Is(err, orderServicePkg.ErrPaymentTargetNotFound) || errors.Is(err, orderServicePkg.ErrOrderAmountMismatch) ||
+			errors.Is(err, orderServicePkg.ErrRechargeAmountMismatch) {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "订单入账失败", err)
+		return
+	}
+	if err := payment.ReviewBankTransfer(db, &transfer, admin.ID, true, ""); err != nil {
+		utils.ErrorResponse(c, http.StatusConflict, err.Error(), err)
+		return
+	}
+
+	utils.CreateAuditLogSimple(c, "approve_bank_transfer", "bank_transfer", transfer.ID,
+		fmt.Sprintf("审核通过银行转账: %s (%s) ¥%.2f", transfer.OrderNo, transfer.ReferenceCode, transfer.Amount))
+	utils.SuccessResponse(c, http.StatusOK, "审核通过，订单已入账", buildBankTransferData(db, &transfer))
+}
+
+// RejectBankTransfer 驳回银行转账，通过站内通知和邮件告知用户原因
+func RejectBankTransfer(c *gin.Context) {
+	admin, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "未登录", nil)
+		return
+	}
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请填写驳回原因", err)
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+
+	db := database.GetDB()
+	var transfer models.BankTransfer
+	if err := db.Preload("User").First(&transfer, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "银行转账支付单不存在", err)
+		return
+	}
+	if err := payment.ReviewBankTransfer(db, &transfer, admin.ID, false, reason); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	db.Create(&models.Notification{
+		UserID:   sql.NullInt64{Int64: int64(transfer.UserID), Valid: true},
+		Title:    "银行转账审核未通过",
+		Content:  fmt.Sprintf("订单 %s 的转账回执未通过审核，原因：%s。请核对后在订单页面重新上传回执。", transfer.OrderNo, reason),
+		Type:     "payment",
+		IsActive: true,
+	})
+	if transfer.User.Email != "" {
+		content := email.NewEmailTemplateBuilder().GetBankTransferRejectedTemplate(
+			transfer.User.Username, transfer.OrderNo, transfer.Amount, transfer.ReferenceCode, reason)
+		if err := email.NewEmailService().QueueEmail(transfer.User.Email, "银行转账审核未通过", content, "bank_transfer_rejected"); err != nil {
+			utils.LogError("RejectBankTransfer: queue email", err, map[string]interface{}{"order_no": transfer.OrderNo})
+		}
+	}
+
+	utils.CreateAuditLogSimple(c, "reject_bank_transfer", "bank_transfer", transfer.ID,
+		fmt.Sprintf("驳回银行转账: %s (%s)，原因: %s", transfer.OrderNo, transfer.ReferenceCode, reason))
+	utils.SuccessResponse(c, http.StatusOK, "已驳回", buildBankTransferData(db, &transfer))
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
+	"cboard-go/internal/utils"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetClashTemplates 获取 Clash 配置模板列表（管理员）
+func GetClashTemplates(c *gin.Context) {
+	db := database.GetDB()
+	var templates []models.ClashTemplate
+	if err := db.Order("id ASC").Find(&templates).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取模板列表失败", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", templates)
+}
+
+// GetBuiltinClashTemplate 获取内置 Clash 模板（作为编辑自定义模板的起点）
+func GetBuiltinClashTemplate(c *gin.Context) {
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"content": config_update.DefaultClashTemplate,
+	})
+}
+
+// CreateClashTemplate 创建 Clash 配置模板（管理员）
+func CreateClashTemplate(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+		Content     string `json:"content" binding:"required"`
+		IsDefault   bool   `json:"is_default"`
+		IsActive    *bool  `json:"is_active"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+
+	if _, err := config_update.NewConfigUpdateService().PreviewClashTemplate(req.Content); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "模板校验失败: "+err.Error(), nil)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	db := database.GetDB()
+	var count int64
+	db.Model(&models.ClashTemplate{}).Where("name = ?", name).Count(&count)
+	if count > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "模板名称已存在", nil)
+		return
+	}
+
+	tpl := models.ClashTemplate{
+		Name:        name,
+		Description: req.Description,
+		Content:     req.Content,
+		IsDefault:   req.IsDefault,
+		IsActive:    true,
+	}
+	if req.IsActive != nil {
+		tpl.IsActive = *req.IsActive
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if tpl.IsDefault {
+			if err := tx.Model(&models.ClashTemplate{}).Where("is_default = ?", true).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&tpl).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建模板失败", err)
+		return
+	}
+	config_update.InvalidateSubscriptionCache()
+
+	utils.SuccessResponse(c, http.StatusCreated, "", tpl)
+}
+
+// UpdateClashTemplate 更新 Clash 配置模板（管理员）
+func UpdateClashTemplate(c *gin.Context) {
+	id := c.Param("id")
+	db := database.GetDB()
+
+	var tpl models.ClashTemplate
+	if err := db.First(&tpl, id).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "模板不存在", err)
+		return
+	}
+
+	var req struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Content     *string `json:"content"`
+		IsDefault   *bool   `json:"is_default"`
+		IsActive    *bool   `json:"is_active"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			utils.ErrorResponse(c, http.StatusBadRequest, "模板名称不能为空", nil)
+			return
+		}
+		var count int64
+		db.Model(&models.ClashTemplate{}).Where("name = ? AND id != ?", name, tpl.ID).Count(&count)
+		if count > 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "模板名称已存在", nil)
+			return
+		}
+		tpl.Name = name
+	}
+	if req.Description != nil {
+		tpl.Description = *req.Description
+	}
+	if req.Content != nil {
+		if _, err := config_update.NewConfigUpdateService().PreviewClashTemplate(*req.Content); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "模板校验失败: "+err.Error(), nil)
+			return
+		}
+		tpl.Content = *req.Content
+	}
+	if req.IsDefault != nil {
+		tpl.IsDefault = *req.IsDefault
+	}
+	if req.IsActive != nil {
+		tpl.IsActive = *req.IsActive
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if tpl.IsDefault {
+			if err := tx.Model(&models.ClashTemplate{}).Where("is_default = ? AND id != ?", true, tpl.ID).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(&tpl).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新模板失败", err)
+		return
+	}
+	config_update.InvalidateSubscriptionCache()
+
+	utils.SuccessResponse(c, http.StatusOK, "更新成功", tpl)
+}
+
+// DeleteClashTemplate 删除 Clash 配置模板，引用该模板的套餐和用户等级恢复为默认模板（管理员）
+func DeleteClashTemplate(c *gin.Context) {
+	id := c.Param("id")
+	db := database.GetDB()
+
+	var tpl models.ClashTemplate
+	if err := db.First(&tpl, id).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "模板不存在", err)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Package{}).Where("clash_template_id = ?", tpl.ID).Update("clash_template_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.UserLevel{}).Where("clash_template_id = ?", tpl.ID).Update("clash_template_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tpl).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除模板失败", err)
+		return
+	}
+	config_update.InvalidateSubscriptionCache()
+
+	utils.SuccessResponse(c, http.StatusOK, "删除成功", nil)
+}
+
+// PreviewClashTemplate 校验并预览 Clash 模板渲染结果（管理员）
+// 传入 content 时预览该内容，否则预览 template_id 对应的已保存模板
+func PreviewClashTemplate(c *gin.Context) {
+	var req struct {
+		Content    string `json:"content"`
+		TemplateID uint   `json:"template_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+
+	content := req.Content
+	if content == "" && req.TemplateID > 0 {
+		var tpl models.ClashTemplate
+		if err := database.GetDB().First(&tpl, req.TemplateID).Error; err != nil {
+			utils.ErrorResponse(c, http.StatusNotFound, "模板不存在", err)
+			return
+		}
+		content = tpl.Content
+	}
+	if content == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请提供模板内容或模板ID", nil)
+		return
+	}
+
+	config, err := config_update.NewConfigUpdateService().PreviewClashTemplate(content)
+	if err != nil {
+		utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+			"valid": false,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"valid":  true,
+		"config": config,
+	})
+}
+
+// resolveClashTemplateID 校验套餐/等级设置的模板ID，0 表示清除（使用默认模板）
+func resolveClashTemplateID(db *gorm.DB, id uint) (*uint, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	var count int64
+	if err := db.Model(&models.ClashTemplate{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("Clash 模板不存在")
+	}
+	return &id, nil
+}
@@ -14,6 +14,7 @@ import (
 	"cboard-go/internal/core/config"
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
 	"cboard-go/internal/services/email"
 	"cboard-go/internal/services/geoip"
 	"cboard-go/internal/services/notification"
@@ -69,6 +70,10 @@ func updateSettingsCommon(c *gin.Context, category string) {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "保存设置失败", err)
 		return
 	}
+	if category == "general" {
+		// 站点域名、订阅分组等设置会缓存在订阅渲染中
+		config_update.InvalidateSubscriptionCache()
+	}
 	utils.SuccessResponse(c, http.StatusOK, "设置已保存", nil)
 }
 
@@ -151,6 +156,7 @@ func UpdateSystemConfig(c *gin.Context) {
 				DoUpdates: clause.Assignments(map[string]interface{}{"value": val}),
 			}).Create(&models.SystemConfig{Key: k, Value: val, Category: "system"})
 		}
+		config_update.InvalidateSubscriptionCache()
 		utils.SuccessResponse(c, http.StatusOK, "批量更新成功", nil)
 		return
 	}
@@ -200,6 +206,7 @@ func UpdateSystemConfig(c *gin.Context) {
 			return
 		}
 	}
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusOK, "更新成功", config)
 }
 
@@ -220,6 +227,10 @@ func GetAdminSettings(c *gin.Context) {
 		"general": {
 			"site_name": "CBoard Modern", "site_description": "现代化的代理服务管理平台", "site_logo": "", "default_theme": "default",
 			"support_qq": "", "support_email": "",
+			"subscription_info_nodes": "true", "subscription_update_interval": 24,
+			"subscription_region_groups": "true", "subscription_region_group_type": "url-test",
+			"subscription_region_priority": "香港,台湾,日本,新加坡,美国,韩国,英国,德国",
+			"node_region_source":           "name",
 		},
 		"registration": {
 			"registration_enabled": "true", "email_verification_required": "true", "min_password_length": 8,
@@ -238,10 +249,14 @@ func GetAdminSettings(c *gin.Context) {
 			"announcement_content": "",
 		},
 		"node_health": {
-			"node_health_check_interval": "300",
-			"node_max_latency":           "3000",
-			"node_test_timeout":          "5",
-			"test_url":                   "https://ping.pe",
+			"node_health_check_interval":        "300",
+			"node_max_latency":                  "3000",
+			"node_test_timeout":                 "5",
+			"node_flap_threshold":               "4",
+			"node_flap_window":                  "60",
+			"node_health_raw_retention_days":    "7",
+			"node_health_rollup_retention_days": "90",
+			"test_url":                          "http://www.gstatic.com/generate_204",
 		},
 		"custom_node": {},
 		"notification": {
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/middleware"
+	"cboard-go/internal/models"
+	orderServicePkg "cboard-go/internal/services/order"
+	"cboard-go/internal/services/payment"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAdminCryptoPayments 管理员查看加密货币支付单（默认只列出过期后到账、待人工处理的支付单）
+func GetAdminCryptoPayments(c *gin.Context) {
+	db := database.GetDB()
+	page, size := 1, 20
+	fmt.Sscanf(c.DefaultQuery("page", "1"), "%d", &page)
+	fmt.Sscanf(c.DefaultQuery("size", "20"), "%d", &size)
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	query := db.Model(&models.CryptoPayment{})
+	if status := c.DefaultQuery("status", payment.CryptoStatusLate); status != "all" {
+		query = query.Where("status = ?", status)
+	}
+	if keyword := utils.SanitizeSearchKeyword(c.Query("keyword")); keyword != "" {
+		query = query.Where("order_no LIKE ? OR tx_hash LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var payments []models.CryptoPayment
+	if err := query.Order("id DESC").Offset((page - 1) * size).Limit(size).Find(&payments).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取加密货币支付单失败", err)
+		return
+	}
+
+	userIDs := make([]uint, 0, len(payments))
+	for _, p := range payments {
+		userIDs = append(userIDs, p.UserID)
+	}
+	var users []models.User
+	if len(userIDs) > 0 {
+		db.Select("id", "username", "email").Where("id IN ?", userIDs).Find(&users)
+	}
+	userMap := make(map[uint]models.User, len(users))
+	for _, u := range users {
+		userMap[u.ID] = u
+	}
+
+	list := make([]gin.H, 0, len(payments))
+	for _, p := range payments {
+		list = append(list, gin.H{
+			"id":            p.ID,
+			"order_no":      p.OrderNo,
+			"user_id":       p.UserID,
+			"username":      userMap[p.UserID].Username,
+			"email":         userMap[p.UserID].Email,
+			"chain":         p.Chain,
+			"amount":        p.Amount,
+			"amount_cny":    p.AmountCNY,
+			"status":        p.Status,
+			"tx_hash":       p.TxHash,
+			"confirmations": p.Confirmations,
+			"expires_at":    p.ExpiresAt,
+			"updated_at":    p.UpdatedAt,
+		})
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"payments": list,
+		"total":    total,
+		"page":     page,
+		"size":     size,
+	})
+}
+
+// ResolveAdminCryptoPayment 处理逾期到账的支付单：credit 为 true 时订单入账，否则标记为不予入账（如已线下退回）
+func ResolveAdminCryptoPayment(c *gin.Context) {
+	admin, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "未登录", nil)
+		return
+	}
+	var req struct {
+		Credit bool `json:"credit"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+
+	db := database.GetDB()
+	var p models.CryptoPayment
+	if err := db.First(&p, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "加密货币支付单不存在", err)
+		return
+	}
+	if p.Status != payment.CryptoStatusLate {
+		utils.ErrorResponse(c, http.StatusBadRequest, "只能处理逾期到账的支付单", nil)
+		return
+	}
+
+	if req.Credit {
+		// 先入账再更新状态：入账失败时保留在待处理列表，入账本身是幂等的
+		err := orderServicePkg.NewOrderService().CompletePayment(orderServicePkg.PaymentResult{
+			OrderNo: p.OrderNo,
+			TradeNo: p.TxHash,
+			Amount:  p.AmountCNY,
+			Raw: map[string]string{
+				"chain":       p.Chain,
+				"address":     p.Address,
+				"amount":      p.Amount,
+				"tx_hash":     p.TxHash,
+				"resolved_by": admin.Username,
+			},
+		})
+		if err != nil {
+			if errors.Is(err, orderServicePkg.ErrPaymentTargetNotFound) || errors.Is(err, orderServicePkg.ErrOrderAmountMismatch) ||
+				errors.Is(err, orderServicePkg.ErrRechargeAmountMismatch) {
+				utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), err)
+				return
+			}
+			utils.ErrorResponse(c, http.StatusInternalServerError, "订单入账失败", err)
+			return
+		}
+	}
+	if err := payment.ResolveLateCryptoPayment(db, &p, req.Credit); err != nil {
+		utils.ErrorResponse(c, http.StatusConflict, err.Error(), err)
+		return
+	}
+
+	action := "不予入账"
+	if req.Credit {
+		action = "已入账"
+	}
+	utils.CreateAuditLogSimple(c, "resolve_crypto_payment", "crypto_payment", p.ID,
+		fmt.Sprintf("处理 USDT 逾期到账: %s %s USDT (%s) %s", p.OrderNo, p.Amount, p.TxHash, action))
+	utils.SuccessResponse(c, http.StatusOK, "处理成功", gin.H{"id": p.ID, "status": p.Status})
+}
@@ -112,6 +112,7 @@ func CreateCustomNode(c *gin.Context) {
 		Port             int        `json:"port"`
 		ExpireTime       *time.Time `json:"expire_time"`
 		FollowUserExpire bool       `json:"follow_user_expire"`
+		Multiplier       float64    `json:"multiplier"` // 流量倍率，为 0 时从节点名称中提取
 		Preview          bool       `json:"preview"`
 	}
 
@@ -119,6 +120,10 @@ func CreateCustomNode(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error(), err)
 		return
 	}
+	if req.Multiplier < 0 || req.Multiplier > 100 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "倍率必须在 0-100 之间", nil)
+		return
+	}
 
 	db := database.GetDB()
 
@@ -155,6 +160,7 @@ func CreateCustomNode(c *gin.Context) {
 			IsActive:         true,
 			ExpireTime:       req.ExpireTime,
 			FollowUserExpire: req.FollowUserExpire,
+			Multiplier:       customNodeMultiplier(req.Multiplier, name),
 		}
 
 		if req.Preview {
@@ -164,6 +170,8 @@ func CreateCustomNode(c *gin.Context) {
 				"server": customNode.Domain,
 				"port":   customNode.Port,
 				"config": customNode.Config,
+
+				"multiplier": customNode.Multiplier,
 			})
 			return
 		}
@@ -173,6 +181,7 @@ func CreateCustomNode(c *gin.Context) {
 			return
 		}
 
+		config_update.InvalidateSubscriptionCache()
 		utils.SuccessResponse(c, http.StatusCreated, "", customNode)
 		return
 	}
@@ -194,6 +203,7 @@ func CreateCustomNode(c *gin.Context) {
 		IsActive:         true,
 		ExpireTime:       req.ExpireTime,
 		FollowUserExpire: req.FollowUserExpire,
+		Multiplier:       customNodeMultiplier(req.Multiplier, req.Name),
 	}
 
 	if err := db.Create(&customNode).Error; err != nil {
@@ -201,9 +211,21 @@ func CreateCustomNode(c *gin.Context) {
 		return
 	}
 
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusCreated, "", customNode)
 }
 
+// customNodeMultiplier 专线节点倍率：未指定时从节点名称中提取，默认 1 倍
+func customNodeMultiplier(multiplier float64, name string) float64 {
+	if multiplier > 0 {
+		return multiplier
+	}
+	if extracted := config_update.ExtractMultiplier(name); extracted > 0 {
+		return extracted
+	}
+	return 1
+}
+
 // ImportCustomNodeLinks 批量导入节点链接
 func ImportCustomNodeLinks(c *gin.Context) {
 	var req struct {
@@ -249,6 +271,8 @@ func ImportCustomNodeLinks(c *gin.Context) {
 			Config:   configStr,
 			Status:   "inactive",
 			IsActive: true,
+
+			Multiplier: customNodeMultiplier(0, name),
 		}
 
 		if err := db.Create(&customNode).Error; err != nil {
@@ -260,6 +284,7 @@ func ImportCustomNodeLinks(c *gin.Context) {
 		imported++
 	}
 
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
 		"imported":    imported,
 		"error_count": errorCount,
@@ -290,6 +315,7 @@ func UpdateCustomNode(c *gin.Context) {
 		IsActive         *bool      `json:"is_active"`
 		ExpireTime       *time.Time `json:"expire_time"`
 		FollowUserExpire *bool      `json:"follow_user_expire"`
+		Multiplier       *float64   `json:"multiplier"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -328,12 +354,20 @@ func UpdateCustomNode(c *gin.Context) {
 	if req.FollowUserExpire != nil {
 		node.FollowUserExpire = *req.FollowUserExpire
 	}
+	if req.Multiplier != nil {
+		if *req.Multiplier <= 0 || *req.Multiplier > 100 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "倍率必须在 0-100 之间", nil)
+			return
+		}
+		node.Multiplier = *req.Multiplier
+	}
 
 	if err := db.Save(&node).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "更新失败: "+err.Error(), err)
 		return
 	}
 
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusOK, "", node)
 }
 
@@ -357,6 +391,7 @@ func DeleteCustomNode(c *gin.Context) {
 		return
 	}
 
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusOK, "删除成功", nil)
 }
 
@@ -382,6 +417,7 @@ func BatchDeleteCustomNodes(c *gin.Context) {
 		return
 	}
 
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusOK, fmt.Sprintf("成功删除 %d 个节点", len(req.NodeIDs)), nil)
 }
 
@@ -450,6 +486,7 @@ func BatchAssignCustomNodes(c *gin.Context) {
 		}
 	}
 
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusOK, fmt.Sprintf("成功分配 %d 个节点关系", assignedCount), nil)
 }
 
@@ -702,6 +739,7 @@ func AssignCustomNodeToUser(c *gin.Context) {
 		db.Save(&user)
 	}
 
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusOK, "分配成功", userNode)
 }
 
@@ -716,6 +754,7 @@ func UnassignCustomNodeFromUser(c *gin.Context) {
 		return
 	}
 
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusOK, "取消分配成功", nil)
 }
 
@@ -85,15 +85,55 @@ func resolveRegion(name, server string) string {
 func buildNodeModel(node *config_update.ProxyNode, isManual bool) models.Node {
 	configJSON, _ := json.Marshal(node)
 	configStr := string(configJSON)
+	multiplier := config_update.ExtractMultiplier(node.Name)
+	if multiplier == 0 {
+		multiplier = 1
+	}
 	return models.Node{
-		Name:     node.Name,
-		Region:   resolveRegion(node.Name, node.Server),
-		Type:     node.Type,
-		Status:   "offline",
-		IsActive: true,
-		IsManual: isManual,
-		Config:   &configStr,
+		Name:       node.Name,
+		Region:     resolveRegion(node.Name, node.Server),
+		Type:       node.Type,
+		Status:     "offline",
+		IsActive:   true,
+		IsManual:   isManual,
+		Config:     &configStr,
+		Multiplier: multiplier,
+	}
+}
+
+// nodeListOrder 节点列表排序：sort=rate 时按倍率排序（order=desc 为降序），否则按导入顺序
+func nodeListOrder(c *gin.Context) string {
+	if c.Query("sort") != "rate" {
+		return "order_index ASC, created_at ASC"
+	}
+	direction := "ASC"
+	if strings.EqualFold(c.Query("order"), "desc") {
+		direction = "DESC"
+	}
+	return "multiplier " + direction + ", order_index ASC, created_at ASC"
+}
+
+// parseRateRange 解析倍率筛选参数 min_rate / max_rate，未提供时为 0（不限制）
+func parseRateRange(c *gin.Context) (float64, float64) {
+	minRate, _ := strconv.ParseFloat(c.Query("min_rate"), 64)
+	maxRate, _ := strconv.ParseFloat(c.Query("max_rate"), 64)
+	return minRate, maxRate
+}
+
+// rateInRange 倍率是否在筛选范围内
+func rateInRange(rate, minRate, maxRate float64) bool {
+	return (minRate <= 0 || rate >= minRate) && (maxRate <= 0 || rate <= maxRate)
+}
+
+// applyRateRange 按倍率范围筛选节点
+func applyRateRange(query *gorm.DB, minRate, maxRate float64) *gorm.DB {
+	if minRate > 0 {
+		query = query.Where("multiplier >= ?", minRate)
+	}
+	if maxRate > 0 {
+		query = query.Where("multiplier <= ?", maxRate)
 	}
+	return query
 }
 
 func findExistingNode(db *gorm.DB, targetKey string, nodeType string) *models.Node {
@@ -131,12 +171,16 @@ func processAndImportLinks(db *gorm.DB, links []string) int {
 		} else {
 			existing.Config, existing.Region, existing.Type, existing.Name = newNode.Config, newNode.Region, newNode.Type, newNode.Name
 			existing.IsActive = true
+			if !existing.MultiplierLocked {
+				existing.Multiplier = newNode.Multiplier
+			}
 			if existing.Status == "offline" {
 				existing.Status = "online"
 			}
 			db.Save(existing)
 		}
 	}
+	config_update.InvalidateSubscriptionCache()
 	return importedCount
 }
 
@@ -148,8 +192,10 @@ func GetNodes(c *gin.Context) {
 			query = query.Where(fmt.Sprintf("%s = ?", param), val)
 		}
 	}
+	minRate, maxRate := parseRateRange(c)
+	query = applyRateRange(query, minRate, maxRate)
 	var allNodes []models.Node
-	if err := query.Order("order_index ASC, created_at ASC").Find(&allNodes).Error; err != nil {
+	if err := query.Order(nodeListOrder(c)).Find(&allNodes).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "获取失败", err)
 		return
 	}
@@ -217,6 +263,20 @@ func GetNodes(c *gin.Context) {
 			}
 		}
 
+		// 套餐限制了最高节点倍率时，不显示超出倍率的节点（与订阅内容一致）
+		if hasOrdSubscription && sub.PackageID != nil {
+			var pkg models.Package
+			if err := db.Select("id", "max_node_multiplier").First(&pkg, *sub.PackageID).Error; err == nil && pkg.MaxNodeMultiplier > 0 {
+				allowed := make([]models.Node, 0, len(uniqueNodes))
+				for _, node := range uniqueNodes {
+					if node.Rate() <= pkg.MaxNodeMultiplier {
+						allowed = append(allowed, node)
+					}
+				}
+				uniqueNodes = allowed
+			}
+		}
+
 		var nodeIDs []uint
 		db.Model(&models.UserCustomNode{}).Where("user_id = ?", user.ID).Pluck("custom_node_id", &nodeIDs)
 		if len(nodeIDs) > 0 {
@@ -239,7 +299,7 @@ func GetNodes(c *gin.Context) {
 						isSpecNodeExpired = isSpecialExpired
 					}
 
-					if isSpecNodeExpired {
+					if isSpecNodeExpired || !rateInRange(cn.Rate(), minRate, maxRate) {
 						continue
 					}
 					var nc models.NodeConfig
@@ -278,6 +338,7 @@ func GetNodes(c *gin.Context) {
 							IsManual:   true,
 							Config:     &cfgStr,
 							OrderIndex: -1, // 专线节点使用 -1，确保显示在最前面
+							Multiplier: cn.Rate(),
 						})
 					}
 				}
@@ -379,9 +440,18 @@ func GetAdminNodes(c *gin.Context) {
 		}
 	}
 
+	// 名称中的地区与服务器地理位置不一致的节点
+	if m := c.Query("geo_mismatch"); m != "" {
+		query = query.Where("geo_mismatch = ?", m == "true")
+	}
+
+	// 倍率筛选
+	minRate, maxRate := parseRateRange(c)
+	query = applyRateRange(query, minRate, maxRate)
+
 	// 先查询所有符合条件的节点（不分页，用于去重）
 	var allNodes []models.Node
-	if err := query.Order("order_index ASC, created_at ASC").Find(&allNodes).Error; err != nil {
+	if err := query.Order(nodeListOrder(c)).Find(&allNodes).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "获取节点列表失败", err)
 		return
 	}
@@ -492,6 +562,7 @@ func CreateNode(c *gin.Context) {
 			utils.ErrorResponse(c, http.StatusInternalServerError, "创建节点失败", err)
 			return
 		}
+		config_update.InvalidateSubscriptionCache()
 		utils.SuccessResponse(c, http.StatusCreated, "", newNode)
 		return
 	}
@@ -500,6 +571,7 @@ func CreateNode(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "创建节点失败", err)
 		return
 	}
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusCreated, "", req.Node)
 }
 
@@ -526,6 +598,7 @@ func ImportNodeLinks(c *gin.Context) {
 			skp++
 		}
 	}
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusOK, fmt.Sprintf("成功 %d, 跳过 %d", imp, skp), gin.H{
 		"imported": imp,
 		"skipped":  skp,
@@ -544,23 +617,42 @@ func UpdateNode(c *gin.Context) {
 		}
 		return
 	}
+	oldMultiplier, oldLocked, oldActive := node.Multiplier, node.MultiplierLocked, node.IsActive
 	if err := c.ShouldBindJSON(&node); err != nil {
 		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误", err)
 		return
 	}
+	// 管理员手动启用或禁用后，节点不再由健康检查自动启用
+	if node.IsActive != oldActive {
+		node.HealthDisabled = false
+	}
+	if node.Multiplier < 0 || node.Multiplier > 100 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "倍率必须在 0-100 之间", nil)
+		return
+	}
+	// 管理员修改倍率后锁定，节点源更新不再覆盖；传入 multiplier_locked=false 可恢复自动提取
+	if node.Multiplier != oldMultiplier && node.MultiplierLocked == oldLocked {
+		node.MultiplierLocked = true
+	}
 	if err := db.Save(&node).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "更新节点失败", err)
 		return
 	}
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusOK, "更新成功", node)
 }
 
 // DeleteNode 删除节点
 func DeleteNode(c *gin.Context) {
-	if err := database.GetDB().Delete(&models.Node{}, c.Param("id")).Error; err != nil {
+	db := database.GetDB()
+	if err := db.Delete(&models.Node{}, c.Param("id")).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "删除节点失败", err)
 		return
 	}
+	if id, err := strconv.ParseUint(c.Param("id"), 10, 32); err == nil {
+		removeNodesFromGroups(db, []uint{uint(id)})
+	}
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusOK, "删除成功", nil)
 }
 
@@ -597,6 +689,28 @@ func TestNode(c *gin.Context) {
 			return
 		}
 
+		// 传输和 TLS 选项用于协议级检测
+		options := map[string]interface{}{}
+		if nc.SNI != "" {
+			options["servername"] = nc.SNI
+		}
+		if nc.SkipCertVerify {
+			options["skip-cert-verify"] = true
+		}
+		if nc.Flow != "" {
+			options["flow"] = nc.Flow
+		}
+		if nc.Security == "reality" {
+			options["reality-opts"] = map[string]interface{}{"public-key": nc.PublicKey, "short-id": nc.ShortID}
+		}
+		if nc.Network == "ws" {
+			wsOpts := map[string]interface{}{"path": nc.Path}
+			if nc.Host != "" {
+				wsOpts["headers"] = map[string]interface{}{"Host": nc.Host}
+			}
+			options["ws-opts"] = wsOpts
+		}
+
 		cfgJSON, _ := json.Marshal(config_update.ProxyNode{
 			Type:     nc.Type,
 			Server:   nc.Server,
@@ -605,7 +719,8 @@ func TestNode(c *gin.Context) {
 			Password: nc.Password,
 			Network:  nc.Network,
 			Cipher:   nc.Encryption,
-			TLS:      nc.Security == "tls",
+			TLS:      nc.Security == "tls" || nc.Security == "reality",
+			Options:  options,
 		})
 		cfgStr := string(cfgJSON)
 
@@ -733,6 +848,7 @@ func BatchDeleteNodes(c *gin.Context) {
 			return
 		}
 		deletedCount += int(result.RowsAffected)
+		removeNodesFromGroups(db, normalNodeIDs)
 	}
 
 	// 删除专线节点
@@ -745,6 +861,7 @@ func BatchDeleteNodes(c *gin.Context) {
 		deletedCount += int(result.RowsAffected)
 	}
 
+	config_update.InvalidateSubscriptionCache()
 	utils.SuccessResponse(c, http.StatusOK, fmt.Sprintf("成功删除 %d 个节点", deletedCount), gin.H{"deleted_count": deletedCount})
 }
 
@@ -779,6 +896,20 @@ func ImportFromFile(c *gin.Context) {
 
 func importNodesFromClashConfig(configStr string) (int, error) {
 	db := database.GetDB()
+	// Clash / sing-box 配置：解析节点后转换为链接导入
+	if results, _, ok := config_update.ParseStructuredNodes([]byte(configStr)); ok {
+		svc := config_update.NewConfigUpdateService()
+		links := make([]string, 0, len(results))
+		for _, result := range results {
+			if result.Node == nil {
+				continue
+			}
+			if link := svc.NodeToLink(result.Node); link != "" {
+				links = append(links, link)
+			}
+		}
+		return processAndImportLinks(db, links), nil
+	}
 	var sysConfig models.SystemConfig
 	if db.Where("key = ? AND category = ?", "urls", "config_update").First(&sysConfig).Error == nil {
 		svc := config_update.NewConfigUpdateService()
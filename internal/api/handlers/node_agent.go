@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/middleware"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/node_agent"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// writeAgentJSON 输出节点后端拉取的数据，内容未变化时返回 304（节点后端按 ETag 缓存）
+func writeAgentJSON(c *gin.Context, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成数据失败", err)
+		return
+	}
+	sum := sha1.Sum(data)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Header("ETag", etag)
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// UniProxyConfig 节点后端拉取节点配置
+func UniProxyConfig(c *gin.Context) {
+	node, _ := middleware.GetAgentNode(c)
+	svc := node_agent.NewNodeAgentService()
+	config, err := svc.BuildNodeConfig(node)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	svc.Touch(node)
+	writeAgentJSON(c, config)
+}
+
+// UniProxyUsers 节点后端拉取可使用该节点的用户
+func UniProxyUsers(c *gin.Context) {
+	node, _ := middleware.GetAgentNode(c)
+	users, err := node_agent.NewNodeAgentService().NodeUsers(node)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取用户列表失败", err)
+		return
+	}
+	writeAgentJSON(c, gin.H{"users": users})
+}
+
+// UniProxyPush 节点后端上报用户流量，格式为 {"订阅ID": [上传, 下载]}
+func UniProxyPush(c *gin.Context) {
+	node, _ := middleware.GetAgentNode(c)
+	var data map[uint][2]int64
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+	if _, err := node_agent.NewNodeAgentService().ReportTraffic(node, data); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "流量记录失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+// UniProxyAlive 节点后端上报在线用户 IP，格式为 {"订阅ID": ["IP", ...]}
+func UniProxyAlive(c *gin.Context) {
+	node, _ := middleware.GetAgentNode(c)
+	var data map[uint][]string
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+	if err := node_agent.NewNodeAgentService().ReportAlive(node, data); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "在线用户记录失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+// UniProxyAliveList 节点后端获取该节点可用用户在所有节点上的在线 IP 数
+func UniProxyAliveList(c *gin.Context) {
+	node, _ := middleware.GetAgentNode(c)
+	counts, err := node_agent.NewNodeAgentService().AliveCounts(node)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取在线用户失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"alive": counts})
+}
+
+// UniProxyStatus 节点后端上报负载
+func UniProxyStatus(c *gin.Context) {
+	node, _ := middleware.GetAgentNode(c)
+	var status node_agent.NodeStatus
+	if err := c.ShouldBindJSON(&status); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+	if err := node_agent.NewNodeAgentService().ReportStatus(node, status); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "状态记录失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+// ReportOnlineIPs 自建代理服务上报在线客户端 IP，格式为 {"订阅ID": ["IP", ...]}，
+// 返回超出套餐同时在线 IP 数上限、需要断开的连接
+func ReportOnlineIPs(c *gin.Context) {
+	node, _ := middleware.GetAgentNode(c)
+	var data map[uint][]string
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+	svc := node_agent.NewNodeAgentService()
+	drops, err := svc.ReportOnline(node, data)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "在线用户记录失败: "+err.Error(), err)
+		return
+	}
+	svc.Touch(node)
+	c.JSON(http.StatusOK, gin.H{
+		"data":   true,
+		"drop":   drops,
+		"window": int(svc.OnlineWindow().Seconds()),
+	})
+}
+
+// ExportNodeCredentials 自建代理服务导出节点上当前有效的用户凭据
+func ExportNodeCredentials(c *gin.Context) {
+	node, _ := middleware.GetAgentNode(c)
+	svc := node_agent.NewNodeAgentService()
+	credentials, err := svc.NodeCredentials(node)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "导出凭据失败: "+err.Error(), err)
+		return
+	}
+	svc.Touch(node)
+	writeAgentJSON(c, gin.H{
+		"node_id":   node.ID,
+		"node_type": node_agent.AgentNodeType(node.Type),
+		"users":     credentials,
+	})
+}
+
+// nodeAgentInfo 节点后端对接信息（不含通信密钥）
+func nodeAgentInfo(db *gorm.DB, node *models.Node) gin.H {
+	var status interface{}
+	if node.AgentStatus != nil {
+		json.Unmarshal([]byte(*node.AgentStatus), &status)
+	}
+	agentConfig := ""
+	if node.AgentConfig != nil {
+		agentConfig = *node.AgentConfig
+	}
+	var online int64
+	db.Model(&models.NodeOnlineIP{}).Where("node_id = ?", node.ID).Count(&online)
+	return gin.H{
+		"node_id":           node.ID,
+		"enabled":           node.IsSelfHosted(),
+		"node_type":         node_agent.AgentNodeType(node.Type),
+		"agent_config":      agentConfig,
+		"agent_status":      status,
+		"agent_reported_at": node.AgentReportedAt,
+		"online_ips":        online,
+	}
+}
+
+// GetNodeAgent 获取节点的后端对接信息（管理员）
+func GetNodeAgent(c *gin.Context) {
+	db := database.GetDB()
+	var node models.Node
+	if err := db.First(&node, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点不存在", err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", nodeAgentInfo(db, &node))
+}
+
+// UpdateNodeAgent 启用/关闭节点的后端对接、更换通信密钥或修改服务端配置（管理员）
+// 通信密钥只在生成时返回一次
+func UpdateNodeAgent(c *gin.Context) {
+	var req struct {
+		Enabled     *bool   `json:"enabled"`
+		RotateKey   bool    `json:"rotate_key"`
+		AgentConfig *string `json:"agent_config"` // JSON 对象，合并到下发给节点后端的配置中；空字符串表示清除
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+
+	db := database.GetDB()
+	var node models.Node
+	if err := db.First(&node, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点不存在", err)
+		return
+	}
+
+	svc := node_agent.NewNodeAgentService()
+	if req.AgentConfig != nil {
+		if err := svc.UpdateAgentConfig(&node, *req.AgentConfig); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		db.First(&node, node.ID)
+	}
+
+	if req.Enabled != nil && !*req.Enabled {
+		if err := svc.DisableAgent(&node); err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "关闭后端对接失败", err)
+			return
+		}
+		db.First(&node, node.ID)
+		utils.SuccessResponse(c, http.StatusOK, "已关闭后端对接", nodeAgentInfo(db, &node))
+		return
+	}
+
+	var apiKey string
+	if (req.Enabled != nil && !node.IsSelfHosted()) || req.RotateKey {
+		if _, err := svc.BuildNodeConfig(&node); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		key, err := svc.EnableAgent(&node)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "生成通信密钥失败", err)
+			return
+		}
+		apiKey = key
+		db.First(&node, node.ID)
+	}
+
+	info := nodeAgentInfo(db, &node)
+	if apiKey != "" {
+		info["api_key"] = apiKey
+	}
+	utils.SuccessResponse(c, http.StatusOK, "更新成功", info)
+}
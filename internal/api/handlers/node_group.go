@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
+	"cboard-go/internal/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// nodeGroupRequest 创建/更新节点分组请求（关联ID列表传入时整体替换，未传入时保持不变）
+type nodeGroupRequest struct {
+	Name         *string `json:"name"`
+	Description  *string `json:"description"`
+	SortOrder    *int    `json:"sort_order"`
+	NodeIDs      *[]uint `json:"node_ids"`
+	PackageIDs   *[]uint `json:"package_ids"`
+	UserLevelIDs *[]uint `json:"user_level_ids"`
+}
+
+// formatNodeGroup 格式化节点分组（包含关联的节点、套餐和用户等级ID）
+func formatNodeGroup(db *gorm.DB, group *models.NodeGroup) gin.H {
+	nodeIDs := make([]uint, 0)
+	packageIDs := make([]uint, 0)
+	levelIDs := make([]uint, 0)
+	db.Table("node_group_nodes").Where("node_group_id = ?", group.ID).Pluck("node_id", &nodeIDs)
+	db.Table("package_node_groups").Where("node_group_id = ?", group.ID).Pluck("package_id", &packageIDs)
+	db.Table("user_level_node_groups").Where("node_group_id = ?", group.ID).Pluck("user_level_id", &levelIDs)
+
+	return gin.H{
+		"id":             group.ID,
+		"name":           group.Name,
+		"description":    group.Description,
+		"sort_order":     group.SortOrder,
+		"node_ids":       nodeIDs,
+		"node_count":     len(nodeIDs),
+		"package_ids":    packageIDs,
+		"user_level_ids": levelIDs,
+		"created_at":     group.CreatedAt.Format("2006-01-02 15:04:05"),
+		"updated_at":     group.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// GetNodeGroups 获取节点分组列表（管理员）
+func GetNodeGroups(c *gin.Context) {
+	db := database.GetDB()
+	var groups []models.NodeGroup
+	if err := db.Order("sort_order ASC, id ASC").Find(&groups).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取节点分组失败", err)
+		return
+	}
+
+	result := make([]gin.H, 0, len(groups))
+	for i := range groups {
+		result = append(result, formatNodeGroup(db, &groups[i]))
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", result)
+}
+
+// CreateNodeGroup 创建节点分组（管理员）
+func CreateNodeGroup(c *gin.Context) {
+	var req nodeGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	if req.Name == nil || strings.TrimSpace(*req.Name) == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "分组名称不能为空", nil)
+		return
+	}
+
+	db := database.GetDB()
+	group := models.NodeGroup{}
+	if msg := applyNodeGroupRequest(db, &group, &req); msg != "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		return replaceNodeGroupLinks(tx, &group, &req)
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建节点分组失败", err)
+		return
+	}
+	config_update.InvalidateSubscriptionCache()
+
+	utils.SuccessResponse(c, http.StatusCreated, "", formatNodeGroup(db, &group))
+}
+
+// UpdateNodeGroup 更新节点分组（管理员）
+func UpdateNodeGroup(c *gin.Context) {
+	db := database.GetDB()
+	var group models.NodeGroup
+	if err := db.First(&group, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点分组不存在", err)
+		return
+	}
+
+	var req nodeGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	if msg := applyNodeGroupRequest(db, &group, &req); msg != "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&group).Error; err != nil {
+			return err
+		}
+		return replaceNodeGroupLinks(tx, &group, &req)
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新节点分组失败", err)
+		return
+	}
+	config_update.InvalidateSubscriptionCache()
+
+	utils.SuccessResponse(c, http.StatusOK, "更新成功", formatNodeGroup(db, &group))
+}
+
+// DeleteNodeGroup 删除节点分组（管理员），分组内节点如未加入其他分组将对所有用户可见
+func DeleteNodeGroup(c *gin.Context) {
+	db := database.GetDB()
+	var group models.NodeGroup
+	if err := db.First(&group, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点分组不存在", err)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&group).Association("Nodes").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Model(&group).Association("Packages").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Model(&group).Association("UserLevels").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&group).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除节点分组失败", err)
+		return
+	}
+	config_update.InvalidateSubscriptionCache()
+
+	utils.SuccessResponse(c, http.StatusOK, "删除成功", nil)
+}
+
+// applyNodeGroupRequest 将请求中的基本字段写入分组，返回错误提示（为空表示成功）
+func applyNodeGroupRequest(db *gorm.DB, group *models.NodeGroup, req *nodeGroupRequest) string {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return "分组名称不能为空"
+		}
+		var count int64
+		db.Model(&models.NodeGroup{}).Where("name = ? AND id != ?", name, group.ID).Count(&count)
+		if count > 0 {
+			return "分组名称已存在"
+		}
+		group.Name = name
+	}
+	if req.Description != nil {
+		group.Description = *req.Description
+	}
+	if req.SortOrder != nil {
+		group.SortOrder = *req.SortOrder
+	}
+	return ""
+}
+
+// replaceNodeGroupLinks 替换分组关联的节点、套餐和用户等级
+func replaceNodeGroupLinks(tx *gorm.DB, group *models.NodeGroup, req *nodeGroupRequest) error {
+	if req.NodeIDs != nil {
+		var nodes []models.Node
+		if len(*req.NodeIDs) > 0 {
+			if err := tx.Where("id IN ?", *req.NodeIDs).Find(&nodes).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(group).Association("Nodes").Replace(nodes); err != nil {
+			return err
+		}
+	}
+	if req.PackageIDs != nil {
+		var packages []models.Package
+		if len(*req.PackageIDs) > 0 {
+			if err := tx.Where("id IN ?", *req.PackageIDs).Find(&packages).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(group).Association("Packages").Replace(packages); err != nil {
+			return err
+		}
+	}
+	if req.UserLevelIDs != nil {
+		var levels []models.UserLevel
+		if len(*req.UserLevelIDs) > 0 {
+			if err := tx.Where("id IN ?", *req.UserLevelIDs).Find(&levels).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(group).Association("UserLevels").Replace(levels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeNodesFromGroups 删除节点时清理分组关联
+func removeNodesFromGroups(db *gorm.DB, nodeIDs []uint) {
+	if len(nodeIDs) == 0 {
+		return
+	}
+	db.Exec("DELETE FROM node_group_nodes WHERE node_id IN ?", nodeIDs)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/node_health"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetNodeHealth 获取节点的健康历史：在线率、延迟分位数、图表数据和最近的检查记录（管理员）
+// 查询参数 range 为 24h / 7d / 30d
+func GetNodeHealth(c *gin.Context) {
+	r, err := node_health.ParseHealthRange(c.Query("range"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	db := database.GetDB()
+	var node models.Node
+	if err := db.First(&node, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点不存在", err)
+		return
+	}
+
+	svc := node_health.NewNodeHealthService()
+	now := utils.GetBeijingTime()
+	stats, err := svc.NodeStats([]uint{node.ID}, now.Add(-r.Window))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取健康统计失败", err)
+		return
+	}
+	series, err := svc.NodeHistory(node.ID, r, now)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取健康历史失败", err)
+		return
+	}
+	recent, _ := svc.RecentChecks(node.ID, 20)
+
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"node_id":         node.ID,
+		"name":            node.Name,
+		"range":           c.DefaultQuery("range", "24h"),
+		"flapping":        node.Flapping,
+		"health_disabled": node.HealthDisabled,
+		"stats":           stats[node.ID],
+		"series":          series,
+		"recent":          recent,
+	})
+}
+
+// GetNodesHealth 获取所有节点的健康统计，用于节点列表展示在线率和频繁上下线节点（管理员）
+func GetNodesHealth(c *gin.Context) {
+	r, err := node_health.ParseHealthRange(c.Query("range"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	db := database.GetDB()
+	query := db.Model(&models.Node{}).Where("is_active = ? OR health_disabled = ?", true, true)
+	if c.Query("flapping") == "true" {
+		query = query.Where("flapping = ?", true)
+	}
+	var nodes []models.Node
+	if err := query.Select("id, name, flapping, health_disabled").Order("order_index ASC, id ASC").Find(&nodes).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取节点失败", err)
+		return
+	}
+	nodeIDs := make([]uint, len(nodes))
+	for i, node := range nodes {
+		nodeIDs[i] = node.ID
+	}
+
+	stats, err := node_health.NewNodeHealthService().NodeStats(nodeIDs, utils.GetBeijingTime().Add(-r.Window))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取健康统计失败", err)
+		return
+	}
+	result := make([]gin.H, 0, len(nodes))
+	for _, node := range nodes {
+		result = append(result, gin.H{
+			"node_id":         node.ID,
+			"name":            node.Name,
+			"flapping":        node.Flapping,
+			"health_disabled": node.HealthDisabled,
+			"stats":           stats[node.ID],
+		})
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", result)
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
+	"cboard-go/internal/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// nodeSourceRequest 创建/更新节点源请求（未传入的字段保持不变）
+type nodeSourceRequest struct {
+	Name           *string `json:"name"`
+	URL            *string `json:"url"`
+	UserAgent      *string `json:"user_agent"`
+	Headers        *string `json:"headers"`
+	Enabled        *bool   `json:"enabled"`
+	FilterKeywords *string `json:"filter_keywords"`
+	NamePrefix     *string `json:"name_prefix"`
+	Rules          *string `json:"rules"`
+	FetchInterval  *int    `json:"fetch_interval"`
+	SortOrder      *int    `json:"sort_order"`
+}
+
+// GetNodeSources 获取节点源列表（管理员），包含各节点源当前启用的节点数
+func GetNodeSources(c *gin.Context) {
+	db := database.GetDB()
+	var sources []models.NodeSource
+	if err := db.Order("sort_order ASC, id ASC").Find(&sources).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取节点源失败", err)
+		return
+	}
+
+	var counts []struct {
+		SourceID uint
+		Count    int
+	}
+	db.Model(&models.Node{}).Select("source_id, COUNT(*) AS count").
+		Where("source_id IS NOT NULL AND is_active = ?", true).Group("source_id").Scan(&counts)
+	activeCounts := make(map[uint]int, len(counts))
+	for _, item := range counts {
+		activeCounts[item.SourceID] = item.Count
+	}
+
+	type nodeSourceItem struct {
+		models.NodeSource
+		ActiveNodes int `json:"active_nodes"`
+	}
+	result := make([]nodeSourceItem, 0, len(sources))
+	for _, src := range sources {
+		result = append(result, nodeSourceItem{NodeSource: src, ActiveNodes: activeCounts[src.ID]})
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", result)
+}
+
+// CreateNodeSource 创建节点源（管理员）
+func CreateNodeSource(c *gin.Context) {
+	var req nodeSourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	if req.Name == nil || req.URL == nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "节点源名称和地址不能为空", nil)
+		return
+	}
+
+	db := database.GetDB()
+	source := models.NodeSource{Enabled: true}
+	if msg := applyNodeSourceRequest(db, &source, &req); msg != "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&source).Error; err != nil {
+			return err
+		}
+		// enabled 字段有默认值，创建时为 false 需要单独更新
+		if !source.Enabled {
+			return tx.Model(&source).Update("enabled", false).Error
+		}
+		return nil
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "创建节点源失败", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "", source)
+}
+
+// UpdateNodeSource 更新节点源（管理员）
+func UpdateNodeSource(c *gin.Context) {
+	db := database.GetDB()
+	var source models.NodeSource
+	if err := db.First(&source, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点源不存在", err)
+		return
+	}
+
+	var req nodeSourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	oldURL := source.URL
+	if msg := applyNodeSourceRequest(db, &source, &req); msg != "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	if err := db.Save(&source).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "更新节点源失败", err)
+		return
+	}
+	if source.URL != oldURL {
+		removeLegacySourceURL(db, oldURL)
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "更新成功", source)
+}
+
+// DeleteNodeSource 删除节点源（管理员），该节点源导入的节点将被下线并清除来源
+func DeleteNodeSource(c *gin.Context) {
+	db := database.GetDB()
+	var source models.NodeSource
+	if err := db.First(&source, c.Param("id")).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点源不存在", err)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Node{}).Where("source_id = ?", source.ID).
+			Updates(map[string]interface{}{"is_active": false, "status": "offline", "source_id": nil}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&source).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "删除节点源失败", err)
+		return
+	}
+	// 同时从旧版 urls 配置中移除，避免下次更新时重新登记
+	removeLegacySourceURL(db, source.URL)
+	config_update.InvalidateSubscriptionCache()
+
+	utils.SuccessResponse(c, http.StatusOK, "删除成功", nil)
+}
+
+// SyncNodeSource 立即同步指定节点源（管理员），在后台执行
+func SyncNodeSource(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的节点源ID", err)
+		return
+	}
+	var count int64
+	database.GetDB().Model(&models.NodeSource{}).Where("id = ?", id).Count(&count)
+	if count == 0 {
+		utils.ErrorResponse(c, http.StatusNotFound, "节点源不存在", nil)
+		return
+	}
+
+	service := config_update.NewConfigUpdateService()
+	go func() {
+		service.SyncNodeSource(uint(id))
+	}()
+	utils.SuccessResponse(c, http.StatusOK, "节点源同步任务已启动", nil)
+}
+
+// TestNodeSourceRules 使用样例节点测试节点规则（管理员）
+// 未传入 rules 时使用指定节点源已保存的规则
+func TestNodeSourceRules(c *gin.Context) {
+	var req struct {
+		SourceID uint                     `json:"source_id"`
+		Rules    []config_update.NodeRule `json:"rules"`
+		Names    []string                 `json:"names"`
+		Samples  []struct {
+			Name   string `json:"name"`
+			Type   string `json:"type"`
+			Server string `json:"server"`
+			Port   int    `json:"port"`
+		} `json:"samples"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+
+	rules := req.Rules
+	if rules == nil && req.SourceID > 0 {
+		var source models.NodeSource
+		if err := database.GetDB().First(&source, req.SourceID).Error; err != nil {
+			utils.ErrorResponse(c, http.StatusNotFound, "节点源不存在", err)
+			return
+		}
+		parsed, err := config_update.ParseNodeRules(source.Rules)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		rules = parsed
+	}
+
+	samples := make([]*config_update.ProxyNode, 0, len(req.Names)+len(req.Samples))
+	for _, name := range req.Names {
+		samples = append(samples, &config_update.ProxyNode{Name: name})
+	}
+	for _, sample := range req.Samples {
+		samples = append(samples, &config_update.ProxyNode{Name: sample.Name, Type: sample.Type, Server: sample.Server, Port: sample.Port})
+	}
+	if len(samples) == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请提供样例节点名称", nil)
+		return
+	}
+
+	results, err := config_update.NewConfigUpdateService().TestNodeRules(rules, samples)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", results)
+}
+
+// applyNodeSourceRequest 将请求字段写入节点源，返回错误提示（为空表示成功）
+func applyNodeSourceRequest(db *gorm.DB, source *models.NodeSource, req *nodeSourceRequest) string {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return "节点源名称不能为空"
+		}
+		var count int64
+		db.Model(&models.NodeSource{}).Where("name = ? AND id != ?", name, source.ID).Count(&count)
+		if count > 0 {
+			return "节点源名称已存在"
+		}
+		source.Name = name
+	}
+	if req.URL != nil {
+		rawURL := strings.TrimSpace(*req.URL)
+		if parsed, err := url.Parse(rawURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return "节点源地址必须为 http(s) 链接"
+		}
+		source.URL = rawURL
+	}
+	if req.UserAgent != nil {
+		source.UserAgent = strings.TrimSpace(*req.UserAgent)
+	}
+	if req.Headers != nil {
+		if _, err := config_update.ParseSourceHeaders(*req.Headers); err != nil {
+			return err.Error()
+		}
+		source.Headers = strings.TrimSpace(*req.Headers)
+	}
+	if req.Enabled != nil {
+		source.Enabled = *req.Enabled
+	}
+	if req.FilterKeywords != nil {
+		source.FilterKeywords = *req.FilterKeywords
+	}
+	if req.NamePrefix != nil {
+		source.NamePrefix = *req.NamePrefix
+	}
+	if req.Rules != nil {
+		rules, err := config_update.ParseNodeRules(*req.Rules)
+		if err != nil {
+			return err.Error()
+		}
+		if _, err := config_update.CompileNodeRules(rules); err != nil {
+			return err.Error()
+		}
+		source.Rules = strings.TrimSpace(*req.Rules)
+	}
+	if req.FetchInterval != nil {
+		if *req.FetchInterval != 0 && *req.FetchInterval < 300 {
+			return "拉取间隔不能小于300秒（0 表示跟随全局自动更新）"
+		}
+		source.FetchInterval = *req.FetchInterval
+	}
+	if req.SortOrder != nil {
+		source.SortOrder = *req.SortOrder
+	}
+	return ""
+}
+
+// removeLegacySourceURL 从旧版 urls 配置中移除指定地址
+func removeLegacySourceURL(db *gorm.DB, sourceURL string) {
+	var config models.SystemConfig
+	if err := db.Where("key = ? AND category = ?", "urls", "config_update").First(&config).Error; err != nil {
+		return
+	}
+	var kept []string
+	for _, u := range strings.Split(config.Value, "\n") {
+		if u = strings.TrimSpace(u); u != "" && u != sourceURL {
+			kept = append(kept, u)
+		}
+	}
+	db.Model(&config).Update("value", strings.Join(kept, "\n"))
+}
@@ -789,63 +789,24 @@ func GetOrderStatusByNo(c *gin.Context) {
 				// 获取支付配置
 				var paymentConfig models.PaymentConfig
 				if err := db.First(&paymentConfig, transaction.PaymentMethodID).Error; err == nil {
-					// 根据支付方式查询状态
-					if paymentConfig.PayType == "alipay" {
-						alipayService, err := payment.NewAlipayService(&paymentConfig)
-						if err == nil {
-							queryResult, err := alipayService.QueryOrder(orderNo)
-							if err == nil && queryResult != nil && queryResult.IsPaid() {
-								// 支付成功，更新订单状态（模拟回调处理）
-								utils.LogError("GetOrderStatusByNo: payment query success, updating order", nil, map[string]interface{}{
-									"order_no":     orderNo,
-									"trade_no":     queryResult.TradeNo,
-									"trade_status": queryResult.TradeStatus,
+					// 根据支付方式主动查询状态（不支持主动查询的支付方式跳过，等待回调）
+					if provider, err := payment.NewProvider(&paymentConfig); err == nil {
+						if queryResult, err := provider.QueryStatus(orderNo); err == nil && queryResult.Paid {
+							utils.LogInfo("GetOrderStatusByNo: 主动查询到支付成功 - order_no=%s, trade_no=%s, trade_status=%s",
+								orderNo, queryResult.TradeNo, queryResult.Status)
+							// 与支付回调走同一入账流程（金额校验、余额抵扣、开通与通知），与回调同时到达时只会入账一次
+							if err := orderServicePkg.NewOrderService().CompletePayment(orderServicePkg.PaymentResult{
+								OrderNo: orderNo,
+								TradeNo: queryResult.TradeNo,
+								Amount:  queryResult.Amount,
+							}); err != nil {
+								utils.LogError("GetOrderStatusByNo: complete payment failed", err, map[string]interface{}{
+									"order_no": orderNo,
+									"trade_no": queryResult.TradeNo,
 								})
-
-								// 使用事务更新订单状态
-								tx := db.Begin()
-								success := false
-								defer func() {
-									if !success {
-										tx.Rollback()
-									}
-								}()
-
-								// 重新加载订单（获取最新状态，避免重复处理）
-								var latestOrder models.Order
-								if err := tx.Where("order_no = ? AND status = ?", orderNo, "pending").First(&latestOrder).Error; err == nil {
-									latestOrder.Status = "paid"
-									latestOrder.PaymentTime = database.NullTime(utils.GetBeijingTime())
-									if err := tx.Save(&latestOrder).Error; err == nil {
-										var latestTransaction models.PaymentTransaction
-										if err := tx.Where("order_id = ?", latestOrder.ID).First(&latestTransaction).Error; err == nil {
-											latestTransaction.Status = "success"
-											latestTransaction.ExternalTransactionID = database.NullString(queryResult.TradeNo)
-											if err := tx.Save(&latestTransaction).Error; err == nil {
-												if err := tx.Commit().Error; err == nil {
-													success = true
-													// 订单状态已更新，处理后续逻辑（异步）
-													go func() {
-														var processedOrder models.Order
-														if err := db.Preload("Package").Where("order_no = ?", orderNo).First(&processedOrder).Error; err == nil {
-															if processedOrder.Status == "paid" {
-																// 统一使用 ProcessPaidOrder 处理所有订单类型（套餐订单和设备升级订单）
-																var processedUser models.User
-																if db.First(&processedUser, processedOrder.UserID).Error == nil {
-																	svc := orderServicePkg.NewOrderService()
-																	svc.ProcessPaidOrder(&processedOrder)
-																}
-															}
-														}
-													}()
-
-													// 重新加载订单以返回最新状态
-													db.Where("order_no = ?", orderNo).First(&order)
-												}
-											}
-										}
-									}
-								}
+							} else {
+								// 重新加载订单以返回最新状态
+								db.Where("order_no = ?", orderNo).First(&order)
 							}
 						}
 					}
@@ -1021,11 +982,12 @@ func UpgradeDevices(c *gin.Context) {
 	// 生成支付URL（如果需要其他支付方式）
 	var paymentURL string
 	if finalAmount > 0.01 && req.PaymentMethod != "" && req.PaymentMethod != "balance" {
-		var paymentConfig models.PaymentConfig
-		payType := req.PaymentMethod
-		if payType == "alipay" || payType == "wechat" {
-			// 查找对应类型的支付配置（不区分大小写）
-			if err := db.Where("LOWER(pay_type) = LOWER(?) AND status = ?", payType, 1).Order("sort_order ASC").First(&paymentConfig).Error; err == nil {
+		paymentConfig, err := payment.ActiveConfig(db, req.PaymentMethod)
+		if err == nil {
+			provider, err := payment.NewProvider(paymentConfig)
+			if err != nil {
+				utils.LogError("UpgradeDevices: init payment provider failed", err, nil)
+			} else {
 				// 创建支付交易（注意：金额是第三方支付部分，不包括余额）
 				transaction := models.PaymentTransaction{
 					OrderID:         order.ID,
@@ -1037,22 +999,11 @@ func UpgradeDevices(c *gin.Context) {
 				}
 				if err := db.Create(&transaction).Error; err == nil {
 					// 生成支付URL（只传递第三方支付部分）
-					if paymentConfig.PayType == "alipay" {
-						alipayService, err := payment.NewAlipayService(&paymentConfig)
-						if err == nil {
-							paymentURL, err = alipayService.CreatePayment(&order, finalAmount)
-							if err != nil {
-								utils.LogError("UpgradeDevices: create alipay payment failed", err, nil)
-							}
-						}
-					} else if paymentConfig.PayType == "wechat" {
-						wechatService, err := payment.NewWechatService(&paymentConfig)
-						if err == nil {
-							paymentURL, err = wechatService.CreatePayment(&order, finalAmount)
-							if err != nil {
-								utils.LogError("UpgradeDevices: create wechat payment failed", err, nil)
-							}
-						}
+					paymentURL, err = provider.CreatePayment(&order, finalAmount)
+					if err != nil {
+						utils.LogError("UpgradeDevices: create payment failed", err, map[string]interface{}{
+							"pay_type": paymentConfig.PayType,
+						})
 					}
 				}
 			}
@@ -1163,24 +1114,9 @@ func PayOrder(c *gin.Context) {
 
 	// 根据支付方式生成支付 URL
 	var paymentURL string
-	var payErr error
-
-	if paymentConfig.PayType == "alipay" {
-		alipayService, err := payment.NewAlipayService(&paymentConfig)
-		if err != nil {
-			payErr = fmt.Errorf("初始化支付宝服务失败: %v", err)
-		} else {
-			paymentURL, payErr = alipayService.CreatePayment(&order, amount)
-		}
-	} else if paymentConfig.PayType == "wechat" {
-		wechatService, err := payment.NewWechatService(&paymentConfig)
-		if err != nil {
-			payErr = fmt.Errorf("初始化微信支付服务失败: %v", err)
-		} else {
-			paymentURL, payErr = wechatService.CreatePayment(&order, amount)
-		}
-	} else {
-		payErr = fmt.Errorf("不支持的支付方式: %s", paymentConfig.PayType)
+	provider, payErr := payment.NewProvider(&paymentConfig)
+	if payErr == nil {
+		paymentURL, payErr = provider.CreatePayment(&order, amount)
 	}
 
 	if payErr != nil {
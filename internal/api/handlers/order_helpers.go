@@ -87,6 +87,7 @@ func buildOrderListData(db *gorm.DB, orders []models.Order) []gin.H {
 			"package_id":     order.PackageID,
 			"package_name":   packageName,
 			"amount":         amount,
+			"refund_amount":  order.RefundAmount,
 			"payment_method": paymentMethod,
 			"payment_time":   paymentTime,
 			"status":         order.Status,
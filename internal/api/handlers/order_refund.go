@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"cboard-go/internal/middleware"
+	orderServicePkg "cboard-go/internal/services/order"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RefundAdminOrder 管理员订单退款（全额或部分，原路退回或退回余额）
+func RefundAdminOrder(c *gin.Context) {
+	admin, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "未登录", nil)
+		return
+	}
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "订单ID无效", err)
+		return
+	}
+	var req struct {
+		Amount      float64 `json:"amount"`      // 0 表示全额退款
+		Destination string  `json:"destination"` // original / balance
+		Reason      string  `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+	if req.Amount < 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "退款金额不能为负数", nil)
+		return
+	}
+
+	outcome, err := orderServicePkg.NewOrderService().RefundOrder(uint(orderID), orderServicePkg.RefundParams{
+		Amount:      req.Amount,
+		Destination: req.Destination,
+		Reason:      strings.TrimSpace(req.Reason),
+		OperatorID:  admin.ID,
+	})
+	if err != nil {
+		refundErrorResponse(c, err)
+		return
+	}
+
+	utils.CreateAuditLogSimple(c, "refund_order", "order", uint(orderID),
+		fmt.Sprintf("订单退款: %.2f 元（%s），退款单号: %s", outcome.Amount, outcome.Destination, outcome.RefundNo))
+	utils.SuccessResponse(c, http.StatusOK, "退款成功", outcome)
+}
+
+// RetryAdminOrderRefund 重试待对账的网关退款
+func RetryAdminOrderRefund(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "订单ID无效", err)
+		return
+	}
+	refundNo := c.Param("refundNo")
+	outcome, err := orderServicePkg.NewOrderService().RetryRefund(uint(orderID), refundNo)
+	if err != nil {
+		refundErrorResponse(c, err)
+		return
+	}
+
+	utils.CreateAuditLogSimple(c, "refund_order", "order", uint(orderID),
+		fmt.Sprintf("待对账退款已确认: %.2f 元，退款单号: %s", outcome.Amount, refundNo))
+	utils.SuccessResponse(c, http.StatusOK, "退款成功", outcome)
+}
+
+// refundErrorResponse 网关结果不确定时返回 502，提示管理员稍后重试对账
+func refundErrorResponse(c *gin.Context, err error) {
+	if errors.Is(err, orderServicePkg.ErrRefundPending) {
+		utils.ErrorResponse(c, http.StatusBadGateway, err.Error(), err)
+		return
+	}
+	utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), err)
+}
+
+// GetAdminOrderRefunds 获取订单的退款记录
+func GetAdminOrderRefunds(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "订单ID无效", err)
+		return
+	}
+	refunds, err := orderServicePkg.NewOrderService().GetRefunds(uint(orderID))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "获取退款记录失败", err)
+		return
+	}
+
+	list := make([]gin.H, 0, len(refunds))
+	for _, r := range refunds {
+		var detail struct {
+			Destination string `json:"destination"`
+			Reason      string `json:"reason"`
+		}
+		if r.PaymentData.Valid {
+			_ = json.Unmarshal([]byte(r.PaymentData.String), &detail)
+		}
+		list = append(list, gin.H{
+			"refund_no":         utils.GetNullStringValue(r.TransactionID),
+			"amount":            float64(-r.Amount) / 100,
+			"gateway_refund_id": utils.GetNullStringValue(r.ExternalTransactionID),
+			"status":            r.Status,
+			"destination":       detail.Destination,
+			"reason":            detail.Reason,
+			"created_at":        r.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", list)
+}
@@ -8,6 +8,7 @@ import (
 
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
 	"cboard-go/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -38,6 +39,14 @@ func GetPackages(c *gin.Context) {
 			"is_recommended": pkg.IsRecommended,
 			"created_at":     pkg.CreatedAt.Format("2006-01-02 15:04:05"),
 			"updated_at":     pkg.UpdatedAt.Format("2006-01-02 15:04:05"),
+
+			"traffic_limit":      pkg.TrafficLimit,
+			"traffic_reset_mode": pkg.TrafficResetMode,
+			"traffic_reset_days": pkg.TrafficResetDays,
+			"clash_template_id":  pkg.ClashTemplateID,
+
+			"max_node_multiplier": pkg.MaxNodeMultiplier,
+			"max_online_ips":      pkg.MaxOnlineIPs,
 		})
 	}
 
@@ -69,6 +78,14 @@ func CreatePackage(c *gin.Context) {
 		SortOrder     int     `json:"sort_order"`
 		IsActive      bool    `json:"is_active"`
 		IsRecommended bool    `json:"is_recommended"`
+
+		TrafficLimit     int64  `json:"traffic_limit"`
+		TrafficResetMode string `json:"traffic_reset_mode"`
+		TrafficResetDays int    `json:"traffic_reset_days"`
+		ClashTemplateID  uint   `json:"clash_template_id"`
+
+		MaxNodeMultiplier float64 `json:"max_node_multiplier"` // 0 表示不限制节点倍率
+		MaxOnlineIPs      int     `json:"max_online_ips"`      // 0 表示不限制同时在线 IP 数
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -90,6 +107,39 @@ func CreatePackage(c *gin.Context) {
 	if req.Description != "" {
 		pkg.Description = database.NullString(req.Description)
 	}
+	if req.TrafficLimit < 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "流量配额不能为负数", nil)
+		return
+	}
+	pkg.TrafficLimit = req.TrafficLimit
+	pkg.TrafficResetMode = utils.TrafficResetNone
+	if req.TrafficResetMode != "" {
+		if !isValidTrafficResetMode(req.TrafficResetMode) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "无效的流量重置方式", nil)
+			return
+		}
+		pkg.TrafficResetMode = req.TrafficResetMode
+	}
+	pkg.TrafficResetDays = 30
+	if req.TrafficResetDays > 0 {
+		pkg.TrafficResetDays = req.TrafficResetDays
+	}
+	templateID, err := resolveClashTemplateID(db, req.ClashTemplateID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	pkg.ClashTemplateID = templateID
+	if req.MaxNodeMultiplier < 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "最高节点倍率不能为负数", nil)
+		return
+	}
+	pkg.MaxNodeMultiplier = req.MaxNodeMultiplier
+	if req.MaxOnlineIPs < 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "同时在线 IP 数不能为负数", nil)
+		return
+	}
+	pkg.MaxOnlineIPs = req.MaxOnlineIPs
 
 	if err := db.Create(&pkg).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "创建套餐失败", err)
@@ -112,6 +162,14 @@ func UpdatePackage(c *gin.Context) {
 		SortOrder     *int     `json:"sort_order"`     // 使用指针，允许检测是否提供
 		IsActive      *bool    `json:"is_active"`      // 使用指针，允许检测是否提供
 		IsRecommended *bool    `json:"is_recommended"` // 使用指针，允许检测是否提供
+
+		TrafficLimit     *int64  `json:"traffic_limit"`
+		TrafficResetMode *string `json:"traffic_reset_mode"`
+		TrafficResetDays *int    `json:"traffic_reset_days"`
+		ClashTemplateID  *uint   `json:"clash_template_id"` // 0 表示恢复为默认模板
+
+		MaxNodeMultiplier *float64 `json:"max_node_multiplier"` // 0 表示不限制节点倍率
+		MaxOnlineIPs      *int     `json:"max_online_ips"`      // 0 表示不限制同时在线 IP 数
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -182,11 +240,53 @@ func UpdatePackage(c *gin.Context) {
 	if req.IsRecommended != nil {
 		pkg.IsRecommended = *req.IsRecommended
 	}
+	if req.TrafficLimit != nil {
+		if *req.TrafficLimit < 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "流量配额不能为负数", nil)
+			return
+		}
+		pkg.TrafficLimit = *req.TrafficLimit
+	}
+	if req.TrafficResetMode != nil {
+		if !isValidTrafficResetMode(*req.TrafficResetMode) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "无效的流量重置方式", nil)
+			return
+		}
+		pkg.TrafficResetMode = *req.TrafficResetMode
+	}
+	if req.TrafficResetDays != nil && *req.TrafficResetDays > 0 {
+		pkg.TrafficResetDays = *req.TrafficResetDays
+	}
+	if req.ClashTemplateID != nil {
+		templateID, err := resolveClashTemplateID(db, *req.ClashTemplateID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		pkg.ClashTemplateID = templateID
+	}
+	if req.MaxNodeMultiplier != nil {
+		if *req.MaxNodeMultiplier < 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "最高节点倍率不能为负数", nil)
+			return
+		}
+		pkg.MaxNodeMultiplier = *req.MaxNodeMultiplier
+	}
+	if req.MaxOnlineIPs != nil {
+		if *req.MaxOnlineIPs < 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "同时在线 IP 数不能为负数", nil)
+			return
+		}
+		pkg.MaxOnlineIPs = *req.MaxOnlineIPs
+	}
 
 	if err := db.Save(&pkg).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "更新套餐失败", err)
 		return
 	}
+	if req.ClashTemplateID != nil || req.MaxNodeMultiplier != nil {
+		config_update.InvalidateSubscriptionCache()
+	}
 
 	// 格式化返回数据，确保 description 字段是字符串而不是对象
 	responseData := gin.H{
@@ -201,6 +301,14 @@ func UpdatePackage(c *gin.Context) {
 		"is_recommended": pkg.IsRecommended,
 		"created_at":     pkg.CreatedAt.Format("2006-01-02 15:04:05"),
 		"updated_at":     pkg.UpdatedAt.Format("2006-01-02 15:04:05"),
+
+		"traffic_limit":      pkg.TrafficLimit,
+		"traffic_reset_mode": pkg.TrafficResetMode,
+		"traffic_reset_days": pkg.TrafficResetDays,
+		"clash_template_id":  pkg.ClashTemplateID,
+
+		"max_node_multiplier": pkg.MaxNodeMultiplier,
+		"max_online_ips":      pkg.MaxOnlineIPs,
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "更新成功", responseData)
@@ -286,6 +394,14 @@ func GetAdminPackages(c *gin.Context) {
 			"is_recommended": pkg.IsRecommended,
 			"created_at":     pkg.CreatedAt.Format("2006-01-02 15:04:05"),
 			"updated_at":     pkg.UpdatedAt.Format("2006-01-02 15:04:05"),
+
+			"traffic_limit":      pkg.TrafficLimit,
+			"traffic_reset_mode": pkg.TrafficResetMode,
+			"traffic_reset_days": pkg.TrafficResetDays,
+			"clash_template_id":  pkg.ClashTemplateID,
+
+			"max_node_multiplier": pkg.MaxNodeMultiplier,
+			"max_online_ips":      pkg.MaxOnlineIPs,
 		})
 	}
 
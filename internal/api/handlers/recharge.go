@@ -55,30 +55,16 @@ func CreateRecharge(c *gin.Context) {
 		paymentMethod = "alipay"
 	}
 
-	var paymentConfig models.PaymentConfig
 	// 查找对应类型的支付配置（不区分大小写）
-	if err := db.Where("LOWER(pay_type) = LOWER(?) AND status = ?", paymentMethod, 1).First(&paymentConfig).Error; err == nil {
-		if paymentMethod == "alipay" {
-			alipayService, err := payment.NewAlipayService(&paymentConfig)
-			if err == nil {
-				// 创建临时订单用于充值
-				tempOrder := &models.Order{
-					OrderNo: recharge.OrderNo,
-					UserID:  user.ID,
-					Amount:  recharge.Amount,
-				}
-				paymentURL, _ = alipayService.CreatePayment(tempOrder, recharge.Amount)
-			}
-		} else if paymentMethod == "wechat" {
-			wechatService, err := payment.NewWechatService(&paymentConfig)
-			if err == nil {
-				tempOrder := &models.Order{
-					OrderNo: recharge.OrderNo,
-					UserID:  user.ID,
-					Amount:  recharge.Amount,
-				}
-				paymentURL, _ = wechatService.CreatePayment(tempOrder, recharge.Amount)
+	if paymentConfig, err := payment.ActiveConfig(db, paymentMethod); err == nil {
+		if provider, err := payment.NewProvider(paymentConfig); err == nil {
+			// 创建临时订单用于充值
+			tempOrder := &models.Order{
+				OrderNo: recharge.OrderNo,
+				UserID:  user.ID,
+				Amount:  recharge.Amount,
 			}
+			paymentURL, _ = provider.CreatePayment(tempOrder, recharge.Amount)
 		}
 	}
 
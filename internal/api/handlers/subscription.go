@@ -10,7 +10,9 @@ import (
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/middleware"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
 	"cboard-go/internal/services/email"
+	"cboard-go/internal/services/node_agent"
 	"cboard-go/internal/services/notification"
 	"cboard-go/internal/utils"
 
@@ -258,10 +260,14 @@ func GetSubscriptionDevices(c *gin.Context) {
 	}
 	var devices []models.Device
 	db.Where("subscription_id = ?", sub.ID).Find(&devices)
+	agent := node_agent.NewNodeAgentService()
+	onlineIPs, _ := agent.OnlineIPs(&sub)
 	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
 		"devices":         formatDeviceList(devices),
 		"device_limit":    sub.DeviceLimit,
 		"current_devices": sub.CurrentDevices,
+		"online_ips":      onlineIPs,
+		"max_online_ips":  agent.OnlineLimit(&sub),
 	})
 }
 
@@ -288,6 +294,10 @@ func UpdateSubscription(c *gin.Context) {
 		ExpireTime  *string `json:"expire_time"`
 		IsActive    *bool   `json:"is_active"`
 		Status      string  `json:"status"`
+
+		TrafficLimit     *int64  `json:"traffic_limit"`
+		TrafficResetMode *string `json:"traffic_reset_mode"`
+		TrafficResetDays *int    `json:"traffic_reset_days"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误", err)
@@ -312,6 +322,23 @@ func UpdateSubscription(c *gin.Context) {
 	if req.Status != "" {
 		sub.Status = req.Status
 	}
+	if req.TrafficLimit != nil {
+		if *req.TrafficLimit < 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "流量配额不能为负数", nil)
+			return
+		}
+		sub.TrafficLimit = *req.TrafficLimit
+	}
+	if req.TrafficResetMode != nil {
+		if !isValidTrafficResetMode(*req.TrafficResetMode) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "无效的流量重置方式", nil)
+			return
+		}
+		sub.TrafficResetMode = *req.TrafficResetMode
+	}
+	if req.TrafficResetDays != nil && *req.TrafficResetDays > 0 {
+		sub.TrafficResetDays = *req.TrafficResetDays
+	}
 	if req.ExpireTime != nil && *req.ExpireTime != "" {
 		if t, err := time.Parse("2006-01-02", *req.ExpireTime); err == nil {
 			sub.ExpireTime = t
@@ -349,6 +376,7 @@ func ResetSubscription(c *gin.Context) {
 	newURL := utils.GenerateSubscriptionURL()
 	sub.SubscriptionURL = newURL
 	sub.CurrentDevices = 0
+	config_update.RotateProxyCredentials(&sub)
 	db.Save(&sub)
 
 	// 记录订阅重置
@@ -432,6 +460,7 @@ func ResetUserSubscription(c *gin.Context) {
 		newURL := utils.GenerateSubscriptionURL()
 		sub.SubscriptionURL = newURL
 		sub.CurrentDevices = 0
+		config_update.RotateProxyCredentials(&sub)
 		db.Save(&sub)
 
 		// 记录订阅重置
@@ -523,6 +552,7 @@ func ResetUserSubscriptionSelf(c *gin.Context) {
 	newURL := utils.GenerateSubscriptionURL()
 	sub.SubscriptionURL = newURL
 	sub.CurrentDevices = 0
+	config_update.RotateProxyCredentials(&sub)
 	db.Save(&sub)
 
 	// 记录订阅重置
@@ -882,6 +912,7 @@ func BatchResetSubscriptions(c *gin.Context) {
 		newURL := utils.GenerateSubscriptionURL()
 		sub.SubscriptionURL = newURL
 		sub.CurrentDevices = 0
+		config_update.RotateProxyCredentials(&sub)
 
 		if err := db.Save(&sub).Error; err != nil {
 			failCount++
@@ -6,12 +6,17 @@ import (
 	"cboard-go/internal/services/config_update"
 	"cboard-go/internal/services/device"
 	"cboard-go/internal/utils"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -274,157 +279,236 @@ func GetSubscriptionConfig(c *gin.Context) {
 		return
 	}
 
-	// 3. 验证有效性（过期/超额）
-	// 注意：具体的设备限制逻辑交由 Service 处理，但在调用前我们需要处理设备记录逻辑
+	// 3. 记录设备访问（新设备超限时不记录，由 Service 返回设备超限的错误节点），
 	// 以确保"新设备超限被阻，旧设备超限可用"的逻辑生效
+	deviceIP := utils.GetRealClientIP(c)
+	deviceUA := c.GetHeader("User-Agent")
+	recordSubscriptionDevice(db, &sub, deviceIP, deviceUA, "clash")
+
+	// 4. 生成配置
+	db.Model(&sub).Update("clash_count", gorm.Expr("clash_count + ?", 1))
+
+	cfg, info, err := config_update.NewConfigUpdateService().GenerateClashConfig(uurl, deviceIP, deviceUA)
+	if err != nil {
+		// 这里的 err 通常是系统错误，而非业务逻辑阻断（业务阻断会返回错误节点的 YAML）
+		c.Header("Content-Type", "application/x-yaml")
+		c.String(200, generateErrorConfig("生成失败", fmt.Sprintf("配置生成错误: %v", err), baseURL))
+		return
+	}
+
+	setSubscriptionHeaders(c, info)
+	writeSubscriptionBody(c, "application/x-yaml", cfg)
+}
+
+// GetUniversalSubscription 处理通用 Base64 订阅
+func GetUniversalSubscription(c *gin.Context) {
+	uurl := c.Param("url")
+	db := database.GetDB()
+	baseURL := utils.GetBuildBaseURL(c.Request, db)
+	var sub models.Subscription
+
+	if err := db.Where("subscription_url = ?", uurl).First(&sub).Error; err != nil {
+		// Service 会处理旧地址检查和错误消息生成，这里不需要重复
+		// 由于我们需要 sub 来进行设备逻辑判断，但这里 sub 不存在
+		// 我们直接调用 Service，Service 内部会再次尝试查找 oldURL
+	}
+
+	// 为了确保逻辑统一，我们重新组织一下 GetUniversalSubscription
+	// 实际上，我们只需要获取 IP/UA，然后调用 Service 即可
 
-	deviceManager := device.NewDeviceManager()
 	deviceIP := utils.GetRealClientIP(c)
 	deviceUA := c.GetHeader("User-Agent")
 
-	// 检查当前设备是否存在
+	// 预先获取 sub 以便进行设备逻辑判断（如果 sub 存在）
+	if db.Where("subscription_url = ?", uurl).First(&sub).Error == nil {
+		if recordSubscriptionDevice(db, &sub, deviceIP, deviceUA, "universal") {
+			db.Model(&sub).Update("universal_count", gorm.Expr("universal_count + ?", 1))
+		}
+	}
+
+	// 调用 Service 生成配置
+	// format 默认为 base64 (vmess/vless/etc)
+	// 如果是 ssr 客户端，可能需要不同的处理，但这里统一用 base64
+	cfg, info, err := config_update.NewConfigUpdateService().GenerateUniversalConfig(uurl, deviceIP, deviceUA, "base64")
+	if err != nil {
+		c.String(200, generateErrorConfigBase64("错误", "生成配置失败", baseURL))
+		return
+	}
+	setSubscriptionHeaders(c, info)
+	writeSubscriptionBody(c, "text/plain; charset=utf-8", cfg)
+}
+
+// recordSubscriptionDevice 记录订阅设备访问（含同UA设备漫游逻辑），返回是否已记录
+// 新设备在超出设备限制时不记录，由 Service 返回设备超限的错误节点
+func recordSubscriptionDevice(db *gorm.DB, sub *models.Subscription, deviceIP, deviceUA, subscriptionType string) bool {
+	deviceManager := device.NewDeviceManager()
 	hash := deviceManager.GenerateDeviceHash(deviceUA, deviceIP, "")
 	var currentDevice models.Device
 	deviceExists := db.Where("device_hash = ? AND subscription_id = ?", hash, sub.ID).First(&currentDevice).Error == nil
 
-	// 如果当前设备不存在，尝试查找是否有相同User-Agent的设备
-	// 这解决了用户开启代理后IP变化导致被识别为新设备的问题
-	// 也解决了同一设备在不同网络环境下（如家庭WiFi和公司WiFi）被识别为不同设备的问题
+	// 同UA设备漫游逻辑
 	if !deviceExists {
 		var sameUADevice models.Device
-		// 查找该订阅下 UA 相同且最近活跃的设备（例如最近24小时内）
-		// 我们取最近活跃的那一个
 		if err := db.Where("subscription_id = ? AND user_agent = ? AND is_active = ?", sub.ID, deviceUA, true).
 			Order("last_access DESC").
 			First(&sameUADevice).Error; err == nil {
 
-			// 找到了同UA的设备，我们将当前请求视为该设备的"漫游"
-			// 更新该设备的IP和Hash为当前的
 			sameUADevice.IPAddress = &deviceIP
 			sameUADevice.DeviceHash = &hash
 			sameUADevice.LastAccess = utils.GetBeijingTime()
 
-			// 保存更新
 			if err := db.Save(&sameUADevice).Error; err == nil {
-				// 成功"继承"了旧设备，标记为已存在
 				deviceExists = true
-				currentDevice = sameUADevice
-				// 记录日志（可选）
-				// utils.LogInfo(fmt.Sprintf("设备漫游: SubID=%d, OldIP=%s, NewIP=%s", sub.ID, sameUADevice.IPAddress, deviceIP))
 			}
 		}
 	}
 
-	// 获取当前设备数
 	var count int64
 	db.Model(&models.Device{}).Where("subscription_id = ? AND is_active = ?", sub.ID, true).Count(&count)
 
-	// 逻辑：
-	// 1. 如果设备已存在 -> 允许 (更新访问时间)
-	// 2. 如果设备不存在 (新设备)
-	//    a. 如果未超限 -> 允许 (创建设备)
-	//    b. 如果已超限 -> 拒绝 (不创建设备，Service 会检测到 device 不在列表中且超限，从而返回错误节点)
-
-	shouldRecord := true
 	if !deviceExists {
 		if sub.DeviceLimit > 0 && int(count) >= sub.DeviceLimit {
-			shouldRecord = false
+			return false
 		} else if sub.DeviceLimit == 0 {
-			shouldRecord = false
+			return false
 		}
 	}
 
-	if shouldRecord {
-		deviceManager.RecordDeviceAccess(sub.ID, sub.UserID, deviceUA, deviceIP, "clash")
-	}
+	deviceManager.RecordDeviceAccess(sub.ID, sub.UserID, deviceUA, deviceIP, subscriptionType)
+	return true
+}
 
-	// 4. 生成配置
-	db.Model(&sub).Update("clash_count", gorm.Expr("clash_count + ?", 1))
+// GetSingboxSubscription 处理 sing-box JSON 订阅
+func GetSingboxSubscription(c *gin.Context) {
+	serveTargetSubscription(c, config_update.TargetSingbox)
+}
 
-	cfg, err := config_update.NewConfigUpdateService().GenerateClashConfig(uurl, deviceIP, deviceUA)
-	if err != nil {
-		// 这里的 err 通常是系统错误，而非业务逻辑阻断（业务阻断会返回错误节点的 YAML）
-		c.Header("Content-Type", "application/x-yaml")
-		c.String(200, generateErrorConfig("生成失败", fmt.Sprintf("配置生成错误: %v", err), baseURL))
+// GetSurgeSubscription 处理 Surge 订阅
+func GetSurgeSubscription(c *gin.Context) {
+	serveTargetSubscription(c, config_update.TargetSurge)
+}
+
+// GetQuantumultXSubscription 处理 Quantumult X 订阅（server_remote 节点资源）
+func GetQuantumultXSubscription(c *gin.Context) {
+	serveTargetSubscription(c, config_update.TargetQuantumultX)
+}
+
+// GetLoonSubscription 处理 Loon 订阅
+func GetLoonSubscription(c *gin.Context) {
+	serveTargetSubscription(c, config_update.TargetLoon)
+}
+
+// GetStashSubscription 处理 Stash 订阅（Clash 兼容 YAML）
+func GetStashSubscription(c *gin.Context) {
+	serveTargetSubscription(c, config_update.TargetStash)
+}
+
+// GetNegotiatedSubscription 统一订阅入口：根据 ?target= 参数、Accept 请求头或 User-Agent 自动选择订阅格式
+func GetNegotiatedSubscription(c *gin.Context) {
+	target := negotiateSubscriptionTarget(c)
+	if target == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "不支持的订阅格式: "+c.Query("target"), nil)
 		return
 	}
 
-	c.Header("Content-Type", "application/x-yaml")
-	c.String(200, cfg)
-}
+	// 同一链接的响应随客户端变化，避免被缓存后返回给其他客户端
+	c.Header("Vary", "User-Agent, Accept")
 
-// GetUniversalSubscription 处理通用 Base64 订阅
-func GetUniversalSubscription(c *gin.Context) {
-	uurl := c.Param("url")
-	db := database.GetDB()
-	baseURL := utils.GetBuildBaseURL(c.Request, db)
-	var sub models.Subscription
+	switch target {
+	case config_update.TargetClash:
+		GetSubscriptionConfig(c)
+	case config_update.TargetUniversal:
+		GetUniversalSubscription(c)
+	default:
+		serveTargetSubscription(c, target)
+	}
+}
 
-	if err := db.Where("subscription_url = ?", uurl).First(&sub).Error; err != nil {
-		// Service 会处理旧地址检查和错误消息生成，这里不需要重复
-		// 由于我们需要 sub 来进行设备逻辑判断，但这里 sub 不存在
-		// 我们直接调用 Service，Service 内部会再次尝试查找 oldURL
+// negotiateSubscriptionTarget 按优先级确定订阅格式：?target= 参数 > Accept 请求头 > User-Agent 识别
+// target 参数无法识别时返回空字符串
+func negotiateSubscriptionTarget(c *gin.Context) string {
+	if target := c.Query("target"); target != "" {
+		return config_update.NormalizeTarget(target)
 	}
+	if target := config_update.TargetFromAccept(c.GetHeader("Accept")); target != "" {
+		return target
+	}
+	software := device.NewDeviceManager().MatchSoftware(c.GetHeader("User-Agent"))
+	return config_update.TargetForSoftware(software)
+}
 
-	// 为了确保逻辑统一，我们重新组织一下 GetUniversalSubscription
-	// 实际上，我们只需要获取 IP/UA，然后调用 Service 即可
+// targetContentTypes 各订阅格式的响应类型
+var targetContentTypes = map[string]string{
+	config_update.TargetClash:       "application/x-yaml",
+	config_update.TargetStash:       "application/x-yaml",
+	config_update.TargetSingbox:     "application/json; charset=utf-8",
+	config_update.TargetSurge:       "text/plain; charset=utf-8",
+	config_update.TargetQuantumultX: "text/plain; charset=utf-8",
+	config_update.TargetLoon:        "text/plain; charset=utf-8",
+	config_update.TargetUniversal:   "text/plain; charset=utf-8",
+}
+
+// serveTargetSubscription 记录设备访问并按指定格式输出订阅
+func serveTargetSubscription(c *gin.Context, target string) {
+	uurl := c.Param("url")
+	db := database.GetDB()
 
 	deviceIP := utils.GetRealClientIP(c)
 	deviceUA := c.GetHeader("User-Agent")
-	deviceManager := device.NewDeviceManager()
 
-	// 预先获取 sub 以便进行设备逻辑判断（如果 sub 存在）
+	var sub models.Subscription
 	if db.Where("subscription_url = ?", uurl).First(&sub).Error == nil {
-		// 同样的设备记录逻辑
-		hash := deviceManager.GenerateDeviceHash(deviceUA, deviceIP, "")
-		var currentDevice models.Device
-		deviceExists := db.Where("device_hash = ? AND subscription_id = ?", hash, sub.ID).First(&currentDevice).Error == nil
-
-		// 同UA设备漫游逻辑
-		if !deviceExists {
-			var sameUADevice models.Device
-			if err := db.Where("subscription_id = ? AND user_agent = ? AND is_active = ?", sub.ID, deviceUA, true).
-				Order("last_access DESC").
-				First(&sameUADevice).Error; err == nil {
-
-				sameUADevice.IPAddress = &deviceIP
-				sameUADevice.DeviceHash = &hash
-				sameUADevice.LastAccess = utils.GetBeijingTime()
-
-				if err := db.Save(&sameUADevice).Error; err == nil {
-					deviceExists = true
-					currentDevice = sameUADevice
-				}
+		if recordSubscriptionDevice(db, &sub, deviceIP, deviceUA, target) {
+			// Stash 与 Clash 同属 YAML 订阅，其余计入通用订阅次数
+			if target == config_update.TargetClash || target == config_update.TargetStash {
+				db.Model(&sub).Update("clash_count", gorm.Expr("clash_count + ?", 1))
+			} else {
+				db.Model(&sub).Update("universal_count", gorm.Expr("universal_count + ?", 1))
 			}
 		}
+	}
 
-		var count int64
-		db.Model(&models.Device{}).Where("subscription_id = ? AND is_active = ?", sub.ID, true).Count(&count)
+	cfg, info, err := config_update.NewConfigUpdateService().GenerateTargetConfig(uurl, deviceIP, deviceUA, target)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "生成配置失败", err)
+		return
+	}
 
-		shouldRecord := true
-		if !deviceExists {
-			if sub.DeviceLimit > 0 && int(count) >= sub.DeviceLimit {
-				shouldRecord = false
-			} else if sub.DeviceLimit == 0 {
-				shouldRecord = false
-			}
-		}
+	setSubscriptionHeaders(c, info)
+	writeSubscriptionBody(c, targetContentTypes[target], cfg)
+}
 
-		if shouldRecord {
-			deviceManager.RecordDeviceAccess(sub.ID, sub.UserID, deviceUA, deviceIP, "universal")
-			db.Model(&sub).Update("universal_count", gorm.Expr("universal_count + ?", 1))
+// writeSubscriptionBody 输出订阅内容并设置 ETag，客户端 If-None-Match 命中时返回 304
+func writeSubscriptionBody(c *gin.Context, contentType, body string) {
+	sum := sha256.Sum256([]byte(body))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+
+	for _, candidate := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			c.Status(http.StatusNotModified)
+			return
 		}
 	}
 
-	// 调用 Service 生成配置
-	// format 默认为 base64 (vmess/vless/etc)
-	// 如果是 ssr 客户端，可能需要不同的处理，但这里统一用 base64
-	cfg, err := config_update.NewConfigUpdateService().GenerateUniversalConfig(uurl, deviceIP, deviceUA, "base64")
-	if err != nil {
-		c.String(200, generateErrorConfigBase64("错误", "生成配置失败", baseURL))
+	c.Header("Content-Type", contentType)
+	c.String(http.StatusOK, body)
+}
+
+// setSubscriptionHeaders 设置客户端识别的订阅响应头（用量、更新间隔、配置文件名）
+func setSubscriptionHeaders(c *gin.Context, info *config_update.SubscriptionUserInfo) {
+	if info == nil {
 		return
 	}
-	c.String(200, cfg)
+	c.Header("subscription-userinfo", info.HeaderValue())
+	if info.UpdateInterval > 0 {
+		c.Header("profile-update-interval", strconv.Itoa(info.UpdateInterval))
+	}
+	if info.FileName != "" {
+		c.Header("content-disposition", "attachment; filename*=UTF-8''"+url.PathEscape(info.FileName))
+	}
 }
 
 // UpdateSubscriptionConfig 更新订阅配置（由用户/管理员手动触发）
@@ -709,3 +793,41 @@ func TestConfigUpdate(c *gin.Context) {
 	}()
 	utils.SuccessResponse(c, http.StatusOK, "测试任务已启动", nil)
 }
+
+// PreviewConfigUpdate 预览节点源更新（dry-run），返回与当前节点的差异和计划ID，不写入节点
+func PreviewConfigUpdate(c *gin.Context) {
+	var req struct {
+		SourceID uint `json:"source_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err)
+		return
+	}
+
+	service := config_update.NewConfigUpdateService()
+	plan, err := service.PreviewUpdate(req.SourceID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "", plan)
+}
+
+// ApplyConfigUpdate 应用预览生成的更新计划
+func ApplyConfigUpdate(c *gin.Context) {
+	var req struct {
+		PlanID string `json:"plan_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请提供更新计划ID", err)
+		return
+	}
+
+	service := config_update.NewConfigUpdateService()
+	plan, err := service.ApplyUpdatePlan(req.PlanID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusConflict, err.Error(), err)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "更新计划已应用", plan.Summary)
+}
@@ -135,8 +135,24 @@ func buildSubscriptionListData(db *gorm.DB, subscriptions []models.Subscription,
 			"days_until_expire": daysUntil,
 			"is_expired":        isExpired,
 			"created_at":        sub.CreatedAt.Format("2006-01-02 15:04:05"),
+
+			"traffic_limit":      sub.TrafficLimit,
+			"upload_traffic":     sub.UploadTraffic,
+			"download_traffic":   sub.DownloadTraffic,
+			"used_traffic":       sub.UsedTraffic(),
+			"traffic_reset_mode": sub.TrafficResetMode,
+			"traffic_exhausted":  sub.IsTrafficExhausted(),
 		})
 	}
 
 	return list
 }
+
+// isValidTrafficResetMode 校验流量重置方式
+func isValidTrafficResetMode(mode string) bool {
+	switch mode {
+	case utils.TrafficResetNone, utils.TrafficResetMonthly, utils.TrafficResetPeriodic:
+		return true
+	}
+	return false
+}
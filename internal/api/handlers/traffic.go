@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/traffic"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ReportNodeTraffic 节点上报用户流量
+func ReportNodeTraffic(c *gin.Context) {
+	var req struct {
+		NodeID uint                  `json:"node_id"`
+		Data   []traffic.UsageReport `json:"data" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误", err)
+		return
+	}
+
+	recorded, err := traffic.NewTrafficService().RecordUsage(req.NodeID, req.Data)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "流量记录失败", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "上报成功", gin.H{
+		"received": len(req.Data),
+		"recorded": recorded,
+	})
+}
+
+// ResetSubscriptionTraffic 管理员手动重置订阅已用流量
+func ResetSubscriptionTraffic(c *gin.Context) {
+	id := c.Param("id")
+	db := database.GetDB()
+	var sub models.Subscription
+	if err := db.First(&sub, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "订阅不存在", err)
+		} else {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "获取订阅失败", err)
+		}
+		return
+	}
+
+	if err := traffic.NewTrafficService().ResetSubscriptionTraffic(&sub); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "重置流量失败", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "流量已重置", sub)
+}
@@ -62,6 +62,31 @@ func SetupRouter() *gin.Engine {
 			auth.POST("/reset-password", handlers.ResetPasswordByCode)
 		}
 
+		// 节点通信接口（节点使用通信密钥认证，不走CSRF保护）
+		server := api.Group("/server")
+		server.Use(middleware.NodeAPIMiddleware())
+		{
+			server.POST("/traffic", handlers.ReportNodeTraffic) // 节点上报用户流量
+		}
+
+		// 自建节点后端接口（兼容 XrayR / V2bX 的 UniProxy 协议，使用节点各自的通信密钥认证）
+		uniProxy := api.Group("/server/UniProxy")
+		uniProxy.Use(middleware.NodeAgentMiddleware())
+		{
+			uniProxy.GET("/config", handlers.UniProxyConfig)
+			uniProxy.GET("/user", handlers.UniProxyUsers)
+			uniProxy.POST("/push", handlers.UniProxyPush)
+			uniProxy.POST("/alive", handlers.UniProxyAlive)
+			uniProxy.GET("/alivelist", handlers.UniProxyAliveList)
+			uniProxy.POST("/status", handlers.UniProxyStatus)
+		}
+		agent := api.Group("/server/agent")
+		agent.Use(middleware.NodeAgentMiddleware())
+		{
+			agent.GET("/credentials", handlers.ExportNodeCredentials) // 自建代理服务导出节点用户凭据
+			agent.POST("/online", handlers.ReportOnlineIPs)           // 自建代理服务上报在线 IP，返回需断开的连接
+		}
+
 		// 对需要认证的API路由应用CSRF保护（Web应用使用）
 		api.Use(middleware.CSRFMiddleware())
 
@@ -108,9 +133,14 @@ func SetupRouter() *gin.Engine {
 		subscribePublic := api.Group("")
 		subscribePublic.Use(middleware.CSRFExemptMiddleware())
 		{
-			subscribePublic.GET("/subscribe/:url", handlers.GetSubscriptionConfig)
+			subscribePublic.GET("/subscribe/:url", handlers.GetNegotiatedSubscription)              // 统一订阅入口（按 target 参数 / Accept / User-Agent 自动选择格式）
 			subscribePublic.GET("/subscriptions/clash/:url", handlers.GetSubscriptionConfig)        // 猫咪订阅（Clash YAML格式）
 			subscribePublic.GET("/subscriptions/universal/:url", handlers.GetUniversalSubscription) // 通用订阅（Base64格式，适用于小火煎、v2ray等）
+			subscribePublic.GET("/subscriptions/singbox/:url", handlers.GetSingboxSubscription)     // sing-box 订阅（JSON格式）
+			subscribePublic.GET("/subscriptions/surge/:url", handlers.GetSurgeSubscription)         // Surge 订阅
+			subscribePublic.GET("/subscriptions/quanx/:url", handlers.GetQuantumultXSubscription)   // Quantumult X 订阅（server_remote）
+			subscribePublic.GET("/subscriptions/loon/:url", handlers.GetLoonSubscription)           // Loon 订阅
+			subscribePublic.GET("/subscriptions/stash/:url", handlers.GetStashSubscription)         // Stash 订阅（Clash 兼容 YAML）
 		}
 
 		// 订单相关
@@ -144,6 +174,10 @@ func SetupRouter() *gin.Engine {
 			payment.GET("/methods", handlers.GetPaymentMethods)
 			payment.POST("", handlers.CreatePayment)
 			payment.GET("/status/:id", handlers.GetPaymentStatus)
+			payment.GET("/crypto/:orderNo", handlers.GetCryptoPayment)
+			payment.GET("/bank-transfer/:orderNo", handlers.GetBankTransfer)
+			payment.POST("/bank-transfer/:orderNo/receipt", handlers.UploadBankTransferReceipt)
+			payment.GET("/bank-transfer/:orderNo/receipt", handlers.GetBankTransferReceipt)
 		}
 		// 支付方式（公开访问）
 		api.GET("/payment-methods/active", handlers.GetPaymentMethods)
@@ -358,6 +392,15 @@ func SetupRouter() *gin.Engine {
 			admin.POST("/orders/bulk-mark-paid", handlers.BulkMarkOrdersPaid)
 			admin.POST("/orders/bulk-cancel", handlers.BulkCancelOrders)
 			admin.POST("/orders/batch-delete", handlers.BatchDeleteOrders)
+			admin.POST("/orders/:id/refund", handlers.RefundAdminOrder)
+			admin.GET("/orders/:id/refunds", handlers.GetAdminOrderRefunds)
+			admin.POST("/orders/:id/refunds/:refundNo/retry", handlers.RetryAdminOrderRefund)
+			admin.GET("/bank-transfers", handlers.GetAdminBankTransfers)
+			admin.GET("/bank-transfers/:id/receipt", handlers.GetAdminBankTransferReceipt)
+			admin.POST("/bank-transfers/:id/approve", handlers.ApproveBankTransfer)
+			admin.POST("/bank-transfers/:id/reject", handlers.RejectBankTransfer)
+			admin.GET("/crypto-payments", handlers.GetAdminCryptoPayments)
+			admin.POST("/crypto-payments/:id/resolve", handlers.ResolveAdminCryptoPayment)
 
 			// 套餐管理
 			admin.GET("/packages", handlers.GetAdminPackages)
@@ -365,14 +408,40 @@ func SetupRouter() *gin.Engine {
 			admin.PUT("/packages/:id", handlers.UpdatePackage)
 			admin.DELETE("/packages/:id", handlers.DeletePackage)
 
+			// Clash 配置模板
+			admin.GET("/clash-templates", handlers.GetClashTemplates)
+			admin.GET("/clash-templates/builtin", handlers.GetBuiltinClashTemplate)
+			admin.POST("/clash-templates", handlers.CreateClashTemplate)
+			admin.POST("/clash-templates/preview", handlers.PreviewClashTemplate)
+			admin.PUT("/clash-templates/:id", handlers.UpdateClashTemplate)
+			admin.DELETE("/clash-templates/:id", handlers.DeleteClashTemplate)
+
+			// 节点分组（套餐/用户等级可用节点）
+			admin.GET("/node-groups", handlers.GetNodeGroups)
+			admin.POST("/node-groups", handlers.CreateNodeGroup)
+			admin.PUT("/node-groups/:id", handlers.UpdateNodeGroup)
+			admin.DELETE("/node-groups/:id", handlers.DeleteNodeGroup)
+
+			// 上游节点源
+			admin.GET("/node-sources", handlers.GetNodeSources)
+			admin.POST("/node-sources", handlers.CreateNodeSource)
+			admin.PUT("/node-sources/:id", handlers.UpdateNodeSource)
+			admin.DELETE("/node-sources/:id", handlers.DeleteNodeSource)
+			admin.POST("/node-sources/:id/sync", handlers.SyncNodeSource)
+			admin.POST("/node-rules/test", handlers.TestNodeSourceRules)
+
 			// 节点管理
 			admin.GET("/nodes", handlers.GetAdminNodes)
 			admin.GET("/nodes/stats", handlers.GetNodeStats)
+			admin.GET("/nodes/health", handlers.GetNodesHealth)
 			admin.POST("/nodes", handlers.CreateNode)
 			admin.POST("/nodes/import-links", handlers.ImportNodeLinks)
 			admin.PUT("/nodes/:id", handlers.UpdateNode)
 			admin.DELETE("/nodes/:id", handlers.DeleteNode)
+			admin.GET("/nodes/:id/agent", handlers.GetNodeAgent)
+			admin.PUT("/nodes/:id/agent", handlers.UpdateNodeAgent)
 			admin.POST("/nodes/:id/test", handlers.TestNode)
+			admin.GET("/nodes/:id/health", handlers.GetNodeHealth)
 			admin.POST("/nodes/batch-test", handlers.BatchTestNodes)
 			admin.POST("/nodes/batch-delete", handlers.BatchDeleteNodes)
 			admin.POST("/nodes/import-from-file", handlers.ImportFromFile)
@@ -439,6 +508,7 @@ func SetupRouter() *gin.Engine {
 			admin.PUT("/subscriptions/:id", handlers.UpdateSubscription)
 			admin.POST("/subscriptions/:id/reset", handlers.ResetSubscription)
 			admin.POST("/subscriptions/:id/extend", handlers.ExtendSubscription)
+			admin.POST("/subscriptions/:id/reset-traffic", handlers.ResetSubscriptionTraffic)
 			admin.GET("/subscriptions/:id/devices", handlers.GetSubscriptionDevices)
 			admin.POST("/subscriptions/user/:id/reset-all", handlers.ResetUserSubscription)
 			admin.POST("/subscriptions/user/:id/send-email", handlers.SendSubscriptionEmail)
@@ -461,6 +531,8 @@ func SetupRouter() *gin.Engine {
 			admin.POST("/config-update/start", handlers.StartConfigUpdate)
 			admin.POST("/config-update/stop", handlers.StopConfigUpdate)
 			admin.POST("/config-update/test", handlers.TestConfigUpdate)
+			admin.POST("/config-update/preview", handlers.PreviewConfigUpdate)
+			admin.POST("/config-update/apply", handlers.ApplyConfigUpdate)
 			admin.GET("/config-update/files", handlers.GetConfigUpdateFiles)
 			admin.GET("/config-update/logs", handlers.GetConfigUpdateLogs)
 			admin.POST("/config-update/logs/clear", handlers.ClearConfigUpdateLogs)
@@ -225,6 +225,15 @@ func AutoMigrate() error {
 		&models.LoginHistory{},
 		&models.AuditLog{},
 		&models.TokenBlacklist{},
+		&models.TrafficLog{},
+		&models.ClashTemplate{},
+		&models.NodeGroup{},
+		&models.NodeSource{},
+		&models.NodeOnlineIP{},
+		&models.NodeHealthCheck{},
+		&models.NodeHealthRollup{},
+		&models.CryptoPayment{},
+		&models.BankTransfer{},
 	)
 
 	if err != nil {
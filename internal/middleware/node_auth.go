@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/node_agent"
+	"cboard-go/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NodeAPIMiddleware 节点通信接口认证中间件
+// 节点需在 X-Node-Token 请求头或 token 查询参数中携带系统配置的 node_api_token
+func NodeAPIMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("X-Node-Token")
+		if token == "" {
+			token = c.Query("token")
+		}
+		if token == "" {
+			utils.ErrorResponse(c, http.StatusUnauthorized, "缺少节点通信密钥", nil)
+			c.Abort()
+			return
+		}
+
+		var config models.SystemConfig
+		db := database.GetDB()
+		if err := db.Where("key = ? AND category = ?", "node_api_token", "general").First(&config).Error; err != nil || config.Value == "" {
+			utils.ErrorResponse(c, http.StatusForbidden, "节点通信接口未启用", nil)
+			c.Abort()
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.Value)) != 1 {
+			utils.ErrorResponse(c, http.StatusUnauthorized, "节点通信密钥无效", nil)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// NodeAgentMiddleware 自建节点后端认证中间件（UniProxy 协议）
+// 节点后端在查询参数中携带 node_id 和该节点的通信密钥 token，node_type 与节点类型不符时拒绝
+func NodeAgentMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		nodeID, err := strconv.ParseUint(c.Query("node_id"), 10, 64)
+		token := c.Query("token")
+		if err != nil || nodeID == 0 || token == "" {
+			utils.ErrorResponse(c, http.StatusUnauthorized, "缺少节点 ID 或通信密钥", nil)
+			c.Abort()
+			return
+		}
+
+		node, err := node_agent.NewNodeAgentService().Authenticate(uint(nodeID), token)
+		if err != nil {
+			status := http.StatusUnauthorized
+			if errors.Is(err, node_agent.ErrAgentDisabled) {
+				status = http.StatusForbidden
+			}
+			utils.ErrorResponse(c, status, err.Error(), nil)
+			c.Abort()
+			return
+		}
+
+		if nodeType := c.Query("node_type"); nodeType != "" && !node_agent.MatchNodeType(node.Type, nodeType) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "节点类型不匹配: "+node_agent.AgentNodeType(node.Type), nil)
+			c.Abort()
+			return
+		}
+
+		c.Set("agent_node", node)
+		c.Next()
+	}
+}
+
+// GetAgentNode 获取已认证的自建节点
+func GetAgentNode(c *gin.Context) (*models.Node, bool) {
+	value, exists := c.Get("agent_node")
+	if !exists {
+		return nil, false
+	}
+	node, ok := value.(*models.Node)
+	return node, ok
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// BankTransfer 银行转账支付单
+// 用户按转账说明汇款并上传回执，管理员审核通过后订单入账，驳回时用户可重新上传
+type BankTransfer struct {
+	ID                uint       `gorm:"primaryKey" json:"id"`
+	OrderNo           string     `gorm:"type:varchar(64);index;not null" json:"order_no"` // 订单号或充值单号
+	UserID            uint       `gorm:"index;not null" json:"user_id"`
+	PaymentConfigID   uint       `gorm:"index;not null" json:"payment_config_id"`
+	Amount            float64    `gorm:"type:decimal(10,2);not null" json:"amount"`
+	ReferenceCode     string     `gorm:"type:varchar(32);uniqueIndex;not null" json:"reference_code"`   // 转账附言中填写的参考号
+	Status            string     `gorm:"type:varchar(20);default:awaiting_receipt;index" json:"status"` // awaiting_receipt / pending_review / approved / rejected / cancelled
+	ReceiptFile       string     `gorm:"type:varchar(255)" json:"-"`                                    // 回执图片文件名（存储在上传目录的 receipts 子目录）
+	ReceiptUploadedAt *time.Time `json:"receipt_uploaded_at,omitempty"`
+	RejectReason      string     `gorm:"type:text" json:"reject_reason,omitempty"`
+	ReviewedBy        *uint      `json:"reviewed_by,omitempty"`
+	ReviewedAt        *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// 关系
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// TableName 指定表名
+func (BankTransfer) TableName() string {
+	return "bank_transfers"
+}
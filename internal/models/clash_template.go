@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// ClashTemplate Clash 配置模板（Go text/template 语法，可按套餐或用户等级选用）
+type ClashTemplate struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"type:varchar(255)" json:"description"`
+	Content     string    `gorm:"type:text;not null" json:"content"`
+	IsDefault   bool      `gorm:"default:false" json:"is_default"` // 未在套餐/等级中指定模板时使用
+	IsActive    bool      `gorm:"default:true" json:"is_active"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ClashTemplate) TableName() string {
+	return "clash_templates"
+}
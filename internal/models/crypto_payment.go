@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// CryptoPayment 加密货币（USDT）支付单
+// 每个待支付订单分配一个唯一的付款金额，链上监听到金额完全一致的转账并达到确认数后入账
+type CryptoPayment struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	OrderNo         string     `gorm:"type:varchar(64);index;not null" json:"order_no"` // 订单号或充值单号
+	UserID          uint       `gorm:"index;not null" json:"user_id"`
+	PaymentConfigID uint       `gorm:"index;not null" json:"payment_config_id"`
+	Chain           string     `gorm:"type:varchar(20);not null" json:"chain"` // tron / evm
+	Address         string     `gorm:"type:varchar(128);index;not null" json:"address"`
+	AmountUnits     int64      `gorm:"index;not null" json:"-"`                              // 付款金额（10^-6 USDT，与代币精度无关）
+	Amount          string     `gorm:"type:varchar(32);not null" json:"amount"`              // 付款金额（USDT）
+	AmountCNY       float64    `gorm:"type:decimal(10,2)" json:"amount_cny"`                 // 订单金额（元）
+	ExchangeRate    float64    `gorm:"type:decimal(12,6)" json:"exchange_rate"`              // 下单时的汇率（1 USDT 兑换的人民币）
+	Status          string     `gorm:"type:varchar(20);default:pending;index" json:"status"` // pending / confirming / paid / expired / late / ignored
+	TxHash          string     `gorm:"type:varchar(128);index" json:"tx_hash,omitempty"`
+	Confirmations   int        `gorm:"default:0" json:"confirmations"`
+	ExpiresAt       time.Time  `gorm:"index" json:"expires_at"`
+	PaidAt          *time.Time `json:"paid_at,omitempty"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (CryptoPayment) TableName() string {
+	return "crypto_payments"
+}
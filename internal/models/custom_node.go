@@ -18,6 +18,7 @@ type CustomNode struct {
 	LastTest         *time.Time `json:"last_test,omitempty"`                // 最后测试时间
 	ExpireTime       *time.Time `json:"expire_time,omitempty"`
 	FollowUserExpire bool       `gorm:"default:false" json:"follow_user_expire"`
+	Multiplier       float64    `gorm:"default:1" json:"multiplier"`        // 流量倍率
 	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt        time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
 }
@@ -46,6 +47,14 @@ type NodeConfig struct {
 	SkipCertVerify    bool   `json:"skip_cert_verify,omitempty"`
 }
 
+// Rate 返回专线节点的有效倍率（未设置时为 1）
+func (n *CustomNode) Rate() float64 {
+	if n.Multiplier <= 0 {
+		return 1
+	}
+	return n.Multiplier
+}
+
 func (CustomNode) TableName() string {
 	return "custom_nodes"
 }
@@ -20,14 +20,55 @@ type Node struct {
 	IsRecommended bool       `gorm:"default:false" json:"is_recommended"`
 	IsActive      bool       `gorm:"default:true" json:"is_active"`
 	IsManual      bool       `gorm:"default:false" json:"is_manual"`     // 是否为手动添加的节点
+	SourceID      *uint      `gorm:"index" json:"source_id,omitempty"`   // 来源节点源ID（手动添加的节点为空）
 	OrderIndex    int        `gorm:"default:0;index" json:"order_index"` // 节点顺序索引，用于排序
 	LastTest      *time.Time `json:"last_test,omitempty"`
 	LastUpdate    time.Time  `gorm:"autoCreateTime;autoUpdateTime" json:"last_update"`
 	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// 流量倍率（导入时从名称中提取，0 或 1 表示不加倍）；管理员修改后锁定，节点源更新时不再覆盖
+	Multiplier       float64 `gorm:"default:1;index" json:"multiplier"`
+	MultiplierLocked bool    `gorm:"default:false" json:"multiplier_locked"`
+
+	// 自建节点对接（XrayR / V2bX 等节点后端）：通信密钥只保存哈希，服务端配置可能包含私钥，均不对外输出
+	AgentKeyHash    string     `gorm:"type:varchar(64);index" json:"-"`
+	AgentConfig     *string    `gorm:"type:text" json:"-"`                      // 服务端配置覆盖项（JSON），如 Reality 私钥、监听端口
+	AgentStatus     *string    `gorm:"type:text" json:"agent_status,omitempty"` // 节点后端最近上报的负载（JSON）
+	AgentReportedAt *time.Time `json:"agent_reported_at,omitempty"`             // 节点后端最近一次通信时间
+	ProxyKey        string     `gorm:"type:varchar(64)" json:"-"`               // Shadowsocks 2022 服务端密钥（随机 32 字节，Base64）
+
+	// 服务器地理位置（节点源导入时解析服务器地址得到）；名称中的地区与解析结果不一致时标记 GeoMismatch
+	GeoIP          string     `gorm:"type:varchar(64)" json:"geo_ip,omitempty"`
+	GeoCountry     string     `gorm:"type:varchar(64)" json:"geo_country,omitempty"`
+	GeoCountryCode string     `gorm:"type:varchar(8);index" json:"geo_country_code,omitempty"`
+	GeoCity        string     `gorm:"type:varchar(64)" json:"geo_city,omitempty"`
+	GeoASN         uint       `gorm:"default:0" json:"geo_asn,omitempty"`
+	GeoASNOrg      string     `gorm:"type:varchar(128)" json:"geo_asn_org,omitempty"`
+	GeoMismatch    bool       `gorm:"default:false;index" json:"geo_mismatch"`
+	GeoCheckedAt   *time.Time `json:"geo_checked_at,omitempty"`
+
+	// 健康检查统计：Availability 为最近 24 小时在线率（%）；频繁上下线（Flapping）的节点恢复在线时暂不自动启用
+	// HealthDisabled 表示节点由健康检查自动禁用，定时检查会继续检测并在恢复后自动启用
+	Availability   float64 `gorm:"default:0" json:"availability"`
+	Flapping       bool    `gorm:"default:false" json:"flapping"`
+	HealthDisabled bool    `gorm:"default:false;index" json:"health_disabled"`
 }
 
 // TableName 指定表名
 func (Node) TableName() string {
 	return "nodes"
 }
+
+// IsSelfHosted 是否为对接了节点后端的自建节点
+func (n *Node) IsSelfHosted() bool {
+	return n.AgentKeyHash != ""
+}
+
+// Rate 返回节点的有效倍率（未设置时为 1）
+func (n *Node) Rate() float64 {
+	if n.Multiplier <= 0 {
+		return 1
+	}
+	return n.Multiplier
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// NodeGroup 节点分组（用于按套餐/用户等级授权节点）
+// 加入任意分组的节点仅对关联了这些分组的套餐或用户等级可见，未加入分组的节点对所有用户可见
+type NodeGroup struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"type:varchar(255)" json:"description"`
+	SortOrder   int       `gorm:"default:0" json:"sort_order"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// 关系
+	Nodes      []Node      `gorm:"many2many:node_group_nodes;" json:"-"`
+	Packages   []Package   `gorm:"many2many:package_node_groups;" json:"-"`
+	UserLevels []UserLevel `gorm:"many2many:user_level_node_groups;" json:"-"`
+}
+
+// TableName 指定表名
+func (NodeGroup) TableName() string {
+	return "node_groups"
+}
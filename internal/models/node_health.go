@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// NodeHealthCheck 节点健康检查记录（原始数据，超过保留期后汇总为小时数据）
+type NodeHealthCheck struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	NodeID    uint      `gorm:"index:idx_node_health_check_time;not null" json:"node_id"`
+	Status    string    `gorm:"type:varchar(20);not null" json:"status"`
+	Latency   int       `gorm:"default:0" json:"latency"`
+	Method    string    `gorm:"type:varchar(20)" json:"method,omitempty"`
+	Error     string    `gorm:"type:varchar(255)" json:"error,omitempty"`
+	CheckedAt time.Time `gorm:"index:idx_node_health_check_time;index;not null" json:"checked_at"`
+}
+
+// TableName 指定表名
+func (NodeHealthCheck) TableName() string {
+	return "node_health_checks"
+}
+
+// NodeHealthRollup 节点健康检查的小时汇总
+type NodeHealthRollup struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	NodeID       uint      `gorm:"uniqueIndex:idx_node_health_rollup;not null" json:"node_id"`
+	Hour         time.Time `gorm:"uniqueIndex:idx_node_health_rollup;index;not null" json:"hour"` // 小时起始时间
+	Checks       int       `gorm:"default:0" json:"checks"`
+	OnlineChecks int       `gorm:"default:0" json:"online_checks"`
+	LatencyP50   int       `gorm:"default:0" json:"latency_p50"`
+	LatencyP95   int       `gorm:"default:0" json:"latency_p95"`
+	StateChanges int       `gorm:"default:0" json:"state_changes"`
+}
+
+// TableName 指定表名
+func (NodeHealthRollup) TableName() string {
+	return "node_health_rollups"
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// NodeOnlineIP 节点后端上报的在线用户 IP
+type NodeOnlineIP struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	NodeID         uint      `gorm:"uniqueIndex:idx_node_online_ip;not null" json:"node_id"`
+	SubscriptionID uint      `gorm:"uniqueIndex:idx_node_online_ip;index;not null" json:"subscription_id"`
+	IP             string    `gorm:"type:varchar(45);uniqueIndex:idx_node_online_ip;not null" json:"ip"`
+	FirstSeen      time.Time `json:"first_seen"`
+	LastSeen       time.Time `gorm:"index" json:"last_seen"`
+}
+
+// TableName 指定表名
+func (NodeOnlineIP) TableName() string {
+	return "node_online_ips"
+}
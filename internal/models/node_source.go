@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// NodeSource 上游节点源（订阅地址），同步时导入的节点记录来源ID
+type NodeSource struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	Name           string     `gorm:"type:varchar(100);uniqueIndex;not null" json:"name"`
+	URL            string     `gorm:"type:text;not null" json:"url"`
+	UserAgent      string     `gorm:"type:varchar(255)" json:"user_agent"` // 拉取时使用的 User-Agent，为空使用默认值
+	Headers        string     `gorm:"type:text" json:"headers"`            // 额外请求头（JSON 对象）
+	Enabled        bool       `gorm:"default:true" json:"enabled"`
+	FilterKeywords string     `gorm:"type:text" json:"filter_keywords"`    // 过滤关键词（换行分隔），与全局关键词同时生效
+	NamePrefix     string     `gorm:"type:varchar(50)" json:"name_prefix"` // 节点名称前缀
+	Rules          string     `gorm:"type:text" json:"rules"`              // 节点规则（JSON 数组，按顺序执行）
+	FetchInterval  int        `gorm:"default:0" json:"fetch_interval"`     // 拉取间隔（秒），0 表示跟随全局自动更新
+	SortOrder      int        `gorm:"default:0;index" json:"sort_order"`
+	LastFetchAt    *time.Time `json:"last_fetch_at,omitempty"`
+	LastStatus     string     `gorm:"type:varchar(20)" json:"last_status"` // success, failed
+	LastError      string     `gorm:"type:text" json:"last_error"`
+	NodeCount      int        `gorm:"default:0" json:"node_count"` // 最近一次同步的节点数
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (NodeSource) TableName() string {
+	return "node_sources"
+}
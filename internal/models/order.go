@@ -22,6 +22,7 @@ type Order struct {
 	DiscountAmount       sql.NullFloat64 `gorm:"type:decimal(10,2);default:0" json:"discount_amount,omitempty"`
 	FinalAmount          sql.NullFloat64 `gorm:"type:decimal(10,2)" json:"final_amount,omitempty"`
 	ExtraData            sql.NullString  `gorm:"type:text" json:"extra_data,omitempty"`
+	RefundAmount         float64         `gorm:"type:decimal(10,2);default:0" json:"refund_amount"` // 已退款金额（部分退款时订单保持 paid，全额退款后为 refunded）
 	CreatedAt            time.Time       `gorm:"autoCreateTime;index" json:"created_at"`
 	UpdatedAt            time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
 
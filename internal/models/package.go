@@ -19,9 +19,24 @@ type Package struct {
 	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 
+	// 流量配额（单位：字节，0表示不限流量）
+	TrafficLimit     int64  `gorm:"default:0" json:"traffic_limit"`
+	TrafficResetMode string `gorm:"type:varchar(20);default:none" json:"traffic_reset_mode"` // none, monthly, periodic
+	TrafficResetDays int    `gorm:"default:30" json:"traffic_reset_days"`
+
+	// 可用节点的最高倍率（0表示不限制），超过该倍率的节点不会下发到订阅
+	MaxNodeMultiplier float64 `gorm:"default:0" json:"max_node_multiplier"`
+
+	// 同时在线 IP 数上限（0 表示不限制），由节点上报的在线 IP 在滑动窗口内统计
+	MaxOnlineIPs int `gorm:"default:0" json:"max_online_ips"`
+
+	// Clash 配置模板（为空时按用户等级或默认模板）
+	ClashTemplateID *uint `gorm:"index" json:"clash_template_id,omitempty"`
+
 	// 关系
 	Orders        []Order        `gorm:"foreignKey:PackageID" json:"-"`
 	Subscriptions []Subscription `gorm:"foreignKey:PackageID" json:"-"`
+	NodeGroups    []NodeGroup    `gorm:"many2many:package_node_groups;" json:"-"`
 }
 
 // TableName 指定表名
@@ -20,6 +20,19 @@ type Subscription struct {
 	CreatedAt       time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 
+	// 流量配额相关（单位：字节，TrafficLimit 为0表示不限流量）
+	TrafficLimit     int64      `gorm:"default:0" json:"traffic_limit"`
+	UploadTraffic    int64      `gorm:"default:0" json:"upload_traffic"`
+	DownloadTraffic  int64      `gorm:"default:0" json:"download_traffic"`
+	TrafficResetMode string     `gorm:"type:varchar(20);default:none" json:"traffic_reset_mode"` // none, monthly, periodic
+	TrafficResetDays int        `gorm:"default:30" json:"traffic_reset_days"`                    // periodic 模式下的重置周期（天）
+	TrafficResetAt   *time.Time `json:"traffic_reset_at,omitempty"`                              // 上次流量重置时间
+
+	// 自建节点使用的代理凭据（UUID，同时作为 Trojan、Shadowsocks 等协议的密码），重置订阅时更换
+	ProxyUUID string `gorm:"type:varchar(36);index" json:"-"`
+	// Shadowsocks 2022 用户密钥（随机 32 字节，Base64），与 UUID 一起更换
+	ProxyKey string `gorm:"type:varchar(64)" json:"-"`
+
 	// 关系
 	User    User                `gorm:"foreignKey:UserID" json:"-"`
 	Package Package             `gorm:"foreignKey:PackageID" json:"-"`
@@ -32,6 +45,16 @@ func (Subscription) TableName() string {
 	return "subscriptions"
 }
 
+// UsedTraffic 已用流量（上传+下载）
+func (s *Subscription) UsedTraffic() int64 {
+	return s.UploadTraffic + s.DownloadTraffic
+}
+
+// IsTrafficExhausted 流量是否已用尽（不限流量时始终返回 false）
+func (s *Subscription) IsTrafficExhausted() bool {
+	return s.TrafficLimit > 0 && s.UsedTraffic() >= s.TrafficLimit
+}
+
 // SubscriptionReset 订阅重置记录
 type SubscriptionReset struct {
 	ID                 uint      `gorm:"primaryKey" json:"id"`
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// TrafficLog 节点上报的用户流量记录
+type TrafficLog struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	UserID         uint      `gorm:"index;not null" json:"user_id"`
+	SubscriptionID uint      `gorm:"index;not null" json:"subscription_id"`
+	NodeID         *uint     `gorm:"index" json:"node_id,omitempty"`
+	Upload         int64     `gorm:"default:0" json:"upload"`
+	Download       int64     `gorm:"default:0" json:"download"`
+	Multiplier     float64   `gorm:"default:1" json:"multiplier"` // 计费倍率，计入订阅的流量 = 原始流量 × 倍率
+	CreatedAt      time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (TrafficLog) TableName() string {
+	return "traffic_logs"
+}
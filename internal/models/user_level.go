@@ -21,8 +21,12 @@ type UserLevel struct {
 	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 
+	// Clash 配置模板（为空时使用默认模板）
+	ClashTemplateID *uint `gorm:"index" json:"clash_template_id,omitempty"`
+
 	// 关系
-	Users []User `gorm:"foreignKey:UserLevelID" json:"-"`
+	Users      []User      `gorm:"foreignKey:UserLevelID" json:"-"`
+	NodeGroups []NodeGroup `gorm:"many2many:user_level_node_groups;" json:"-"`
 }
 
 // TableName 指定表名
@@ -44,6 +48,8 @@ type UserLevelResponse struct {
 	IsActive       bool      `json:"is_active"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
+
+	ClashTemplateID *uint `json:"clash_template_id,omitempty"`
 }
 
 // ToUserLevelResponse 将UserLevel转换为UserLevelResponse
@@ -59,6 +65,8 @@ func (ul *UserLevel) ToUserLevelResponse() UserLevelResponse {
 		IsActive:       ul.IsActive,
 		CreatedAt:      ul.CreatedAt,
 		UpdatedAt:      ul.UpdatedAt,
+
+		ClashTemplateID: ul.ClashTemplateID,
 	}
 
 	if ul.Benefits.Valid {
@@ -0,0 +1,391 @@
+package config_update
+
+import (
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultClashTemplate 内置 Clash 配置模板（未配置自定义模板时使用）
+//
+// 模板可用数据：
+//   - .Proxies      已渲染的 proxies 列表（YAML，每项缩进 2 格）
+//   - .ProxyNames   全部节点名称
+//   - .Regions      按地区分组的节点（.Name 地区名称，.GroupName 分组名称，.ProxyNames 该地区节点名称）
+//   - .RegionGroups 启用地区分组时同 .Regions，否则为空
+//   - .RegionGroupType  地区分组类型（url-test / fallback）
+//   - .SelectProxies    节点选择组的成员（启用地区分组时为地区分组、手动选择组和未识别地区的节点）
+//   - .SelectGroup  节点选择组名称，.AutoGroup 自动选择组名称，.ManualGroup 手动选择组名称，.TestURL 测速地址
+//
+// 模板函数：
+//   - list N names       输出缩进 N 格的 YAML 列表（列表为空时输出 DIRECT，避免空代理组）
+//   - quote s            按需为 YAML 字符串加引号
+//   - filter re names    保留名称匹配正则的节点
+//   - exclude re names   去除名称匹配正则的节点
+const DefaultClashTemplate = `port: 7890
+socks-port: 7891
+allow-lan: true
+mode: Rule
+log-level: info
+external-controller: 127.0.0.1:9090
+
+proxies:
+{{ .Proxies }}
+
+proxy-groups:
+  - name: {{ quote .SelectGroup }}
+    type: select
+    proxies:
+      - {{ quote .AutoGroup }}
+{{ list 6 .SelectProxies }}
+  - name: {{ quote .AutoGroup }}
+    type: url-test
+    url: {{ .TestURL }}
+    interval: 300
+    tolerance: 50
+    proxies:
+{{ list 6 .ProxyNames }}
+{{- if .RegionGroups }}
+  - name: {{ quote .ManualGroup }}
+    type: select
+    proxies:
+{{ list 6 .ProxyNames }}
+{{- end }}
+{{- range .RegionGroups }}
+  - name: {{ quote .GroupName }}
+    type: {{ $.RegionGroupType }}
+    url: {{ $.TestURL }}
+    interval: 300
+{{- if eq $.RegionGroupType "url-test" }}
+    tolerance: 50
+{{- end }}
+    proxies:
+{{ list 6 .ProxyNames }}
+{{- end }}
+
+rules:
+  - DOMAIN-SUFFIX,local,DIRECT
+  - IP-CIDR,127.0.0.0/8,DIRECT
+  - IP-CIDR,172.16.0.0/12,DIRECT
+  - IP-CIDR,192.168.0.0/16,DIRECT
+  - GEOIP,CN,DIRECT
+  - MATCH,{{ .SelectGroup }}
+`
+
+// ClashTemplateData Clash 模板渲染数据
+type ClashTemplateData struct {
+	Proxies         string
+	ProxyNames      []string
+	Regions         []ClashTemplateRegion
+	RegionGroups    []ClashTemplateRegion
+	RegionGroupType string
+	SelectProxies   []string
+	SelectGroup     string
+	AutoGroup       string
+	ManualGroup     string
+	TestURL         string
+}
+
+// ClashTemplateRegion 按地区分组的节点名称
+type ClashTemplateRegion struct {
+	Name       string
+	GroupName  string
+	ProxyNames []string
+}
+
+// clashBuiltinTargets 代理组中无需定义即可引用的内置策略
+var clashBuiltinTargets = map[string]bool{
+	"DIRECT":      true,
+	"REJECT":      true,
+	"REJECT-DROP": true,
+	"PASS":        true,
+	"COMPATIBLE":  true,
+}
+
+// clashTemplateFuncs 模板函数
+func (s *ConfigUpdateService) clashTemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"list": func(indent int, names []string) string {
+			if len(names) == 0 {
+				names = []string{"DIRECT"}
+			}
+			prefix := strings.Repeat(" ", indent) + "- "
+			lines := make([]string, 0, len(names))
+			for _, name := range names {
+				lines = append(lines, prefix+s.escapeYAMLString(name))
+			}
+			return strings.Join(lines, "\n")
+		},
+		"quote": s.escapeYAMLString,
+		"filter": func(pattern string, names []string) ([]string, error) {
+			return filterNames(pattern, names, true)
+		},
+		"exclude": func(pattern string, names []string) ([]string, error) {
+			return filterNames(pattern, names, false)
+		},
+	}
+}
+
+// filterNames 按正则筛选节点名称，keep 为 false 时去除匹配项
+func filterNames(pattern string, names []string, keep bool) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("无效的正则表达式 %q: %v", pattern, err)
+	}
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		if re.MatchString(name) == keep {
+			result = append(result, name)
+		}
+	}
+	return result, nil
+}
+
+// buildClashTemplateData 生成模板数据，proxies 需已过滤并保证名称唯一
+func (s *ConfigUpdateService) buildClashTemplateData(proxies []*ProxyNode) *ClashTemplateData {
+	data := &ClashTemplateData{
+		RegionGroupType: s.regionGroupType,
+		SelectGroup:     groupSelectName,
+		AutoGroup:       groupAutoName,
+		ManualGroup:     groupManualName,
+		TestURL:         groupTestURL,
+	}
+	if data.RegionGroupType == "" {
+		data.RegionGroupType = RegionGroupURLTest
+	}
+
+	var builder strings.Builder
+	for _, proxy := range proxies {
+		builder.WriteString(s.nodeToYAML(proxy, 2))
+		data.ProxyNames = append(data.ProxyNames, proxy.Name)
+	}
+	data.Proxies = strings.TrimRight(builder.String(), "\n")
+
+	regions, ungrouped := s.groupProxiesByRegion(proxies, s.regionPriority)
+	data.Regions = regions
+	data.SelectProxies = data.ProxyNames
+	if s.regionGroups && len(regions) > 0 {
+		data.RegionGroups = regions
+		data.SelectProxies = make([]string, 0, len(regions)+1+len(ungrouped))
+		for _, region := range regions {
+			data.SelectProxies = append(data.SelectProxies, region.GroupName)
+		}
+		data.SelectProxies = append(data.SelectProxies, groupManualName)
+		data.SelectProxies = append(data.SelectProxies, ungrouped...)
+	}
+
+	return data
+}
+
+// executeClashTemplate 渲染 Clash 模板
+func (s *ConfigUpdateService) executeClashTemplate(content string, data *ClashTemplateData) (string, error) {
+	tmpl, err := template.New("clash").Funcs(s.clashTemplateFuncs()).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("模板语法错误: %v", err)
+	}
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, data); err != nil {
+		return "", fmt.Errorf("模板渲染失败: %v", err)
+	}
+	return builder.String(), nil
+}
+
+// validateClashConfig 校验渲染结果是合法的 Clash 配置（YAML 结构、代理组引用）
+func validateClashConfig(config string) error {
+	var cfg struct {
+		Proxies []struct {
+			Name string `yaml:"name"`
+		} `yaml:"proxies"`
+		ProxyGroups []struct {
+			Name    string   `yaml:"name"`
+			Type    string   `yaml:"type"`
+			Proxies []string `yaml:"proxies"`
+			Use     []string `yaml:"use"`
+			Filter  string   `yaml:"filter"`
+		} `yaml:"proxy-groups"`
+		ProxyProviders map[string]interface{} `yaml:"proxy-providers"`
+		Rules          []string               `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal([]byte(config), &cfg); err != nil {
+		return fmt.Errorf("YAML 格式错误: %v", err)
+	}
+	if len(cfg.ProxyGroups) == 0 {
+		return fmt.Errorf("缺少 proxy-groups")
+	}
+	if len(cfg.Rules) == 0 {
+		return fmt.Errorf("缺少 rules")
+	}
+
+	known := make(map[string]bool)
+	for _, p := range cfg.Proxies {
+		known[p.Name] = true
+	}
+	for _, g := range cfg.ProxyGroups {
+		if g.Name == "" {
+			return fmt.Errorf("存在未命名的代理组")
+		}
+		if known[g.Name] {
+			return fmt.Errorf("代理组名称重复: %s", g.Name)
+		}
+		known[g.Name] = true
+	}
+	for _, g := range cfg.ProxyGroups {
+		if g.Type == "" {
+			return fmt.Errorf("代理组 %s 缺少 type", g.Name)
+		}
+		if len(g.Proxies) == 0 && len(g.Use) == 0 {
+			return fmt.Errorf("代理组 %s 没有可用节点", g.Name)
+		}
+		for _, name := range g.Proxies {
+			if !known[name] && !clashBuiltinTargets[name] {
+				return fmt.Errorf("代理组 %s 引用了不存在的节点或代理组: %s", g.Name, name)
+			}
+		}
+		for _, provider := range g.Use {
+			if _, ok := cfg.ProxyProviders[provider]; !ok {
+				return fmt.Errorf("代理组 %s 引用了不存在的 proxy-provider: %s", g.Name, provider)
+			}
+		}
+	}
+	for _, rule := range cfg.Rules {
+		if target := ruleTarget(rule); target != "" && !known[target] && !clashBuiltinTargets[target] {
+			return fmt.Errorf("规则 %s 引用了不存在的代理组: %s", rule, target)
+		}
+	}
+	return nil
+}
+
+// ruleTarget 解析规则的目标策略（如 "DOMAIN-SUFFIX,google.com,🚀 节点选择,no-resolve" 返回 "🚀 节点选择"）
+func ruleTarget(rule string) string {
+	parts := strings.Split(rule, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	if len(parts) > 2 && parts[len(parts)-1] == "no-resolve" {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[len(parts)-1]
+}
+
+// renderClashTemplate 使用指定模板渲染并校验配置，content 为空时使用内置模板
+func (s *ConfigUpdateService) renderClashTemplate(content string, proxies []*ProxyNode) (string, error) {
+	if strings.TrimSpace(content) == "" {
+		content = DefaultClashTemplate
+	}
+	config, err := s.executeClashTemplate(content, s.buildClashTemplateData(proxies))
+	if err != nil {
+		return "", err
+	}
+	if err := validateClashConfig(config); err != nil {
+		return "", err
+	}
+	return config, nil
+}
+
+// PreviewClashTemplate 使用当前启用的节点（无节点时使用示例节点）预览模板渲染结果，模板无效时返回错误
+func (s *ConfigUpdateService) PreviewClashTemplate(content string) (string, error) {
+	var proxies []*ProxyNode
+	if s.db != nil {
+		var nodes []models.Node
+		if err := s.db.Where("is_active = ?", true).Order("order_index ASC, id ASC").Find(&nodes).Error; err == nil {
+			for i := range nodes {
+				if parsed, err := s.parseNodeToProxies(&nodes[i]); err == nil {
+					proxies = append(proxies, parsed...)
+				}
+			}
+		}
+	}
+	if len(proxies) == 0 {
+		proxies = sampleClashTemplateNodes()
+	}
+
+	filtered := make([]*ProxyNode, 0, len(proxies))
+	usedNames := make(map[string]bool)
+	for _, proxy := range proxies {
+		if !supportedClashTypes[proxy.Type] {
+			continue
+		}
+		proxy.Name = uniqueYAMLName(proxy.Name, usedNames)
+		filtered = append(filtered, proxy)
+	}
+
+	return s.renderClashTemplate(content, filtered)
+}
+
+// sampleClashTemplateNodes 模板预览用的示例节点
+func sampleClashTemplateNodes() []*ProxyNode {
+	return []*ProxyNode{
+		{Name: "🇭🇰 香港 01", Type: "ss", Server: "hk.example.com", Port: 8388, Cipher: "aes-128-gcm", Password: "password", UDP: true},
+		{Name: "🇯🇵 日本 01", Type: "trojan", Server: "jp.example.com", Port: 443, Password: "password", UDP: true},
+		{Name: "🇺🇸 美国 01", Type: "vmess", Server: "us.example.com", Port: 443, UUID: "00000000-0000-0000-0000-000000000000", Cipher: "auto", TLS: true},
+	}
+}
+
+// uniqueYAMLName 生成唯一的节点名称（重名时追加序号）
+func uniqueYAMLName(name string, usedNames map[string]bool) string {
+	result := name
+	counter := 1
+	for usedNames[result] {
+		result = fmt.Sprintf("%s_%d", name, counter)
+		counter++
+	}
+	usedNames[result] = true
+	return result
+}
+
+// loadClashTemplate 按 套餐 > 用户等级 > 默认模板 的优先级查找订阅使用的模板内容，未配置时返回空字符串
+func (s *ConfigUpdateService) loadClashTemplate(ctx *SubscriptionContext) string {
+	if s.db == nil {
+		return ""
+	}
+
+	findActive := func(id *uint) string {
+		if id == nil || *id == 0 {
+			return ""
+		}
+		var tpl models.ClashTemplate
+		if err := s.db.Where("id = ? AND is_active = ?", *id, true).First(&tpl).Error; err != nil {
+			return ""
+		}
+		return tpl.Content
+	}
+
+	if ctx.Subscription.PackageID != nil && *ctx.Subscription.PackageID > 0 {
+		var pkg models.Package
+		if err := s.db.Select("id", "clash_template_id").First(&pkg, *ctx.Subscription.PackageID).Error; err == nil {
+			if content := findActive(pkg.ClashTemplateID); content != "" {
+				return content
+			}
+		}
+	}
+
+	if ctx.User.UserLevelID.Valid && ctx.User.UserLevelID.Int64 > 0 {
+		var level models.UserLevel
+		if err := s.db.Select("id", "clash_template_id").First(&level, ctx.User.UserLevelID.Int64).Error; err == nil {
+			if content := findActive(level.ClashTemplateID); content != "" {
+				return content
+			}
+		}
+	}
+
+	var tpl models.ClashTemplate
+	if err := s.db.Where("is_default = ? AND is_active = ?", true, true).Order("id ASC").First(&tpl).Error; err == nil {
+		return tpl.Content
+	}
+	return ""
+}
+
+// logClashTemplateFallback 记录自定义模板渲染失败并回退到内置模板
+func logClashTemplateFallback(err error) {
+	if utils.AppLogger != nil {
+		utils.AppLogger.Warn("Clash 模板渲染失败，已回退到内置模板: %v", err)
+	}
+}
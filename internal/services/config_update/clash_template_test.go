@@ -0,0 +1,98 @@
+package config_update
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRenderDefaultClashTemplate 测试内置模板渲染结果可通过校验
+func TestRenderDefaultClashTemplate(t *testing.T) {
+	s := &ConfigUpdateService{}
+	cfg := s.renderClashStyleYAML(testRendererNodes(t), supportedClashTypes)
+
+	if err := validateClashConfig(cfg); err != nil {
+		t.Fatalf("内置模板渲染结果校验失败: %v\n%s", err, cfg)
+	}
+	if !strings.Contains(cfg, "port: 7890") || !strings.Contains(cfg, "  - MATCH,"+groupSelectName) {
+		t.Errorf("内置模板内容错误:\n%s", cfg)
+	}
+}
+
+// TestCustomClashTemplate 测试自定义模板的函数与回退
+func TestCustomClashTemplate(t *testing.T) {
+	s := &ConfigUpdateService{}
+	s.clashTemplate = `proxies:
+{{ .Proxies }}
+proxy-groups:
+  - name: 流媒体
+    type: select
+    proxies:
+{{ list 6 (filter "香港|日本" .ProxyNames) }}
+  - name: 其他
+    type: select
+    proxies:
+{{ list 6 (filter "不存在" .ProxyNames) }}
+rules:
+  - DOMAIN-SUFFIX,netflix.com,流媒体
+  - MATCH,DIRECT
+`
+	cfg := s.renderClashStyleYAML(testRendererNodes(t), supportedClashTypes)
+	if !strings.Contains(cfg, "      - 日本-Reality\n") || strings.Contains(cfg, "      - 美国-Trojan\n") {
+		t.Errorf("filter 筛选结果错误:\n%s", cfg)
+	}
+	if !strings.Contains(cfg, "    proxies:\n      - DIRECT\n") {
+		t.Errorf("空节点列表应输出 DIRECT:\n%s", cfg)
+	}
+
+	// 引用不存在的代理组时回退到内置模板
+	s.clashTemplate = strings.Replace(s.clashTemplate, "MATCH,DIRECT", "MATCH,不存在的组", 1)
+	cfg = s.renderClashStyleYAML(testRendererNodes(t), supportedClashTypes)
+	if !strings.Contains(cfg, "port: 7890") {
+		t.Errorf("无效模板应回退到内置模板:\n%s", cfg)
+	}
+}
+
+// TestPreviewClashTemplateErrors 测试模板校验错误
+func TestPreviewClashTemplateErrors(t *testing.T) {
+	s := &ConfigUpdateService{}
+	if _, err := s.PreviewClashTemplate("{{ .Unknown }}"); err == nil {
+		t.Error("引用不存在的字段应返回错误")
+	}
+	if _, err := s.PreviewClashTemplate(`{{ filter "(" .ProxyNames }}`); err == nil {
+		t.Error("无效正则应返回错误")
+	}
+	if _, err := s.PreviewClashTemplate("proxies: [\n"); err == nil {
+		t.Error("无效 YAML 应返回错误")
+	}
+	if _, err := s.PreviewClashTemplate(DefaultClashTemplate); err != nil {
+		t.Errorf("内置模板预览失败: %v", err)
+	}
+}
+
+// TestRegionProxyGroups 测试按地区生成代理组及优先级排序
+func TestRegionProxyGroups(t *testing.T) {
+	s := &ConfigUpdateService{
+		regionGroups:    true,
+		regionGroupType: RegionGroupFallback,
+		regionPriority:  []string{"日本", "香港"},
+	}
+	nodes := testRendererNodes(t)
+	regions := []string{"香港", "日本", "美国", "新加坡", ""}
+	for i, node := range nodes {
+		node.Region = regions[i]
+	}
+	nodes = append(nodes, &ProxyNode{Name: "美国 02", Type: "ss", Server: "us2.example.com", Port: 8388, Cipher: "aes-128-gcm", Password: "p", Region: "美国"})
+
+	cfg := s.renderClashStyleYAML(nodes, supportedClashTypes)
+	if err := validateClashConfig(cfg); err != nil {
+		t.Fatalf("地区分组配置校验失败: %v\n%s", err, cfg)
+	}
+
+	selector := "    proxies:\n      - " + groupAutoName + "\n      - 🇯🇵 日本\n      - 🇭🇰 香港\n      - 🇺🇸 美国\n      - 🇸🇬 新加坡\n      - " + groupManualName + "\n      - 台湾-TUIC\n"
+	if !strings.Contains(cfg, selector) {
+		t.Errorf("节点选择组应按优先级引用地区分组:\n%s", cfg)
+	}
+	if !strings.Contains(cfg, "  - name: 🇺🇸 美国\n    type: fallback\n") || !strings.Contains(cfg, "      - 美国-Trojan\n      - 美国 02\n") {
+		t.Errorf("地区分组内容错误:\n%s", cfg)
+	}
+}
@@ -10,12 +10,14 @@ import (
 	"net/url"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/models"
+	"cboard-go/internal/services/traffic"
 	"cboard-go/internal/utils"
 
 	"gorm.io/gorm"
@@ -29,13 +31,14 @@ import (
 type SubscriptionStatus int
 
 const (
-	StatusNormal          SubscriptionStatus = iota
-	StatusExpired                            // 过期
-	StatusInactive                           // 失效（被禁用）
-	StatusAccountAbnormal                    // 账户异常（被禁用）
-	StatusDeviceOverLimit                    // 设备超限
-	StatusOldAddress                         // 旧订阅地址
-	StatusNotFound                           // 订阅不存在
+	StatusNormal           SubscriptionStatus = iota
+	StatusExpired                             // 过期
+	StatusInactive                            // 失效（被禁用）
+	StatusAccountAbnormal                     // 账户异常（被禁用）
+	StatusDeviceOverLimit                     // 设备超限
+	StatusOldAddress                          // 旧订阅地址
+	StatusNotFound                            // 订阅不存在
+	StatusTrafficExhausted                    // 流量已用尽
 )
 
 // 预编译正则表达式以提升性能
@@ -97,21 +100,46 @@ type SubscriptionContext struct {
 	DeviceLimit    int
 }
 
+// SubscriptionUserInfo 订阅响应头信息（subscription-userinfo 等），供客户端原生展示用量
+type SubscriptionUserInfo struct {
+	Upload         int64
+	Download       int64
+	Total          int64 // 0 表示不限流量
+	Expire         int64 // 到期时间（Unix 秒），0 表示无限期
+	UpdateInterval int   // profile-update-interval（小时）
+	FileName       string
+}
+
+// HeaderValue 生成 subscription-userinfo 响应头的值
+func (i *SubscriptionUserInfo) HeaderValue() string {
+	return fmt.Sprintf("upload=%d; download=%d; total=%d; expire=%d", i.Upload, i.Download, i.Total, i.Expire)
+}
+
 // ConfigUpdateService 配置更新服务
 type ConfigUpdateService struct {
-	db            *gorm.DB
-	isRunning     bool
-	runningMutex  sync.Mutex
-	siteURL       string         // 缓存站点URL，避免频繁查询
-	supportQQ     string         // 缓存客服QQ
-	regionMatcher *RegionMatcher // 地区匹配器（优化版）
-	parserPool    *ParserPool    // 解析器池（并发处理）
+	db              *gorm.DB
+	isRunning       bool
+	runningMutex    sync.Mutex
+	siteURL         string         // 缓存站点URL，避免频繁查询
+	supportQQ       string         // 缓存客服QQ
+	siteName        string         // 缓存站点名称（用于订阅文件名）
+	infoNodes       bool           // 是否在节点列表前插入信息节点
+	updateHours     int            // 客户端订阅自动更新间隔（小时）
+	clashTemplate   string         // 当前订阅使用的 Clash 模板内容（为空时使用内置模板）
+	regionGroups    bool           // 是否按地区生成代理组
+	regionGroupType string         // 地区分组类型（url-test / fallback）
+	regionPriority  []string       // 地区分组顺序
+	regionMatcher   *RegionMatcher // 地区匹配器（优化版）
+	preferGeoRegion bool           // 节点源更新时地区优先使用 GeoIP 解析结果
+	parserPool      *ParserPool    // 解析器池（并发处理）
 }
 
 // nodeWithOrder 用于排序导入
 type nodeWithOrder struct {
 	node       *ProxyNode
 	orderIndex int
+	multiplier float64  // 从名称中提取的倍率，0 表示未提取（按 1 倍计算）
+	geo        *NodeGeo // 服务器地理位置，未解析或解析失败时为空
 }
 
 // ==========================================
@@ -160,23 +188,107 @@ func (s *ConfigUpdateService) loadLegacyRegionMaps() {
 	// 不再需要，配置从 region_config.json 加载
 }
 
+// subscriptionSettings 订阅渲染使用的系统设置
+type subscriptionSettings struct {
+	siteURL         string
+	supportQQ       string
+	siteName        string
+	infoNodes       bool
+	updateHours     int
+	regionGroups    bool
+	regionGroupType string
+	regionPriority  []string
+}
+
+// settingsCacheTTL 系统设置缓存时间，保存设置时会通过 InvalidateSubscriptionCache 立即失效
+const settingsCacheTTL = time.Minute
+
+// settingsCache 进程内共享的系统设置缓存（按渲染缓存代数失效），避免每次请求订阅都查询系统设置
+var settingsCache struct {
+	mu       sync.Mutex
+	settings *subscriptionSettings
+	epoch    uint64
+	loadedAt time.Time
+}
+
 // refreshSystemConfig 刷新系统配置缓存
 func (s *ConfigUpdateService) refreshSystemConfig() {
+	epoch := renderCacheEpoch.Load()
+	settingsCache.mu.Lock()
+	settings := settingsCache.settings
+	if settings == nil || settingsCache.epoch != epoch || time.Since(settingsCache.loadedAt) > settingsCacheTTL {
+		settings = s.loadSubscriptionSettings()
+		settingsCache.settings, settingsCache.epoch, settingsCache.loadedAt = settings, epoch, time.Now()
+	}
+	settingsCache.mu.Unlock()
+
+	s.siteURL, s.supportQQ, s.siteName = settings.siteURL, settings.supportQQ, settings.siteName
+	s.infoNodes, s.updateHours = settings.infoNodes, settings.updateHours
+	s.regionGroups, s.regionGroupType, s.regionPriority = settings.regionGroups, settings.regionGroupType, settings.regionPriority
+}
+
+// loadSubscriptionSettings 从数据库读取订阅渲染使用的系统设置
+func (s *ConfigUpdateService) loadSubscriptionSettings() *subscriptionSettings {
+	st := &subscriptionSettings{}
+
 	// 获取网站域名（使用公共函数）
 	domain := utils.GetDomainFromDB(s.db)
 	if domain != "" {
-		s.siteURL = utils.FormatDomainURL(domain)
+		st.siteURL = utils.FormatDomainURL(domain)
 	} else {
-		s.siteURL = "请在系统设置中配置域名"
+		st.siteURL = "请在系统设置中配置域名"
 	}
 
 	// 获取客服QQ（只从 category = "general" 获取）
 	var supportQQConfig models.SystemConfig
 	if err := s.db.Where("key = ? AND category = ?", "support_qq", "general").First(&supportQQConfig).Error; err == nil && supportQQConfig.Value != "" {
-		s.supportQQ = strings.TrimSpace(supportQQConfig.Value)
-	} else {
-		s.supportQQ = "" // 不设置默认值，如果未配置则为空
+		st.supportQQ = strings.TrimSpace(supportQQConfig.Value)
+	}
+
+	// 获取站点名称（先 general 后 system）
+	st.siteName = "CBoard"
+	var siteNameConfig models.SystemConfig
+	if err := s.db.Where("key = ? AND category = ?", "site_name", "general").First(&siteNameConfig).Error; err == nil && strings.TrimSpace(siteNameConfig.Value) != "" {
+		st.siteName = strings.TrimSpace(siteNameConfig.Value)
+	} else if err := s.db.Where("key = ? AND category = ?", "site_name", "system").First(&siteNameConfig).Error; err == nil && strings.TrimSpace(siteNameConfig.Value) != "" {
+		st.siteName = strings.TrimSpace(siteNameConfig.Value)
+	}
+
+	// 是否插入信息节点（默认开启）
+	st.infoNodes = true
+	var infoNodesConfig models.SystemConfig
+	if err := s.db.Where("key = ? AND category = ?", "subscription_info_nodes", "general").First(&infoNodesConfig).Error; err == nil {
+		st.infoNodes = infoNodesConfig.Value != "false" && infoNodesConfig.Value != "0"
+	}
+
+	// 订阅更新间隔（默认24小时）
+	st.updateHours = 24
+	var intervalConfig models.SystemConfig
+	if err := s.db.Where("key = ? AND category = ?", "subscription_update_interval", "general").First(&intervalConfig).Error; err == nil {
+		if hours, err := strconv.Atoi(strings.TrimSpace(intervalConfig.Value)); err == nil && hours > 0 {
+			st.updateHours = hours
+		}
+	}
+
+	// 地区分组（默认开启，url-test，按默认地区顺序）
+	st.regionGroups = true
+	var regionGroupsConfig models.SystemConfig
+	if err := s.db.Where("key = ? AND category = ?", "subscription_region_groups", "general").First(&regionGroupsConfig).Error; err == nil {
+		st.regionGroups = regionGroupsConfig.Value != "false" && regionGroupsConfig.Value != "0"
+	}
+	st.regionGroupType = RegionGroupURLTest
+	var regionTypeConfig models.SystemConfig
+	if err := s.db.Where("key = ? AND category = ?", "subscription_region_group_type", "general").First(&regionTypeConfig).Error; err == nil && strings.TrimSpace(regionTypeConfig.Value) == RegionGroupFallback {
+		st.regionGroupType = RegionGroupFallback
 	}
+	st.regionPriority = defaultRegionPriority
+	var priorityConfig models.SystemConfig
+	if err := s.db.Where("key = ? AND category = ?", "subscription_region_priority", "general").First(&priorityConfig).Error; err == nil {
+		if priority := parseRegionPriority(priorityConfig.Value); len(priority) > 0 {
+			st.regionPriority = priority
+		}
+	}
+	return st
 }
 
 // ==========================================
@@ -248,24 +360,8 @@ func (s *ConfigUpdateService) GetConfig() (map[string]interface{}, error) {
 	return s.getConfig()
 }
 
-// RunUpdateTask 执行配置更新任务
+// RunUpdateTask 执行配置更新任务：同步所有启用的节点源
 func (s *ConfigUpdateService) RunUpdateTask() error {
-	s.runningMutex.Lock()
-	if s.isRunning {
-		s.runningMutex.Unlock()
-		return fmt.Errorf("任务已在运行中")
-	}
-	s.isRunning = true
-	s.runningMutex.Unlock()
-
-	defer func() {
-		s.runningMutex.Lock()
-		s.isRunning = false
-		s.runningMutex.Unlock()
-	}()
-
-	s.log("INFO", "开始执行配置更新任务")
-
 	// 获取配置
 	config, err := s.getConfig()
 	if err != nil {
@@ -273,72 +369,19 @@ func (s *ConfigUpdateService) RunUpdateTask() error {
 		return err
 	}
 
-	urls := config["urls"].([]string)
-	if len(urls) == 0 {
-		msg := "未配置节点源URL"
-		s.log("ERROR", msg)
-		return fmt.Errorf("%s", msg)
-	}
-
-	s.log("INFO", fmt.Sprintf("获取到 %d 个节点源URL", len(urls)))
-
-	// 1. 获取节点
-	nodes, err := s.FetchNodesFromURLs(urls)
+	s.MigrateLegacySourceURLs()
+	sources, err := s.loadNodeSources()
 	if err != nil {
-		s.log("ERROR", fmt.Sprintf("获取节点失败: %v", err))
+		s.log("ERROR", fmt.Sprintf("获取节点源失败: %v", err))
 		return err
 	}
-
-	if len(nodes) == 0 {
-		msg := "未获取到有效节点"
-		s.log("WARN", msg)
+	if len(sources) == 0 {
+		msg := "未配置节点源URL"
+		s.log("ERROR", msg)
 		return fmt.Errorf("%s", msg)
 	}
 
-	s.log("INFO", fmt.Sprintf("共获取到 %d 个有效节点链接，准备入库", len(nodes)))
-
-	// 2. 解析节点并整理准备入库（包含关键词过滤）
-	filterKeywords := []string{}
-	if keywords, ok := config["filter_keywords"].([]string); ok {
-		filterKeywords = keywords
-	} else if keywordsStr, ok := config["filter_keywords"].(string); ok && keywordsStr != "" {
-		// 处理字符串格式的关键词（用换行符分隔）- 向后兼容
-		for _, kw := range strings.Split(keywordsStr, "\n") {
-			if kw = strings.TrimSpace(kw); kw != "" {
-				filterKeywords = append(filterKeywords, kw)
-			}
-		}
-	}
-
-	if len(filterKeywords) > 0 {
-		s.log("INFO", fmt.Sprintf("已配置 %d 个过滤关键词: %v，将过滤包含这些关键词的节点", len(filterKeywords), filterKeywords))
-	} else {
-		s.log("DEBUG", "未配置过滤关键词，将不过滤任何节点")
-	}
-
-	nodesWithOrder, stats := s.processFetchedNodes(urls, nodes, filterKeywords)
-
-	// 输出统计信息
-	if stats.parseFailed > 0 {
-		s.log("WARN", fmt.Sprintf("解析失败的节点: %d 个", stats.parseFailed))
-	}
-	if stats.filtered > 0 {
-		s.log("INFO", fmt.Sprintf("被关键词过滤的节点: %d 个", stats.filtered))
-	}
-	if stats.duplicates > 0 {
-		s.log("INFO", fmt.Sprintf("去重跳过的节点: %d 个", stats.duplicates))
-	}
-	if stats.invalidLinks > 0 {
-		s.log("WARN", fmt.Sprintf("无效链接的节点: %d 个", stats.invalidLinks))
-	}
-	s.log("INFO", fmt.Sprintf("成功解析并准备入库的节点: %d 个", len(nodesWithOrder)))
-
-	// 3. 入库
-	importedCount := s.importNodesToDatabaseWithOrder(nodesWithOrder)
-	s.updateLastUpdateTime()
-
-	s.log("SUCCESS", fmt.Sprintf("任务完成: 解析出 %d 个节点，成功入库/更新 %d 个", len(nodesWithOrder), importedCount))
-	return nil
+	return s.syncNodeSources(sources, config, true)
 }
 
 // ==========================================
@@ -347,120 +390,125 @@ func (s *ConfigUpdateService) RunUpdateTask() error {
 
 // updateStats 统计信息结构
 type updateStats struct {
-	parseFailed   int
-	duplicates    int
-	invalidLinks  int
-	missingSource int
-	filtered      int // 被关键词过滤的节点数量
+	parseFailed  int
+	duplicates   int
+	invalidLinks int
+	filtered     int // 被关键词过滤的节点数量
+
+	filteredNodes  []FilteredNode  // 被关键词过滤的节点
+	duplicateNodes []DuplicateNode // 与之前节点服务器、端口和凭据相同的重复节点
+}
+
+// parseSourceContent 解析节点源内容，支持 Clash YAML（proxies）、sing-box JSON（outbounds）
+// 和节点链接列表（可 Base64 编码），返回解析结果和识别出的格式
+func (s *ConfigUpdateService) parseSourceContent(sourceName string, content []byte) ([]ParseResult, string) {
+	if results, format, ok := ParseStructuredNodes(content); ok {
+		s.log("INFO", fmt.Sprintf("节点源 [%s] 识别为 %s 配置，包含 %d 个节点", sourceName, format, len(results)))
+		return results, format
+	}
+
+	decoded := TryDecodeNodeList(string(content))
+	links := s.extractNodeLinks(decoded)
+	s.logNodeTypeStats(sourceName, links)
+	// 使用 ParserPool 并发解析
+	return s.parserPool.ParseLinks(links), SourceFormatLinks
 }
 
-// processFetchedNodes 处理获取到的节点：分组、去重、排序、关键词过滤
-func (s *ConfigUpdateService) processFetchedNodes(urls []string, nodes []map[string]interface{}, filterKeywords []string) ([]nodeWithOrder, updateStats) {
+// processSourceLinks 处理单个节点源的解析结果：关键词过滤、节点规则、去重、添加名称前缀
+func (s *ConfigUpdateService) processSourceLinks(source *models.NodeSource, results []ParseResult, filterKeywords []string, rules *NodeRulePipeline, usedNames map[string]bool, stats *updateStats) []nodeWithOrder {
 	var nodesWithOrder []nodeWithOrder
-	stats := updateStats{}
 	seenKeys := make(map[string]bool)
-	usedNames := make(map[string]bool)
+	seenNodes := make(map[string]string) // 节点身份键 -> 首个节点名称
 
-	// 按订阅地址分组节点
-	nodesByURL := make(map[string][]map[string]interface{})
-	for _, nodeInfo := range nodes {
-		sourceURL, _ := nodeInfo["source_url"].(string)
-		if sourceURL == "" {
-			stats.missingSource++
-			continue
-		}
-		nodesByURL[sourceURL] = append(nodesByURL[sourceURL], nodeInfo)
-	}
+	nodeIndex := 0
+	counts := struct{ Processed, Failed, Filtered, Duplicate int }{}
 
-	// 按照订阅地址的顺序处理节点
-	for urlIndex, url := range urls {
-		urlNodes := nodesByURL[url]
-		if len(urlNodes) == 0 {
+	for _, result := range results {
+		link := result.Link
+
+		// 链接去重
+		if seenKeys[link] {
+			stats.duplicates++
+			counts.Duplicate++
 			continue
 		}
+		seenKeys[link] = true
 
-		s.log("INFO", fmt.Sprintf("开始处理订阅地址 [%d/%d] 的节点，共 %d 个链接", urlIndex+1, len(urls), len(urlNodes)))
-
-		// 提取所有链接
-		links := make([]string, 0, len(urlNodes))
-		linkToNodeInfo := make(map[string]map[string]interface{})
-		for _, nodeInfo := range urlNodes {
-			link, ok := nodeInfo["url"].(string)
-			if !ok {
-				stats.invalidLinks++
-				s.log("WARN", fmt.Sprintf("订阅地址 [%d/%d] 中发现无效链接（缺少url字段）", urlIndex+1, len(urls)))
-				continue
+		// 检查解析错误
+		if result.Err != nil {
+			stats.parseFailed++
+			counts.Failed++
+			if counts.Failed <= 10 {
+				s.log("WARN", fmt.Sprintf("解析失败 [节点源 %s, 链接索引 %d]: %v, 链接片段: %s",
+					source.Name, nodeIndex, result.Err, truncateString(link, 50)))
 			}
-			links = append(links, link)
-			linkToNodeInfo[link] = nodeInfo
+			continue
 		}
 
-		// 使用 ParserPool 并发解析
-		results := s.parserPool.ParseLinks(links)
-
-		nodeIndexInURL := 0
-		counts := struct{ Processed, Failed, Filtered, Duplicate int }{}
-
-		for _, result := range results {
-			link := result.Link
-
-			// 链接去重
-			if seenKeys[link] {
-				stats.duplicates++
-				counts.Duplicate++
-				continue
-			}
-			seenKeys[link] = true
-
-			// 检查解析错误
-			if result.Err != nil {
-				stats.parseFailed++
-				counts.Failed++
-				// 增强错误日志：记录更多上下文信息
-				if counts.Failed <= 10 { // 增加到10条，提供更多调试信息
-					s.log("WARN", fmt.Sprintf("解析失败 [订阅地址 %d/%d, 链接索引 %d]: %v, 链接片段: %s",
-						urlIndex+1, len(urls), nodeIndexInURL, result.Err, truncateString(link, 50)))
-				}
-				continue
-			}
+		if result.Node == nil {
+			stats.parseFailed++
+			counts.Failed++
+			s.log("WARN", fmt.Sprintf("解析返回空节点 [节点源 %s, 链接索引 %d]: %s",
+				source.Name, nodeIndex, truncateString(link, 50)))
+			continue
+		}
 
-			if result.Node == nil {
-				stats.parseFailed++
-				counts.Failed++
-				s.log("WARN", fmt.Sprintf("解析返回空节点 [订阅地址 %d/%d, 链接索引 %d]: %s",
-					urlIndex+1, len(urls), nodeIndexInURL, truncateString(link, 50)))
-				continue
-			}
+		// 解析结果来自解析缓存，复制后再修改名称
+		parsed := *result.Node
+		node := &parsed
 
-			node := result.Node
+		// 关键词过滤
+		if filtered, keyword := s.isNodeFiltered(node, filterKeywords); filtered {
+			stats.filtered++
+			counts.Filtered++
+			stats.filteredNodes = append(stats.filteredNodes, FilteredNode{Name: node.Name, Keyword: keyword})
+			s.log("DEBUG", fmt.Sprintf("节点被过滤 [节点源 %s]: %s (关键词: %s)", source.Name, node.Name, keyword))
+			continue
+		}
 
-			// 关键词过滤
-			if filtered, keyword := s.isNodeFiltered(node, filterKeywords); filtered {
-				stats.filtered++
-				counts.Filtered++
-				s.log("DEBUG", fmt.Sprintf("节点被过滤 [订阅地址 %d/%d]: %s (关键词: %s)",
-					urlIndex+1, len(urls), node.Name, keyword))
-				continue
-			}
+		// 节点规则：过滤、重命名、旗帜和倍率
+		ruleResult := rules.Apply(node, s.resolveRegion)
+		if ruleResult.Dropped {
+			stats.filtered++
+			counts.Filtered++
+			stats.filteredNodes = append(stats.filteredNodes, FilteredNode{Name: node.Name, Rule: ruleResult.Rule})
+			s.log("DEBUG", fmt.Sprintf("节点被过滤 [节点源 %s]: %s (%s)", source.Name, node.Name, ruleResult.Rule))
+			continue
+		}
+		node.Name = ruleResult.Name
+		multiplier := ruleResult.Multiplier
+		if multiplier == 0 {
+			multiplier = ExtractMultiplier(node.Name)
+		}
 
-			counts.Processed++
+		// 服务器、端口和凭据都相同的节点只保留第一个
+		identity := s.nodeIdentityKey(node)
+		if first, ok := seenNodes[identity]; ok {
+			stats.duplicates++
+			counts.Duplicate++
+			stats.duplicateNodes = append(stats.duplicateNodes, DuplicateNode{Name: node.Name, DuplicateOf: first})
+			continue
+		}
+		seenNodes[identity] = node.Name
 
-			// 名称去重和重命名
-			node.Name = s.ensureUniqueName(node.Name, usedNames)
-			usedNames[node.Name] = true
+		counts.Processed++
 
-			// 添加到结果列表
-			nodesWithOrder = append(nodesWithOrder, nodeWithOrder{
-				node:       node,
-				orderIndex: urlIndex*10000 + nodeIndexInURL,
-			})
-			nodeIndexInURL++
-		}
+		// 名称前缀、去重和重命名
+		node.Name = s.ensureUniqueName(source.NamePrefix+node.Name, usedNames)
+		usedNames[node.Name] = true
+		seenNodes[identity] = node.Name
 
-		s.log("INFO", fmt.Sprintf("订阅地址 [%d/%d] 完成: 成功=%d, 失败=%d, 过滤=%d, 重复=%d",
-			urlIndex+1, len(urls), counts.Processed, counts.Failed, counts.Filtered, counts.Duplicate))
+		nodesWithOrder = append(nodesWithOrder, nodeWithOrder{
+			node:       node,
+			orderIndex: source.SortOrder*10000 + nodeIndex,
+			multiplier: multiplier,
+		})
+		nodeIndex++
 	}
-	return nodesWithOrder, stats
+
+	s.log("INFO", fmt.Sprintf("节点源 [%s] 解析完成: 成功=%d, 失败=%d, 过滤=%d, 重复=%d",
+		source.Name, counts.Processed, counts.Failed, counts.Filtered, counts.Duplicate))
+	return nodesWithOrder
 }
 
 // isNodeFiltered 检查节点是否应被过滤
@@ -650,25 +698,36 @@ func (s *ConfigUpdateService) saveLogToDB(logEntry map[string]interface{}) {
 // FetchNodesFromURLs 从URL列表获取节点
 func (s *ConfigUpdateService) FetchNodesFromURLs(urls []string) ([]map[string]interface{}, error) {
 	var allNodes []map[string]interface{}
-	// 增加超时时间，特别是对于 GitHub Gist 等可能较慢的服务
-	client := &http.Client{
-		Timeout: 60 * time.Second, // 增加到 60 秒
-		Transport: &http.Transport{
-			DisableKeepAlives: false,
-			MaxIdleConns:      10,
-			IdleConnTimeout:   30 * time.Second,
-		},
-	}
+	client := newSourceHTTPClient()
 
 	for i, url := range urls {
 		s.log("INFO", fmt.Sprintf("正在下载节点源 [%d/%d]: %s", i+1, len(urls), url))
 
-		content, err := s.fetchURLContent(client, url)
+		content, err := s.fetchURLContent(client, url, nil)
 		if err != nil {
 			s.log("ERROR", fmt.Sprintf("获取节点源失败: %v", err))
 			continue
 		}
 
+		// Clash / sing-box 配置转换为节点链接
+		if results, format, ok := ParseStructuredNodes(content); ok {
+			count := 0
+			for _, result := range results {
+				if result.Node == nil {
+					continue
+				}
+				if link := s.nodeToLink(result.Node); link != "" {
+					allNodes = append(allNodes, map[string]interface{}{
+						"url":        link,
+						"source_url": url,
+					})
+					count++
+				}
+			}
+			s.log("INFO", fmt.Sprintf("从 %s 识别到 %s 配置，转换 %d 个节点链接", url, format, count))
+			continue
+		}
+
 		// 使用 node_parser.go 中的统一解码函数
 		decoded := TryDecodeNodeList(string(content))
 
@@ -693,8 +752,21 @@ func (s *ConfigUpdateService) FetchNodesFromURLs(urls []string) ([]map[string]in
 	return allNodes, nil
 }
 
-// fetchURLContent 下载单个 URL 内容（带重试）
-func (s *ConfigUpdateService) fetchURLContent(client *http.Client, url string) ([]byte, error) {
+// newSourceHTTPClient 创建下载节点源使用的 HTTP 客户端
+func newSourceHTTPClient() *http.Client {
+	// 增加超时时间，特别是对于 GitHub Gist 等可能较慢的服务
+	return &http.Client{
+		Timeout: 60 * time.Second, // 增加到 60 秒
+		Transport: &http.Transport{
+			DisableKeepAlives: false,
+			MaxIdleConns:      10,
+			IdleConnTimeout:   30 * time.Second,
+		},
+	}
+}
+
+// fetchURLContent 下载单个 URL 内容（带重试），headers 为节点源配置的额外请求头
+func (s *ConfigUpdateService) fetchURLContent(client *http.Client, url string, headers map[string]string) ([]byte, error) {
 	maxRetries := 3
 	retryDelay := 2 * time.Second
 
@@ -715,6 +787,9 @@ func (s *ConfigUpdateService) fetchURLContent(client *http.Client, url string) (
 			req.Header.Set("Connection", "keep-alive")
 		}
 		// 不设置 Accept-Encoding，让服务器决定是否压缩，避免解压问题
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
 
 		resp, err := client.Do(req)
 		if err != nil {
@@ -983,57 +1058,6 @@ func (s *ConfigUpdateService) generateNodeDedupKey(nodeType, server string, port
 // Database Operations
 // ==========================================
 
-// importNodesToDatabaseWithOrder 将节点导入到数据库的 nodes 表，并保存顺序索引
-func (s *ConfigUpdateService) importNodesToDatabaseWithOrder(nodesWithOrder []nodeWithOrder) int {
-	importedCount := 0
-
-	for _, item := range nodesWithOrder {
-		node := item.node
-		orderIndex := item.orderIndex
-
-		configJSON, _ := json.Marshal(node)
-		configStr := string(configJSON)
-
-		region := s.resolveRegion(node.Name, node.Server)
-
-		var existingNode models.Node
-		err := s.db.Where("type = ? AND name = ?", node.Type, node.Name).First(&existingNode).Error
-
-		if err == nil {
-			existingNode.Config = &configStr
-			existingNode.Status = "online"
-			existingNode.IsActive = true
-			existingNode.OrderIndex = orderIndex
-			existingNode.Region = region
-
-			if err := s.db.Save(&existingNode).Error; err == nil {
-				importedCount++
-			} else {
-				s.log("ERROR", fmt.Sprintf("更新节点失败: %s (%s), 错误: %v", node.Name, node.Type, err))
-			}
-		} else if errors.Is(err, gorm.ErrRecordNotFound) {
-			newNode := models.Node{
-				Name:       node.Name,
-				Type:       node.Type,
-				Status:     "online",
-				IsActive:   true,
-				IsManual:   false,
-				Config:     &configStr,
-				Region:     region,
-				OrderIndex: orderIndex,
-			}
-			if err := s.db.Create(&newNode).Error; err == nil {
-				importedCount++
-			} else {
-				s.log("ERROR", fmt.Sprintf("创建节点失败: %s (%s), 错误: %v", node.Name, node.Type, err))
-			}
-		} else {
-			s.log("ERROR", fmt.Sprintf("查询节点失败: %s (%s), 错误: %v", node.Name, node.Type, err))
-		}
-	}
-	return importedCount
-}
-
 // fetchProxiesForUser 获取用户的可用节点
 func (s *ConfigUpdateService) fetchProxiesForUser(user models.User, sub models.Subscription) ([]*ProxyNode, error) {
 	var proxies []*ProxyNode
@@ -1078,6 +1102,8 @@ func (s *ConfigUpdateService) fetchProxiesForUser(user models.User, sub models.S
 		// 获取普通节点
 		var nodes []models.Node
 		query := s.db.Model(&models.Node{}).Where("is_active = ?", true).Where("status != ?", "timeout")
+		query = s.applyNodeGroupFilter(query, user, sub)
+		query = s.applyMultiplierLimit(query, sub)
 
 		if err := query.Find(&nodes).Error; err != nil {
 			return nil, err
@@ -1089,6 +1115,19 @@ func (s *ConfigUpdateService) fetchProxiesForUser(user models.User, sub models.S
 				continue
 			}
 
+			// 自建节点使用订阅自己的凭据
+			if node.IsSelfHosted() {
+				if err := EnsureProxyCredentials(s.db, &sub); err != nil {
+					continue
+				}
+				if err := EnsureNodeProxyKey(s.db, &node); err != nil {
+					continue
+				}
+				for _, proxy := range proxyNodes {
+					applyProxyCredential(proxy, NodeCredential(&node, proxy, &sub))
+				}
+			}
+
 			for _, proxy := range proxyNodes {
 				// 使用统一的去重键生成函数
 				key := s.generateNodeDedupKey(proxy.Type, proxy.Server, proxy.Port)
@@ -1138,7 +1177,7 @@ func (s *ConfigUpdateService) fetchProxiesForUser(user models.User, sub models.S
 			if cn.Config != "" {
 				var proxyNode ProxyNode
 				if err := json.Unmarshal([]byte(cn.Config), &proxyNode); err == nil {
-					proxyNode.Name = displayName
+					proxyNode.Name = FormatMultiplierName(displayName, cn.Rate())
 					customProxies = append(customProxies, &proxyNode)
 				}
 			}
@@ -1156,22 +1195,23 @@ func (s *ConfigUpdateService) parseNodeToProxies(node *models.Node) ([]*ProxyNod
 	if node.Config != nil && *node.Config != "" {
 		var configProxy ProxyNode
 		if err := json.Unmarshal([]byte(*node.Config), &configProxy); err == nil {
-			configProxy.Name = node.Name
+			configProxy.Name = FormatMultiplierName(node.Name, node.Rate())
+			configProxy.Region = node.Region
 			return []*ProxyNode{&configProxy}, nil
 		}
 	}
 	return nil, fmt.Errorf("节点配置为空")
 }
 
-// getSubscriptionContext 获取订阅上下文
-func (s *ConfigUpdateService) getSubscriptionContext(token string, clientIP string, userAgent string) *SubscriptionContext {
+// checkSubscriptionContext 获取订阅上下文并检查订阅状态（不加载节点，节点由 loadContextProxies 加载）
+func (s *ConfigUpdateService) checkSubscriptionContext(token string, clientIP string, userAgent string) *SubscriptionContext {
 	ctx := &SubscriptionContext{
 		Status: StatusNotFound,
 	}
 
-	// 1. 查找订阅
+	// 1. 查找订阅（同一查询中关联用户）
 	var sub models.Subscription
-	if err := s.db.Where("subscription_url = ?", token).First(&sub).Error; err != nil {
+	if err := s.db.Joins("User").Where("subscriptions.subscription_url = ?", token).First(&sub).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			var reset models.SubscriptionReset
 			if err := s.db.Where("old_subscription_url = ?", token).First(&reset).Error; err == nil {
@@ -1184,9 +1224,9 @@ func (s *ConfigUpdateService) getSubscriptionContext(token string, clientIP stri
 	}
 	ctx.Subscription = sub
 
-	// 2. 查找用户
-	var user models.User
-	if err := s.db.First(&user, sub.UserID).Error; err != nil {
+	// 2. 订阅关联的用户
+	user := sub.User
+	if user.ID == 0 {
 		return ctx
 	}
 	ctx.User = user
@@ -1228,6 +1268,12 @@ func (s *ConfigUpdateService) getSubscriptionContext(token string, clientIP stri
 		}
 	}
 
+	// 检查流量配额
+	if sub.IsTrafficExhausted() {
+		ctx.Status = StatusTrafficExhausted
+		return ctx
+	}
+
 	// 4. 检查设备
 	var currentDevices int64
 	s.db.Model(&models.Device{}).Where("subscription_id = ? AND is_active = ?", sub.ID, true).Count(&currentDevices)
@@ -1253,16 +1299,18 @@ func (s *ConfigUpdateService) getSubscriptionContext(token string, clientIP stri
 		}
 	}
 
-	// 5. 获取节点
-	proxies, err := s.fetchProxiesForUser(user, sub)
+	ctx.Status = StatusNormal
+	return ctx
+}
+
+// loadContextProxies 加载订阅可用的节点
+func (s *ConfigUpdateService) loadContextProxies(ctx *SubscriptionContext) {
+	proxies, err := s.fetchProxiesForUser(ctx.User, ctx.Subscription)
 	if err != nil {
 		ctx.Proxies = []*ProxyNode{}
 	} else {
 		ctx.Proxies = proxies
 	}
-
-	ctx.Status = StatusNormal
-	return ctx
 }
 
 // UpdateSubscriptionConfig 更新订阅配置
@@ -1279,22 +1327,25 @@ func (s *ConfigUpdateService) UpdateSubscriptionConfig(subscriptionURL string) e
 // Config Generation
 // ==========================================
 
-// GenerateClashConfig 生成 Clash 配置
-func (s *ConfigUpdateService) GenerateClashConfig(token string, clientIP string, userAgent string) (string, error) {
-	nodes, err := s.prepareExportNodes(token, clientIP, userAgent)
-	if err != nil {
-		return "", err
-	}
-	return s.generateClashYAML(nodes), nil
+// GenerateClashConfig 生成 Clash 配置，同时返回订阅响应头信息（订阅不存在时为 nil）
+func (s *ConfigUpdateService) GenerateClashConfig(token string, clientIP string, userAgent string) (string, *SubscriptionUserInfo, error) {
+	return s.GenerateTargetConfig(token, clientIP, userAgent, TargetClash)
 }
 
-// GenerateUniversalConfig 生成通用订阅配置
-func (s *ConfigUpdateService) GenerateUniversalConfig(token string, clientIP string, userAgent string, format string) (string, error) {
-	nodes, err := s.prepareExportNodes(token, clientIP, userAgent)
+// GenerateUniversalConfig 生成通用订阅配置，同时返回订阅响应头信息（订阅不存在时为 nil）
+func (s *ConfigUpdateService) GenerateUniversalConfig(token string, clientIP string, userAgent string, format string) (string, *SubscriptionUserInfo, error) {
+	if format == "base64" {
+		return s.GenerateTargetConfig(token, clientIP, userAgent, TargetUniversal)
+	}
+	nodes, info, err := s.prepareExportNodes(token, clientIP, userAgent)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
+	return s.generateUniversalLinks(nodes, format), info, nil
+}
 
+// generateUniversalLinks 生成 Base64 编码的节点链接列表
+func (s *ConfigUpdateService) generateUniversalLinks(nodes []*ProxyNode, format string) string {
 	var links []string
 	for _, node := range nodes {
 		var link string
@@ -1308,97 +1359,80 @@ func (s *ConfigUpdateService) GenerateUniversalConfig(token string, clientIP str
 		}
 	}
 
-	return base64.StdEncoding.EncodeToString([]byte(strings.Join(links, "\n"))), nil
+	return base64.StdEncoding.EncodeToString([]byte(strings.Join(links, "\n")))
 }
 
 // prepareExportNodes 准备导出的节点列表（包含信息节点或错误节点）
-func (s *ConfigUpdateService) prepareExportNodes(token, clientIP, userAgent string) ([]*ProxyNode, error) {
+func (s *ConfigUpdateService) prepareExportNodes(token, clientIP, userAgent string) ([]*ProxyNode, *SubscriptionUserInfo, error) {
 	// 每次生成配置前都刷新系统配置，确保使用最新的域名设置
 	s.refreshSystemConfig()
 
-	ctx := s.getSubscriptionContext(token, clientIP, userAgent)
+	ctx := s.checkSubscriptionContext(token, clientIP, userAgent)
+	return s.exportNodes(ctx), s.buildUserInfo(ctx), nil
+}
+
+// exportNodes 根据订阅上下文生成导出节点：正常状态加载可用节点并按设置插入信息节点，否则生成错误节点
+func (s *ConfigUpdateService) exportNodes(ctx *SubscriptionContext) []*ProxyNode {
+	s.clashTemplate = s.loadClashTemplate(ctx)
 
 	if ctx.Status != StatusNormal {
-		return s.generateErrorNodes(ctx.Status, ctx), nil
+		return s.generateErrorNodes(ctx.Status, ctx)
 	}
 
-	return s.addInfoNodes(ctx.Proxies, ctx), nil
+	s.loadContextProxies(ctx)
+	if !s.infoNodes {
+		return ctx.Proxies
+	}
+	return s.addInfoNodes(ctx.Proxies, ctx)
+}
+
+// buildUserInfo 根据订阅上下文生成响应头信息
+func (s *ConfigUpdateService) buildUserInfo(ctx *SubscriptionContext) *SubscriptionUserInfo {
+	if ctx.Subscription.ID == 0 {
+		return nil
+	}
+	sub := &ctx.Subscription
+	info := &SubscriptionUserInfo{
+		Upload:         sub.UploadTraffic,
+		Download:       sub.DownloadTraffic,
+		Total:          sub.TrafficLimit,
+		UpdateInterval: s.updateHours,
+		FileName:       s.siteName,
+	}
+	if !sub.ExpireTime.IsZero() {
+		info.Expire = sub.ExpireTime.Unix()
+	}
+	return info
 }
 
 // generateClashYAML 生成 Clash YAML 配置
 func (s *ConfigUpdateService) generateClashYAML(proxies []*ProxyNode) string {
-	var builder strings.Builder
+	return s.renderClashStyleYAML(proxies, supportedClashTypes)
+}
 
-	// 过滤支持的节点
+// renderClashStyleYAML 生成 Clash 风格的 YAML 配置（Clash / Stash 共用），只保留 supported 中的节点类型
+// 优先使用订阅匹配到的自定义模板，模板无效时回退到内置模板
+func (s *ConfigUpdateService) renderClashStyleYAML(proxies []*ProxyNode, supported map[string]bool) string {
+	// 过滤支持的节点，并确保节点名称唯一
 	filteredProxies := make([]*ProxyNode, 0)
+	usedNames := make(map[string]bool)
 	for _, proxy := range proxies {
-		if supportedClashTypes[proxy.Type] {
+		if supported[proxy.Type] {
+			proxy.Name = uniqueYAMLName(proxy.Name, usedNames)
 			filteredProxies = append(filteredProxies, proxy)
 		}
 	}
 
-	// 基础配置
-	builder.WriteString("port: 7890\n")
-	builder.WriteString("socks-port: 7891\n")
-	builder.WriteString("allow-lan: true\n")
-	builder.WriteString("mode: Rule\n")
-	builder.WriteString("log-level: info\n")
-	builder.WriteString("external-controller: 127.0.0.1:9090\n\n")
-
-	builder.WriteString("proxies:\n")
-
-	// 确保节点名称唯一
-	usedNames := make(map[string]bool)
-	var proxyNames []string
-
-	for _, proxy := range filteredProxies {
-		originalName := proxy.Name
-		newName := originalName
-		counter := 1
-		for usedNames[newName] {
-			newName = fmt.Sprintf("%s_%d", originalName, counter)
-			counter++
-		}
-		proxy.Name = newName
-		usedNames[newName] = true
-
-		builder.WriteString(s.nodeToYAML(proxy, 2))
-		proxyNames = append(proxyNames, s.escapeYAMLString(proxy.Name))
-	}
-
-	// 代理组
-	builder.WriteString("\nproxy-groups:\n")
-
-	// 节点选择
-	builder.WriteString("  - name: \"🚀 节点选择\"\n")
-	builder.WriteString("    type: select\n")
-	builder.WriteString("    proxies:\n")
-	builder.WriteString("      - \"♻️ 自动选择\"\n")
-	for _, name := range proxyNames {
-		builder.WriteString(fmt.Sprintf("      - %s\n", name))
-	}
-
-	// 自动选择
-	builder.WriteString("  - name: \"♻️ 自动选择\"\n")
-	builder.WriteString("    type: url-test\n")
-	builder.WriteString("    url: http://www.gstatic.com/generate_204\n")
-	builder.WriteString("    interval: 300\n")
-	builder.WriteString("    tolerance: 50\n")
-	builder.WriteString("    proxies:\n")
-	for _, name := range proxyNames {
-		builder.WriteString(fmt.Sprintf("      - %s\n", name))
-	}
-
-	// 规则
-	builder.WriteString("\nrules:\n")
-	builder.WriteString("  - DOMAIN-SUFFIX,local,DIRECT\n")
-	builder.WriteString("  - IP-CIDR,127.0.0.0/8,DIRECT\n")
-	builder.WriteString("  - IP-CIDR,172.16.0.0/12,DIRECT\n")
-	builder.WriteString("  - IP-CIDR,192.168.0.0/16,DIRECT\n")
-	builder.WriteString("  - GEOIP,CN,DIRECT\n")
-	builder.WriteString("  - MATCH,🚀 节点选择\n")
-
-	return builder.String()
+	config, err := s.renderClashTemplate(s.clashTemplate, filteredProxies)
+	if err == nil {
+		return config
+	}
+	if s.clashTemplate != "" {
+		logClashTemplateFallback(err)
+	}
+	// 内置模板仅在节点名称异常时才会校验失败，此时仍输出渲染结果
+	config, _ = s.executeClashTemplate(DefaultClashTemplate, s.buildClashTemplateData(filteredProxies))
+	return config
 }
 
 // addInfoNodes 添加信息节点
@@ -1444,6 +1478,13 @@ func (s *ConfigUpdateService) generateErrorNodes(status SubscriptionStatus, ctx
 	case StatusNotFound:
 		reason = "订阅不存在"
 		solution = "请检查订阅链接是否正确，或重新复制"
+	case StatusTrafficExhausted:
+		reason = "流量已用尽"
+		sub := &ctx.Subscription
+		solution = fmt.Sprintf("已用 %s/%s，请前往官网购买流量", utils.FormatBytes(sub.UsedTraffic()), utils.FormatBytes(sub.TrafficLimit))
+		if next, ok := traffic.NextResetTime(sub); ok {
+			solution = fmt.Sprintf("已用 %s/%s，将于 %s 重置", utils.FormatBytes(sub.UsedTraffic()), utils.FormatBytes(sub.TrafficLimit), next.Format("2006-01-02"))
+		}
 	default:
 		reason = "账户异常"
 		solution = "检测到账户异常，请联系管理员"
@@ -1477,6 +1518,7 @@ func (s *ConfigUpdateService) createMessageNode(name string, password ...string)
 		Port:     1234,
 		Cipher:   "aes-128-gcm",
 		Password: pwd,
+		Region:   unknownRegion, // 信息节点不参与地区分组
 	}
 }
 
@@ -0,0 +1,111 @@
+package config_update
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+
+	"cboard-go/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ProxyCredential 订阅在自建节点上使用的凭据
+type ProxyCredential struct {
+	SubscriptionID uint   `json:"id"`
+	UUID           string `json:"uuid"`
+	Password       string `json:"password"`
+}
+
+// RotateProxyCredentials 为订阅生成新的代理凭据（旧凭据在节点后端下次拉取用户后失效），调用方负责保存订阅
+func RotateProxyCredentials(sub *models.Subscription) {
+	sub.ProxyUUID = uuid.New().String()
+	sub.ProxyKey = newProxyKey()
+}
+
+// EnsureProxyCredentials 订阅尚未生成代理凭据时生成并保存
+// 已有 UUID 但缺少 Shadowsocks 2022 密钥的订阅只补充密钥，不更换 UUID
+func EnsureProxyCredentials(db *gorm.DB, sub *models.Subscription) error {
+	if sub.ProxyUUID != "" && sub.ProxyKey != "" {
+		return nil
+	}
+	if sub.ProxyUUID == "" {
+		RotateProxyCredentials(sub)
+	} else {
+		sub.ProxyKey = newProxyKey()
+	}
+	return db.Model(&models.Subscription{}).Where("id = ?", sub.ID).
+		UpdateColumns(map[string]interface{}{"proxy_uuid": sub.ProxyUUID, "proxy_key": sub.ProxyKey}).Error
+}
+
+// EnsureNodeProxyKey 自建节点尚未生成 Shadowsocks 2022 服务端密钥时生成并保存
+func EnsureNodeProxyKey(db *gorm.DB, node *models.Node) error {
+	if node.ProxyKey != "" {
+		return nil
+	}
+	node.ProxyKey = newProxyKey()
+	return db.Model(&models.Node{}).Where("id = ?", node.ID).UpdateColumn("proxy_key", node.ProxyKey).Error
+}
+
+// newProxyKey 生成 32 字节随机密钥（Base64），按加密方式截取所需长度
+func newProxyKey() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// proxyKey 按加密方式的密钥长度截取保存的随机密钥，密钥缺失或无效时返回空
+func proxyKey(stored string, size int) string {
+	raw, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil || len(raw) < size {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(raw[:size])
+}
+
+// SS2022KeySize Shadowsocks 2022 加密方式的密钥长度，非 2022 加密返回 0
+func SS2022KeySize(cipher string) int {
+	switch cipher {
+	case "2022-blake3-aes-128-gcm":
+		return 16
+	case "2022-blake3-aes-256-gcm", "2022-blake3-chacha20-poly1305":
+		return 32
+	}
+	return 0
+}
+
+// SS2022ServerKey Shadowsocks 2022 服务端密钥，取节点保存的随机密钥（需先调用 EnsureNodeProxyKey）
+func SS2022ServerKey(node *models.Node, size int) string {
+	return proxyKey(node.ProxyKey, size)
+}
+
+// SS2022UserKey Shadowsocks 2022 用户密钥，取订阅保存的随机密钥
+func SS2022UserKey(sub *models.Subscription, size int) string {
+	return proxyKey(sub.ProxyKey, size)
+}
+
+// NodeCredential 订阅在指定自建节点上的凭据
+// 与 UniProxy 约定一致：UUID 同时作为密码；Shadowsocks 2022 客户端密码为 "服务端密钥:用户密钥"，
+// 两个密钥均为随机生成并保存的密钥
+func NodeCredential(node *models.Node, proxy *ProxyNode, sub *models.Subscription) ProxyCredential {
+	cred := ProxyCredential{SubscriptionID: sub.ID, UUID: sub.ProxyUUID, Password: sub.ProxyUUID}
+	if proxy.Type == "ss" {
+		if size := SS2022KeySize(proxy.Cipher); size > 0 {
+			cred.Password = SS2022ServerKey(node, size) + ":" + SS2022UserKey(sub, size)
+		}
+	}
+	return cred
+}
+
+// applyProxyCredential 将订阅凭据替换到自建节点的代理配置中
+func applyProxyCredential(proxy *ProxyNode, cred ProxyCredential) {
+	switch proxy.Type {
+	case "vmess", "vless":
+		proxy.UUID = cred.UUID
+	case "tuic":
+		proxy.UUID = cred.UUID
+		proxy.Password = cred.Password
+	default:
+		proxy.Password = cred.Password
+	}
+}
@@ -0,0 +1,65 @@
+package config_update
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"cboard-go/internal/models"
+)
+
+// TestNodeCredential 测试自建节点的订阅凭据替换
+func TestNodeCredential(t *testing.T) {
+	sub := &models.Subscription{ID: 7}
+	RotateProxyCredentials(sub)
+	if len(sub.ProxyUUID) != 36 {
+		t.Fatalf("代理凭据应为 UUID: %q", sub.ProxyUUID)
+	}
+	node := &models.Node{ID: 1, ProxyKey: newProxyKey()}
+
+	vless := &ProxyNode{Type: "vless", UUID: "upstream"}
+	applyProxyCredential(vless, NodeCredential(node, vless, sub))
+	if vless.UUID != sub.ProxyUUID {
+		t.Errorf("vless 应使用订阅 UUID: %s", vless.UUID)
+	}
+
+	trojan := &ProxyNode{Type: "trojan", Password: "upstream"}
+	applyProxyCredential(trojan, NodeCredential(node, trojan, sub))
+	if trojan.Password != sub.ProxyUUID {
+		t.Errorf("trojan 应使用订阅 UUID 作为密码: %s", trojan.Password)
+	}
+
+	ss := &ProxyNode{Type: "ss", Cipher: "2022-blake3-aes-128-gcm", Password: "upstream"}
+	applyProxyCredential(ss, NodeCredential(node, ss, sub))
+	serverKey, userKey, ok := strings.Cut(ss.Password, ":")
+	if !ok || serverKey != SS2022ServerKey(node, 16) || userKey != SS2022UserKey(sub, 16) {
+		t.Errorf("Shadowsocks 2022 密码应为 服务端密钥:用户密钥: %s", ss.Password)
+	}
+	for _, key := range []string{serverKey, userKey} {
+		raw, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(raw) != 16 {
+			t.Errorf("密钥应为 16 字节 Base64: %q", key)
+		}
+	}
+	if userKey == base64.StdEncoding.EncodeToString([]byte(sub.ProxyUUID[:16])) {
+		t.Error("用户密钥不应由 UUID 派生")
+	}
+	if other := (&models.Node{ID: 1, ProxyKey: newProxyKey()}); SS2022ServerKey(other, 16) == serverKey {
+		t.Error("服务端密钥应随机生成，不能由节点 ID 推算")
+	}
+
+	ss256 := &ProxyNode{Type: "ss", Cipher: "2022-blake3-aes-256-gcm"}
+	serverKey, userKey, _ = strings.Cut(NodeCredential(node, ss256, sub).Password, ":")
+	if raw, _ := base64.StdEncoding.DecodeString(serverKey); len(raw) != 32 {
+		t.Errorf("256 位加密的服务端密钥应为 32 字节: %q", serverKey)
+	}
+	if raw, _ := base64.StdEncoding.DecodeString(userKey); len(raw) != 32 {
+		t.Errorf("256 位加密的用户密钥应为 32 字节: %q", userKey)
+	}
+
+	oldUUID, oldKey := sub.ProxyUUID, sub.ProxyKey
+	RotateProxyCredentials(sub)
+	if sub.ProxyUUID == oldUUID || sub.ProxyKey == oldKey {
+		t.Error("重置后应生成新的凭据和密钥")
+	}
+}
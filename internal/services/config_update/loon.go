@@ -0,0 +1,145 @@
+package config_update
+
+import (
+	"fmt"
+	"strings"
+)
+
+// supportedLoonTypes Loon 支持的节点类型
+var supportedLoonTypes = map[string]bool{
+	"ss":        true,
+	"ssr":       true,
+	"vmess":     true,
+	"vless":     true,
+	"trojan":    true,
+	"hysteria2": true,
+}
+
+// generateLoonConfig 生成 Loon 配置（[General] / [Proxy] / [Proxy Group] / [Rule]）
+func (s *ConfigUpdateService) generateLoonConfig(proxies []*ProxyNode) string {
+	var builder strings.Builder
+
+	builder.WriteString("[General]\n")
+	builder.WriteString("ipv6 = false\n")
+	builder.WriteString("dns-server = system, 119.29.29.29, 223.5.5.5\n")
+	builder.WriteString(fmt.Sprintf("proxy-test-url = %s\n", groupTestURL))
+	builder.WriteString("skip-proxy = 127.0.0.1, 192.168.0.0/16, 10.0.0.0/8, 172.16.0.0/12, 100.64.0.0/10, localhost, *.local\n\n")
+
+	builder.WriteString("[Proxy]\n")
+	usedNames := make(map[string]bool)
+	var names []string
+	for _, proxy := range proxies {
+		if !supportedLoonTypes[proxy.Type] {
+			continue
+		}
+		params := s.loonProxyParams(proxy)
+		if params == "" {
+			continue
+		}
+		name := uniqueININame(proxy.Name, usedNames)
+		builder.WriteString(fmt.Sprintf("%s = %s\n", name, params))
+		names = append(names, name)
+	}
+	builder.WriteString("\n")
+
+	writeINIProxyGroups(&builder, names)
+	builder.WriteString("\n")
+	writeINIRules(&builder)
+
+	return builder.String()
+}
+
+// loonProxyParams 生成 Loon [Proxy] 行等号右侧的参数，无法表示的节点返回空字符串
+func (s *ConfigUpdateService) loonProxyParams(node *ProxyNode) string {
+	opts := node.Options
+	if opts == nil {
+		opts = make(map[string]interface{})
+	}
+	transportOpts := TransportOptsFromMap(opts)
+
+	// Loon 仅支持 tcp / ws 传输
+	if node.Network != "" && node.Network != "tcp" && node.Network != "ws" {
+		return ""
+	}
+	if transportOpts.WSOpts != nil && transportOpts.WSOpts.V2rayHTTPUpgrade {
+		return ""
+	}
+
+	port := fmt.Sprint(node.Port)
+	var parts []string
+	switch node.Type {
+	case "ss":
+		parts = append(parts, "Shadowsocks", node.Server, port, node.Cipher, quoteINIValue(node.Password), "udp=true")
+	case "ssr":
+		parts = append(parts, "ShadowsocksR", node.Server, port, node.Cipher, quoteINIValue(node.Password),
+			"protocol="+getString(opts, "protocol", "origin"),
+			"protocol-param="+getString(opts, "protocol-param", ""),
+			"obfs="+getString(opts, "obfs", "plain"),
+			"obfs-param="+getString(opts, "obfs-param", ""))
+	case "vmess":
+		parts = append(parts, "vmess", node.Server, port, firstNotEmpty(node.Cipher, "auto"), quoteINIValue(node.UUID))
+		parts = append(parts, loonTransportParams(node.Network, transportOpts)...)
+		parts = append(parts, fmt.Sprintf("alterId=%d", getInt(opts, "alterId")))
+		if node.TLS {
+			parts = append(parts, "over-tls=true")
+			parts = append(parts, loonTLSParams(transportOpts)...)
+		}
+	case "vless":
+		parts = append(parts, "VLESS", node.Server, port, quoteINIValue(node.UUID))
+		parts = append(parts, loonTransportParams(node.Network, transportOpts)...)
+		if node.TLS || transportOpts.RealityOpts != nil {
+			parts = append(parts, "over-tls=true")
+			parts = append(parts, loonTLSParams(transportOpts)...)
+		}
+		if flow := getString(opts, "flow", ""); flow != "" {
+			parts = append(parts, "flow="+flow)
+		}
+		if transportOpts.RealityOpts != nil {
+			parts = append(parts, "public-key="+quoteINIValue(transportOpts.RealityOpts.PublicKey))
+			if transportOpts.RealityOpts.ShortID != "" {
+				parts = append(parts, "short-id="+transportOpts.RealityOpts.ShortID)
+			}
+		}
+	case "trojan":
+		parts = append(parts, "trojan", node.Server, port, quoteINIValue(node.Password))
+		parts = append(parts, loonTransportParams(node.Network, transportOpts)...)
+		parts = append(parts, loonTLSParams(transportOpts)...)
+		parts = append(parts, "udp=true")
+	case "hysteria2":
+		parts = append(parts, "Hysteria2", node.Server, port, quoteINIValue(node.Password))
+		parts = append(parts, loonTLSParams(transportOpts)...)
+		if down := parseMbps(getString(opts, "down", ""), 0); down > 0 {
+			parts = append(parts, fmt.Sprintf("download-bandwidth=%d", down))
+		}
+		parts = append(parts, "udp=true")
+	default:
+		return ""
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// loonTransportParams 生成 Loon 传输层参数
+func loonTransportParams(network string, transportOpts *TransportOpts) []string {
+	if network != "ws" {
+		return []string{"transport=tcp"}
+	}
+	params := []string{"transport=ws"}
+	if transportOpts.WSOpts != nil {
+		params = append(params, "path="+firstNotEmpty(transportOpts.WSOpts.Path, "/"))
+		if host := transportOpts.WSOpts.Headers["Host"]; host != "" {
+			params = append(params, "host="+host)
+		}
+	}
+	return params
+}
+
+// loonTLSParams 生成 Loon TLS 参数
+func loonTLSParams(transportOpts *TransportOpts) []string {
+	var params []string
+	if transportOpts.SNI != "" {
+		params = append(params, "tls-name="+transportOpts.SNI)
+	}
+	params = append(params, fmt.Sprintf("skip-cert-verify=%t", transportOpts.SkipCertVerify))
+	return params
+}
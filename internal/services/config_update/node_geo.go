@@ -0,0 +1,210 @@
+package config_update
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/geoip"
+)
+
+// 节点地区来源（系统设置 node_region_source）
+const (
+	RegionSourceName = "name" // 按节点名称和服务器地址中的关键词匹配（默认）
+	RegionSourceGeo  = "geo"  // 优先使用 GeoIP 解析结果，解析失败时按关键词匹配
+)
+
+// geoLookupTimeout 解析单个服务器域名的超时时间
+const geoLookupTimeout = 3 * time.Second
+
+// geoResolveWorkers 并发解析服务器地址的数量
+const geoResolveWorkers = 8
+
+// countryRegions 国家代码对应的地区名称（与 RegionMatcher 的地区名称保持一致）
+var countryRegions = map[string]string{
+	"HK": "香港", "TW": "台湾", "MO": "澳门", "JP": "日本", "SG": "新加坡", "US": "美国",
+	"KR": "韩国", "GB": "英国", "DE": "德国", "FR": "法国", "CA": "加拿大", "AU": "澳大利亚",
+	"CN": "中国", "RU": "俄罗斯", "IN": "印度", "NL": "荷兰", "TR": "土耳其", "BR": "巴西",
+	"AR": "阿根廷", "MY": "马来西亚", "TH": "泰国", "VN": "越南", "PH": "菲律宾", "ID": "印度尼西亚",
+	"IT": "意大利", "ES": "西班牙", "CH": "瑞士", "SE": "瑞典", "IE": "爱尔兰", "PL": "波兰",
+	"UA": "乌克兰", "AE": "阿联酋", "IL": "以色列", "ZA": "南非", "MX": "墨西哥", "NZ": "新西兰",
+}
+
+// NodeGeo 节点服务器的地理位置和 ASN
+type NodeGeo struct {
+	IP          string `json:"ip"`
+	Country     string `json:"country"`
+	CountryCode string `json:"country_code"`
+	City        string `json:"city,omitempty"`
+	ASN         uint   `json:"asn,omitempty"`
+	ASNOrg      string `json:"asn_org,omitempty"`
+}
+
+// Region 地理位置对应的地区名称
+func (g *NodeGeo) Region() string {
+	if g == nil {
+		return ""
+	}
+	if region, ok := countryRegions[strings.ToUpper(g.CountryCode)]; ok {
+		return region
+	}
+	return g.Country
+}
+
+// String 地理位置摘要，如 "JP 东京 AS2516 1.2.3.4"
+func (g *NodeGeo) String() string {
+	if g == nil {
+		return ""
+	}
+	parts := []string{g.CountryCode}
+	if g.City != "" {
+		parts = append(parts, g.City)
+	}
+	if g.ASN > 0 {
+		parts = append(parts, fmt.Sprintf("AS%d", g.ASN))
+	}
+	return strings.Join(append(parts, g.IP), " ")
+}
+
+// nodeGeoOf 读取数据库中保存的节点地理位置，未解析过时返回 nil
+func nodeGeoOf(node *models.Node) *NodeGeo {
+	if node.GeoCountryCode == "" {
+		return nil
+	}
+	return &NodeGeo{
+		IP:          node.GeoIP,
+		Country:     node.GeoCountry,
+		CountryCode: node.GeoCountryCode,
+		City:        node.GeoCity,
+		ASN:         node.GeoASN,
+		ASNOrg:      node.GeoASNOrg,
+	}
+}
+
+// geoResolver 解析服务器地址的地理位置，同一次节点源更新中按服务器地址缓存结果
+type geoResolver struct {
+	mu    sync.Mutex
+	cache map[string]*NodeGeo
+}
+
+// newGeoResolver 创建地理位置解析器，GeoIP 未启用时返回 nil（不解析）
+func newGeoResolver() *geoResolver {
+	if !geoip.IsEnabled() {
+		return nil
+	}
+	return &geoResolver{cache: make(map[string]*NodeGeo)}
+}
+
+// Resolve 解析服务器地址（域名先做 DNS 解析，优先使用 IPv4），失败时返回 nil
+func (r *geoResolver) Resolve(server string) *NodeGeo {
+	if r == nil {
+		return nil
+	}
+	server = strings.Trim(strings.TrimSpace(server), "[]")
+	if server == "" {
+		return nil
+	}
+	r.mu.Lock()
+	geo, ok := r.cache[server]
+	r.mu.Unlock()
+	if ok {
+		return geo
+	}
+
+	geo = lookupNodeGeo(server)
+	r.mu.Lock()
+	r.cache[server] = geo
+	r.mu.Unlock()
+	return geo
+}
+
+// lookupNodeGeo 解析服务器地址并查询 GeoIP / ASN 数据库
+func lookupNodeGeo(server string) *NodeGeo {
+	ip := net.ParseIP(server)
+	if ip == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), geoLookupTimeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, server)
+		if err != nil || len(addrs) == 0 {
+			return nil
+		}
+		ip = addrs[0].IP
+		for _, addr := range addrs {
+			if addr.IP.To4() != nil {
+				ip = addr.IP
+				break
+			}
+		}
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() {
+		return nil
+	}
+
+	location, err := geoip.GetLocation(ip.String())
+	if err != nil {
+		return nil
+	}
+	geo := &NodeGeo{
+		IP:          ip.String(),
+		Country:     location.Country,
+		CountryCode: location.CountryCode,
+		City:        location.City,
+	}
+	if asn, err := geoip.GetASN(ip.String()); err == nil {
+		geo.ASN = asn.Number
+		geo.ASNOrg = asn.Organization
+	}
+	return geo
+}
+
+// effectiveRegion 根据名称匹配的地区和地理位置确定节点地区：
+// preferGeo 时优先使用地理位置；两者都能识别但不一致时标记为不一致
+func effectiveRegion(nameRegion string, geo *NodeGeo, preferGeo bool) (region string, mismatch bool) {
+	region = nameRegion
+	geoRegion := geo.Region()
+	if geoRegion == "" {
+		return region, false
+	}
+	if preferGeo || region == "" || region == unknownRegion {
+		region = geoRegion
+	}
+	mismatch = nameRegion != "" && nameRegion != unknownRegion && nameRegion != geoRegion
+	return region, mismatch
+}
+
+// resolveNodesGeo 并发解析节点服务器的地理位置
+func (r *geoResolver) resolveNodesGeo(items []nodeWithOrder) {
+	if r == nil || len(items) == 0 {
+		return
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < geoResolveWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				items[i].geo = r.Resolve(items[i].node.Server)
+			}
+		}()
+	}
+	for i := range items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// regionSourceSetting 读取节点地区来源设置
+func (s *ConfigUpdateService) regionSourceSetting() string {
+	var config models.SystemConfig
+	if err := s.db.Where("key = ? AND category = ?", "node_region_source", "general").First(&config).Error; err == nil &&
+		strings.TrimSpace(config.Value) == RegionSourceGeo {
+		return RegionSourceGeo
+	}
+	return RegionSourceName
+}
@@ -0,0 +1,36 @@
+package config_update
+
+import "testing"
+
+// TestEffectiveRegion 测试名称地区与地理位置的合并及不一致标记
+func TestEffectiveRegion(t *testing.T) {
+	hk := &NodeGeo{IP: "1.1.1.1", Country: "香港", CountryCode: "HK"}
+	jp := &NodeGeo{IP: "2.2.2.2", Country: "日本", CountryCode: "jp"}
+	other := &NodeGeo{IP: "3.3.3.3", Country: "芬兰", CountryCode: "FI"}
+
+	cases := []struct {
+		nameRegion string
+		geo        *NodeGeo
+		preferGeo  bool
+		region     string
+		mismatch   bool
+	}{
+		{"香港", nil, true, "香港", false},
+		{"香港", hk, false, "香港", false},
+		{"香港", jp, false, "香港", true},
+		{"香港", jp, true, "日本", true},
+		{unknownRegion, jp, false, "日本", false},
+		{"", other, false, "芬兰", false},
+	}
+	for _, c := range cases {
+		region, mismatch := effectiveRegion(c.nameRegion, c.geo, c.preferGeo)
+		if region != c.region || mismatch != c.mismatch {
+			t.Errorf("%q / %v (优先地理位置 %v): 期望 %q 不一致=%v，实际 %q 不一致=%v",
+				c.nameRegion, c.geo.String(), c.preferGeo, c.region, c.mismatch, region, mismatch)
+		}
+	}
+
+	if got := (&NodeGeo{IP: "2.2.2.2", CountryCode: "JP", City: "东京", ASN: 2516}).String(); got != "JP 东京 AS2516 2.2.2.2" {
+		t.Errorf("地理位置摘要错误: %q", got)
+	}
+}
@@ -0,0 +1,47 @@
+package config_update
+
+import (
+	"cboard-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// entitledNodeGroupIDs 获取用户可使用的节点分组（订阅套餐与用户等级关联分组的并集）
+func (s *ConfigUpdateService) entitledNodeGroupIDs(user models.User, sub models.Subscription) []uint {
+	var ids []uint
+	if sub.PackageID != nil && *sub.PackageID > 0 {
+		var packageGroups []uint
+		s.db.Table("package_node_groups").Where("package_id = ?", *sub.PackageID).Pluck("node_group_id", &packageGroups)
+		ids = append(ids, packageGroups...)
+	}
+	if user.UserLevelID.Valid && user.UserLevelID.Int64 > 0 {
+		var levelGroups []uint
+		s.db.Table("user_level_node_groups").Where("user_level_id = ?", user.UserLevelID.Int64).Pluck("node_group_id", &levelGroups)
+		ids = append(ids, levelGroups...)
+	}
+	return ids
+}
+
+// applyNodeGroupFilter 按节点分组过滤普通节点：未加入分组的节点对所有用户可见，
+// 已加入分组的节点仅当用户套餐或等级关联了其中任一分组时可见
+func (s *ConfigUpdateService) applyNodeGroupFilter(query *gorm.DB, user models.User, sub models.Subscription) *gorm.DB {
+	grouped := s.db.Table("node_group_nodes").Select("node_id")
+	groupIDs := s.entitledNodeGroupIDs(user, sub)
+	if len(groupIDs) == 0 {
+		return query.Where("id NOT IN (?)", grouped)
+	}
+	entitled := s.db.Table("node_group_nodes").Select("node_id").Where("node_group_id IN ?", groupIDs)
+	return query.Where("(id NOT IN (?) OR id IN (?))", grouped, entitled)
+}
+
+// applyMultiplierLimit 按订阅套餐的最高节点倍率过滤普通节点（套餐未设置时不限制）
+func (s *ConfigUpdateService) applyMultiplierLimit(query *gorm.DB, sub models.Subscription) *gorm.DB {
+	if sub.PackageID == nil || *sub.PackageID == 0 {
+		return query
+	}
+	var pkg models.Package
+	if err := s.db.Select("id", "max_node_multiplier").First(&pkg, *sub.PackageID).Error; err != nil || pkg.MaxNodeMultiplier <= 0 {
+		return query
+	}
+	return query.Where("multiplier <= ?", pkg.MaxNodeMultiplier)
+}
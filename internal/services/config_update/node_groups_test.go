@@ -0,0 +1,56 @@
+package config_update
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"cboard-go/internal/models"
+)
+
+// TestApplyNodeGroupFilter 测试按套餐和用户等级关联的节点分组过滤节点
+func TestApplyNodeGroupFilter(t *testing.T) {
+	db := newConfigUpdateTestDB(t, &models.Node{}, &models.Package{}, &models.UserLevel{}, &models.NodeGroup{})
+	s := &ConfigUpdateService{db: db}
+
+	// 节点 1 未分组，节点 2 属于分组 A，节点 3 属于分组 B，节点 4 同时属于 A 和 B
+	for id := uint(1); id <= 4; id++ {
+		db.Create(&models.Node{ID: id, Name: fmt.Sprintf("节点 %d", id), Type: "ss", IsActive: true})
+	}
+	db.Create(&models.NodeGroup{ID: 1, Name: "A"})
+	db.Create(&models.NodeGroup{ID: 2, Name: "B"})
+	for _, link := range [][2]uint{{1, 2}, {2, 3}, {1, 4}, {2, 4}} {
+		db.Table("node_group_nodes").Create(map[string]interface{}{"node_group_id": link[0], "node_id": link[1]})
+	}
+	// 套餐 1 关联分组 A，套餐 2 未关联分组；等级 1 关联分组 B
+	db.Create(&models.Package{ID: 1, Name: "套餐 A"})
+	db.Create(&models.Package{ID: 2, Name: "无分组套餐"})
+	db.Create(&models.UserLevel{ID: 1, LevelName: "等级 B"})
+	db.Table("package_node_groups").Create(map[string]interface{}{"node_group_id": 1, "package_id": 1})
+	db.Table("user_level_node_groups").Create(map[string]interface{}{"node_group_id": 2, "user_level_id": 1})
+
+	packageA, packageNone := int64(1), int64(2)
+	levelB := sql.NullInt64{Int64: 1, Valid: true}
+	cases := []struct {
+		name string
+		user models.User
+		sub  models.Subscription
+		want []uint
+	}{
+		{"无套餐无等级", models.User{}, models.Subscription{}, []uint{1}},
+		{"套餐未关联分组", models.User{}, models.Subscription{PackageID: &packageNone}, []uint{1}},
+		{"套餐关联分组 A", models.User{}, models.Subscription{PackageID: &packageA}, []uint{1, 2, 4}},
+		{"等级关联分组 B", models.User{UserLevelID: levelB}, models.Subscription{}, []uint{1, 3, 4}},
+		{"套餐与等级取并集", models.User{UserLevelID: levelB}, models.Subscription{PackageID: &packageA}, []uint{1, 2, 3, 4}},
+	}
+	for _, c := range cases {
+		var ids []uint
+		query := s.applyNodeGroupFilter(db.Model(&models.Node{}), c.user, c.sub)
+		if err := query.Order("id").Pluck("id", &ids).Error; err != nil {
+			t.Fatalf("%s: 查询失败: %v", c.name, err)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(c.want) {
+			t.Errorf("%s: 期望节点 %v，实际 %v", c.name, c.want, ids)
+		}
+	}
+}
@@ -22,6 +22,7 @@ type ProxyNode struct {
 	TLS      bool                   `yaml:"tls,omitempty"`
 	UDP      bool                   `yaml:"udp,omitempty"`
 	Options  map[string]interface{} `yaml:",inline"`
+	Region   string                 `yaml:"-" json:"-"` // 所属地区（来自节点表，不参与配置输出）
 }
 
 // ParseNodeLink 解析节点链接
@@ -446,7 +447,12 @@ func parseHysteria(link string) (*ProxyNode, error) {
 func parseHysteria2(link string) (*ProxyNode, error) {
 	return parseGenericNode(link, "hysteria2", func(n *ProxyNode, q url.Values) {
 		if p, _ := url.Parse(link); p.User != nil {
-			n.Password, _ = p.User.Password()
+			// 标准格式 hysteria2://password@host，兼容 user:password 形式
+			if password, ok := p.User.Password(); ok {
+				n.Password = password
+			} else {
+				n.Password = p.User.Username()
+			}
 		}
 		n.TLS = true
 		if up := q.Get("mbpsUp"); up != "" {
@@ -679,6 +685,9 @@ func getInt(m map[string]interface{}, key string) int {
 		if f, ok := v.(float64); ok {
 			return int(f)
 		}
+		if i, ok := v.(int); ok {
+			return i
+		}
 		if s, ok := v.(string); ok {
 			if i, err := strconv.Atoi(s); err == nil {
 				return i
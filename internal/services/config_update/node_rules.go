@@ -0,0 +1,299 @@
+package config_update
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 节点规则动作
+const (
+	RuleInclude    = "include"    // 只保留名称匹配正则的节点
+	RuleExclude    = "exclude"    // 排除名称匹配正则的节点
+	RuleRename     = "rename"     // 正则替换名称，支持 $1、${name} 捕获组
+	RuleFlag       = "flag"       // 按地区在名称前添加旗帜
+	RuleMultiplier = "multiplier" // 从名称中提取倍率（如 "x2"、"0.5x"、"3倍"）
+	RuleType       = "type"       // 按节点类型过滤
+	RulePort       = "port"       // 按端口过滤
+)
+
+// defaultMultiplierPattern 默认倍率正则，取第一个非空捕获组作为倍率。
+// 数字后必须是词边界，避免把 "x 10G" 这类带单位的文字识别为倍率
+const defaultMultiplierPattern = `(?i)倍率\s*[:：]?\s*(\d+(?:\.\d+)?)\b|(\d+(?:\.\d+)?)\s*(?:x\b|×|倍)|(?:\bx|×)\s*(\d+(?:\.\d+)?)\b`
+
+// maxMultiplier 倍率上限，超出的数字（如 "ARM x86" 中的 86）不视为倍率
+const maxMultiplier = 10
+
+// defaultMultiplierRegexp 未配置倍率规则时用于提取和统一倍率文字
+var defaultMultiplierRegexp = regexp.MustCompile(defaultMultiplierPattern)
+
+// emptyBracketsPattern 移除倍率后残留的空括号
+var emptyBracketsPattern = regexp.MustCompile(`\[\s*\]|\(\s*\)|【\s*】|（\s*）`)
+
+// NodeRule 节点规则，按顺序依次作用于节点源中的每个节点
+type NodeRule struct {
+	Action  string   `json:"action"`
+	Pattern string   `json:"pattern,omitempty"` // 正则表达式（include / exclude / rename / multiplier）
+	Replace string   `json:"replace,omitempty"` // rename 的替换内容
+	Values  []string `json:"values,omitempty"`  // type：节点类型列表；port：端口或端口范围（如 443、8000-9000）
+	Exclude bool     `json:"exclude,omitempty"` // type / port：为 true 时排除匹配的节点，否则只保留匹配的节点
+	Strip   bool     `json:"strip,omitempty"`   // multiplier：提取后从名称中移除倍率文字
+}
+
+// NodeRuleResult 节点经过规则处理后的结果
+type NodeRuleResult struct {
+	Name       string  `json:"name"`
+	Dropped    bool    `json:"dropped"`
+	Rule       string  `json:"rule,omitempty"`       // 过滤节点的规则
+	Region     string  `json:"region,omitempty"`     // flag 规则使用的地区
+	Multiplier float64 `json:"multiplier,omitempty"` // 提取到的倍率，0 表示未提取
+}
+
+// NodeRulePipeline 编译后的节点规则
+type NodeRulePipeline struct {
+	rules    []NodeRule
+	patterns []*regexp.Regexp
+}
+
+// ParseNodeRules 解析节点规则（JSON 数组），空字符串表示没有规则
+func ParseNodeRules(value string) ([]NodeRule, error) {
+	var rules []NodeRule
+	if strings.TrimSpace(value) == "" {
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return nil, fmt.Errorf("节点规则必须为 JSON 数组: %v", err)
+	}
+	return rules, nil
+}
+
+// CompileNodeRules 校验并编译节点规则
+func CompileNodeRules(rules []NodeRule) (*NodeRulePipeline, error) {
+	pipeline := &NodeRulePipeline{
+		rules:    rules,
+		patterns: make([]*regexp.Regexp, len(rules)),
+	}
+
+	for i, rule := range rules {
+		label := fmt.Sprintf("规则 %d (%s)", i+1, rule.Action)
+		switch rule.Action {
+		case RuleInclude, RuleExclude, RuleRename, RuleMultiplier:
+			pattern := rule.Pattern
+			if pattern == "" && rule.Action == RuleMultiplier {
+				pattern = defaultMultiplierPattern
+			}
+			if pattern == "" {
+				return nil, fmt.Errorf("%s: 正则表达式不能为空", label)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: 正则表达式错误: %v", label, err)
+			}
+			pipeline.patterns[i] = re
+		case RuleType:
+			if len(rule.Values) == 0 {
+				return nil, fmt.Errorf("%s: 节点类型不能为空", label)
+			}
+		case RulePort:
+			if len(rule.Values) == 0 {
+				return nil, fmt.Errorf("%s: 端口不能为空", label)
+			}
+			for _, value := range rule.Values {
+				if _, _, err := parsePortRange(value); err != nil {
+					return nil, fmt.Errorf("%s: %v", label, err)
+				}
+			}
+		case RuleFlag:
+		default:
+			return nil, fmt.Errorf("%s: 不支持的规则类型", label)
+		}
+	}
+	return pipeline, nil
+}
+
+// Apply 依次执行规则，返回处理后的名称和过滤结果（不修改节点）
+// regionOf 用于 flag 规则按当前名称和服务器地址解析地区
+func (p *NodeRulePipeline) Apply(node *ProxyNode, regionOf func(name, server string) string) NodeRuleResult {
+	result := NodeRuleResult{Name: node.Name}
+	if p == nil {
+		return result
+	}
+
+	for i, rule := range p.rules {
+		re := p.patterns[i]
+		switch rule.Action {
+		case RuleInclude:
+			if !re.MatchString(result.Name) {
+				return dropNode(result, i, rule, "名称不匹配 "+rule.Pattern)
+			}
+		case RuleExclude:
+			if re.MatchString(result.Name) {
+				return dropNode(result, i, rule, "名称匹配 "+rule.Pattern)
+			}
+		case RuleRename:
+			if renamed := strings.TrimSpace(re.ReplaceAllString(result.Name, rule.Replace)); renamed != "" {
+				result.Name = renamed
+			}
+		case RuleFlag:
+			region := regionOf(result.Name, node.Server)
+			result.Region = region
+			if flag, ok := regionFlags[region]; ok && !hasFlagPrefix(result.Name) {
+				result.Name = flag + " " + result.Name
+			}
+		case RuleMultiplier:
+			if value, match := findMultiplier(re, result.Name); match != nil {
+				result.Multiplier = value
+				if rule.Strip {
+					result.Name = stripMatch(result.Name, match[0], match[1])
+				}
+			}
+		case RuleType:
+			if containsFold(rule.Values, node.Type) == rule.Exclude {
+				return dropNode(result, i, rule, "节点类型 "+node.Type)
+			}
+		case RulePort:
+			if portInRanges(node.Port, rule.Values) == rule.Exclude {
+				return dropNode(result, i, rule, "端口 "+strconv.Itoa(node.Port))
+			}
+		}
+	}
+	return result
+}
+
+// ExtractMultiplier 使用默认倍率正则从节点名称中提取倍率，未找到时返回 0
+func ExtractMultiplier(name string) float64 {
+	value, _ := findMultiplier(defaultMultiplierRegexp, name)
+	return value
+}
+
+// FormatMultiplier 格式化倍率，如 0.5 -> "0.5x"
+func FormatMultiplier(multiplier float64) string {
+	return strconv.FormatFloat(multiplier, 'f', -1, 64) + "x"
+}
+
+// FormatMultiplierName 生成订阅中的节点名称：移除名称中原有的倍率文字，
+// 倍率不为 1 时统一在末尾追加 "[倍率]"，保证名称与实际计费倍率一致
+func FormatMultiplierName(name string, multiplier float64) string {
+	if _, match := findMultiplier(defaultMultiplierRegexp, name); match != nil {
+		name = stripMatch(name, match[0], match[1])
+	}
+	if multiplier <= 0 || multiplier == 1 {
+		return name
+	}
+	return name + " [" + FormatMultiplier(multiplier) + "]"
+}
+
+// validMultiplier 倍率是否在合理范围内
+func validMultiplier(value float64) bool {
+	return value > 0 && value <= maxMultiplier
+}
+
+// findMultiplier 返回名称中第一个有效的倍率及其匹配位置，跳过超出范围的匹配，未找到时 match 为 nil
+func findMultiplier(re *regexp.Regexp, name string) (float64, []int) {
+	for _, match := range re.FindAllStringSubmatchIndex(name, -1) {
+		if value := firstSubmatch(name, match); validMultiplier(value) {
+			return value, match
+		}
+	}
+	return 0, nil
+}
+
+// dropNode 标记节点被规则过滤
+func dropNode(result NodeRuleResult, index int, rule NodeRule, reason string) NodeRuleResult {
+	result.Dropped = true
+	result.Rule = fmt.Sprintf("规则 %d (%s): %s", index+1, rule.Action, reason)
+	return result
+}
+
+// hasFlagPrefix 名称是否已以旗帜（区域指示符号）开头
+func hasFlagPrefix(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// firstSubmatch 返回第一个非空捕获组的数值；没有捕获组时使用整个匹配
+func firstSubmatch(name string, match []int) float64 {
+	candidates := [][2]int{}
+	for g := 2; g+1 < len(match); g += 2 {
+		if match[g] >= 0 {
+			candidates = append(candidates, [2]int{match[g], match[g+1]})
+		}
+	}
+	if len(match) == 2 {
+		candidates = append(candidates, [2]int{match[0], match[1]})
+	}
+	for _, c := range candidates {
+		if value, err := strconv.ParseFloat(strings.TrimSpace(name[c[0]:c[1]]), 64); err == nil {
+			return value
+		}
+	}
+	return 0
+}
+
+// stripMatch 从名称中移除匹配的文字，并清理残留的空括号和多余空白
+func stripMatch(name string, start, end int) string {
+	stripped := name[:start] + " " + name[end:]
+	stripped = emptyBracketsPattern.ReplaceAllString(stripped, "")
+	stripped = strings.Join(strings.Fields(stripped), " ")
+	stripped = strings.Trim(stripped, " -_|")
+	if stripped == "" {
+		return name
+	}
+	return stripped
+}
+
+// parsePortRange 解析端口或端口范围
+func parsePortRange(value string) (int, int, error) {
+	value = strings.TrimSpace(value)
+	low, high, isRange := strings.Cut(value, "-")
+	start, err := strconv.Atoi(strings.TrimSpace(low))
+	if err != nil {
+		return 0, 0, fmt.Errorf("无效的端口: %s", value)
+	}
+	end := start
+	if isRange {
+		if end, err = strconv.Atoi(strings.TrimSpace(high)); err != nil {
+			return 0, 0, fmt.Errorf("无效的端口范围: %s", value)
+		}
+	}
+	if start < 1 || end > 65535 || start > end {
+		return 0, 0, fmt.Errorf("无效的端口范围: %s", value)
+	}
+	return start, end, nil
+}
+
+// portInRanges 端口是否在任一端口范围内
+func portInRanges(port int, values []string) bool {
+	for _, value := range values {
+		if start, end, err := parsePortRange(value); err == nil && port >= start && port <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold 忽略大小写检查列表是否包含指定值
+func containsFold(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(strings.TrimSpace(value), target) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestNodeRules 使用规则处理样例节点（管理员测试规则）
+func (s *ConfigUpdateService) TestNodeRules(rules []NodeRule, samples []*ProxyNode) ([]NodeRuleResult, error) {
+	pipeline, err := CompileNodeRules(rules)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]NodeRuleResult, 0, len(samples))
+	for _, sample := range samples {
+		results = append(results, pipeline.Apply(sample, s.resolveRegion))
+	}
+	return results, nil
+}
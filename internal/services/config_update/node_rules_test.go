@@ -0,0 +1,129 @@
+package config_update
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestNodeRulePipeline 测试节点规则按顺序执行
+func TestNodeRulePipeline(t *testing.T) {
+	rules := []NodeRule{
+		{Action: RuleExclude, Pattern: `(?i)剩余|到期|官网`},
+		{Action: RuleType, Values: []string{"ssr"}, Exclude: true},
+		{Action: RulePort, Values: []string{"443", "8000-9000"}},
+		{Action: RuleRename, Pattern: `^HK(\d+)`, Replace: "香港 $1"},
+		{Action: RuleMultiplier, Strip: true},
+		{Action: RuleFlag},
+	}
+	pipeline, err := CompileNodeRules(rules)
+	if err != nil {
+		t.Fatalf("编译规则失败: %v", err)
+	}
+	regionOf := func(name, server string) string {
+		if strings.Contains(name, "香港") {
+			return "香港"
+		}
+		return unknownRegion
+	}
+
+	cases := []struct {
+		node       ProxyNode
+		name       string
+		dropped    bool
+		multiplier float64
+	}{
+		{ProxyNode{Name: "HK01 [2x]", Type: "vmess", Port: 443}, "🇭🇰 香港 01", false, 2},
+		{ProxyNode{Name: "HK02 0.5倍", Type: "trojan", Port: 8443}, "🇭🇰 香港 02", false, 0.5},
+		{ProxyNode{Name: "🇭🇰 香港 03 x3", Type: "vless", Port: 443}, "🇭🇰 香港 03", false, 3},
+		{ProxyNode{Name: "Proxy Box2", Type: "vless", Port: 443}, "Proxy Box2", false, 0},
+		{ProxyNode{Name: "剩余流量: 100G", Type: "ss", Port: 443}, "", true, 0},
+		{ProxyNode{Name: "HK04", Type: "ssr", Port: 443}, "", true, 0},
+		{ProxyNode{Name: "HK05", Type: "ss", Port: 10086}, "", true, 0},
+	}
+	for _, c := range cases {
+		result := pipeline.Apply(&c.node, regionOf)
+		if result.Dropped != c.dropped {
+			t.Errorf("%s: 过滤结果错误: %+v", c.node.Name, result)
+			continue
+		}
+		if c.dropped {
+			if result.Rule == "" {
+				t.Errorf("%s: 被过滤的节点应记录规则", c.node.Name)
+			}
+			continue
+		}
+		if result.Name != c.name || result.Multiplier != c.multiplier {
+			t.Errorf("%s: 期望 %q (倍率 %v)，实际 %q (倍率 %v)", c.node.Name, c.name, c.multiplier, result.Name, result.Multiplier)
+		}
+	}
+}
+
+// TestCompileNodeRulesValidation 测试规则校验
+func TestCompileNodeRulesValidation(t *testing.T) {
+	invalid := [][]NodeRule{
+		{{Action: RuleInclude}},
+		{{Action: RuleRename, Pattern: "("}},
+		{{Action: RulePort, Values: []string{"9000-8000"}}},
+		{{Action: RuleType}},
+		{{Action: "unknown"}},
+	}
+	for _, rules := range invalid {
+		if _, err := CompileNodeRules(rules); err == nil {
+			t.Errorf("无效规则应编译失败: %+v", rules)
+		}
+	}
+
+	if _, err := ParseNodeRules(`{"action":"flag"}`); err == nil {
+		t.Error("规则不是 JSON 数组时应解析失败")
+	}
+	if rules, err := ParseNodeRules(""); err != nil || len(rules) != 0 {
+		t.Errorf("空规则应解析为空列表: %v %v", rules, err)
+	}
+}
+
+// TestFormatMultiplierName 测试订阅节点名称中的倍率展示
+func TestFormatMultiplierName(t *testing.T) {
+	cases := []struct {
+		name       string
+		multiplier float64
+		want       string
+	}{
+		{"香港 01", 1, "香港 01"},
+		{"香港 01", 0, "香港 01"},
+		{"香港 01", 2, "香港 01 [2x]"},
+		{"香港 01 [0.5x]", 0.5, "香港 01 [0.5x]"},
+		{"日本 02 3倍", 1.5, "日本 02 [1.5x]"},
+		{"美国 x2", 1, "美国"},
+		{"Proxy Box2", 2, "Proxy Box2 [2x]"},
+	}
+	for _, c := range cases {
+		if got := FormatMultiplierName(c.name, c.multiplier); got != c.want {
+			t.Errorf("%s (倍率 %v): 期望 %q，实际 %q", c.name, c.multiplier, c.want, got)
+		}
+	}
+
+	if got := ExtractMultiplier("新加坡 倍率：0.8"); got != 0.8 {
+		t.Errorf("倍率提取错误: %v", got)
+	}
+	if got := ExtractMultiplier("新加坡 01"); got != 0 {
+		t.Errorf("未标注倍率的节点应返回 0: %v", got)
+	}
+
+	// 型号、带宽等文字不应被识别为倍率
+	for name, want := range map[string]float64{
+		"美国 ARM x86":      0,
+		"日本 x 10G":        0,
+		"香港 x86_64":       0,
+		"新加坡 倍率: 100":     0,
+		"德国 ARM x86 [2x]": 2,
+		"英国 ×1.5":         1.5,
+		"台湾 x2":           2,
+	} {
+		if got := ExtractMultiplier(name); got != want {
+			t.Errorf("%s: 期望倍率 %v，实际 %v", name, want, got)
+		}
+	}
+	if got := FormatMultiplierName("美国 ARM x86", 2); got != "美国 ARM x86 [2x]" {
+		t.Errorf("非倍率文字不应被移除: %q", got)
+	}
+}
@@ -0,0 +1,186 @@
+package config_update
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+)
+
+// sourceSyncMutex 节点源同步互斥锁（服务实例按请求创建，需使用包级锁防止并发同步）
+var sourceSyncMutex sync.Mutex
+
+// loadNodeSources 获取启用的节点源（按排序）
+func (s *ConfigUpdateService) loadNodeSources() ([]models.NodeSource, error) {
+	var sources []models.NodeSource
+	if err := s.db.Where("enabled = ?", true).Order("sort_order ASC, id ASC").Find(&sources).Error; err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// MigrateLegacySourceURLs 将旧版 urls 配置中尚未登记的地址创建为节点源（启动时和执行节点源同步前调用，预览不写入）
+func (s *ConfigUpdateService) MigrateLegacySourceURLs() {
+	config, err := s.getConfig()
+	if err != nil {
+		return
+	}
+	if urls, ok := config["urls"].([]string); ok && len(urls) > 0 {
+		s.migrateLegacySourceURLs(urls)
+	}
+}
+
+// migrateLegacySourceURLs 将旧版 urls 配置中尚未登记的地址创建为节点源
+func (s *ConfigUpdateService) migrateLegacySourceURLs(urls []string) {
+	var existing []models.NodeSource
+	s.db.Select("id, name, url, sort_order").Find(&existing)
+
+	knownURLs := make(map[string]bool, len(existing))
+	usedNames := make(map[string]bool, len(existing))
+	maxOrder := -1
+	for _, src := range existing {
+		knownURLs[src.URL] = true
+		usedNames[src.Name] = true
+		if src.SortOrder > maxOrder {
+			maxOrder = src.SortOrder
+		}
+	}
+
+	for _, u := range urls {
+		if knownURLs[u] {
+			continue
+		}
+		knownURLs[u] = true
+		maxOrder++
+
+		name := s.ensureUniqueName(fmt.Sprintf("订阅源 %d", maxOrder+1), usedNames)
+		usedNames[name] = true
+		src := models.NodeSource{Name: name, URL: u, Enabled: true, SortOrder: maxOrder}
+		if err := s.db.Create(&src).Error; err != nil {
+			s.log("ERROR", fmt.Sprintf("创建节点源失败: %s, 错误: %v", truncateString(u, 50), err))
+			continue
+		}
+		s.log("INFO", fmt.Sprintf("已将订阅地址登记为节点源 [%s]: %s", name, truncateString(u, 50)))
+	}
+}
+
+// globalFilterKeywords 获取全局过滤关键词
+func globalFilterKeywords(config map[string]interface{}) []string {
+	if keywords, ok := config["filter_keywords"].([]string); ok {
+		return keywords
+	}
+	if keywordsStr, ok := config["filter_keywords"].(string); ok {
+		// 处理字符串格式的关键词（用换行符分隔）- 向后兼容
+		return splitLines(keywordsStr)
+	}
+	return nil
+}
+
+// splitLines 按行拆分并去除空行
+func splitLines(value string) []string {
+	var result []string
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// ParseSourceHeaders 解析节点源的额外请求头（JSON 对象）
+func ParseSourceHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	if strings.TrimSpace(value) == "" {
+		return headers, nil
+	}
+	if err := json.Unmarshal([]byte(value), &headers); err != nil {
+		return nil, fmt.Errorf("请求头必须为 JSON 对象: %v", err)
+	}
+	return headers, nil
+}
+
+// SyncNodeSource 立即同步指定节点源
+func (s *ConfigUpdateService) SyncNodeSource(id uint) error {
+	var source models.NodeSource
+	if err := s.db.First(&source, id).Error; err != nil {
+		return fmt.Errorf("节点源不存在")
+	}
+	config, err := s.getConfig()
+	if err != nil {
+		return err
+	}
+	return s.syncNodeSources([]models.NodeSource{source}, config, false)
+}
+
+// RunDueNodeSources 同步设置了独立拉取间隔且已到期的节点源
+func (s *ConfigUpdateService) RunDueNodeSources() error {
+	var sources []models.NodeSource
+	if err := s.db.Where("enabled = ? AND fetch_interval > ?", true, 0).Order("sort_order ASC, id ASC").Find(&sources).Error; err != nil {
+		return err
+	}
+
+	now := utils.GetBeijingTime()
+	var due []models.NodeSource
+	for _, src := range sources {
+		if src.LastFetchAt == nil || now.Sub(*src.LastFetchAt) >= time.Duration(src.FetchInterval)*time.Second {
+			due = append(due, src)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	config, err := s.getConfig()
+	if err != nil {
+		return err
+	}
+	return s.syncNodeSources(due, config, false)
+}
+
+// syncNodeSources 同步节点源：生成更新计划并立即应用，fullRun 为 true 时记录全局最后更新时间
+func (s *ConfigUpdateService) syncNodeSources(sources []models.NodeSource, config map[string]interface{}, fullRun bool) error {
+	if !sourceSyncMutex.TryLock() {
+		return fmt.Errorf("任务已在运行中")
+	}
+	defer sourceSyncMutex.Unlock()
+	defer s.markRunning()()
+
+	s.log("INFO", fmt.Sprintf("开始执行配置更新任务，共 %d 个节点源", len(sources)))
+	plan := s.buildUpdatePlan(sources, config, fullRun)
+	return s.commitUpdatePlan(plan)
+}
+
+// reservedNodeNames 返回同步时不可使用的节点名称：手动添加的节点和其他节点源的节点
+func (s *ConfigUpdateService) reservedNodeNames(syncingSourceIDs []uint) map[string]bool {
+	var names []string
+	s.db.Model(&models.Node{}).
+		Where("is_manual = ? OR (source_id IS NOT NULL AND source_id NOT IN ? AND is_active = ?)", true, syncingSourceIDs, true).
+		Pluck("name", &names)
+
+	usedNames := make(map[string]bool, len(names))
+	for _, name := range names {
+		usedNames[name] = true
+	}
+	return usedNames
+}
+
+// recordSourceResult 记录节点源的同步结果
+func (s *ConfigUpdateService) recordSourceResult(source *models.NodeSource, nodeCount int, syncErr error) {
+	now := utils.GetBeijingTime()
+	updates := map[string]interface{}{
+		"last_fetch_at": now,
+		"last_status":   "success",
+		"last_error":    "",
+	}
+	if syncErr != nil {
+		updates["last_status"] = "failed"
+		updates["last_error"] = syncErr.Error()
+	} else {
+		updates["node_count"] = nodeCount
+	}
+	s.db.Model(&models.NodeSource{}).Where("id = ?", source.ID).Updates(updates)
+}
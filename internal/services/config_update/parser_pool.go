@@ -36,9 +36,9 @@ func (p *ParserPool) ParseLinks(links []string) []ParseResult {
 		return []ParseResult{}
 	}
 
-	// 为每次调用创建新的 channels（避免并发冲突）
-	taskChan := make(chan string, len(links))
-	resultChan := make(chan ParseResult, len(links))
+	// 结果按输入顺序写入（节点顺序决定排序索引）
+	results := make([]ParseResult, len(links))
+	taskChan := make(chan int, len(links))
 	var wg sync.WaitGroup
 
 	// 启动workers
@@ -46,22 +46,19 @@ func (p *ParserPool) ParseLinks(links []string) []ParseResult {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for link := range taskChan {
+			for idx := range taskChan {
+				link := links[idx]
+
 				// 检查缓存
 				if cached, ok := p.cache.Get(link); ok {
-					resultChan <- ParseResult{
-						Node: cached,
-						Err:  nil,
-						Link: link,
-					}
+					results[idx] = ParseResult{Node: cached, Link: link}
 					continue
 				}
 
 				// 解析节点
 				node, err := ParseNodeLink(link)
 				if err != nil {
-					resultChan <- ParseResult{
-						Node: nil,
+					results[idx] = ParseResult{
 						Err:  fmt.Errorf("解析失败 [链接: %s...]: %w", truncateLink(link, 50), err),
 						Link: link,
 					}
@@ -70,36 +67,18 @@ func (p *ParserPool) ParseLinks(links []string) []ParseResult {
 
 				// 缓存结果
 				p.cache.Set(link, node)
-
-				resultChan <- ParseResult{
-					Node: node,
-					Err:  nil,
-					Link: link,
-				}
+				results[idx] = ParseResult{Node: node, Link: link}
 			}
 		}()
 	}
 
 	// 发送任务
-	go func() {
-		defer close(taskChan)
-		for _, link := range links {
-			taskChan <- link
-		}
-	}()
-
-	// 等待所有workers完成并关闭结果channel
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-
-	// 收集结果
-	results := make([]ParseResult, 0, len(links))
-	for result := range resultChan {
-		results = append(results, result)
+	for idx := range links {
+		taskChan <- idx
 	}
+	close(taskChan)
 
+	wg.Wait()
 	return results
 }
 
@@ -0,0 +1,132 @@
+package config_update
+
+import (
+	"fmt"
+	"strings"
+)
+
+// supportedQuantumultXTypes Quantumult X 支持的节点类型
+var supportedQuantumultXTypes = map[string]bool{
+	"ss":     true,
+	"ssr":    true,
+	"vmess":  true,
+	"vless":  true,
+	"trojan": true,
+}
+
+// generateQuantumultXConfig 生成 Quantumult X server_remote 节点资源（每行一个节点）
+func (s *ConfigUpdateService) generateQuantumultXConfig(proxies []*ProxyNode) string {
+	usedNames := make(map[string]bool)
+	var lines []string
+	for _, proxy := range proxies {
+		if !supportedQuantumultXTypes[proxy.Type] {
+			continue
+		}
+		params := s.quantumultXParams(proxy)
+		if params == "" {
+			continue
+		}
+		name := uniqueININame(proxy.Name, usedNames)
+		lines = append(lines, fmt.Sprintf("%s, tag=%s", params, name))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// quantumultXParams 生成 Quantumult X 节点行（不含 tag），无法表示的节点返回空字符串
+func (s *ConfigUpdateService) quantumultXParams(node *ProxyNode) string {
+	opts := node.Options
+	if opts == nil {
+		opts = make(map[string]interface{})
+	}
+	transportOpts := TransportOptsFromMap(opts)
+
+	// Quantumult X 仅支持 tcp / ws 传输，且不支持 reality
+	if node.Network != "" && node.Network != "tcp" && node.Network != "ws" {
+		return ""
+	}
+	if transportOpts.RealityOpts != nil || getString(opts, "flow", "") != "" {
+		return ""
+	}
+	if transportOpts.WSOpts != nil && transportOpts.WSOpts.V2rayHTTPUpgrade {
+		return ""
+	}
+
+	server := fmt.Sprintf("%s:%d", node.Server, node.Port)
+	var parts []string
+	switch node.Type {
+	case "ss":
+		parts = append(parts, "shadowsocks="+server, "method="+node.Cipher, "password="+node.Password)
+	case "ssr":
+		parts = append(parts, "shadowsocks="+server, "method="+node.Cipher, "password="+node.Password,
+			"ssr-protocol="+getString(opts, "protocol", "origin"))
+		if param := getString(opts, "protocol-param", ""); param != "" {
+			parts = append(parts, "ssr-protocol-param="+param)
+		}
+		parts = append(parts, "obfs="+getString(opts, "obfs", "plain"))
+		if param := getString(opts, "obfs-param", ""); param != "" {
+			parts = append(parts, "obfs-host="+param)
+		}
+	case "vmess":
+		method := node.Cipher
+		if method == "" || method == "auto" {
+			method = "chacha20-poly1305"
+		}
+		parts = append(parts, "vmess="+server, "method="+method, "password="+node.UUID)
+		parts = append(parts, quantumultXTransportParams(node, transportOpts, node.TLS)...)
+		if getInt(opts, "alterId") == 0 {
+			parts = append(parts, "aead=true")
+		} else {
+			parts = append(parts, "aead=false")
+		}
+	case "vless":
+		parts = append(parts, "vless="+server, "method=none", "password="+node.UUID)
+		parts = append(parts, quantumultXTransportParams(node, transportOpts, node.TLS)...)
+	case "trojan":
+		parts = append(parts, "trojan="+server, "password="+node.Password)
+		if node.Network == "ws" {
+			parts = append(parts, quantumultXTransportParams(node, transportOpts, true)...)
+		} else {
+			parts = append(parts, "over-tls=true")
+			if transportOpts.SNI != "" {
+				parts = append(parts, "tls-host="+transportOpts.SNI)
+			}
+			parts = append(parts, fmt.Sprintf("tls-verification=%t", !transportOpts.SkipCertVerify))
+		}
+	default:
+		return ""
+	}
+
+	parts = append(parts, "fast-open=false", fmt.Sprintf("udp-relay=%t", node.Type == "ss" || node.Type == "ssr"))
+	return strings.Join(parts, ", ")
+}
+
+// quantumultXTransportParams 生成 Quantumult X 的 obfs 传输参数（ws / wss / over-tls）
+func quantumultXTransportParams(node *ProxyNode, transportOpts *TransportOpts, tls bool) []string {
+	var params []string
+	if node.Network == "ws" {
+		if tls {
+			params = append(params, "obfs=wss")
+		} else {
+			params = append(params, "obfs=ws")
+		}
+		host := transportOpts.SNI
+		path := "/"
+		if transportOpts.WSOpts != nil {
+			host = firstNotEmpty(transportOpts.WSOpts.Headers["Host"], host)
+			path = firstNotEmpty(transportOpts.WSOpts.Path, path)
+		}
+		if host != "" {
+			params = append(params, "obfs-host="+host)
+		}
+		params = append(params, "obfs-uri="+path)
+	} else if tls {
+		params = append(params, "obfs=over-tls")
+		if transportOpts.SNI != "" {
+			params = append(params, "obfs-host="+transportOpts.SNI)
+		}
+	}
+	if tls {
+		params = append(params, fmt.Sprintf("tls-verification=%t", !transportOpts.SkipCertVerify))
+	}
+	return params
+}
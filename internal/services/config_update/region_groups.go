@@ -0,0 +1,142 @@
+package config_update
+
+import (
+	"sort"
+	"strings"
+)
+
+// 地区分组类型
+const (
+	RegionGroupURLTest  = "url-test"
+	RegionGroupFallback = "fallback"
+)
+
+// unknownRegion 无法识别地区时的名称（与 RegionMatcher 保持一致），不生成地区分组
+const unknownRegion = "未知"
+
+// defaultRegionPriority 默认地区分组顺序
+var defaultRegionPriority = []string{"香港", "台湾", "日本", "新加坡", "美国", "韩国", "英国", "德国"}
+
+// regionFlags 常见地区的旗帜
+var regionFlags = map[string]string{
+	"香港":    "🇭🇰",
+	"台湾":    "🇹🇼",
+	"日本":    "🇯🇵",
+	"新加坡":   "🇸🇬",
+	"美国":    "🇺🇸",
+	"韩国":    "🇰🇷",
+	"英国":    "🇬🇧",
+	"德国":    "🇩🇪",
+	"法国":    "🇫🇷",
+	"加拿大":   "🇨🇦",
+	"澳大利亚":  "🇦🇺",
+	"中国":    "🇨🇳",
+	"俄罗斯":   "🇷🇺",
+	"印度":    "🇮🇳",
+	"荷兰":    "🇳🇱",
+	"土耳其":   "🇹🇷",
+	"巴西":    "🇧🇷",
+	"阿根廷":   "🇦🇷",
+	"马来西亚":  "🇲🇾",
+	"泰国":    "🇹🇭",
+	"越南":    "🇻🇳",
+	"菲律宾":   "🇵🇭",
+	"印度尼西亚": "🇮🇩",
+	"意大利":   "🇮🇹",
+	"西班牙":   "🇪🇸",
+	"瑞士":    "🇨🇭",
+	"瑞典":    "🇸🇪",
+	"爱尔兰":   "🇮🇪",
+	"波兰":    "🇵🇱",
+	"乌克兰":   "🇺🇦",
+	"阿联酋":   "🇦🇪",
+	"以色列":   "🇮🇱",
+	"南非":    "🇿🇦",
+	"墨西哥":   "🇲🇽",
+	"新西兰":   "🇳🇿",
+}
+
+// regionGroupName 生成地区分组名称（如 "🇭🇰 香港"），没有对应旗帜时使用 🌐
+func regionGroupName(region string) string {
+	flag, ok := regionFlags[region]
+	if !ok {
+		flag = "🌐"
+	}
+	return flag + " " + region
+}
+
+// proxyRegion 获取节点所属地区：优先使用导入时解析的地区，否则按名称和服务器地址匹配
+func (s *ConfigUpdateService) proxyRegion(proxy *ProxyNode) string {
+	if proxy.Region != "" {
+		return proxy.Region
+	}
+	return s.resolveRegion(proxy.Name, proxy.Server)
+}
+
+// groupProxiesByRegion 按地区分组节点名称（不含未知地区），按优先级排序：
+// priority 中的地区按配置顺序在前，其余地区按节点数降序，节点数相同时保持出现顺序
+func (s *ConfigUpdateService) groupProxiesByRegion(proxies []*ProxyNode, priority []string) (regions []ClashTemplateRegion, ungrouped []string) {
+	regionIndex := make(map[string]int)
+	for _, proxy := range proxies {
+		region := s.proxyRegion(proxy)
+		if region == "" || region == unknownRegion {
+			ungrouped = append(ungrouped, proxy.Name)
+			continue
+		}
+		idx, ok := regionIndex[region]
+		if !ok {
+			idx = len(regions)
+			regionIndex[region] = idx
+			regions = append(regions, ClashTemplateRegion{Name: region})
+		}
+		regions[idx].ProxyNames = append(regions[idx].ProxyNames, proxy.Name)
+	}
+
+	rank := make(map[string]int, len(priority))
+	for i, region := range priority {
+		if _, exists := rank[region]; !exists {
+			rank[region] = i
+		}
+	}
+	sort.SliceStable(regions, func(i, j int) bool {
+		ri, iok := rank[regions[i].Name]
+		rj, jok := rank[regions[j].Name]
+		if iok && jok {
+			return ri < rj
+		}
+		if iok != jok {
+			return iok
+		}
+		return len(regions[i].ProxyNames) > len(regions[j].ProxyNames)
+	})
+
+	// 分组名称不能与节点名称重复
+	usedNames := make(map[string]bool, len(proxies))
+	for _, proxy := range proxies {
+		usedNames[proxy.Name] = true
+	}
+	for i := range regions {
+		name := regionGroupName(regions[i].Name)
+		for usedNames[name] {
+			name += " 组"
+		}
+		usedNames[name] = true
+		regions[i].GroupName = name
+	}
+
+	return regions, ungrouped
+}
+
+// parseRegionPriority 解析地区优先级配置（逗号或换行分隔）
+func parseRegionPriority(value string) []string {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '，' || r == '\n' || r == '\r'
+	})
+	var result []string
+	for _, field := range fields {
+		if field = strings.TrimSpace(field); field != "" {
+			result = append(result, field)
+		}
+	}
+	return result
+}
@@ -0,0 +1,111 @@
+package config_update
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 订阅渲染缓存参数
+const (
+	renderCacheTTL        = 10 * time.Minute // 兜底过期时间（节点到期等未主动失效的变化最多延迟该时长生效）
+	renderCacheMaxEntries = 2000
+)
+
+// renderCacheEntry 缓存条目
+type renderCacheEntry struct {
+	content   string
+	expiresAt time.Time
+}
+
+// RenderCache 已渲染订阅配置的内存缓存
+type RenderCache struct {
+	mu      sync.RWMutex
+	entries map[string]renderCacheEntry
+}
+
+// renderCache 全局订阅渲染缓存
+var renderCache = &RenderCache{entries: make(map[string]renderCacheEntry)}
+
+// renderCacheEpoch 缓存代数，调用 InvalidateSubscriptionCache 后递增，使所有旧缓存键失效
+var renderCacheEpoch atomic.Uint64
+
+// InvalidateSubscriptionCache 使全部订阅渲染缓存失效
+// 订阅和用户的变化会自动反映在缓存键中；节点、专线节点及其分配、模板、节点分组等变更需调用此函数
+// （健康检查只在节点启用状态变化时调用，避免每轮检查都清空缓存）
+func InvalidateSubscriptionCache() {
+	renderCacheEpoch.Add(1)
+	renderCache.mu.Lock()
+	renderCache.entries = make(map[string]renderCacheEntry)
+	renderCache.mu.Unlock()
+}
+
+// Get 获取未过期的缓存内容
+func (c *RenderCache) Get(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok || time.Now().After(entry.expiresAt) {
+		return "", false
+	}
+	return entry.content, true
+}
+
+// Set 写入缓存，条目过多时先清理过期条目，仍然过多则清空
+func (c *RenderCache) Set(key, content string) {
+	if key == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= renderCacheMaxEntries {
+		now := time.Now()
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= renderCacheMaxEntries {
+			c.entries = make(map[string]renderCacheEntry)
+		}
+	}
+	c.entries[key] = renderCacheEntry{content: content, expiresAt: time.Now().Add(renderCacheTTL)}
+}
+
+// renderCacheKey 生成缓存键，仅正常状态的订阅可缓存（异常状态返回空字符串）
+// 缓存键包含订阅令牌、输出格式、缓存代数，以及影响输出内容的订阅、用户和系统设置字段
+func (s *ConfigUpdateService) renderCacheKey(ctx *SubscriptionContext, target string) string {
+	if ctx.Status != StatusNormal || s.db == nil {
+		return ""
+	}
+	sub := &ctx.Subscription
+	user := &ctx.User
+
+	var packageID int64
+	if sub.PackageID != nil {
+		packageID = *sub.PackageID
+	}
+	var specialExpire int64
+	if user.SpecialNodeExpiresAt.Valid {
+		specialExpire = user.SpecialNodeExpiresAt.Time.Unix()
+	}
+
+	parts := []string{
+		sub.SubscriptionURL,
+		target,
+		fmt.Sprint(renderCacheEpoch.Load()),
+		fmt.Sprintf("sub:%d,%d,%d,%d,%d", sub.ID, sub.ExpireTime.Unix(), sub.DeviceLimit, packageID, ctx.CurrentDevices),
+		fmt.Sprintf("user:%d,%s,%d,%d", user.ID, user.SpecialNodeSubscriptionType, specialExpire, user.UserLevelID.Int64),
+		fmt.Sprintf("cfg:%s,%s,%t,%t,%s,%s", s.siteURL, s.supportQQ, s.infoNodes, s.regionGroups, s.regionGroupType, strings.Join(s.regionPriority, "/")),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,80 @@
+package config_update
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// TestRenderCache 测试渲染缓存的读写与失效
+func TestRenderCache(t *testing.T) {
+	cache := &RenderCache{entries: make(map[string]renderCacheEntry)}
+	cache.Set("", "ignored")
+	if _, ok := cache.Get(""); ok {
+		t.Error("空缓存键不应命中")
+	}
+
+	cache.Set("key", "content")
+	if content, ok := cache.Get("key"); !ok || content != "content" {
+		t.Errorf("缓存读取错误: %q, %v", content, ok)
+	}
+
+	renderCache.Set("global", "content")
+	epoch := renderCacheEpoch.Load()
+	InvalidateSubscriptionCache()
+	if _, ok := renderCache.Get("global"); ok {
+		t.Error("失效后缓存仍然命中")
+	}
+	if renderCacheEpoch.Load() != epoch+1 {
+		t.Error("失效后缓存代数未递增")
+	}
+}
+
+// TestGenerateTargetConfigCacheHit 测试缓存命中时只查询订阅上下文，不再读取系统设置和节点
+func TestGenerateTargetConfigCacheHit(t *testing.T) {
+	db := newConfigUpdateTestDB(t, &models.User{}, &models.Subscription{}, &models.Device{}, &models.SystemConfig{},
+		&models.Node{}, &models.CustomNode{}, &models.UserCustomNode{}, &models.Package{}, &models.UserLevel{},
+		&models.NodeGroup{}, &models.ClashTemplate{})
+	db.Create(&models.User{ID: 1, Username: "u1", Email: "u1@example.com", Password: "x", IsActive: true})
+	db.Create(&models.Subscription{UserID: 1, SubscriptionURL: "token", IsActive: true, Status: "active",
+		DeviceLimit: 3, ExpireTime: time.Now().Add(24 * time.Hour)})
+	config := `{"name":"香港 01","type":"ss","server":"hk.example.com","port":8388,"cipher":"aes-128-gcm","password":"p"}`
+	db.Create(&models.Node{Name: "香港 01", Type: "ss", Status: "online", IsActive: true, Config: &config, Region: "香港"})
+
+	var queries int
+	db.Callback().Query().Before("gorm:query").Register("test:count", func(*gorm.DB) { queries++ })
+	db.Callback().Row().Before("gorm:row").Register("test:count_row", func(*gorm.DB) { queries++ })
+
+	InvalidateSubscriptionCache()
+	s := &ConfigUpdateService{db: db}
+	first, _, err := s.GenerateTargetConfig("token", "1.2.3.4", "clash", TargetClash)
+	if err != nil || !strings.Contains(first, "hk.example.com") {
+		t.Fatalf("生成配置失败: %v\n%s", err, first)
+	}
+
+	queries = 0
+	second, _, err := s.GenerateTargetConfig("token", "1.2.3.4", "clash", TargetClash)
+	if err != nil || second != first {
+		t.Fatalf("缓存命中时应返回相同配置: %v", err)
+	}
+	// 订阅（关联用户）和在线设备数各一次查询
+	if queries > 2 {
+		t.Errorf("缓存命中时查询次数过多: %d", queries)
+	}
+
+	// 健康检查等未调用失效函数的节点更新不影响缓存
+	db.Model(&models.Node{}).Where("name = ?", "香港 01").Update("latency", 120)
+	if third, _, _ := s.GenerateTargetConfig("token", "1.2.3.4", "clash", TargetClash); third != first {
+		t.Error("节点延迟变化不应使缓存失效")
+	}
+
+	db.Model(&models.Node{}).Where("name = ?", "香港 01").Update("is_active", false)
+	InvalidateSubscriptionCache()
+	if fourth, _, _ := s.GenerateTargetConfig("token", "1.2.3.4", "clash", TargetClash); strings.Contains(fourth, "hk.example.com") {
+		t.Error("调用失效函数后应重新渲染")
+	}
+}
@@ -0,0 +1,187 @@
+package config_update
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 订阅输出格式
+const (
+	TargetClash       = "clash"
+	TargetUniversal   = "universal"
+	TargetSingbox     = "singbox"
+	TargetSurge       = "surge"
+	TargetQuantumultX = "quanx"
+	TargetLoon        = "loon"
+	TargetStash       = "stash"
+)
+
+// 代理组名称（各客户端渲染器共用）
+const (
+	groupSelectName = "🚀 节点选择"
+	groupAutoName   = "♻️ 自动选择"
+	groupManualName = "🎯 手动选择"
+	groupTestURL    = "http://www.gstatic.com/generate_204"
+)
+
+// IsSupportedTarget 检查是否为支持的订阅输出格式
+func IsSupportedTarget(target string) bool {
+	switch target {
+	case TargetClash, TargetUniversal, TargetSingbox, TargetSurge, TargetQuantumultX, TargetLoon, TargetStash:
+		return true
+	}
+	return false
+}
+
+// targetAliases target 参数的常用别名
+var targetAliases = map[string]string{
+	"mihomo":       TargetClash,
+	"meta":         TargetClash,
+	"clash.meta":   TargetClash,
+	"clashmeta":    TargetClash,
+	"sing-box":     TargetSingbox,
+	"sfa":          TargetSingbox,
+	"sfi":          TargetSingbox,
+	"quantumultx":  TargetQuantumultX,
+	"quantumult":   TargetQuantumultX,
+	"qx":           TargetQuantumultX,
+	"shadowrocket": TargetUniversal,
+	"v2ray":        TargetUniversal,
+	"v2rayn":       TargetUniversal,
+	"base64":       TargetUniversal,
+}
+
+// NormalizeTarget 将 target 参数（含别名，大小写不敏感）转换为订阅输出格式，无法识别时返回空字符串
+func NormalizeTarget(target string) string {
+	target = strings.ToLower(strings.TrimSpace(target))
+	if IsSupportedTarget(target) {
+		return target
+	}
+	return targetAliases[target]
+}
+
+// TargetForSoftware 根据客户端软件名称（device.DeviceManager.MatchSoftware 的结果）选择订阅输出格式
+// 未识别的客户端沿用 Clash 格式，保持旧订阅链接的行为不变
+func TargetForSoftware(software string) string {
+	switch software {
+	case "Stash":
+		return TargetStash
+	case "sing-box", "Hiddify":
+		return TargetSingbox
+	case "Surge":
+		return TargetSurge
+	case "Quantumult":
+		return TargetQuantumultX
+	case "Loon":
+		return TargetLoon
+	case "Shadowrocket", "v2rayN", "V2Ray":
+		return TargetUniversal
+	default:
+		return TargetClash
+	}
+}
+
+// TargetFromAccept 根据 Accept 请求头选择订阅输出格式，未明确指定时返回空字符串
+func TargetFromAccept(accept string) string {
+	for _, part := range strings.Split(strings.ToLower(accept), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		switch mediaType {
+		case "application/x-yaml", "application/yaml", "text/yaml", "text/x-yaml":
+			return TargetClash
+		case "application/json":
+			return TargetSingbox
+		}
+	}
+	return ""
+}
+
+// GenerateTargetConfig 按指定格式生成订阅配置，同时返回订阅响应头信息（订阅不存在时为 nil）
+// 正常状态的订阅渲染结果会被缓存，节点集合、订阅或用户变化后自动失效
+func (s *ConfigUpdateService) GenerateTargetConfig(token string, clientIP string, userAgent string, target string) (string, *SubscriptionUserInfo, error) {
+	if !IsSupportedTarget(target) {
+		return "", nil, fmt.Errorf("不支持的订阅格式: %s", target)
+	}
+
+	// 系统设置带进程内缓存，保存设置后立即失效
+	s.refreshSystemConfig()
+
+	ctx := s.checkSubscriptionContext(token, clientIP, userAgent)
+	info := s.buildUserInfo(ctx)
+
+	cacheKey := s.renderCacheKey(ctx, target)
+	if cfg, ok := renderCache.Get(cacheKey); ok {
+		return cfg, info, nil
+	}
+
+	cfg, err := s.renderTarget(s.exportNodes(ctx), target)
+	if err != nil {
+		return "", nil, err
+	}
+	renderCache.Set(cacheKey, cfg)
+	return cfg, info, nil
+}
+
+// renderTarget 将节点渲染为指定格式的配置
+func (s *ConfigUpdateService) renderTarget(nodes []*ProxyNode, target string) (string, error) {
+	switch target {
+	case TargetClash:
+		return s.generateClashYAML(nodes), nil
+	case TargetUniversal:
+		return s.generateUniversalLinks(nodes, "base64"), nil
+	case TargetSingbox:
+		return s.generateSingboxJSON(nodes)
+	case TargetSurge:
+		return s.generateSurgeConfig(nodes), nil
+	case TargetQuantumultX:
+		return s.generateQuantumultXConfig(nodes), nil
+	case TargetLoon:
+		return s.generateLoonConfig(nodes), nil
+	default:
+		return s.generateStashYAML(nodes), nil
+	}
+}
+
+// uniqueININame 生成 INI 风格配置中唯一且合法的节点名称（名称中不能包含逗号和等号）
+func uniqueININame(name string, usedNames map[string]bool) string {
+	cleaned := strings.NewReplacer(",", " ", "=", "-", "\n", " ", "\r", " ").Replace(name)
+	cleaned = strings.TrimSpace(cleaned)
+	if cleaned == "" {
+		cleaned = "node"
+	}
+
+	result := cleaned
+	counter := 1
+	for usedNames[result] || result == groupSelectName || result == groupAutoName || result == groupManualName {
+		result = fmt.Sprintf("%s_%d", cleaned, counter)
+		counter++
+	}
+	usedNames[result] = true
+	return result
+}
+
+// writeINIProxyGroups 写入 Surge / Loon 风格的代理组
+func writeINIProxyGroups(builder *strings.Builder, names []string) {
+	builder.WriteString("[Proxy Group]\n")
+	if len(names) == 0 {
+		builder.WriteString(fmt.Sprintf("%s = select, DIRECT\n", groupSelectName))
+		return
+	}
+	builder.WriteString(fmt.Sprintf("%s = select, %s, %s, DIRECT\n", groupSelectName, groupAutoName, strings.Join(names, ", ")))
+	builder.WriteString(fmt.Sprintf("%s = url-test, %s, url=%s, interval=300, tolerance=50\n", groupAutoName, strings.Join(names, ", "), groupTestURL))
+}
+
+// writeINIRules 写入 Surge / Loon 风格的规则
+func writeINIRules(builder *strings.Builder) {
+	builder.WriteString("[Rule]\n")
+	builder.WriteString("DOMAIN-SUFFIX,local,DIRECT\n")
+	builder.WriteString("IP-CIDR,127.0.0.0/8,DIRECT,no-resolve\n")
+	builder.WriteString("IP-CIDR,172.16.0.0/12,DIRECT,no-resolve\n")
+	builder.WriteString("IP-CIDR,192.168.0.0/16,DIRECT,no-resolve\n")
+	builder.WriteString("GEOIP,CN,DIRECT\n")
+	builder.WriteString(fmt.Sprintf("FINAL,%s\n", groupSelectName))
+}
+
+// quoteINIValue 为包含分隔符的值加引号
+func quoteINIValue(value string) string {
+	return "\"" + strings.ReplaceAll(value, "\"", "\\\"") + "\""
+}
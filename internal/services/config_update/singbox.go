@@ -0,0 +1,398 @@
+package config_update
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sing-box 配置中使用的固定出站标签
+const (
+	singboxSelectorTag = groupSelectName
+	singboxURLTestTag  = groupAutoName
+	singboxDirectTag   = "direct"
+)
+
+// supportedSingboxTypes sing-box 支持的节点类型（ssr 已在 sing-box 中移除）
+var supportedSingboxTypes = map[string]bool{
+	"vmess":     true,
+	"vless":     true,
+	"trojan":    true,
+	"ss":        true,
+	"hysteria":  true,
+	"hysteria2": true,
+	"tuic":      true,
+	"anytls":    true,
+	"naive":     true,
+}
+
+// GenerateSingboxConfig 生成 sing-box 配置，同时返回订阅响应头信息（订阅不存在时为 nil）
+func (s *ConfigUpdateService) GenerateSingboxConfig(token string, clientIP string, userAgent string) (string, *SubscriptionUserInfo, error) {
+	return s.GenerateTargetConfig(token, clientIP, userAgent, TargetSingbox)
+}
+
+// generateSingboxJSON 生成 sing-box JSON 配置（面向 sing-box 1.11+ 的规则动作语法）
+func (s *ConfigUpdateService) generateSingboxJSON(proxies []*ProxyNode) (string, error) {
+	usedNames := make(map[string]bool)
+	var tags []string
+	var nodeOutbounds []map[string]interface{}
+
+	for _, proxy := range proxies {
+		outbound := s.nodeToSingboxOutbound(proxy)
+		if outbound == nil {
+			continue
+		}
+
+		// 确保标签唯一
+		tag := proxy.Name
+		counter := 1
+		for usedNames[tag] || tag == singboxSelectorTag || tag == singboxURLTestTag || tag == singboxDirectTag {
+			tag = fmt.Sprintf("%s_%d", proxy.Name, counter)
+			counter++
+		}
+		usedNames[tag] = true
+		outbound["tag"] = tag
+
+		tags = append(tags, tag)
+		nodeOutbounds = append(nodeOutbounds, outbound)
+	}
+
+	// 代理组：没有可用节点时 urltest 不能为空，只保留直连
+	selectorOutbounds := []string{}
+	outbounds := make([]map[string]interface{}, 0, len(nodeOutbounds)+3)
+	if len(tags) > 0 {
+		selectorOutbounds = append(selectorOutbounds, singboxURLTestTag)
+		selectorOutbounds = append(selectorOutbounds, tags...)
+	}
+	selectorOutbounds = append(selectorOutbounds, singboxDirectTag)
+
+	outbounds = append(outbounds, map[string]interface{}{
+		"type":      "selector",
+		"tag":       singboxSelectorTag,
+		"outbounds": selectorOutbounds,
+		"default":   selectorOutbounds[0],
+	})
+	if len(tags) > 0 {
+		outbounds = append(outbounds, map[string]interface{}{
+			"type":      "urltest",
+			"tag":       singboxURLTestTag,
+			"outbounds": tags,
+			"url":       "https://www.gstatic.com/generate_204",
+			"interval":  "5m",
+			"tolerance": 50,
+		})
+	}
+	outbounds = append(outbounds, nodeOutbounds...)
+	outbounds = append(outbounds, map[string]interface{}{
+		"type": "direct",
+		"tag":  singboxDirectTag,
+	})
+
+	config := map[string]interface{}{
+		"log": map[string]interface{}{
+			"level":     "info",
+			"timestamp": true,
+		},
+		"inbounds": []map[string]interface{}{
+			{
+				"type":         "tun",
+				"tag":          "tun-in",
+				"address":      []string{"172.19.0.1/30", "fdfe:dcba:9876::1/126"},
+				"auto_route":   true,
+				"strict_route": true,
+				"stack":        "mixed",
+			},
+			{
+				"type":        "mixed",
+				"tag":         "mixed-in",
+				"listen":      "127.0.0.1",
+				"listen_port": 2080,
+			},
+		},
+		"outbounds": outbounds,
+		"route": map[string]interface{}{
+			"rules": []map[string]interface{}{
+				{"action": "sniff"},
+				{"protocol": "dns", "action": "hijack-dns"},
+				{"ip_is_private": true, "outbound": singboxDirectTag},
+				{"rule_set": []string{"geosite-cn", "geoip-cn"}, "outbound": singboxDirectTag},
+			},
+			"rule_set": []map[string]interface{}{
+				singboxRemoteRuleSet("geosite-cn", "https://raw.githubusercontent.com/SagerNet/sing-geosite/rule-set/geosite-cn.srs"),
+				singboxRemoteRuleSet("geoip-cn", "https://raw.githubusercontent.com/SagerNet/sing-geoip/rule-set/geoip-cn.srs"),
+			},
+			"final":                 singboxSelectorTag,
+			"auto_detect_interface": true,
+		},
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("生成 sing-box 配置失败: %v", err)
+	}
+	return string(data), nil
+}
+
+// singboxRemoteRuleSet 构建远程规则集（通过代理下载）
+func singboxRemoteRuleSet(tag, url string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":            "remote",
+		"tag":             tag,
+		"format":          "binary",
+		"url":             url,
+		"download_detour": singboxSelectorTag,
+	}
+}
+
+// nodeToSingboxOutbound 将节点转换为 sing-box 出站，不支持的类型返回 nil
+func (s *ConfigUpdateService) nodeToSingboxOutbound(node *ProxyNode) map[string]interface{} {
+	if !supportedSingboxTypes[node.Type] || node.Server == "" || node.Port <= 0 {
+		return nil
+	}
+
+	opts := node.Options
+	if opts == nil {
+		opts = make(map[string]interface{})
+	}
+	transportOpts := TransportOptsFromMap(opts)
+
+	outbound := map[string]interface{}{
+		"server":      node.Server,
+		"server_port": node.Port,
+	}
+
+	switch node.Type {
+	case "vmess":
+		outbound["type"] = "vmess"
+		outbound["uuid"] = node.UUID
+		outbound["security"] = firstNotEmpty(node.Cipher, "auto")
+		outbound["alter_id"] = getInt(opts, "alterId")
+		if node.TLS {
+			outbound["tls"] = singboxTLS(node, transportOpts, opts)
+		}
+		if transport := singboxTransport(node.Network, transportOpts); transport != nil {
+			outbound["transport"] = transport
+		}
+	case "vless":
+		outbound["type"] = "vless"
+		outbound["uuid"] = node.UUID
+		if flow := getString(opts, "flow", ""); flow != "" {
+			outbound["flow"] = flow
+		}
+		outbound["packet_encoding"] = "xudp"
+		if node.TLS || transportOpts.RealityOpts != nil {
+			outbound["tls"] = singboxTLS(node, transportOpts, opts)
+		}
+		if transport := singboxTransport(node.Network, transportOpts); transport != nil {
+			outbound["transport"] = transport
+		}
+	case "trojan":
+		outbound["type"] = "trojan"
+		outbound["password"] = node.Password
+		// trojan 协议本身基于 TLS
+		outbound["tls"] = singboxTLS(node, transportOpts, opts)
+		if transport := singboxTransport(node.Network, transportOpts); transport != nil {
+			outbound["transport"] = transport
+		}
+	case "ss":
+		outbound["type"] = "shadowsocks"
+		outbound["method"] = node.Cipher
+		outbound["password"] = node.Password
+	case "hysteria":
+		outbound["type"] = "hysteria"
+		if auth := getString(opts, "auth", ""); auth != "" {
+			outbound["auth_str"] = auth
+		}
+		outbound["up_mbps"] = parseMbps(getString(opts, "up", ""), 50)
+		outbound["down_mbps"] = parseMbps(getString(opts, "down", ""), 100)
+		outbound["tls"] = singboxTLS(node, transportOpts, opts)
+	case "hysteria2":
+		outbound["type"] = "hysteria2"
+		outbound["password"] = node.Password
+		if up := parseMbps(getString(opts, "up", ""), 0); up > 0 {
+			outbound["up_mbps"] = up
+		}
+		if down := parseMbps(getString(opts, "down", ""), 0); down > 0 {
+			outbound["down_mbps"] = down
+		}
+		if obfs := getString(opts, "obfs", ""); obfs != "" {
+			outbound["obfs"] = map[string]interface{}{
+				"type":     obfs,
+				"password": getString(opts, "obfs-password", ""),
+			}
+		}
+		outbound["tls"] = singboxTLS(node, transportOpts, opts)
+	case "tuic":
+		outbound["type"] = "tuic"
+		outbound["uuid"] = node.UUID
+		outbound["password"] = node.Password
+		if cc := getString(opts, "congestion_control", ""); cc != "" {
+			outbound["congestion_control"] = cc
+		}
+		if mode := getString(opts, "udp_relay_mode", ""); mode != "" {
+			outbound["udp_relay_mode"] = mode
+		}
+		outbound["tls"] = singboxTLS(node, transportOpts, opts)
+	case "anytls":
+		outbound["type"] = "anytls"
+		// anytls 链接中的密码存放在 UUID 字段
+		outbound["password"] = firstNotEmpty(node.Password, node.UUID)
+		outbound["tls"] = singboxTLS(node, transportOpts, opts)
+	case "naive":
+		// naive 服务端兼容标准 HTTPS 代理，使用 http 出站 + TLS 以兼容各版本 sing-box
+		outbound["type"] = "http"
+		if node.UUID != "" {
+			outbound["username"] = node.UUID
+		}
+		if node.Password != "" {
+			outbound["password"] = node.Password
+		}
+		outbound["tls"] = singboxTLS(node, transportOpts, opts)
+	}
+
+	return outbound
+}
+
+// singboxTLS 构建 sing-box TLS 配置
+func singboxTLS(node *ProxyNode, transportOpts *TransportOpts, opts map[string]interface{}) map[string]interface{} {
+	tls := map[string]interface{}{
+		"enabled":     true,
+		"server_name": firstNotEmpty(transportOpts.SNI, getString(opts, "peer", ""), getString(opts, "sni", ""), node.Server),
+	}
+	if transportOpts.SkipCertVerify {
+		tls["insecure"] = true
+	}
+	if alpn := getStringSlice(opts, "alpn"); len(alpn) > 0 {
+		tls["alpn"] = alpn
+	}
+
+	fingerprint := transportOpts.ClientFingerprint
+	if transportOpts.RealityOpts != nil {
+		tls["reality"] = map[string]interface{}{
+			"enabled":    true,
+			"public_key": transportOpts.RealityOpts.PublicKey,
+			"short_id":   transportOpts.RealityOpts.ShortID,
+		}
+		// reality 必须启用 uTLS
+		if fingerprint == "" {
+			fingerprint = "chrome"
+		}
+	}
+	if fingerprint != "" {
+		tls["utls"] = map[string]interface{}{
+			"enabled":     true,
+			"fingerprint": fingerprint,
+		}
+	}
+	return tls
+}
+
+// singboxTransport 构建 sing-box 传输层配置，tcp 返回 nil
+func singboxTransport(network string, transportOpts *TransportOpts) map[string]interface{} {
+	switch network {
+	case "ws":
+		path, host := "/", ""
+		if transportOpts.WSOpts != nil {
+			if transportOpts.WSOpts.Path != "" {
+				path = transportOpts.WSOpts.Path
+			}
+			host = transportOpts.WSOpts.Headers["Host"]
+		}
+		if transportOpts.WSOpts != nil && transportOpts.WSOpts.V2rayHTTPUpgrade {
+			transport := map[string]interface{}{
+				"type": "httpupgrade",
+				"path": path,
+			}
+			if host != "" {
+				transport["host"] = host
+			}
+			return transport
+		}
+
+		transport := map[string]interface{}{
+			"type": "ws",
+		}
+		// 路径中的 ?ed=2048 转换为 sing-box 的 early data 配置
+		if idx := strings.Index(path, "?ed="); idx >= 0 {
+			if ed, err := strconv.Atoi(path[idx+4:]); err == nil && ed > 0 {
+				transport["max_early_data"] = ed
+				transport["early_data_header_name"] = "Sec-WebSocket-Protocol"
+				path = path[:idx]
+			}
+		}
+		transport["path"] = path
+		if host != "" {
+			transport["headers"] = map[string]string{"Host": host}
+		}
+		return transport
+	case "grpc":
+		transport := map[string]interface{}{
+			"type": "grpc",
+		}
+		if transportOpts.GRPCOpts != nil && transportOpts.GRPCOpts.GRPCServiceName != "" {
+			transport["service_name"] = transportOpts.GRPCOpts.GRPCServiceName
+		}
+		return transport
+	case "h2", "http":
+		transport := map[string]interface{}{
+			"type": "http",
+		}
+		if transportOpts.H2Opts != nil {
+			if transportOpts.H2Opts.Path != "" {
+				transport["path"] = transportOpts.H2Opts.Path
+			}
+			if len(transportOpts.H2Opts.Host) > 0 {
+				transport["host"] = transportOpts.H2Opts.Host
+			}
+		}
+		return transport
+	case "httpupgrade":
+		transport := map[string]interface{}{
+			"type": "httpupgrade",
+		}
+		if transportOpts.WSOpts != nil {
+			transport["path"] = firstNotEmpty(transportOpts.WSOpts.Path, "/")
+			if host := transportOpts.WSOpts.Headers["Host"]; host != "" {
+				transport["host"] = host
+			}
+		}
+		return transport
+	default:
+		return nil
+	}
+}
+
+// getStringSlice 读取字符串列表选项（兼容 []string、[]interface{} 和逗号分隔字符串）
+func getStringSlice(m map[string]interface{}, key string) []string {
+	switch v := m[key].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok && str != "" {
+				result = append(result, str)
+			}
+		}
+		return result
+	case string:
+		if v == "" {
+			return nil
+		}
+		return strings.Split(v, ",")
+	}
+	return nil
+}
+
+// parseMbps 解析 "100 mbps" 形式的带宽值
+func parseMbps(value string, defaultValue int) int {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return defaultValue
+	}
+	if n, err := strconv.Atoi(fields[0]); err == nil && n > 0 {
+		return n
+	}
+	return defaultValue
+}
@@ -0,0 +1,91 @@
+package config_update
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestGenerateSingboxJSON 测试 sing-box 配置生成
+func TestGenerateSingboxJSON(t *testing.T) {
+	s := &ConfigUpdateService{}
+
+	vless, err := ParseNodeLink("vless://11111111-2222-3333-4444-555555555555@example.com:443?security=reality&pbk=PUBKEY&sid=abcd&flow=xtls-rprx-vision&type=tcp&sni=www.microsoft.com#香港-Reality")
+	if err != nil {
+		t.Fatalf("解析 vless 链接失败: %v", err)
+	}
+	trojan, err := ParseNodeLink("trojan://pass@trojan.example.com:443?type=ws&path=%2Fws%3Fed%3D2048&host=cdn.example.com#日本-Trojan")
+	if err != nil {
+		t.Fatalf("解析 trojan 链接失败: %v", err)
+	}
+	ssr := &ProxyNode{Name: "SSR", Type: "ssr", Server: "ssr.example.com", Port: 443}
+
+	cfg, err := s.generateSingboxJSON([]*ProxyNode{vless, trojan, ssr, vless})
+	if err != nil {
+		t.Fatalf("生成 sing-box 配置失败: %v", err)
+	}
+
+	var parsed struct {
+		Outbounds []map[string]interface{} `json:"outbounds"`
+	}
+	if err := json.Unmarshal([]byte(cfg), &parsed); err != nil {
+		t.Fatalf("生成的配置不是合法 JSON: %v", err)
+	}
+
+	byTag := make(map[string]map[string]interface{})
+	for _, ob := range parsed.Outbounds {
+		byTag[ob["tag"].(string)] = ob
+	}
+
+	// ssr 不支持，应被跳过；重复名称应被重命名
+	if _, ok := byTag["SSR"]; ok {
+		t.Error("ssr 节点不应出现在 sing-box 配置中")
+	}
+	if _, ok := byTag["香港-Reality_1"]; !ok {
+		t.Error("重复的节点名称应被重命名为唯一标签")
+	}
+
+	reality := byTag["香港-Reality"]
+	if reality["type"] != "vless" || reality["flow"] != "xtls-rprx-vision" {
+		t.Errorf("vless 出站转换错误: %v", reality)
+	}
+	tls, _ := reality["tls"].(map[string]interface{})
+	realityOpts, _ := tls["reality"].(map[string]interface{})
+	if realityOpts["public_key"] != "PUBKEY" || realityOpts["short_id"] != "abcd" {
+		t.Errorf("reality 配置转换错误: %v", tls)
+	}
+	if utls, _ := tls["utls"].(map[string]interface{}); utls["fingerprint"] != "chrome" {
+		t.Errorf("reality 应默认启用 uTLS: %v", tls)
+	}
+
+	transport, _ := byTag["日本-Trojan"]["transport"].(map[string]interface{})
+	if transport["type"] != "ws" || transport["path"] != "/ws" || transport["max_early_data"] != float64(2048) {
+		t.Errorf("ws 传输层转换错误: %v", transport)
+	}
+
+	urltest := byTag[singboxURLTestTag]
+	if members, _ := urltest["outbounds"].([]interface{}); len(members) != 3 {
+		t.Errorf("自动选择组应包含 3 个节点，实际为 %v", urltest["outbounds"])
+	}
+}
+
+// TestGenerateSingboxJSONEmpty 测试无可用节点时的配置
+func TestGenerateSingboxJSONEmpty(t *testing.T) {
+	s := &ConfigUpdateService{}
+
+	cfg, err := s.generateSingboxJSON(nil)
+	if err != nil {
+		t.Fatalf("生成 sing-box 配置失败: %v", err)
+	}
+
+	var parsed struct {
+		Outbounds []map[string]interface{} `json:"outbounds"`
+	}
+	if err := json.Unmarshal([]byte(cfg), &parsed); err != nil {
+		t.Fatalf("生成的配置不是合法 JSON: %v", err)
+	}
+	for _, ob := range parsed.Outbounds {
+		if ob["type"] == "urltest" {
+			t.Error("没有节点时不应生成 urltest 组")
+		}
+	}
+}
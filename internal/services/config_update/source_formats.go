@@ -0,0 +1,440 @@
+package config_update
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 节点源内容格式
+const (
+	SourceFormatLinks   = "links"   // 节点链接列表（可 Base64 编码）
+	SourceFormatClash   = "clash"   // Clash / Mihomo 配置（proxies）
+	SourceFormatSingbox = "singbox" // sing-box 配置（outbounds）
+)
+
+// importableNodeTypes 可从结构化配置导入的节点类型（与链接解析支持的协议一致）
+var importableNodeTypes = map[string]bool{
+	"vmess":     true,
+	"vless":     true,
+	"trojan":    true,
+	"ss":        true,
+	"ssr":       true,
+	"hysteria":  true,
+	"hysteria2": true,
+	"tuic":      true,
+	"anytls":    true,
+}
+
+// singboxNonProxyTypes sing-box 中不代表节点的出站类型，解析时直接跳过
+var singboxNonProxyTypes = map[string]bool{
+	"direct":   true,
+	"block":    true,
+	"dns":      true,
+	"selector": true,
+	"urltest":  true,
+}
+
+// ParseStructuredNodes 解析 Clash YAML（proxies）或 sing-box JSON（outbounds）格式的节点源
+// 内容不是这两种格式时 ok 为 false，调用方应按节点链接列表处理
+func ParseStructuredNodes(content []byte) (results []ParseResult, format string, ok bool) {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")))
+	if len(trimmed) == 0 {
+		return nil, "", false
+	}
+
+	if trimmed[0] == '{' {
+		var doc struct {
+			Outbounds []map[string]interface{} `json:"outbounds"`
+			Proxies   []map[string]interface{} `json:"proxies"`
+		}
+		if err := json.Unmarshal(trimmed, &doc); err == nil {
+			if doc.Outbounds != nil {
+				return parseSingboxOutbounds(doc.Outbounds), SourceFormatSingbox, true
+			}
+			if doc.Proxies != nil {
+				return parseClashProxies(doc.Proxies), SourceFormatClash, true
+			}
+		}
+		return nil, "", false
+	}
+
+	if !bytes.Contains(trimmed, []byte("proxies:")) {
+		return nil, "", false
+	}
+	var doc struct {
+		Proxies []map[string]interface{} `yaml:"proxies"`
+	}
+	if err := yaml.Unmarshal(trimmed, &doc); err != nil || doc.Proxies == nil {
+		return nil, "", false
+	}
+	return parseClashProxies(doc.Proxies), SourceFormatClash, true
+}
+
+// ==========================================
+// Clash
+// ==========================================
+
+// clashBaseKeys Clash 节点中对应 ProxyNode 基础字段的键，其余键保存到 Options
+var clashBaseKeys = map[string]bool{
+	"name": true, "type": true, "server": true, "port": true, "uuid": true,
+	"password": true, "cipher": true, "network": true, "tls": true, "udp": true,
+}
+
+// parseClashProxies 解析 Clash 配置中的 proxies 列表
+func parseClashProxies(proxies []map[string]interface{}) []ParseResult {
+	results := make([]ParseResult, 0, len(proxies))
+	for i, proxy := range proxies {
+		node, err := clashProxyToNode(proxy)
+		results = append(results, structuredResult(SourceFormatClash, i, proxy["name"], node, err))
+	}
+	return results
+}
+
+// clashProxyToNode 将 Clash 节点转换为 ProxyNode，选项键统一为链接解析使用的形式
+func clashProxyToNode(proxy map[string]interface{}) (*ProxyNode, error) {
+	node := &ProxyNode{
+		Name:     strings.TrimSpace(getString(proxy, "name", "")),
+		Type:     getString(proxy, "type", ""),
+		Server:   getString(proxy, "server", ""),
+		Port:     getInt(proxy, "port"),
+		UUID:     getString(proxy, "uuid", ""),
+		Password: getString(proxy, "password", ""),
+		Cipher:   getString(proxy, "cipher", ""),
+		Network:  getString(proxy, "network", ""),
+		TLS:      getBool(proxy, "tls", false),
+		UDP:      getBool(proxy, "udp", false),
+		Options:  make(map[string]interface{}),
+	}
+	for key, value := range proxy {
+		if !clashBaseKeys[key] {
+			node.Options[key] = value
+		}
+	}
+
+	opts := node.Options
+	switch node.Type {
+	case "vmess":
+		if _, ok := opts["alterId"]; !ok {
+			opts["alterId"] = 0
+		}
+		node.Network = firstNotEmpty(node.Network, "tcp")
+	case "vless", "trojan":
+		node.Network = firstNotEmpty(node.Network, "tcp")
+	case "hysteria":
+		renameOption(opts, "auth-str", "auth")
+		normalizeMbpsOption(opts, "up")
+		normalizeMbpsOption(opts, "down")
+	case "hysteria2":
+		normalizeMbpsOption(opts, "up")
+		normalizeMbpsOption(opts, "down")
+	case "tuic":
+		renameOption(opts, "congestion-controller", "congestion_control")
+		renameOption(opts, "udp-relay-mode", "udp_relay_mode")
+	}
+	// trojan / hysteria 等类型在 Clash 中使用 sni 指定服务器名称
+	if node.Type != "ss" && node.Type != "ssr" {
+		if _, ok := opts["servername"]; !ok {
+			renameOption(opts, "sni", "servername")
+		}
+	}
+	// 以下协议本身基于 TLS
+	switch node.Type {
+	case "trojan", "hysteria2", "tuic", "anytls":
+		node.TLS = true
+	}
+
+	if err := validateStructuredNode(node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// normalizeMbpsOption 将带宽选项统一为 "100 mbps" 形式
+func normalizeMbpsOption(opts map[string]interface{}, key string) {
+	switch v := opts[key].(type) {
+	case int:
+		opts[key] = fmt.Sprintf("%d mbps", v)
+	case float64:
+		opts[key] = fmt.Sprintf("%d mbps", int(v))
+	case string:
+		if n := parseMbps(v, 0); n > 0 {
+			opts[key] = fmt.Sprintf("%d mbps", n)
+		}
+	}
+}
+
+// ==========================================
+// sing-box
+// ==========================================
+
+// parseSingboxOutbounds 解析 sing-box 配置中的 outbounds 列表，跳过分组、直连等非节点出站
+func parseSingboxOutbounds(outbounds []map[string]interface{}) []ParseResult {
+	results := make([]ParseResult, 0, len(outbounds))
+	for i, outbound := range outbounds {
+		if singboxNonProxyTypes[getString(outbound, "type", "")] {
+			continue
+		}
+		node, err := singboxOutboundToNode(outbound)
+		results = append(results, structuredResult(SourceFormatSingbox, i, outbound["tag"], node, err))
+	}
+	return results
+}
+
+// singboxOutboundToNode 将 sing-box 出站转换为 ProxyNode
+func singboxOutboundToNode(outbound map[string]interface{}) (*ProxyNode, error) {
+	node := &ProxyNode{
+		Name:    strings.TrimSpace(getString(outbound, "tag", "")),
+		Server:  getString(outbound, "server", ""),
+		Port:    getInt(outbound, "server_port"),
+		UDP:     true,
+		Options: make(map[string]interface{}),
+	}
+	opts := node.Options
+
+	outboundType := getString(outbound, "type", "")
+	switch outboundType {
+	case "vmess":
+		node.Type = "vmess"
+		node.UUID = getString(outbound, "uuid", "")
+		node.Cipher = firstNotEmpty(getString(outbound, "security", ""), "auto")
+		opts["alterId"] = getInt(outbound, "alter_id")
+	case "vless":
+		node.Type = "vless"
+		node.UUID = getString(outbound, "uuid", "")
+		if flow := getString(outbound, "flow", ""); flow != "" {
+			opts["flow"] = flow
+		}
+	case "trojan":
+		node.Type = "trojan"
+		node.Password = getString(outbound, "password", "")
+		node.TLS = true
+	case "shadowsocks":
+		node.Type = "ss"
+		node.UDP = false
+		node.Cipher = getString(outbound, "method", "")
+		node.Password = getString(outbound, "password", "")
+		if plugin := getString(outbound, "plugin", ""); plugin != "" {
+			setSingboxSSPlugin(opts, plugin, getString(outbound, "plugin_opts", ""))
+		}
+	case "hysteria":
+		node.Type = "hysteria"
+		if auth := getString(outbound, "auth_str", ""); auth != "" {
+			opts["auth"] = auth
+		}
+		if up := getInt(outbound, "up_mbps"); up > 0 {
+			opts["up"] = fmt.Sprintf("%d mbps", up)
+		}
+		if down := getInt(outbound, "down_mbps"); down > 0 {
+			opts["down"] = fmt.Sprintf("%d mbps", down)
+		}
+	case "hysteria2":
+		node.Type = "hysteria2"
+		node.Password = getString(outbound, "password", "")
+		node.TLS = true
+		if up := getInt(outbound, "up_mbps"); up > 0 {
+			opts["up"] = fmt.Sprintf("%d mbps", up)
+		}
+		if down := getInt(outbound, "down_mbps"); down > 0 {
+			opts["down"] = fmt.Sprintf("%d mbps", down)
+		}
+		if obfs, ok := outbound["obfs"].(map[string]interface{}); ok {
+			if obfsType := getString(obfs, "type", ""); obfsType != "" {
+				opts["obfs"] = obfsType
+				opts["obfs-password"] = getString(obfs, "password", "")
+			}
+		}
+	case "tuic":
+		node.Type = "tuic"
+		node.UUID = getString(outbound, "uuid", "")
+		node.Password = getString(outbound, "password", "")
+		node.TLS = true
+		if cc := getString(outbound, "congestion_control", ""); cc != "" {
+			opts["congestion_control"] = cc
+		}
+		if mode := getString(outbound, "udp_relay_mode", ""); mode != "" {
+			opts["udp_relay_mode"] = mode
+		}
+	case "anytls":
+		node.Type = "anytls"
+		node.Password = getString(outbound, "password", "")
+		node.TLS = true
+	default:
+		return nil, fmt.Errorf("不支持的出站类型: %s", outboundType)
+	}
+
+	if tls, ok := outbound["tls"].(map[string]interface{}); ok && getBool(tls, "enabled", false) {
+		node.TLS = true
+		applySingboxTLS(opts, tls)
+	}
+	if transport, ok := outbound["transport"].(map[string]interface{}); ok {
+		node.Network = applySingboxTransport(opts, transport)
+	}
+	if node.Network == "" && (node.Type == "vmess" || node.Type == "vless" || node.Type == "trojan") {
+		node.Network = "tcp"
+	}
+
+	if err := validateStructuredNode(node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// applySingboxTLS 将 sing-box TLS 配置转换为节点选项
+func applySingboxTLS(opts map[string]interface{}, tls map[string]interface{}) {
+	if serverName := getString(tls, "server_name", ""); serverName != "" {
+		opts["servername"] = serverName
+	}
+	opts["skip-cert-verify"] = getBool(tls, "insecure", false)
+	if alpn := getStringSlice(tls, "alpn"); len(alpn) > 0 {
+		opts["alpn"] = alpn
+	}
+	if utls, ok := tls["utls"].(map[string]interface{}); ok && getBool(utls, "enabled", false) {
+		if fp := getString(utls, "fingerprint", ""); fp != "" {
+			opts["client-fingerprint"] = fp
+		}
+	}
+	if reality, ok := tls["reality"].(map[string]interface{}); ok && getBool(reality, "enabled", false) {
+		realityOpts := map[string]interface{}{"public-key": getString(reality, "public_key", "")}
+		if sid := getString(reality, "short_id", ""); sid != "" {
+			realityOpts["short-id"] = sid
+		}
+		opts["reality-opts"] = realityOpts
+	}
+}
+
+// applySingboxTransport 将 sing-box 传输层配置转换为节点选项，返回对应的 network
+func applySingboxTransport(opts map[string]interface{}, transport map[string]interface{}) string {
+	switch getString(transport, "type", "") {
+	case "ws":
+		path := firstNotEmpty(getString(transport, "path", ""), "/")
+		// early data 还原为路径中的 ?ed= 参数
+		if ed := getInt(transport, "max_early_data"); ed > 0 && getString(transport, "early_data_header_name", "") == "Sec-WebSocket-Protocol" {
+			path = fmt.Sprintf("%s?ed=%d", path, ed)
+		}
+		wsOpts := map[string]interface{}{"path": path}
+		if headers, ok := transport["headers"].(map[string]interface{}); ok {
+			wsHeaders := make(map[string]string)
+			for k, v := range headers {
+				// sing-box 的请求头可以是字符串或字符串列表
+				switch value := v.(type) {
+				case string:
+					wsHeaders[k] = value
+				case []interface{}:
+					if len(value) > 0 {
+						wsHeaders[k] = fmt.Sprint(value[0])
+					}
+				}
+			}
+			if len(wsHeaders) > 0 {
+				wsOpts["headers"] = wsHeaders
+			}
+		}
+		opts["ws-opts"] = wsOpts
+		return "ws"
+	case "httpupgrade":
+		wsOpts := map[string]interface{}{
+			"path":               firstNotEmpty(getString(transport, "path", ""), "/"),
+			"v2ray-http-upgrade": true,
+		}
+		if host := getString(transport, "host", ""); host != "" {
+			wsOpts["headers"] = map[string]string{"Host": host}
+		}
+		opts["ws-opts"] = wsOpts
+		return "ws"
+	case "grpc":
+		opts["grpc-opts"] = map[string]interface{}{"grpc-service-name": getString(transport, "service_name", "")}
+		return "grpc"
+	case "http":
+		h2Opts := map[string]interface{}{"path": firstNotEmpty(getString(transport, "path", ""), "/")}
+		if hosts := getStringSlice(transport, "host"); len(hosts) > 0 {
+			h2Opts["host"] = hosts
+		}
+		opts["h2-opts"] = h2Opts
+		return "h2"
+	}
+	return ""
+}
+
+// setSingboxSSPlugin 将 sing-box 的 SS 插件配置（k=v;k=v）转换为 Clash 插件选项
+func setSingboxSSPlugin(opts map[string]interface{}, plugin, pluginOpts string) {
+	values := make(map[string]string)
+	for _, part := range strings.Split(pluginOpts, ";") {
+		if k, v, found := strings.Cut(part, "="); found {
+			values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		} else if part = strings.TrimSpace(part); part != "" {
+			values[part] = "true"
+		}
+	}
+
+	switch plugin {
+	case "obfs-local", "simple-obfs":
+		opts["plugin"] = "obfs"
+		opts["plugin-opts"] = map[string]interface{}{"mode": values["obfs"], "host": values["obfs-host"]}
+	case "v2ray-plugin":
+		pluginMap := map[string]interface{}{
+			"mode": firstNotEmpty(values["mode"], "websocket"),
+			"tls":  values["tls"] == "true",
+		}
+		if host := values["host"]; host != "" {
+			pluginMap["host"] = host
+		}
+		if path := values["path"]; path != "" {
+			pluginMap["path"] = path
+		}
+		opts["plugin"] = "v2ray-plugin"
+		opts["plugin-opts"] = pluginMap
+	default:
+		opts["plugin"] = plugin
+		if pluginOpts != "" {
+			opts["plugin-opts"] = pluginOpts
+		}
+	}
+}
+
+// ==========================================
+// Helpers
+// ==========================================
+
+// validateStructuredNode 检查结构化配置中解析出的节点是否完整
+func validateStructuredNode(node *ProxyNode) error {
+	if !importableNodeTypes[node.Type] {
+		return fmt.Errorf("不支持的节点类型: %s", node.Type)
+	}
+	if node.Server == "" {
+		return fmt.Errorf("缺少服务器地址")
+	}
+	if node.Port <= 0 || node.Port > 65535 {
+		return fmt.Errorf("无效的端口: %d", node.Port)
+	}
+	switch node.Type {
+	case "vmess", "vless", "tuic":
+		if node.UUID == "" {
+			return fmt.Errorf("缺少 UUID")
+		}
+	case "trojan", "ss", "ssr", "hysteria2", "anytls":
+		if node.Password == "" {
+			return fmt.Errorf("缺少密码")
+		}
+	}
+	if node.Name == "" {
+		node.Name = fmt.Sprintf("%s-%s:%d", strings.ToUpper(node.Type), node.Server, node.Port)
+	}
+	return nil
+}
+
+// structuredResult 生成结构化配置的解析结果，Link 字段记录来源位置用于日志和去重
+func structuredResult(format string, index int, name interface{}, node *ProxyNode, err error) ParseResult {
+	link := format + "#" + strconv.Itoa(index)
+	if s, ok := name.(string); ok && s != "" {
+		link += " " + s
+	}
+	if err != nil {
+		return ParseResult{Err: fmt.Errorf("解析失败 [%s]: %w", link, err), Link: link}
+	}
+	return ParseResult{Node: node, Link: link}
+}
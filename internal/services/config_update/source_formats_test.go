@@ -0,0 +1,152 @@
+package config_update
+
+import (
+	"testing"
+)
+
+// TestParseClashProxies 测试 Clash 配置导入
+func TestParseClashProxies(t *testing.T) {
+	content := `
+port: 7890
+proxies:
+  - name: 香港 01
+    type: vmess
+    server: hk.example.com
+    port: 443
+    uuid: 11111111-2222-3333-4444-555555555555
+    alterId: 0
+    cipher: auto
+    tls: true
+    servername: cdn.example.com
+    network: ws
+    ws-opts:
+      path: /ray
+      headers:
+        Host: cdn.example.com
+  - name: 日本 Trojan
+    type: trojan
+    server: jp.example.com
+    port: "443"
+    password: pass
+    sni: jp.example.com
+    skip-cert-verify: true
+  - {name: 美国 TUIC, type: tuic, server: us.example.com, port: 443, uuid: u, password: p, congestion-controller: bbr}
+  - {name: 缺少服务器, type: ss, port: 8388, cipher: aes-128-gcm, password: p}
+proxy-groups: []
+`
+	results, format, ok := ParseStructuredNodes([]byte(content))
+	if !ok || format != SourceFormatClash {
+		t.Fatalf("应识别为 Clash 配置: %v %s", ok, format)
+	}
+	if len(results) != 4 {
+		t.Fatalf("解析结果数量错误: %d", len(results))
+	}
+
+	vmess := results[0].Node
+	if vmess == nil || vmess.Type != "vmess" || vmess.Network != "ws" || !vmess.TLS {
+		t.Fatalf("vmess 节点解析错误: %+v", vmess)
+	}
+	wsOpts := TransportOptsFromMap(vmess.Options).WSOpts
+	if wsOpts == nil || wsOpts.Path != "/ray" || wsOpts.Headers["Host"] != "cdn.example.com" {
+		t.Errorf("ws 传输选项解析错误: %+v", wsOpts)
+	}
+
+	trojan := results[1].Node
+	if trojan == nil || trojan.Port != 443 || trojan.Options["servername"] != "jp.example.com" || trojan.Network != "tcp" {
+		t.Errorf("trojan 节点解析错误（sni 应转换为 servername）: %+v", trojan)
+	}
+	if _, ok := trojan.Options["sni"]; ok {
+		t.Error("sni 转换后不应保留")
+	}
+
+	if tuic := results[2].Node; tuic == nil || tuic.Options["congestion_control"] != "bbr" || !tuic.TLS {
+		t.Errorf("tuic 选项应统一为链接解析的形式: %+v", tuic)
+	}
+	if results[3].Err == nil {
+		t.Error("缺少服务器地址的节点应解析失败")
+	}
+}
+
+// TestParseSingboxOutbounds 测试 sing-box 配置导入
+func TestParseSingboxOutbounds(t *testing.T) {
+	content := `{
+  "outbounds": [
+    {"type": "selector", "tag": "proxy", "outbounds": ["香港-Reality"]},
+    {"type": "vless", "tag": "香港-Reality", "server": "example.com", "server_port": 443,
+     "uuid": "11111111-2222-3333-4444-555555555555", "flow": "xtls-rprx-vision",
+     "tls": {"enabled": true, "server_name": "www.microsoft.com",
+             "utls": {"enabled": true, "fingerprint": "chrome"},
+             "reality": {"enabled": true, "public_key": "PUBKEY", "short_id": "abcd"}}},
+    {"type": "trojan", "tag": "日本-WS", "server": "jp.example.com", "server_port": 443, "password": "pass",
+     "tls": {"enabled": true, "server_name": "cdn.example.com"},
+     "transport": {"type": "ws", "path": "/ws", "headers": {"Host": "cdn.example.com"},
+                   "max_early_data": 2048, "early_data_header_name": "Sec-WebSocket-Protocol"}},
+    {"type": "shadowsocks", "tag": "SS-Obfs", "server": "ss.example.com", "server_port": 8388,
+     "method": "aes-128-gcm", "password": "p", "plugin": "obfs-local", "plugin_opts": "obfs=http;obfs-host=bing.com"},
+    {"type": "wireguard", "tag": "WG"},
+    {"type": "direct", "tag": "direct"}
+  ]
+}`
+	results, format, ok := ParseStructuredNodes([]byte(content))
+	if !ok || format != SourceFormatSingbox {
+		t.Fatalf("应识别为 sing-box 配置: %v %s", ok, format)
+	}
+	if len(results) != 4 {
+		t.Fatalf("分组和直连出站应被跳过，实际结果数量: %d", len(results))
+	}
+
+	vless := results[0].Node
+	if vless == nil || vless.Network != "tcp" || vless.Options["flow"] != "xtls-rprx-vision" {
+		t.Fatalf("vless 节点解析错误: %+v", vless)
+	}
+	opts := TransportOptsFromMap(vless.Options)
+	if opts.RealityOpts == nil || opts.RealityOpts.PublicKey != "PUBKEY" || opts.RealityOpts.ShortID != "abcd" ||
+		opts.SNI != "www.microsoft.com" || opts.ClientFingerprint != "chrome" {
+		t.Errorf("reality 配置解析错误: %+v", opts)
+	}
+
+	trojan := results[1].Node
+	wsOpts := TransportOptsFromMap(trojan.Options).WSOpts
+	if trojan.Network != "ws" || wsOpts == nil || wsOpts.Path != "/ws?ed=2048" || wsOpts.Headers["Host"] != "cdn.example.com" {
+		t.Errorf("ws 传输解析错误: %+v %+v", trojan, wsOpts)
+	}
+
+	ss := results[2].Node
+	pluginOpts, _ := ss.Options["plugin-opts"].(map[string]interface{})
+	if ss.Type != "ss" || ss.Options["plugin"] != "obfs" || pluginOpts["mode"] != "http" || pluginOpts["host"] != "bing.com" {
+		t.Errorf("ss 插件解析错误: %+v", ss)
+	}
+	if results[3].Err == nil {
+		t.Error("不支持的出站类型应解析失败")
+	}
+}
+
+// TestSingboxRoundTrip 测试生成的 sing-box 配置可重新导入
+func TestSingboxRoundTrip(t *testing.T) {
+	s := &ConfigUpdateService{}
+	original, err := ParseNodeLink("vless://11111111-2222-3333-4444-555555555555@example.com:443?security=tls&type=grpc&serviceName=svc&sni=sni.example.com#Node")
+	if err != nil {
+		t.Fatalf("解析链接失败: %v", err)
+	}
+	cfg, err := s.generateSingboxJSON([]*ProxyNode{original})
+	if err != nil {
+		t.Fatalf("生成配置失败: %v", err)
+	}
+
+	results, _, ok := ParseStructuredNodes([]byte(cfg))
+	if !ok || len(results) != 1 || results[0].Node == nil {
+		t.Fatalf("重新导入失败: %+v", results)
+	}
+	node := results[0].Node
+	opts := TransportOptsFromMap(node.Options)
+	if node.Name != "Node" || node.Network != "grpc" || opts.GRPCOpts == nil || opts.GRPCOpts.GRPCServiceName != "svc" || opts.SNI != "sni.example.com" {
+		t.Errorf("重新导入的节点与原节点不一致: %+v", node)
+	}
+}
+
+// TestParseStructuredNodesIgnoresLinks 节点链接列表不应识别为结构化配置
+func TestParseStructuredNodesIgnoresLinks(t *testing.T) {
+	if _, _, ok := ParseStructuredNodes([]byte("trojan://pass@example.com:443#A\nvless://id@example.com:443#B")); ok {
+		t.Error("节点链接列表不应识别为结构化配置")
+	}
+}
@@ -0,0 +1,715 @@
+package config_update
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// updatePlanTTL 预览生成的更新计划保留时长，过期后需重新预览
+const updatePlanTTL = 30 * time.Minute
+
+// UpdatePlan 节点源更新计划：拉取并解析节点源后与 nodes 表比较得到的差异
+// 预览（dry-run）只生成计划不写入；应用时按计划逐项写入，不会重新拉取节点源
+type UpdatePlan struct {
+	ID        string        `json:"plan_id"`
+	CreatedAt time.Time     `json:"created_at"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	Summary   PlanSummary   `json:"summary"`
+	Sources   []*SourcePlan `json:"sources"`
+
+	fullRun bool // 是否为全部节点源的更新（应用后记录全局最后更新时间）
+}
+
+// PlanSummary 更新计划汇总
+type PlanSummary struct {
+	Added         int `json:"added"`
+	Removed       int `json:"removed"`
+	Changed       int `json:"changed"`
+	Renamed       int `json:"renamed"`
+	Unchanged     int `json:"unchanged"`
+	Filtered      int `json:"filtered"`
+	Duplicates    int `json:"duplicates"`
+	ParseFailed   int `json:"parse_failed"`
+	FailedSources int `json:"failed_sources"`
+}
+
+// SourcePlan 单个节点源的差异
+// Error 不为空时表示拉取或解析失败，该节点源不会产生任何变更
+type SourcePlan struct {
+	SourceID    uint            `json:"source_id"`
+	SourceName  string          `json:"source_name"`
+	Format      string          `json:"format,omitempty"` // 节点源内容格式：links / clash / singbox
+	Error       string          `json:"error,omitempty"`
+	Added       []NodeChange    `json:"added"`
+	Removed     []NodeChange    `json:"removed"`
+	Changed     []NodeChange    `json:"changed"`
+	Renamed     []NodeChange    `json:"renamed"`
+	Unchanged   int             `json:"unchanged"`
+	Filtered    []FilteredNode  `json:"filtered"`
+	Duplicates  []DuplicateNode `json:"duplicates"`
+	ParseFailed int             `json:"parse_failed"`
+}
+
+// NodeChange 单个节点的变更
+type NodeChange struct {
+	NodeID  uint          `json:"node_id,omitempty"`
+	Name    string        `json:"name"`
+	OldName string        `json:"old_name,omitempty"`
+	Type    string        `json:"type"`
+	Server  string        `json:"server"`
+	Port    int           `json:"port"`
+	Fields  []FieldChange `json:"fields,omitempty"`
+
+	config     string       // 新的节点配置（JSON）
+	region     string       // 新的地区
+	orderIndex int          // 新的排序索引
+	multiplier float64      // 从名称中提取的倍率（已锁定倍率的节点不更新）
+	geo        *NodeGeo     // 服务器地理位置（解析失败时为空，不覆盖已有结果）
+	mismatch   bool         // 名称中的地区与地理位置不一致
+	snapshot   nodeSnapshot // 生成计划时数据库中的节点状态
+}
+
+// FieldChange 节点字段变更，敏感字段不展示具体值
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// FilteredNode 被关键词或节点规则过滤的节点
+type FilteredNode struct {
+	Name    string `json:"name"`
+	Keyword string `json:"keyword,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+}
+
+// DuplicateNode 节点源中重复的节点（与之前的节点服务器、端口和凭据完全相同）
+type DuplicateNode struct {
+	Name        string `json:"name"`
+	DuplicateOf string `json:"duplicate_of"`
+}
+
+// nodeSnapshot 生成计划时节点的关键字段，应用前用于检测节点是否已被修改
+type nodeSnapshot struct {
+	name     string
+	config   string
+	sourceID *uint
+}
+
+// planStore 待应用的更新计划（仅保存在当前进程内存中）
+var planStore = struct {
+	sync.Mutex
+	plans map[string]*UpdatePlan
+}{plans: make(map[string]*UpdatePlan)}
+
+// storePlan 保存计划并清理过期计划
+func storePlan(plan *UpdatePlan) {
+	planStore.Lock()
+	defer planStore.Unlock()
+	now := time.Now()
+	for id, p := range planStore.plans {
+		if now.After(p.ExpiresAt) {
+			delete(planStore.plans, id)
+		}
+	}
+	planStore.plans[plan.ID] = plan
+}
+
+// takePlan 取出计划（取出后即删除，同一计划只能应用一次）
+func takePlan(id string) (*UpdatePlan, error) {
+	planStore.Lock()
+	defer planStore.Unlock()
+	plan, ok := planStore.plans[id]
+	if !ok {
+		return nil, fmt.Errorf("更新计划不存在或已应用，请重新预览")
+	}
+	delete(planStore.plans, id)
+	if time.Now().After(plan.ExpiresAt) {
+		return nil, fmt.Errorf("更新计划已过期，请重新预览")
+	}
+	return plan, nil
+}
+
+// PreviewUpdate 预览节点源更新（dry-run）：拉取并解析节点源，返回与 nodes 表的差异，不写入节点
+// sourceID 为 0 时预览所有启用的节点源
+func (s *ConfigUpdateService) PreviewUpdate(sourceID uint) (*UpdatePlan, error) {
+	config, err := s.getConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []models.NodeSource
+	if sourceID > 0 {
+		var source models.NodeSource
+		if err := s.db.First(&source, sourceID).Error; err != nil {
+			return nil, fmt.Errorf("节点源不存在")
+		}
+		sources = []models.NodeSource{source}
+	} else if sources, err = s.loadNodeSources(); err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("未配置节点源URL")
+	}
+
+	plan := s.buildUpdatePlan(sources, config, sourceID == 0)
+	storePlan(plan)
+	return plan, nil
+}
+
+// ApplyUpdatePlan 应用预览生成的更新计划，按计划写入节点
+func (s *ConfigUpdateService) ApplyUpdatePlan(id string) (*UpdatePlan, error) {
+	if !sourceSyncMutex.TryLock() {
+		return nil, fmt.Errorf("任务已在运行中")
+	}
+	defer sourceSyncMutex.Unlock()
+
+	plan, err := takePlan(id)
+	if err != nil {
+		return nil, err
+	}
+	defer s.markRunning()()
+	if err := s.commitUpdatePlan(plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// buildUpdatePlan 依次拉取节点源并生成更新计划
+func (s *ConfigUpdateService) buildUpdatePlan(sources []models.NodeSource, config map[string]interface{}, fullRun bool) *UpdatePlan {
+	now := time.Now()
+	plan := &UpdatePlan{
+		ID:        newPlanID(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(updatePlanTTL),
+		fullRun:   fullRun,
+	}
+
+	keywords := globalFilterKeywords(config)
+	if len(keywords) > 0 {
+		s.log("INFO", fmt.Sprintf("已配置 %d 个全局过滤关键词: %v，将过滤包含这些关键词的节点", len(keywords), keywords))
+	}
+
+	sourceIDs := make([]uint, len(sources))
+	for i, src := range sources {
+		sourceIDs[i] = src.ID
+	}
+	usedNames := s.reservedNodeNames(sourceIDs)
+	client := newSourceHTTPClient()
+	resolver := newGeoResolver()
+	s.preferGeoRegion = s.regionSourceSetting() == RegionSourceGeo
+
+	for i := range sources {
+		sp := s.planNodeSource(client, resolver, &sources[i], keywords, usedNames)
+		plan.Sources = append(plan.Sources, sp)
+
+		summary := &plan.Summary
+		if sp.Error != "" {
+			summary.FailedSources++
+		}
+		summary.Added += len(sp.Added)
+		summary.Removed += len(sp.Removed)
+		summary.Changed += len(sp.Changed)
+		summary.Renamed += len(sp.Renamed)
+		summary.Unchanged += sp.Unchanged
+		summary.Filtered += len(sp.Filtered)
+		summary.Duplicates += len(sp.Duplicates)
+		summary.ParseFailed += sp.ParseFailed
+	}
+	return plan
+}
+
+// planNodeSource 拉取并解析单个节点源，与该节点源已导入的节点比较生成差异
+// 下载失败或未解析出任何节点时不生成下线项，避免上游临时故障导致节点被批量下线
+func (s *ConfigUpdateService) planNodeSource(client *http.Client, resolver *geoResolver, source *models.NodeSource, globalKeywords []string, usedNames map[string]bool) *SourcePlan {
+	sp := &SourcePlan{
+		SourceID:   source.ID,
+		SourceName: source.Name,
+		Added:      []NodeChange{},
+		Removed:    []NodeChange{},
+		Changed:    []NodeChange{},
+		Renamed:    []NodeChange{},
+	}
+
+	headers, err := ParseSourceHeaders(source.Headers)
+	if err != nil {
+		sp.Error = err.Error()
+		return sp
+	}
+	if source.UserAgent != "" {
+		headers["User-Agent"] = source.UserAgent
+	}
+
+	s.log("INFO", fmt.Sprintf("正在下载节点源 [%s]: %s", source.Name, source.URL))
+	content, err := s.fetchURLContent(client, source.URL, headers)
+	if err != nil {
+		sp.Error = err.Error()
+		return sp
+	}
+
+	results, format := s.parseSourceContent(source.Name, content)
+	sp.Format = format
+	if len(results) == 0 {
+		sp.Error = "未获取到有效节点"
+		return sp
+	}
+
+	rules, err := ParseNodeRules(source.Rules)
+	if err != nil {
+		sp.Error = err.Error()
+		return sp
+	}
+	pipeline, err := CompileNodeRules(rules)
+	if err != nil {
+		sp.Error = err.Error()
+		return sp
+	}
+
+	keywords := append(append([]string{}, globalKeywords...), splitLines(source.FilterKeywords)...)
+	stats := updateStats{}
+	nodesWithOrder := s.processSourceLinks(source, results, keywords, pipeline, usedNames, &stats)
+	sp.Filtered = stats.filteredNodes
+	sp.Duplicates = stats.duplicateNodes
+	sp.ParseFailed = stats.parseFailed
+	if sp.Filtered == nil {
+		sp.Filtered = []FilteredNode{}
+	}
+	if sp.Duplicates == nil {
+		sp.Duplicates = []DuplicateNode{}
+	}
+	if stats.parseFailed > 0 {
+		s.log("WARN", fmt.Sprintf("节点源 [%s] 解析失败的节点: %d 个", source.Name, stats.parseFailed))
+	}
+	if len(nodesWithOrder) == 0 && stats.filtered == 0 {
+		sp.Error = "未解析出有效节点"
+		return sp
+	}
+
+	resolver.resolveNodesGeo(nodesWithOrder)
+	if err := s.diffSourceNodes(sp, nodesWithOrder); err != nil {
+		sp.Error = fmt.Sprintf("查询节点失败: %v", err)
+		sp.Added, sp.Removed, sp.Changed, sp.Renamed, sp.Unchanged = []NodeChange{}, []NodeChange{}, []NodeChange{}, []NodeChange{}, 0
+	}
+	return sp
+}
+
+// diffSourceNodes 将解析出的节点与数据库比较：
+// 1. 同一来源的同名节点视为同一节点（字段不同则为变更）
+// 2. 尚未记录来源的同名自动导入节点将被认领
+// 3. 同一来源中服务器、端口和凭据相同但名称不同的节点视为改名
+// 4. 其余为新增；同一来源中未出现在本次结果里的启用节点将被下线（手动添加的节点不受影响）
+func (s *ConfigUpdateService) diffSourceNodes(sp *SourcePlan, nodesWithOrder []nodeWithOrder) error {
+	var owned []models.Node
+	if err := s.db.Where("source_id = ? AND is_manual = ?", sp.SourceID, false).Order("id ASC").Find(&owned).Error; err != nil {
+		return err
+	}
+	var legacy []models.Node
+	if err := s.db.Where("source_id IS NULL AND is_manual = ?", false).Order("id ASC").Find(&legacy).Error; err != nil {
+		return err
+	}
+
+	ownedByName := make(map[string]*models.Node, len(owned))
+	ownedByIdentity := make(map[string]*models.Node, len(owned))
+	for i := range owned {
+		node := &owned[i]
+		if _, ok := ownedByName[node.Type+"\x00"+node.Name]; !ok {
+			ownedByName[node.Type+"\x00"+node.Name] = node
+		}
+		if old := decodeNodeConfig(node.Config); old != nil {
+			key := s.nodeIdentityKey(old)
+			if _, ok := ownedByIdentity[key]; !ok {
+				ownedByIdentity[key] = node
+			}
+		}
+	}
+	legacyByName := make(map[string]*models.Node, len(legacy))
+	for i := range legacy {
+		node := &legacy[i]
+		if _, ok := legacyByName[node.Type+"\x00"+node.Name]; !ok {
+			legacyByName[node.Type+"\x00"+node.Name] = node
+		}
+	}
+
+	matched := make(map[uint]bool)
+	pending := make([]nodeWithOrder, 0, len(nodesWithOrder))
+
+	// 按名称匹配
+	for _, item := range nodesWithOrder {
+		key := item.node.Type + "\x00" + item.node.Name
+		existing := ownedByName[key]
+		if existing == nil || matched[existing.ID] {
+			existing = legacyByName[key]
+		}
+		if existing == nil || matched[existing.ID] {
+			pending = append(pending, item)
+			continue
+		}
+		matched[existing.ID] = true
+
+		change := s.newNodeChange(item, existing, sp.SourceID)
+		if len(change.Fields) == 0 {
+			sp.Unchanged++
+		} else {
+			sp.Changed = append(sp.Changed, change)
+		}
+	}
+
+	// 按服务器和凭据匹配改名的节点，其余为新增
+	for _, item := range pending {
+		existing := ownedByIdentity[s.nodeIdentityKey(item.node)]
+		if existing != nil && !matched[existing.ID] {
+			matched[existing.ID] = true
+			change := s.newNodeChange(item, existing, sp.SourceID)
+			change.OldName = existing.Name
+			sp.Renamed = append(sp.Renamed, change)
+			continue
+		}
+		sp.Added = append(sp.Added, s.newNodeChange(item, nil, sp.SourceID))
+	}
+
+	for i := range owned {
+		node := &owned[i]
+		if matched[node.ID] || !node.IsActive {
+			continue
+		}
+		change := NodeChange{
+			NodeID:   node.ID,
+			Name:     node.Name,
+			Type:     node.Type,
+			snapshot: snapshotNode(node),
+		}
+		if old := decodeNodeConfig(node.Config); old != nil {
+			change.Server, change.Port = old.Server, old.Port
+		}
+		sp.Removed = append(sp.Removed, change)
+	}
+	return nil
+}
+
+// newNodeChange 生成节点变更项，existing 为空表示新增
+func (s *ConfigUpdateService) newNodeChange(item nodeWithOrder, existing *models.Node, sourceID uint) NodeChange {
+	node := item.node
+	configJSON, _ := json.Marshal(node)
+	change := NodeChange{
+		Name:       node.Name,
+		Type:       node.Type,
+		Server:     node.Server,
+		Port:       node.Port,
+		config:     string(configJSON),
+		orderIndex: item.orderIndex,
+		multiplier: item.multiplier,
+		geo:        item.geo,
+	}
+	// 本次解析失败时沿用已保存的地理位置，避免 DNS 临时故障导致地区来回变化
+	geo := item.geo
+	if geo == nil && existing != nil {
+		geo = nodeGeoOf(existing)
+	}
+	change.region, change.mismatch = effectiveRegion(s.resolveRegion(node.Name, node.Server), geo, s.preferGeoRegion)
+	if change.multiplier <= 0 {
+		change.multiplier = 1
+	}
+	if existing != nil {
+		change.NodeID = existing.ID
+		change.snapshot = snapshotNode(existing)
+		change.Fields = diffNodeFields(existing, node, change.region, change.orderIndex, sourceID)
+		if !existing.MultiplierLocked && existing.Rate() != change.multiplier {
+			change.Fields = append(change.Fields, FieldChange{
+				Field: "multiplier",
+				Old:   FormatMultiplier(existing.Rate()),
+				New:   FormatMultiplier(change.multiplier),
+			})
+		}
+		if change.geo != nil {
+			if old := nodeGeoOf(existing).String(); old != change.geo.String() {
+				change.Fields = append(change.Fields, FieldChange{Field: "geo", Old: old, New: change.geo.String()})
+			}
+			if existing.GeoMismatch != change.mismatch {
+				change.Fields = append(change.Fields, FieldChange{
+					Field: "geo_mismatch",
+					Old:   strconv.FormatBool(existing.GeoMismatch),
+					New:   strconv.FormatBool(change.mismatch),
+				})
+			}
+		}
+	}
+	return change
+}
+
+// nodeIdentityKey 节点身份键：类型、服务器、端口和凭据相同即视为同一节点
+func (s *ConfigUpdateService) nodeIdentityKey(node *ProxyNode) string {
+	return s.generateNodeDedupKey(node.Type, node.Server, node.Port) + ":" + node.UUID + ":" + node.Password
+}
+
+// decodeNodeConfig 解析数据库中保存的节点配置
+func decodeNodeConfig(config *string) *ProxyNode {
+	if config == nil || *config == "" {
+		return nil
+	}
+	var node ProxyNode
+	if err := json.Unmarshal([]byte(*config), &node); err != nil {
+		return nil
+	}
+	return &node
+}
+
+// snapshotNode 记录节点的关键字段
+func snapshotNode(node *models.Node) nodeSnapshot {
+	snap := nodeSnapshot{name: node.Name, sourceID: node.SourceID}
+	if node.Config != nil {
+		snap.config = *node.Config
+	}
+	return snap
+}
+
+// matches 检查节点自生成计划后是否未被修改
+func (snap nodeSnapshot) matches(node *models.Node) bool {
+	current := snapshotNode(node)
+	if current.name != snap.name || current.config != snap.config {
+		return false
+	}
+	if (current.sourceID == nil) != (snap.sourceID == nil) {
+		return false
+	}
+	return current.sourceID == nil || *current.sourceID == *snap.sourceID
+}
+
+// diffNodeFields 比较数据库中的节点与新解析的节点，返回变化的字段
+func diffNodeFields(existing *models.Node, node *ProxyNode, region string, orderIndex int, sourceID uint) []FieldChange {
+	var fields []FieldChange
+	add := func(field, oldValue, newValue string) {
+		if oldValue != newValue {
+			fields = append(fields, FieldChange{Field: field, Old: oldValue, New: newValue})
+		}
+	}
+	addSecret := func(field, oldValue, newValue string) {
+		if oldValue != newValue {
+			fields = append(fields, FieldChange{Field: field, Old: "******", New: "******（已更换）"})
+		}
+	}
+
+	add("name", existing.Name, node.Name)
+
+	old := decodeNodeConfig(existing.Config)
+	if old == nil {
+		add("config", "", "已更新")
+	} else {
+		add("server", old.Server, node.Server)
+		add("port", strconv.Itoa(old.Port), strconv.Itoa(node.Port))
+		addSecret("uuid", old.UUID, node.UUID)
+		addSecret("password", old.Password, node.Password)
+		add("cipher", old.Cipher, node.Cipher)
+		add("network", old.Network, node.Network)
+		add("tls", strconv.FormatBool(old.TLS), strconv.FormatBool(node.TLS))
+		add("udp", strconv.FormatBool(old.UDP), strconv.FormatBool(node.UDP))
+		if !optionsEqual(old.Options, node.Options) {
+			oldJSON, _ := json.Marshal(old.Options)
+			newJSON, _ := json.Marshal(node.Options)
+			fields = append(fields, FieldChange{Field: "options", Old: string(oldJSON), New: string(newJSON)})
+		}
+	}
+
+	add("region", existing.Region, region)
+	add("order_index", strconv.Itoa(existing.OrderIndex), strconv.Itoa(orderIndex))
+	if !existing.IsActive {
+		add("is_active", "false", "true")
+	}
+	if existing.SourceID == nil || *existing.SourceID != sourceID {
+		add("source_id", "", strconv.FormatUint(uint64(sourceID), 10))
+	}
+	return fields
+}
+
+// optionsEqual 比较节点附加选项（经 JSON 往返后比较，忽略数值类型差异）
+func optionsEqual(a, b map[string]interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	normalize := func(m map[string]interface{}) interface{} {
+		data, _ := json.Marshal(m)
+		var v interface{}
+		json.Unmarshal(data, &v)
+		return v
+	}
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// commitUpdatePlan 在一个事务中写入更新计划，并记录各节点源的同步结果
+// 计划生成后节点被修改（或被删除）时放弃整个计划，需重新预览
+func (s *ConfigUpdateService) commitUpdatePlan(plan *UpdatePlan) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, sp := range plan.Sources {
+			if sp.Error != "" {
+				continue
+			}
+			if err := applySourcePlan(tx, sp); err != nil {
+				return fmt.Errorf("节点源 [%s]: %v", sp.SourceName, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.log("ERROR", fmt.Sprintf("应用更新计划失败，未写入任何节点: %v", err))
+		return err
+	}
+	InvalidateSubscriptionCache()
+
+	for _, sp := range plan.Sources {
+		source := &models.NodeSource{ID: sp.SourceID}
+		if sp.Error != "" {
+			s.recordSourceResult(source, 0, fmt.Errorf("%s", sp.Error))
+			s.log("ERROR", fmt.Sprintf("节点源 [%s] 同步失败: %s", sp.SourceName, sp.Error))
+			continue
+		}
+		s.recordSourceResult(source, len(sp.Added)+len(sp.Changed)+len(sp.Renamed)+sp.Unchanged, nil)
+		if len(sp.Removed) > 0 {
+			s.log("INFO", fmt.Sprintf("节点源 [%s] 下线 %d 个已移除的节点", sp.SourceName, len(sp.Removed)))
+		}
+	}
+
+	if plan.fullRun {
+		s.updateLastUpdateTime()
+	}
+
+	sum := plan.Summary
+	s.log("SUCCESS", fmt.Sprintf("任务完成: 新增 %d 个节点，更新 %d 个，改名 %d 个，未变化 %d 个，下线 %d 个已从节点源移除的节点，失败节点源 %d 个",
+		sum.Added, sum.Changed, sum.Renamed, sum.Unchanged, sum.Removed, sum.FailedSources))
+	if sum.FailedSources == len(plan.Sources) {
+		return fmt.Errorf("所有节点源同步失败")
+	}
+	return nil
+}
+
+// applySourcePlan 写入单个节点源的差异
+// 已有节点的在线状态由健康检查维护，更新配置时不改写
+func applySourcePlan(tx *gorm.DB, sp *SourcePlan) error {
+	sourceID := sp.SourceID
+
+	updates := append(append([]NodeChange{}, sp.Changed...), sp.Renamed...)
+	for _, change := range updates {
+		if err := checkPlannedNode(tx, change); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Node{}).Where("id = ?", change.NodeID).Updates(map[string]interface{}{
+			"name":        change.Name,
+			"config":      change.config,
+			"region":      change.region,
+			"order_index": change.orderIndex,
+			"source_id":   sourceID,
+			"is_active":   true,
+		}).Error; err != nil {
+			return fmt.Errorf("更新节点 %s 失败: %v", change.Name, err)
+		}
+		if change.geo != nil {
+			if err := tx.Model(&models.Node{}).Where("id = ?", change.NodeID).Updates(geoColumns(change)).Error; err != nil {
+				return fmt.Errorf("更新节点 %s 地理位置失败: %v", change.Name, err)
+			}
+		}
+		// 管理员设置的倍率不被覆盖
+		if err := tx.Model(&models.Node{}).Where("id = ? AND multiplier_locked = ?", change.NodeID, false).
+			Update("multiplier", change.multiplier).Error; err != nil {
+			return fmt.Errorf("更新节点 %s 倍率失败: %v", change.Name, err)
+		}
+	}
+
+	for _, change := range sp.Removed {
+		if err := checkPlannedNode(tx, change); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Node{}).Where("id = ?", change.NodeID).
+			Updates(map[string]interface{}{"is_active": false, "status": "offline", "health_disabled": false}).Error; err != nil {
+			return fmt.Errorf("下线节点 %s 失败: %v", change.Name, err)
+		}
+	}
+
+	for _, change := range sp.Added {
+		var count int64
+		tx.Model(&models.Node{}).Where("source_id = ? AND type = ? AND name = ?", sourceID, change.Type, change.Name).Count(&count)
+		if count > 0 {
+			return fmt.Errorf("节点 %s 在预览后已存在，请重新预览", change.Name)
+		}
+		config := change.config
+		newNode := models.Node{
+			Name:       change.Name,
+			Type:       change.Type,
+			Status:     "online",
+			IsActive:   true,
+			IsManual:   false,
+			SourceID:   &sourceID,
+			Config:     &config,
+			Region:     change.region,
+			OrderIndex: change.orderIndex,
+			Multiplier: change.multiplier,
+		}
+		if geo := change.geo; geo != nil {
+			now := time.Now()
+			newNode.GeoIP, newNode.GeoCountry, newNode.GeoCountryCode, newNode.GeoCity = geo.IP, geo.Country, geo.CountryCode, geo.City
+			newNode.GeoASN, newNode.GeoASNOrg = geo.ASN, geo.ASNOrg
+			newNode.GeoMismatch, newNode.GeoCheckedAt = change.mismatch, &now
+		}
+		if err := tx.Create(&newNode).Error; err != nil {
+			return fmt.Errorf("创建节点 %s 失败: %v", change.Name, err)
+		}
+	}
+	return nil
+}
+
+// geoColumns 节点地理位置字段的更新内容
+func geoColumns(change NodeChange) map[string]interface{} {
+	geo := change.geo
+	return map[string]interface{}{
+		"geo_ip":           geo.IP,
+		"geo_country":      geo.Country,
+		"geo_country_code": geo.CountryCode,
+		"geo_city":         geo.City,
+		"geo_asn":          geo.ASN,
+		"geo_asn_org":      geo.ASNOrg,
+		"geo_mismatch":     change.mismatch,
+		"geo_checked_at":   time.Now(),
+	}
+}
+
+// checkPlannedNode 检查计划中的节点自生成计划后未被修改
+func checkPlannedNode(tx *gorm.DB, change NodeChange) error {
+	var node models.Node
+	if err := tx.First(&node, change.NodeID).Error; err != nil {
+		return fmt.Errorf("节点 %s 在预览后已被删除，请重新预览", change.snapshot.name)
+	}
+	if node.IsManual || !change.snapshot.matches(&node) {
+		return fmt.Errorf("节点 %s 在预览后已被修改，请重新预览", change.snapshot.name)
+	}
+	return nil
+}
+
+// markRunning 标记任务运行中，返回结束标记的函数
+func (s *ConfigUpdateService) markRunning() func() {
+	s.runningMutex.Lock()
+	s.isRunning = true
+	s.runningMutex.Unlock()
+	return func() {
+		s.runningMutex.Lock()
+		s.isRunning = false
+		s.runningMutex.Unlock()
+	}
+}
+
+// newPlanID 生成更新计划ID
+func newPlanID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(utils.GetBeijingTime().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,136 @@
+package config_update
+
+import (
+	"testing"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newConfigUpdateTestDB 创建内存数据库并迁移给定的表
+func newConfigUpdateTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	return db
+}
+
+// TestApplySourcePlanKeepsStatus 测试节点源更新只写入配置，不改写健康检查维护的在线状态
+func TestApplySourcePlanKeepsStatus(t *testing.T) {
+	db := newConfigUpdateTestDB(t, &models.Node{})
+	sourceID := uint(3)
+	config := `{"name":"香港 01","type":"ss","server":"hk.example.com","port":443}`
+	node := models.Node{Name: "香港 01", Type: "ss", Status: "timeout", IsActive: true, SourceID: &sourceID, Config: &config, Region: "香港"}
+	db.Create(&node)
+
+	err := applySourcePlan(db, &SourcePlan{SourceID: sourceID, Changed: []NodeChange{{
+		NodeID:     node.ID,
+		Name:       "香港 01",
+		config:     `{"name":"香港 01","type":"ss","server":"hk2.example.com","port":443}`,
+		region:     "香港",
+		multiplier: 1,
+		snapshot:   snapshotNode(&node),
+	}}})
+	if err != nil {
+		t.Fatalf("写入更新计划失败: %v", err)
+	}
+	var got models.Node
+	db.First(&got, node.ID)
+	if got.Status != "timeout" {
+		t.Errorf("更新配置不应改写节点状态，实际 %s", got.Status)
+	}
+	if got.Config == nil || *got.Config == config {
+		t.Error("节点配置应已更新")
+	}
+}
+
+// TestDiffNodeFields 测试节点字段差异（敏感字段不展示明文）
+func TestDiffNodeFields(t *testing.T) {
+	sourceID := uint(1)
+	config := `{"Name":"香港 01","Type":"trojan","Server":"a.example.com","Port":443,"Password":"old","TLS":true,"Options":{"sni":"a.example.com"}}`
+	existing := &models.Node{Name: "香港 01", Type: "trojan", Config: &config, Region: "香港", IsActive: true, SourceID: &sourceID}
+
+	same := &ProxyNode{Name: "香港 01", Type: "trojan", Server: "a.example.com", Port: 443, Password: "old", TLS: true,
+		Options: map[string]interface{}{"sni": "a.example.com"}}
+	if fields := diffNodeFields(existing, same, "香港", 0, sourceID); len(fields) != 0 {
+		t.Errorf("未变化的节点不应有差异: %+v", fields)
+	}
+
+	changed := &ProxyNode{Name: "香港 01", Type: "trojan", Server: "a.example.com", Port: 8443, Password: "new", TLS: true,
+		Options: map[string]interface{}{"sni": "a.example.com"}}
+	fields := diffNodeFields(existing, changed, "香港", 0, sourceID)
+	got := make(map[string]FieldChange)
+	for _, f := range fields {
+		got[f.Field] = f
+	}
+	if len(fields) != 2 || got["port"].New != "8443" {
+		t.Errorf("端口和密码变更识别错误: %+v", fields)
+	}
+	if f := got["password"]; f.Old == "old" || f.New == "new" {
+		t.Errorf("密码不应以明文展示: %+v", f)
+	}
+
+	existing.IsActive = false
+	existing.SourceID = nil
+	fields = diffNodeFields(existing, same, "香港", 0, sourceID)
+	if len(fields) != 2 || fields[0].Field != "is_active" || fields[1].Field != "source_id" {
+		t.Errorf("重新启用和认领节点应体现在差异中: %+v", fields)
+	}
+}
+
+// TestSnapshotMatches 测试应用计划前的节点修改检测
+func TestSnapshotMatches(t *testing.T) {
+	sourceID := uint(1)
+	config := `{"Name":"A"}`
+	node := &models.Node{Name: "A", Config: &config, SourceID: &sourceID}
+	snap := snapshotNode(node)
+	if !snap.matches(node) {
+		t.Error("未修改的节点应匹配快照")
+	}
+
+	renamed := *node
+	renamed.Name = "B"
+	if snap.matches(&renamed) {
+		t.Error("已改名的节点不应匹配快照")
+	}
+
+	otherSource := uint(2)
+	moved := *node
+	moved.SourceID = &otherSource
+	if snap.matches(&moved) {
+		t.Error("来源已变更的节点不应匹配快照")
+	}
+}
+
+// TestPreviewDoesNotMigrateLegacyURLs 测试预览不写入节点源，旧版订阅地址在启动或执行同步时才登记
+func TestPreviewDoesNotMigrateLegacyURLs(t *testing.T) {
+	db := newConfigUpdateTestDB(t, &models.SystemConfig{}, &models.NodeSource{}, &models.Node{})
+	db.Create(&models.SystemConfig{Key: "urls", Value: "https://example.com/sub", Type: "string", Category: "config_update", DisplayName: "urls"})
+	s := &ConfigUpdateService{db: db}
+
+	if _, err := s.PreviewUpdate(0); err == nil {
+		t.Error("没有节点源时预览应返回错误")
+	}
+	var count int64
+	db.Model(&models.NodeSource{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("预览不应创建节点源，实际 %d 个", count)
+	}
+
+	s.MigrateLegacySourceURLs()
+	var sources []models.NodeSource
+	db.Find(&sources)
+	if len(sources) != 1 || sources[0].URL != "https://example.com/sub" || !sources[0].Enabled {
+		t.Errorf("应将旧版订阅地址登记为节点源: %+v", sources)
+	}
+}
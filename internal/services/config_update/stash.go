@@ -0,0 +1,72 @@
+package config_update
+
+// supportedStashTypes Stash 支持的节点类型
+var supportedStashTypes = map[string]bool{
+	"ss":        true,
+	"vmess":     true,
+	"vless":     true,
+	"trojan":    true,
+	"hysteria":  true,
+	"hysteria2": true,
+	"tuic":      true,
+}
+
+// generateStashYAML 生成 Stash 配置（Clash 兼容格式，hysteria/hysteria2/tuic 使用 Stash 扩展字段）
+func (s *ConfigUpdateService) generateStashYAML(proxies []*ProxyNode) string {
+	converted := make([]*ProxyNode, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !supportedStashTypes[proxy.Type] {
+			continue
+		}
+		converted = append(converted, toStashNode(proxy))
+	}
+	return s.renderClashStyleYAML(converted, supportedStashTypes)
+}
+
+// toStashNode 复制节点并将选项转换为 Stash 的字段命名
+func toStashNode(node *ProxyNode) *ProxyNode {
+	clone := *node
+	clone.Options = make(map[string]interface{}, len(node.Options))
+	for k, v := range node.Options {
+		clone.Options[k] = v
+	}
+	opts := clone.Options
+
+	switch node.Type {
+	case "hysteria", "hysteria2":
+		if node.Type == "hysteria2" && node.Password != "" {
+			opts["auth"] = node.Password
+		}
+		if up := parseMbps(getString(opts, "up", ""), 0); up > 0 {
+			opts["up-speed"] = up
+		}
+		if down := parseMbps(getString(opts, "down", ""), 0); down > 0 {
+			opts["down-speed"] = down
+		}
+		delete(opts, "up")
+		delete(opts, "down")
+		renameOption(opts, "servername", "sni")
+		// TLS 由 sni 隐含，Stash 不识别 tls 字段
+		clone.TLS = false
+	case "tuic":
+		opts["version"] = 5
+		opts["uuid"] = node.UUID
+		opts["password"] = node.Password
+		renameOption(opts, "servername", "sni")
+		renameOption(opts, "congestion_control", "congestion-controller")
+		renameOption(opts, "udp_relay_mode", "udp-relay-mode")
+		clone.TLS = false
+	}
+
+	return &clone
+}
+
+// renameOption 重命名选项键（目标键已存在时不覆盖）
+func renameOption(opts map[string]interface{}, from, to string) {
+	if v, ok := opts[from]; ok {
+		if _, exists := opts[to]; !exists {
+			opts[to] = v
+		}
+		delete(opts, from)
+	}
+}
@@ -0,0 +1,132 @@
+package config_update
+
+import (
+	"fmt"
+	"strings"
+)
+
+// supportedSurgeTypes Surge 支持的节点类型
+var supportedSurgeTypes = map[string]bool{
+	"ss":        true,
+	"vmess":     true,
+	"trojan":    true,
+	"hysteria2": true,
+	"tuic":      true,
+}
+
+// generateSurgeConfig 生成 Surge 配置（[General] / [Proxy] / [Proxy Group] / [Rule]）
+func (s *ConfigUpdateService) generateSurgeConfig(proxies []*ProxyNode) string {
+	var builder strings.Builder
+
+	builder.WriteString("[General]\n")
+	builder.WriteString("loglevel = notify\n")
+	builder.WriteString(fmt.Sprintf("internet-test-url = %s\n", groupTestURL))
+	builder.WriteString(fmt.Sprintf("proxy-test-url = %s\n", groupTestURL))
+	builder.WriteString("dns-server = system, 223.5.5.5, 119.29.29.29\n")
+	builder.WriteString("skip-proxy = 127.0.0.1, 192.168.0.0/16, 10.0.0.0/8, 172.16.0.0/12, 100.64.0.0/10, localhost, *.local\n\n")
+
+	builder.WriteString("[Proxy]\n")
+	usedNames := make(map[string]bool)
+	var names []string
+	for _, proxy := range proxies {
+		if !supportedSurgeTypes[proxy.Type] {
+			continue
+		}
+		params := s.surgeProxyParams(proxy)
+		if params == "" {
+			continue
+		}
+		name := uniqueININame(proxy.Name, usedNames)
+		builder.WriteString(fmt.Sprintf("%s = %s\n", name, params))
+		names = append(names, name)
+	}
+	builder.WriteString("\n")
+
+	writeINIProxyGroups(&builder, names)
+	builder.WriteString("\n")
+	writeINIRules(&builder)
+
+	return builder.String()
+}
+
+// surgeProxyParams 生成 Surge [Proxy] 行等号右侧的参数，无法表示的节点返回空字符串
+func (s *ConfigUpdateService) surgeProxyParams(node *ProxyNode) string {
+	opts := node.Options
+	if opts == nil {
+		opts = make(map[string]interface{})
+	}
+	transportOpts := TransportOptsFromMap(opts)
+
+	// Surge 仅支持 tcp / ws 传输
+	if node.Network != "" && node.Network != "tcp" && node.Network != "ws" {
+		return ""
+	}
+	if transportOpts.WSOpts != nil && transportOpts.WSOpts.V2rayHTTPUpgrade {
+		return ""
+	}
+
+	parts := []string{}
+	switch node.Type {
+	case "ss":
+		parts = append(parts, "ss", node.Server, fmt.Sprint(node.Port),
+			"encrypt-method="+node.Cipher, "password="+quoteINIValue(node.Password), "udp-relay=true")
+	case "vmess":
+		parts = append(parts, "vmess", node.Server, fmt.Sprint(node.Port), "username="+node.UUID)
+		if getInt(opts, "alterId") == 0 {
+			parts = append(parts, "vmess-aead=true")
+		}
+		if node.TLS {
+			parts = append(parts, "tls=true")
+			parts = append(parts, surgeTLSParams(transportOpts)...)
+		}
+		parts = append(parts, surgeWSParams(node.Network, transportOpts)...)
+	case "trojan":
+		parts = append(parts, "trojan", node.Server, fmt.Sprint(node.Port), "password="+quoteINIValue(node.Password))
+		parts = append(parts, surgeTLSParams(transportOpts)...)
+		parts = append(parts, surgeWSParams(node.Network, transportOpts)...)
+	case "hysteria2":
+		parts = append(parts, "hysteria2", node.Server, fmt.Sprint(node.Port), "password="+quoteINIValue(node.Password))
+		parts = append(parts, surgeTLSParams(transportOpts)...)
+		if down := parseMbps(getString(opts, "down", ""), 0); down > 0 {
+			parts = append(parts, fmt.Sprintf("download-bandwidth=%d", down))
+		}
+	case "tuic":
+		parts = append(parts, "tuic-v5", node.Server, fmt.Sprint(node.Port),
+			"password="+quoteINIValue(node.Password), "uuid="+node.UUID)
+		parts = append(parts, surgeTLSParams(transportOpts)...)
+		if alpn := getStringSlice(opts, "alpn"); len(alpn) > 0 {
+			parts = append(parts, "alpn="+alpn[0])
+		}
+	default:
+		return ""
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// surgeTLSParams 生成 Surge TLS 参数（trojan / hysteria2 / tuic 默认启用 TLS）
+func surgeTLSParams(transportOpts *TransportOpts) []string {
+	var params []string
+	if transportOpts.SNI != "" {
+		params = append(params, "sni="+transportOpts.SNI)
+	}
+	if transportOpts.SkipCertVerify {
+		params = append(params, "skip-cert-verify=true")
+	}
+	return params
+}
+
+// surgeWSParams 生成 Surge WebSocket 参数
+func surgeWSParams(network string, transportOpts *TransportOpts) []string {
+	if network != "ws" {
+		return nil
+	}
+	params := []string{"ws=true"}
+	if transportOpts.WSOpts != nil {
+		params = append(params, "ws-path="+firstNotEmpty(transportOpts.WSOpts.Path, "/"))
+		if host := transportOpts.WSOpts.Headers["Host"]; host != "" {
+			params = append(params, "ws-headers=Host:"+host)
+		}
+	}
+	return params
+}
@@ -135,6 +135,11 @@ func TransportOptsFromMap(m map[string]interface{}) *TransportOpts {
 					opts.WSOpts.Headers[k] = s
 				}
 			}
+		} else if headers, ok := wsOpts["headers"].(map[string]string); ok {
+			// 刚解析出的节点尚未经过 JSON 序列化
+			for k, v := range headers {
+				opts.WSOpts.Headers[k] = v
+			}
 		}
 		if v2ray, ok := wsOpts["v2ray-http-upgrade"].(bool); ok && v2ray {
 			opts.WSOpts.V2rayHTTPUpgrade = true
@@ -162,6 +167,8 @@ func TransportOptsFromMap(m map[string]interface{}) *TransportOpts {
 					opts.H2Opts.Host = append(opts.H2Opts.Host, s)
 				}
 			}
+		} else if host, ok := h2Opts["host"].([]string); ok {
+			opts.H2Opts.Host = host
 		}
 	}
 	
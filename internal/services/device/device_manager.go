@@ -99,6 +99,11 @@ func (dm *DeviceManager) ParseUserAgent(userAgent string) *DeviceInfo {
 	return info
 }
 
+// MatchSoftware 根据 User-Agent 识别客户端软件名称
+func (dm *DeviceManager) MatchSoftware(userAgent string) string {
+	return dm.matchSoftware(userAgent, strings.ToLower(userAgent))
+}
+
 // matchSoftware 匹配软件
 func (dm *DeviceManager) matchSoftware(userAgent, uaLower string) string {
 	// Shadowrocket
@@ -137,19 +142,33 @@ func (dm *DeviceManager) matchSoftware(userAgent, uaLower string) string {
 		return "Mihomo"
 	}
 
-	// 其他常见软件
-	softwares := map[string]string{
-		"quantumult": "Quantumult",
-		"hiddify":    "Hiddify",
-		"clash":      "Clash",
-		"v2ray":      "V2Ray",
-		"loon":       "Loon",
-		"surge":      "Surge",
+	// sing-box 官方客户端（SFA / SFI / SFM）及其内核
+	if strings.Contains(uaLower, "sing-box") || strings.Contains(uaLower, "singbox") ||
+		strings.HasPrefix(uaLower, "sfa/") || strings.HasPrefix(uaLower, "sfi/") || strings.HasPrefix(uaLower, "sfm/") {
+		return "sing-box"
+	}
+
+	// Stash 的 UA 同时包含 clash 字样，需在通用匹配前识别
+	if strings.Contains(uaLower, "stash") {
+		return "Stash"
+	}
+
+	// 其他常见软件，按顺序匹配（UA 可能同时包含多个关键字，如 Hiddify 的 UA 常带 clash 字样）
+	softwares := []struct {
+		key  string
+		name string
+	}{
+		{"quantumult", "Quantumult"},
+		{"hiddify", "Hiddify"},
+		{"clash", "Clash"},
+		{"v2ray", "V2Ray"},
+		{"loon", "Loon"},
+		{"surge", "Surge"},
 	}
 
-	for key, name := range softwares {
-		if strings.Contains(uaLower, key) {
-			return name
+	for _, sw := range softwares {
+		if strings.Contains(uaLower, sw.key) {
+			return sw.name
 		}
 	}
 
@@ -345,6 +345,70 @@ func (b *EmailTemplateBuilder) GetPaymentSuccessTemplate(username, orderNo, pack
 	return b.GetBaseTemplate(title, content, "感谢您的信任")
 }
 
+// GetBankTransferRejectedTemplate 获取银行转账审核驳回邮件模板
+func (b *EmailTemplateBuilder) GetBankTransferRejectedTemplate(username, orderNo string, amount float64, referenceCode, reason string) string {
+	title := "银行转账审核未通过"
+	content := fmt.Sprintf(`<h2>⚠️ 银行转账审核未通过</h2>
+            <p>亲爱的 %s，</p>
+            <p>您为以下订单提交的转账回执未通过审核：</p>
+            <div class="warning-box">
+                <h3>📋 转账信息</h3>
+                <table class="info-table">
+                    <tr><th>订单号</th><td><strong>%s</strong></td></tr>
+                    <tr><th>应付金额</th><td style="color: #e74c3c; font-weight: bold; font-size: 18px;">¥%.2f</td></tr>
+                    <tr><th>转账参考号</th><td><strong style="font-family: 'Courier New', monospace;">%s</strong></td></tr>
+                    <tr><th>驳回原因</th><td>%s</td></tr>
+                </table>
+            </div>
+            <div class="info-box">
+                <p><strong>💡 接下来：</strong></p>
+                <ul>
+                    <li>请根据驳回原因核对转账金额和附言中的参考号</li>
+                    <li>在订单页面重新上传清晰完整的转账回执</li>
+                    <li>如有疑问，请提交工单联系客服</li>
+                </ul>
+            </div>`, template.HTMLEscapeString(username), orderNo, amount, referenceCode, template.HTMLEscapeString(reason))
+
+	return b.GetBaseTemplate(title, content, "感谢您的理解与支持")
+}
+
+// GetRefundTemplate 获取订单退款邮件模板
+func (b *EmailTemplateBuilder) GetRefundTemplate(username, orderNo, packageName string, amount float64, destination, reason, expireTime string) string {
+	title := "订单退款通知"
+	reasonRow := ""
+	if reason != "" {
+		reasonRow = fmt.Sprintf(`<tr><th>退款原因</th><td>%s</td></tr>`, template.HTMLEscapeString(reason))
+	}
+	expireRow := ""
+	if expireTime != "" {
+		expireRow = fmt.Sprintf(`<tr><th>订阅到期时间</th><td>%s</td></tr>`, expireTime)
+	}
+	content := fmt.Sprintf(`<h2>💰 订单退款通知</h2>
+            <p>亲爱的 %s，</p>
+            <p>您的订单已办理退款，详情如下：</p>
+            <div class="info-box">
+                <h3>📋 退款信息</h3>
+                <table class="info-table">
+                    <tr><th>订单号</th><td><strong>%s</strong></td></tr>
+                    <tr><th>商品</th><td>%s</td></tr>
+                    <tr><th>退款金额</th><td style="color: #27ae60; font-weight: bold; font-size: 18px;">¥%.2f</td></tr>
+                    <tr><th>退款去向</th><td>%s</td></tr>
+                    %s
+                    %s
+                </table>
+            </div>
+            <div class="info-box">
+                <p><strong>💡 温馨提示：</strong></p>
+                <ul>
+                    <li>原路退回的款项到账时间以支付渠道为准，通常为 1-7 个工作日</li>
+                    <li>退回账户余额的款项已即时到账，可用于后续购买</li>
+                    <li>订阅时长已按退款比例相应扣减</li>
+                </ul>
+            </div>`, template.HTMLEscapeString(username), orderNo, template.HTMLEscapeString(packageName), amount, destination, reasonRow, expireRow)
+
+	return b.GetBaseTemplate(title, content, "如有疑问，请提交工单联系客服")
+}
+
 // GetWelcomeTemplate 获取欢迎邮件模板
 func (b *EmailTemplateBuilder) GetWelcomeTemplate(username, email, loginURL string, hasPassword bool, password string) string {
 	title := "欢迎加入我们！"
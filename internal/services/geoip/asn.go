@@ -0,0 +1,82 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+var asnDB *geoip2.Reader
+
+// ASNInfo 自治系统信息
+type ASNInfo struct {
+	Number       uint   `json:"number"`
+	Organization string `json:"organization"`
+}
+
+// InitASN 初始化 ASN 数据库（GeoLite2-ASN），未找到时仅禁用 ASN 解析
+func InitASN(dbPath string) error {
+	geoipDBLock.Lock()
+	defer geoipDBLock.Unlock()
+
+	if asnDB != nil {
+		asnDB.Close()
+		asnDB = nil
+	}
+
+	if dbPath == "" {
+		possiblePaths := []string{
+			"./GeoLite2-ASN.mmdb",
+			"./data/GeoLite2-ASN.mmdb",
+			"/usr/share/GeoIP/GeoLite2-ASN.mmdb",
+			"/var/lib/GeoIP/GeoLite2-ASN.mmdb",
+		}
+		for _, path := range possiblePaths {
+			if _, err := os.Stat(path); err == nil {
+				dbPath = path
+				break
+			}
+		}
+	}
+	if dbPath == "" {
+		return fmt.Errorf("未找到 ASN 数据库文件，ASN 解析功能已禁用")
+	}
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return fmt.Errorf("ASN 数据库文件不存在: %s", dbPath)
+	}
+
+	db, err := geoip2.Open(dbPath)
+	if err != nil {
+		return fmt.Errorf("打开 ASN 数据库失败: %w", err)
+	}
+	asnDB = db
+	return nil
+}
+
+// GetASN 根据IP地址获取自治系统信息
+func GetASN(ipAddress string) (*ASNInfo, error) {
+	parsedIP := net.ParseIP(ipAddress)
+	if parsedIP == nil {
+		return nil, fmt.Errorf("无效的IP地址格式: %s", ipAddress)
+	}
+
+	geoipDBLock.RLock()
+	defer geoipDBLock.RUnlock()
+
+	if asnDB == nil {
+		return nil, fmt.Errorf("ASN 数据库未启用")
+	}
+	record, err := asnDB.ASN(parsedIP)
+	if err != nil {
+		return nil, fmt.Errorf("ASN解析失败: %w", err)
+	}
+	if record.AutonomousSystemNumber == 0 {
+		return nil, fmt.Errorf("数据库中没有该IP地址的ASN记录")
+	}
+	return &ASNInfo{
+		Number:       record.AutonomousSystemNumber,
+		Organization: record.AutonomousSystemOrganization,
+	}, nil
+}
@@ -229,7 +229,7 @@ func IsEnabled() bool {
 	return geoipEnabled
 }
 
-// Close 关闭 GeoIP 数据库
+// Close 关闭 GeoIP 数据库（包括 ASN 数据库）
 func Close() {
 	geoipDBLock.Lock()
 	defer geoipDBLock.Unlock()
@@ -238,6 +238,10 @@ func Close() {
 		geoipDB.Close()
 		geoipDB = nil
 	}
+	if asnDB != nil {
+		asnDB.Close()
+		asnDB = nil
+	}
 	geoipEnabled = false
 }
 
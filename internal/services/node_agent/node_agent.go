@@ -0,0 +1,500 @@
+package node_agent
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
+	"cboard-go/internal/services/traffic"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// 节点后端通信参数（秒），通过节点配置的 base_config 下发给节点后端
+const (
+	PushInterval = 60
+	PullInterval = 60
+)
+
+// 认证错误
+var (
+	ErrAgentDisabled = errors.New("节点未启用后端对接")
+	ErrInvalidKey    = errors.New("节点通信密钥无效")
+)
+
+// AgentUser 下发给节点后端的用户（ID 为订阅 ID，流量按订阅上报）
+// Shadowsocks 2022 节点的用户密钥为随机生成的密钥，通过 password 下发，不再由 UUID 派生
+type AgentUser struct {
+	ID          uint   `json:"id"`
+	UUID        string `json:"uuid"`
+	Password    string `json:"password,omitempty"`
+	SpeedLimit  int    `json:"speed_limit"`
+	DeviceLimit int    `json:"device_limit"`
+}
+
+// UsageStat 资源用量
+type UsageStat struct {
+	Total uint64 `json:"total"`
+	Used  uint64 `json:"used"`
+}
+
+// NodeStatus 节点后端上报的负载
+type NodeStatus struct {
+	CPU    float64   `json:"cpu"`
+	Mem    UsageStat `json:"mem"`
+	Swap   UsageStat `json:"swap"`
+	Disk   UsageStat `json:"disk"`
+	Uptime int       `json:"uptime,omitempty"`
+}
+
+// NodeAgentService 自建节点后端对接服务（兼容 XrayR / V2bX 的 UniProxy 协议）
+type NodeAgentService struct {
+	db *gorm.DB
+}
+
+// NewNodeAgentService 创建节点后端对接服务
+func NewNodeAgentService() *NodeAgentService {
+	return &NodeAgentService{
+		db: database.GetDB(),
+	}
+}
+
+// Authenticate 使用节点 ID 和通信密钥认证节点后端
+func (s *NodeAgentService) Authenticate(nodeID uint, key string) (*models.Node, error) {
+	var node models.Node
+	if err := s.db.First(&node, nodeID).Error; err != nil {
+		return nil, ErrInvalidKey
+	}
+	if !node.IsSelfHosted() {
+		return nil, ErrAgentDisabled
+	}
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(key)), []byte(node.AgentKeyHash)) != 1 {
+		return nil, ErrInvalidKey
+	}
+	return &node, nil
+}
+
+// EnableAgent 为节点生成新的通信密钥（旧密钥立即失效），明文密钥只返回这一次
+func (s *NodeAgentService) EnableAgent(node *models.Node) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成通信密钥失败: %v", err)
+	}
+	key := hex.EncodeToString(buf)
+	if err := s.db.Model(node).Update("agent_key_hash", utils.HashToken(key)).Error; err != nil {
+		return "", err
+	}
+	// 自建节点改用订阅自己的凭据
+	config_update.InvalidateSubscriptionCache()
+	return key, nil
+}
+
+// DisableAgent 关闭节点的后端对接
+func (s *NodeAgentService) DisableAgent(node *models.Node) error {
+	if err := s.db.Model(node).Update("agent_key_hash", "").Error; err != nil {
+		return err
+	}
+	config_update.InvalidateSubscriptionCache()
+	return s.db.Where("node_id = ?", node.ID).Delete(&models.NodeOnlineIP{}).Error
+}
+
+// UpdateAgentConfig 更新服务端配置覆盖项，必须为 JSON 对象，空字符串表示清除
+func (s *NodeAgentService) UpdateAgentConfig(node *models.Node, config string) error {
+	config = strings.TrimSpace(config)
+	if config == "" {
+		return s.db.Model(node).Update("agent_config", nil).Error
+	}
+	var overrides map[string]interface{}
+	if err := json.Unmarshal([]byte(config), &overrides); err != nil {
+		return fmt.Errorf("服务端配置必须为 JSON 对象: %v", err)
+	}
+	return s.db.Model(node).Update("agent_config", config).Error
+}
+
+// AgentNodeType 节点类型转换为 UniProxy 的 node_type
+func AgentNodeType(nodeType string) string {
+	switch nodeType {
+	case "ss":
+		return "shadowsocks"
+	default:
+		return nodeType
+	}
+}
+
+// MatchNodeType 节点后端配置的 node_type 是否与节点类型一致
+func MatchNodeType(nodeType, agentType string) bool {
+	agentType = strings.ToLower(agentType)
+	if agentType == "hysteria" {
+		agentType = "hysteria2"
+	}
+	if nodeType == "hysteria" {
+		nodeType = "hysteria2"
+	}
+	return AgentNodeType(nodeType) == agentType
+}
+
+// BuildNodeConfig 生成下发给节点后端的节点配置
+// 配置由订阅使用的节点参数转换而来，服务端配置覆盖项（如 Reality 私钥、监听端口）最后合并
+func (s *NodeAgentService) BuildNodeConfig(node *models.Node) (map[string]interface{}, error) {
+	if node.Config == nil || *node.Config == "" {
+		return nil, fmt.Errorf("节点配置为空")
+	}
+	var proxy config_update.ProxyNode
+	if err := json.Unmarshal([]byte(*node.Config), &proxy); err != nil {
+		return nil, fmt.Errorf("节点配置解析失败: %v", err)
+	}
+	opts := config_update.TransportOptsFromMap(proxy.Options)
+	if opts == nil {
+		opts = &config_update.TransportOpts{}
+	}
+	serverName := firstNonEmpty(opts.SNI, optionString(proxy.Options, "sni"), proxy.Server)
+
+	config := map[string]interface{}{
+		"server_port": proxy.Port,
+		"base_config": map[string]interface{}{
+			"push_interval": PushInterval,
+			"pull_interval": PullInterval,
+		},
+		"routes": []interface{}{},
+	}
+
+	switch proxy.Type {
+	case "ss":
+		config["cipher"] = proxy.Cipher
+		if plugin := optionString(proxy.Options, "plugin"); plugin == "obfs" || plugin == "obfs-local" {
+			pluginOpts, _ := proxy.Options["plugin-opts"].(map[string]interface{})
+			config["obfs"] = optionString(pluginOpts, "mode")
+			config["obfs_settings"] = map[string]interface{}{
+				"host": optionString(pluginOpts, "host"),
+				"path": optionString(pluginOpts, "path"),
+			}
+		}
+		if size := config_update.SS2022KeySize(proxy.Cipher); size > 0 {
+			if err := config_update.EnsureNodeProxyKey(s.db, node); err != nil {
+				return nil, err
+			}
+			config["server_key"] = config_update.SS2022ServerKey(node, size)
+		}
+	case "vmess", "vless":
+		network, settings := networkSettings(&proxy, opts)
+		config["network"] = network
+		config["networkSettings"] = settings
+		config["network_settings"] = settings
+		tls := 0
+		if proxy.TLS {
+			tls = 1
+		}
+		if proxy.Type == "vless" {
+			config["flow"] = optionString(proxy.Options, "flow")
+			tlsSettings := map[string]interface{}{
+				"server_name":    serverName,
+				"allow_insecure": opts.SkipCertVerify,
+			}
+			if opts.RealityOpts != nil {
+				tls = 2
+				tlsSettings["short_id"] = opts.RealityOpts.ShortID
+				tlsSettings["server_port"] = "443"
+				tlsSettings["dest"] = serverName
+			}
+			config["tls_settings"] = tlsSettings
+		}
+		config["tls"] = tls
+	case "trojan":
+		network, settings := networkSettings(&proxy, opts)
+		config["host"] = proxy.Server
+		config["server_name"] = serverName
+		config["network"] = network
+		config["networkSettings"] = settings
+		config["network_settings"] = settings
+	case "hysteria2", "hysteria":
+		config["version"] = 2
+		config["host"] = proxy.Server
+		config["server_name"] = serverName
+		config["up_mbps"] = optionInt(proxy.Options, "up")
+		config["down_mbps"] = optionInt(proxy.Options, "down")
+		if obfs := optionString(proxy.Options, "obfs"); obfs != "" {
+			config["obfs"] = obfs
+			config["obfs-password"] = optionString(proxy.Options, "obfs-password")
+		}
+	case "tuic":
+		config["server_name"] = serverName
+		config["congestion_control"] = firstNonEmpty(optionString(proxy.Options, "congestion_control"), "bbr")
+		config["zero_rtt_handshake"] = false
+	case "anytls":
+		config["server_name"] = serverName
+		config["padding_scheme"] = []interface{}{}
+	default:
+		return nil, fmt.Errorf("节点类型 %s 不支持后端对接", proxy.Type)
+	}
+
+	if node.AgentConfig != nil && *node.AgentConfig != "" {
+		var overrides map[string]interface{}
+		if err := json.Unmarshal([]byte(*node.AgentConfig), &overrides); err != nil {
+			return nil, fmt.Errorf("服务端配置解析失败: %v", err)
+		}
+		mergeConfig(config, overrides)
+	}
+	return config, nil
+}
+
+// mergeConfig 将覆盖项合并到配置中，两边都是对象的字段逐项合并
+func mergeConfig(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if srcMap, ok := value.(map[string]interface{}); ok {
+			if dstMap, ok := dst[key].(map[string]interface{}); ok {
+				mergeConfig(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// networkSettings 生成传输层配置
+func networkSettings(proxy *config_update.ProxyNode, opts *config_update.TransportOpts) (string, interface{}) {
+	network := proxy.Network
+	if network == "" {
+		network = "tcp"
+	}
+	switch network {
+	case "ws":
+		settings := map[string]interface{}{}
+		if opts.WSOpts != nil {
+			settings["path"] = opts.WSOpts.Path
+			if host := opts.WSOpts.Headers["Host"]; host != "" {
+				settings["headers"] = map[string]string{"Host": host}
+			}
+			if opts.WSOpts.V2rayHTTPUpgrade {
+				return "httpupgrade", map[string]interface{}{"path": opts.WSOpts.Path, "host": opts.WSOpts.Headers["Host"]}
+			}
+		}
+		return network, settings
+	case "grpc":
+		settings := map[string]interface{}{}
+		if opts.GRPCOpts != nil {
+			settings["serviceName"] = opts.GRPCOpts.GRPCServiceName
+		}
+		return network, settings
+	case "h2", "http":
+		settings := map[string]interface{}{}
+		if opts.H2Opts != nil {
+			settings["path"] = opts.H2Opts.Path
+			settings["host"] = opts.H2Opts.Host
+		}
+		return "h2", settings
+	}
+	return network, nil
+}
+
+// NodeUsers 获取可使用节点的用户，设备数限制为套餐的同时在线 IP 数上限
+func (s *NodeAgentService) NodeUsers(node *models.Node) ([]AgentUser, error) {
+	subs, err := s.eligibleSubscriptions(node)
+	if err != nil {
+		return nil, err
+	}
+	subIDs := make([]uint, 0, len(subs))
+	for i := range subs {
+		subIDs = append(subIDs, subs[i].ID)
+	}
+	limits := s.onlineLimits(subIDs)
+	keySize := 0
+	if node.Config != nil {
+		var proxy config_update.ProxyNode
+		if json.Unmarshal([]byte(*node.Config), &proxy) == nil && proxy.Type == "ss" {
+			keySize = config_update.SS2022KeySize(proxy.Cipher)
+		}
+	}
+	users := make([]AgentUser, 0, len(subs))
+	for i := range subs {
+		user := AgentUser{ID: subs[i].ID, UUID: subs[i].ProxyUUID, DeviceLimit: limits[subs[i].ID]}
+		if keySize > 0 {
+			user.Password = config_update.SS2022UserKey(&subs[i], keySize)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// NodeCredentials 导出节点上当前有效的全部用户凭据（密码已按节点协议生成，供自建代理服务加载）
+func (s *NodeAgentService) NodeCredentials(node *models.Node) ([]config_update.ProxyCredential, error) {
+	if node.Config == nil || *node.Config == "" {
+		return nil, fmt.Errorf("节点配置为空")
+	}
+	var proxy config_update.ProxyNode
+	if err := json.Unmarshal([]byte(*node.Config), &proxy); err != nil {
+		return nil, fmt.Errorf("节点配置解析失败: %v", err)
+	}
+	if err := config_update.EnsureNodeProxyKey(s.db, node); err != nil {
+		return nil, err
+	}
+	subs, err := s.eligibleSubscriptions(node)
+	if err != nil {
+		return nil, err
+	}
+	credentials := make([]config_update.ProxyCredential, 0, len(subs))
+	for i := range subs {
+		credentials = append(credentials, config_update.NodeCredential(node, &proxy, &subs[i]))
+	}
+	return credentials, nil
+}
+
+// eligibleSubscriptions 获取可使用节点的订阅：订阅有效、未过期、流量未用尽，
+// 且节点分组和套餐倍率限制允许使用该节点；尚未生成代理凭据的订阅同时生成凭据
+func (s *NodeAgentService) eligibleSubscriptions(node *models.Node) ([]models.Subscription, error) {
+	var subs []models.Subscription
+	if err := s.eligibleQuery(node).Select("subscriptions.*").Order("subscriptions.id ASC").Find(&subs).Error; err != nil {
+		return nil, err
+	}
+
+	eligible := make([]models.Subscription, 0, len(subs))
+	for i := range subs {
+		if subs[i].IsTrafficExhausted() {
+			continue
+		}
+		if err := config_update.EnsureProxyCredentials(s.db, &subs[i]); err != nil {
+			return nil, err
+		}
+		eligible = append(eligible, subs[i])
+	}
+	return eligible, nil
+}
+
+// eligibleSubscriptionIDs 节点可用订阅的 ID 集合，用于校验节点后端上报的订阅 ID。
+// 流量已用尽的订阅仍保留，节点移除该用户前产生的流量和在线记录照常入账
+func (s *NodeAgentService) eligibleSubscriptionIDs(node *models.Node) (map[uint]bool, error) {
+	var ids []uint
+	if err := s.eligibleQuery(node).Pluck("subscriptions.id", &ids).Error; err != nil {
+		return nil, err
+	}
+	eligible := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		eligible[id] = true
+	}
+	return eligible, nil
+}
+
+// eligibleQuery 查询节点可用订阅：订阅与用户有效、节点分组与套餐倍率限制允许
+func (s *NodeAgentService) eligibleQuery(node *models.Node) *gorm.DB {
+	query := s.db.Model(&models.Subscription{}).
+		Joins("JOIN users ON users.id = subscriptions.user_id").
+		Where("subscriptions.is_active = ? AND subscriptions.status = ? AND subscriptions.expire_time > ?", true, "active", time.Now()).
+		Where("users.is_active = ?", true).
+		Where("users.special_node_subscription_type IS NULL OR users.special_node_subscription_type != ?", "special_only")
+
+	// 节点加入分组后，仅套餐或用户等级关联了其中任一分组的用户可用
+	var groupIDs []uint
+	s.db.Table("node_group_nodes").Where("node_id = ?", node.ID).Pluck("node_group_id", &groupIDs)
+	if len(groupIDs) > 0 {
+		packageIDs := s.db.Table("package_node_groups").Select("package_id").Where("node_group_id IN ?", groupIDs)
+		levelIDs := s.db.Table("user_level_node_groups").Select("user_level_id").Where("node_group_id IN ?", groupIDs)
+		query = query.Where("(subscriptions.package_id IN (?) OR users.user_level_id IN (?))", packageIDs, levelIDs)
+	}
+
+	// 套餐限制了最高节点倍率时，倍率更高的节点不可用
+	limited := s.db.Model(&models.Package{}).Select("id").Where("max_node_multiplier > 0 AND max_node_multiplier < ?", node.Rate())
+	return query.Where("subscriptions.package_id IS NULL OR subscriptions.package_id NOT IN (?)", limited)
+}
+
+// ReportTraffic 记录节点后端上报的用户流量（键为订阅 ID，值为 [上传, 下载]），
+// 忽略不属于该节点可用订阅的 ID，避免节点为其他用户记账
+func (s *NodeAgentService) ReportTraffic(node *models.Node, data map[uint][2]int64) (int, error) {
+	eligible, err := s.eligibleSubscriptionIDs(node)
+	if err != nil {
+		return 0, err
+	}
+	reports := make([]traffic.UsageReport, 0, len(data))
+	ignored := 0
+	for subID, usage := range data {
+		if !eligible[subID] {
+			ignored++
+			continue
+		}
+		reports = append(reports, traffic.UsageReport{SubscriptionID: subID, Upload: usage[0], Download: usage[1]})
+	}
+	if ignored > 0 {
+		utils.LogWarn("节点 %s (ID: %d) 上报了 %d 个不可用订阅的流量，已忽略", node.Name, node.ID, ignored)
+	}
+	return traffic.NewTrafficService().RecordUsage(node.ID, reports)
+}
+
+// ReportStatus 记录节点后端上报的负载
+func (s *NodeAgentService) ReportStatus(node *models.Node, status NodeStatus) error {
+	data, _ := json.Marshal(status)
+	updates := map[string]interface{}{
+		"agent_status":      string(data),
+		"agent_reported_at": time.Now(),
+		"load":              status.CPU,
+		"status":            "online",
+	}
+	if status.Uptime > 0 {
+		updates["uptime"] = status.Uptime
+	}
+	return s.db.Model(node).Updates(updates).Error
+}
+
+// Touch 记录节点后端的通信时间
+func (s *NodeAgentService) Touch(node *models.Node) {
+	s.db.Model(node).UpdateColumn("agent_reported_at", time.Now())
+}
+
+// normalizeIP 去掉节点后端上报的 IP 中可能附带的端口或节点后缀（如 "1.2.3.4_5"）
+func normalizeIP(ip string) string {
+	ip = strings.TrimSpace(ip)
+	if host, _, ok := strings.Cut(ip, "_"); ok {
+		ip = host
+	}
+	if strings.HasPrefix(ip, "[") {
+		if end := strings.Index(ip, "]"); end > 0 {
+			return ip[1:end]
+		}
+	}
+	if strings.Count(ip, ":") == 1 {
+		ip, _, _ = strings.Cut(ip, ":")
+	}
+	return ip
+}
+
+// optionString 读取节点附加选项中的字符串
+func optionString(options map[string]interface{}, key string) string {
+	if options == nil {
+		return ""
+	}
+	if value, ok := options[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// optionInt 读取节点附加选项中的整数（兼容 "100 Mbps" 形式）
+func optionInt(options map[string]interface{}, key string) int {
+	switch value := options[key].(type) {
+	case float64:
+		return int(value)
+	case int:
+		return value
+	case string:
+		var n int
+		fmt.Sscanf(value, "%d", &n)
+		return n
+	}
+	return 0
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
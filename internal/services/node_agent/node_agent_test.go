@@ -0,0 +1,145 @@
+package node_agent
+
+import (
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestBuildNodeConfig 测试下发给节点后端的节点配置
+func TestBuildNodeConfig(t *testing.T) {
+	s := &NodeAgentService{}
+	config := `{"Name":"香港 01","Type":"trojan","Server":"hk.example.com","Port":443,"Password":"p","Network":"ws",` +
+		`"Options":{"servername":"cdn.example.com","ws-opts":{"path":"/ws","headers":{"Host":"cdn.example.com"}}}}`
+	overrides := `{"server_port":8443,"networkSettings":{"path":"/inner"}}`
+	node := &models.Node{ID: 1, Type: "trojan", Config: &config, AgentConfig: &overrides}
+
+	result, err := s.BuildNodeConfig(node)
+	if err != nil {
+		t.Fatalf("生成节点配置失败: %v", err)
+	}
+	if result["server_name"] != "cdn.example.com" || result["network"] != "ws" {
+		t.Errorf("trojan 配置错误: %+v", result)
+	}
+	if result["server_port"] != float64(8443) {
+		t.Errorf("服务端配置应覆盖监听端口: %v", result["server_port"])
+	}
+	settings, _ := result["networkSettings"].(map[string]interface{})
+	if settings["path"] != "/inner" || settings["headers"] == nil {
+		t.Errorf("服务端配置应逐项合并到传输配置: %+v", settings)
+	}
+
+	unsupported := `{"Type":"ssr","Server":"a.example.com","Port":443}`
+	if _, err := s.BuildNodeConfig(&models.Node{Type: "ssr", Config: &unsupported}); err == nil {
+		t.Error("不支持的节点类型应返回错误")
+	}
+}
+
+// TestNormalizeIP 测试在线 IP 格式统一
+func TestNormalizeIP(t *testing.T) {
+	cases := map[string]string{
+		"1.2.3.4":           "1.2.3.4",
+		"1.2.3.4:5678":      "1.2.3.4",
+		"1.2.3.4_3":         "1.2.3.4",
+		"[2001:db8::1]:443": "2001:db8::1",
+		"2001:db8::1":       "2001:db8::1",
+	}
+	for input, want := range cases {
+		if got := normalizeIP(input); got != want {
+			t.Errorf("%s: 期望 %s，实际 %s", input, want, got)
+		}
+	}
+	if !MatchNodeType("ss", "shadowsocks") || !MatchNodeType("hysteria2", "hysteria") || MatchNodeType("vmess", "vless") {
+		t.Error("节点类型匹配错误")
+	}
+}
+
+// TestOverLimitIPs 测试同时在线 IP 数超限时保留最早出现的 IP
+func TestOverLimitIPs(t *testing.T) {
+	records := []models.NodeOnlineIP{
+		{NodeID: 1, IP: "1.1.1.1"},
+		{NodeID: 2, IP: "2.2.2.2"},
+		{NodeID: 2, IP: "1.1.1.1"},
+		{NodeID: 1, IP: "3.3.3.3"},
+	}
+	ips := orderedIPs(records)
+	if len(ips) != 3 || ips[0] != "1.1.1.1" || ips[2] != "3.3.3.3" {
+		t.Fatalf("在线 IP 去重或排序错误: %v", ips)
+	}
+	over := overLimitIPs(ips, 2)
+	if len(over) != 1 || !over["3.3.3.3"] {
+		t.Errorf("应只断开最晚出现的 IP: %v", over)
+	}
+	if len(overLimitIPs(ips, 0)) != 0 || len(overLimitIPs(ips, 3)) != 0 {
+		t.Error("未超限或不限制时不应断开连接")
+	}
+}
+
+// TestReportIgnoresIneligibleSubscriptions 测试节点上报时忽略不属于该节点可用订阅的 ID
+func TestReportIgnoresIneligibleSubscriptions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.Subscription{}, &models.Package{}, &models.UserLevel{},
+		&models.NodeGroup{}, &models.Node{}, &models.NodeOnlineIP{}, &models.SystemConfig{}); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	s := &NodeAgentService{db: db}
+
+	node := models.Node{Name: "香港 01", Type: "ss", IsActive: true}
+	db.Create(&node)
+	db.Create(&models.NodeGroup{ID: 1, Name: "香港"})
+	db.Table("node_group_nodes").Create(map[string]interface{}{"node_group_id": 1, "node_id": node.ID})
+	db.Create(&models.Package{ID: 1, Name: "香港套餐"})
+	db.Create(&models.Package{ID: 2, Name: "其他套餐"})
+	db.Table("package_node_groups").Create(map[string]interface{}{"node_group_id": 1, "package_id": 1})
+
+	grouped, other := int64(1), int64(2)
+	expire := time.Now().Add(24 * time.Hour)
+	db.Create(&models.User{ID: 1, Username: "u1", Email: "u1@example.com", Password: "x", IsActive: true})
+	db.Create(&models.User{ID: 2, Username: "u2", Email: "u2@example.com", Password: "x", IsActive: true})
+	db.Create(&models.Subscription{ID: 1, UserID: 1, SubscriptionURL: "t1", PackageID: &grouped, IsActive: true, Status: "active", ExpireTime: expire})
+	db.Create(&models.Subscription{ID: 2, UserID: 2, SubscriptionURL: "t2", PackageID: &other, IsActive: true, Status: "active", ExpireTime: expire})
+	// 流量已用尽的订阅仍可上报，节点移除该用户前的流量照常入账
+	db.Create(&models.Subscription{ID: 3, UserID: 1, SubscriptionURL: "t3", PackageID: &grouped, IsActive: true, Status: "active", ExpireTime: expire,
+		TrafficLimit: 10, DownloadTraffic: 10})
+
+	eligible, err := s.eligibleSubscriptionIDs(&node)
+	if err != nil {
+		t.Fatalf("查询可用订阅失败: %v", err)
+	}
+	if !eligible[1] || eligible[2] || !eligible[3] || eligible[99] {
+		t.Errorf("可用订阅错误: %v", eligible)
+	}
+
+	if err := s.ReportAlive(&node, map[uint][]string{1: {"1.1.1.1"}, 2: {"2.2.2.2"}, 3: {"3.3.3.3"}, 99: {"9.9.9.9"}}); err != nil {
+		t.Fatalf("上报在线 IP 失败: %v", err)
+	}
+	var subIDs []uint
+	db.Model(&models.NodeOnlineIP{}).Order("subscription_id").Pluck("subscription_id", &subIDs)
+	if len(subIDs) != 2 || subIDs[0] != 1 || subIDs[1] != 3 {
+		t.Errorf("应只记录可用订阅的在线 IP: %v", subIDs)
+	}
+
+	// 其他节点上报的在线 IP 也只返回本节点可用订阅的统计
+	japan := models.Node{Name: "日本 01", Type: "ss", IsActive: true}
+	db.Create(&japan)
+	if err := s.ReportAlive(&japan, map[uint][]string{1: {"4.4.4.4"}, 2: {"2.2.2.2"}}); err != nil {
+		t.Fatalf("上报在线 IP 失败: %v", err)
+	}
+	counts, err := s.AliveCounts(&node)
+	if err != nil {
+		t.Fatalf("统计在线 IP 失败: %v", err)
+	}
+	if len(counts) != 2 || counts[1] != 2 || counts[3] != 1 {
+		t.Errorf("在线 IP 统计错误: %v", counts)
+	}
+}
@@ -0,0 +1,253 @@
+package node_agent
+
+import (
+	"strconv"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// defaultOnlineWindow 在线 IP 统计窗口（秒）的默认值，窗口内上报过的 IP 都计为在线
+const defaultOnlineWindow = 3 * PushInterval
+
+// OnlineSession 需要节点断开的连接（订阅 ID + 客户端 IP）
+type OnlineSession struct {
+	SubscriptionID uint   `json:"id"`
+	IP             string `json:"ip"`
+}
+
+// OnlineIP 订阅当前的在线 IP（管理员查看）
+type OnlineIP struct {
+	IP        string    `json:"ip"`
+	NodeID    uint      `json:"node_id"`
+	NodeName  string    `json:"node_name"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	OverLimit bool      `json:"over_limit"`
+}
+
+// OnlineWindow 在线 IP 统计窗口，可通过系统设置 online_ip_window（秒）调整，最小为一个上报周期
+func (s *NodeAgentService) OnlineWindow() time.Duration {
+	seconds := defaultOnlineWindow
+	var config models.SystemConfig
+	if err := s.db.Where("key = ? AND category = ?", "online_ip_window", "general").First(&config).Error; err == nil {
+		if value, err := strconv.Atoi(config.Value); err == nil && value >= PushInterval {
+			seconds = value
+		}
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// ReportAlive 记录节点后端上报的在线用户 IP（键为订阅 ID），超出统计窗口未再上报的 IP 视为离线
+func (s *NodeAgentService) ReportAlive(node *models.Node, data map[uint][]string) error {
+	data, err := s.eligibleOnline(node, data)
+	if err != nil {
+		return err
+	}
+	return s.recordOnline(node, data, time.Now())
+}
+
+// ReportOnline 记录节点上报的在线 IP，并按套餐的同时在线 IP 数上限返回该节点需要断开的连接：
+// 同一订阅在所有节点上按首次出现时间保留最早的 IP，超出上限的 IP 需断开
+func (s *NodeAgentService) ReportOnline(node *models.Node, data map[uint][]string) ([]OnlineSession, error) {
+	data, err := s.eligibleOnline(node, data)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := s.recordOnline(node, data, now); err != nil {
+		return nil, err
+	}
+
+	subIDs := make([]uint, 0, len(data))
+	for subID := range data {
+		subIDs = append(subIDs, subID)
+	}
+	limits := s.onlineLimits(subIDs)
+
+	drops := make([]OnlineSession, 0)
+	since := now.Add(-s.OnlineWindow())
+	for subID, ips := range data {
+		limit, ok := limits[subID]
+		if !ok {
+			continue
+		}
+		records, err := s.onlineRecords(subID, since)
+		if err != nil {
+			return nil, err
+		}
+		over := overLimitIPs(orderedIPs(records), limit)
+		reported := make(map[string]bool, len(ips))
+		for _, ip := range ips {
+			if ip = normalizeIP(ip); ip != "" && over[ip] && !reported[ip] {
+				reported[ip] = true
+				drops = append(drops, OnlineSession{SubscriptionID: subID, IP: ip})
+			}
+		}
+	}
+	return drops, nil
+}
+
+// eligibleOnline 过滤掉不属于该节点可用订阅的在线记录
+func (s *NodeAgentService) eligibleOnline(node *models.Node, data map[uint][]string) (map[uint][]string, error) {
+	eligible, err := s.eligibleSubscriptionIDs(node)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make(map[uint][]string, len(data))
+	for subID, ips := range data {
+		if eligible[subID] {
+			filtered[subID] = ips
+		}
+	}
+	if ignored := len(data) - len(filtered); ignored > 0 {
+		utils.LogWarn("节点 %s (ID: %d) 上报了 %d 个不可用订阅的在线 IP，已忽略", node.Name, node.ID, ignored)
+	}
+	return filtered, nil
+}
+
+// recordOnline 更新节点上报的在线 IP，并清理超出统计窗口的记录
+func (s *NodeAgentService) recordOnline(node *models.Node, data map[uint][]string, now time.Time) error {
+	window := s.OnlineWindow()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for subID, ips := range data {
+			for _, ip := range ips {
+				ip = normalizeIP(ip)
+				if ip == "" {
+					continue
+				}
+				record := models.NodeOnlineIP{NodeID: node.ID, SubscriptionID: subID, IP: ip}
+				if err := tx.Where(&record).Attrs(models.NodeOnlineIP{FirstSeen: now}).FirstOrCreate(&record).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&record).Update("last_seen", now).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Where("last_seen < ?", now.Add(-window)).Delete(&models.NodeOnlineIP{}).Error
+	})
+}
+
+// AliveCounts 统计节点可用订阅在所有节点上的在线 IP 数（供节点后端做设备数限制），
+// 不返回该节点未服务的订阅
+func (s *NodeAgentService) AliveCounts(node *models.Node) (map[uint]int, error) {
+	var rows []struct {
+		SubscriptionID uint
+		Count          int
+	}
+	if err := s.db.Model(&models.NodeOnlineIP{}).
+		Select("subscription_id, COUNT(DISTINCT ip) AS count").
+		Where("last_seen > ?", time.Now().Add(-s.OnlineWindow())).
+		Where("subscription_id IN (?)", s.eligibleQuery(node).Select("subscriptions.id")).
+		Group("subscription_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.SubscriptionID] = row.Count
+	}
+	return counts, nil
+}
+
+// OnlineIPs 获取订阅在统计窗口内的在线 IP，超出套餐上限的 IP 标记为 over_limit
+func (s *NodeAgentService) OnlineIPs(sub *models.Subscription) ([]OnlineIP, error) {
+	records, err := s.onlineRecords(sub.ID, time.Now().Add(-s.OnlineWindow()))
+	if err != nil {
+		return nil, err
+	}
+	over := map[string]bool{}
+	if limit, ok := s.onlineLimits([]uint{sub.ID})[sub.ID]; ok {
+		over = overLimitIPs(orderedIPs(records), limit)
+	}
+
+	nodeIDs := make([]uint, 0, len(records))
+	for _, record := range records {
+		nodeIDs = append(nodeIDs, record.NodeID)
+	}
+	var nodes []models.Node
+	if len(nodeIDs) > 0 {
+		s.db.Select("id, name").Where("id IN ?", nodeIDs).Find(&nodes)
+	}
+	names := make(map[uint]string, len(nodes))
+	for _, node := range nodes {
+		names[node.ID] = node.Name
+	}
+
+	result := make([]OnlineIP, 0, len(records))
+	for _, record := range records {
+		result = append(result, OnlineIP{
+			IP:        record.IP,
+			NodeID:    record.NodeID,
+			NodeName:  names[record.NodeID],
+			FirstSeen: record.FirstSeen,
+			LastSeen:  record.LastSeen,
+			OverLimit: over[record.IP],
+		})
+	}
+	return result, nil
+}
+
+// OnlineLimit 订阅所属套餐的同时在线 IP 数上限，0 表示不限制
+func (s *NodeAgentService) OnlineLimit(sub *models.Subscription) int {
+	return s.onlineLimits([]uint{sub.ID})[sub.ID]
+}
+
+// onlineLimits 获取订阅的同时在线 IP 数上限（仅返回有限制的订阅）
+func (s *NodeAgentService) onlineLimits(subIDs []uint) map[uint]int {
+	limits := make(map[uint]int)
+	if len(subIDs) == 0 {
+		return limits
+	}
+	var rows []struct {
+		ID           uint
+		MaxOnlineIPs int
+	}
+	s.db.Table("subscriptions").
+		Select("subscriptions.id, packages.max_online_ips").
+		Joins("JOIN packages ON packages.id = subscriptions.package_id").
+		Where("subscriptions.id IN ? AND packages.max_online_ips > 0", subIDs).
+		Scan(&rows)
+	for _, row := range rows {
+		limits[row.ID] = row.MaxOnlineIPs
+	}
+	return limits
+}
+
+// onlineRecords 获取订阅在 since 之后上报过的在线 IP 记录，按首次出现时间排序
+func (s *NodeAgentService) onlineRecords(subID uint, since time.Time) ([]models.NodeOnlineIP, error) {
+	var records []models.NodeOnlineIP
+	err := s.db.Where("subscription_id = ? AND last_seen > ?", subID, since).
+		Order("first_seen ASC, id ASC").
+		Find(&records).Error
+	return records, err
+}
+
+// orderedIPs 按首次出现的顺序去重（同一 IP 可能同时出现在多个节点上）
+func orderedIPs(records []models.NodeOnlineIP) []string {
+	seen := make(map[string]bool, len(records))
+	ips := make([]string, 0, len(records))
+	for _, record := range records {
+		if !seen[record.IP] {
+			seen[record.IP] = true
+			ips = append(ips, record.IP)
+		}
+	}
+	return ips
+}
+
+// overLimitIPs 保留最早出现的 limit 个 IP，返回超出上限的 IP
+func overLimitIPs(ips []string, limit int) map[string]bool {
+	over := make(map[string]bool)
+	if limit <= 0 {
+		return over
+	}
+	for i := limit; i < len(ips); i++ {
+		over[ips[i]] = true
+	}
+	return over
+}
@@ -0,0 +1,327 @@
+package node_health
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"cboard-go/internal/services/config_update"
+
+	"github.com/google/uuid"
+)
+
+// 地址类型（SOCKS5 格式，Shadowsocks / Trojan 使用）
+const (
+	socksAtypIPv4   = 1
+	socksAtypDomain = 3
+	socksAtypIPv6   = 4
+)
+
+// 地址类型（V2Ray 格式，VLESS / VMess 使用）
+const (
+	v2rayAtypIPv4   = 1
+	v2rayAtypDomain = 2
+	v2rayAtypIPv6   = 3
+)
+
+// unsupportedReason 返回节点无法进行协议级检测的原因，为空表示支持
+// 支持 ss（AEAD 加密、无插件）、trojan、vless（无 flow）、vmess（AEAD，alterId 为 0），
+// 传输方式支持 tcp / ws（含 httpupgrade）及 TLS，暂不支持 Reality、gRPC、HTTP/2
+func unsupportedReason(node *config_update.ProxyNode) string {
+	opts := transportOpts(node)
+	nodeType := strings.ToLower(node.Type)
+
+	switch nodeType {
+	case "ss", "shadowsocks":
+		if _, ok := ssCiphers[strings.ToLower(node.Cipher)]; !ok {
+			return "Shadowsocks 加密方式 " + node.Cipher
+		}
+		if plugin, _ := opts.Other["plugin"].(string); plugin != "" {
+			return "Shadowsocks 插件 " + plugin
+		}
+		return ""
+	case "trojan", "vless", "vmess":
+	default:
+		return "协议 " + node.Type
+	}
+
+	if opts.RealityOpts != nil {
+		return "Reality"
+	}
+	switch strings.ToLower(node.Network) {
+	case "", "tcp":
+		if headerType, _ := opts.Other["header-type"].(string); headerType != "" && headerType != "none" {
+			return "TCP 伪装 " + headerType
+		}
+	case "ws":
+	default:
+		return "传输方式 " + node.Network
+	}
+
+	switch nodeType {
+	case "vless":
+		if flow, _ := opts.Other["flow"].(string); flow != "" {
+			return "VLESS flow " + flow
+		}
+	case "vmess":
+		if alterID := optionInt(opts.Other["alterId"]); alterID > 0 {
+			return "VMess alterId 非 0"
+		}
+		if _, ok := vmessSecurities[vmessSecurityName(node.Cipher)]; !ok {
+			return "VMess 加密方式 " + node.Cipher
+		}
+	}
+	return ""
+}
+
+// dialNode 通过节点建立到目标地址（host:port）的代理连接
+func dialNode(ctx context.Context, node *config_update.ProxyNode, target string) (net.Conn, error) {
+	if reason := unsupportedReason(node); reason != "" {
+		return nil, fmt.Errorf("暂不支持协议检测: %s", reason)
+	}
+	host, port, err := splitTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialTransport(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+
+	var proxyConn net.Conn
+	switch strings.ToLower(node.Type) {
+	case "ss", "shadowsocks":
+		proxyConn, err = newShadowsocksConn(conn, strings.ToLower(node.Cipher), node.Password, socksAddr(host, port))
+	case "trojan":
+		proxyConn = newTrojanConn(conn, node.Password, host, port)
+	case "vless":
+		proxyConn, err = newVLESSConn(conn, node.UUID, host, port)
+	case "vmess":
+		proxyConn, err = newVMessConn(conn, node.UUID, vmessSecurityName(node.Cipher), host, port)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return proxyConn, nil
+}
+
+// dialTransport 建立到节点服务器的底层连接（TCP，按需叠加 TLS 和 WebSocket）
+func dialTransport(ctx context.Context, node *config_update.ProxyNode) (net.Conn, error) {
+	opts := transportOpts(node)
+	address := net.JoinHostPort(node.Server, strconv.Itoa(node.Port))
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("连接失败: %v", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	isWS := strings.EqualFold(node.Network, "ws")
+	if node.TLS || strings.EqualFold(node.Type, "trojan") {
+		serverName := opts.SNI
+		if serverName == "" {
+			serverName, _ = opts.Other["sni"].(string)
+		}
+		if serverName == "" {
+			serverName = node.Server
+		}
+		tlsConfig := &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: opts.SkipCertVerify,
+			NextProtos:         optionStrings(opts.Other["alpn"]),
+		}
+		// WebSocket 只能运行在 HTTP/1.1 之上
+		if isWS {
+			tlsConfig.NextProtos = []string{"http/1.1"}
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS 握手失败: %v", err)
+		}
+		conn = tlsConn
+	}
+
+	if isWS {
+		path, host := "/", node.Server
+		var headers map[string]string
+		httpUpgrade := false
+		if opts.WSOpts != nil {
+			if opts.WSOpts.Path != "" {
+				path = opts.WSOpts.Path
+			}
+			headers = opts.WSOpts.Headers
+			if h := headers["Host"]; h != "" {
+				host = h
+			}
+			httpUpgrade = opts.WSOpts.V2rayHTTPUpgrade
+		}
+		wsConn, err := dialWebSocket(conn, host, path, headers, httpUpgrade)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = wsConn
+	}
+	return conn, nil
+}
+
+// transportOpts 解析节点的传输选项
+func transportOpts(node *config_update.ProxyNode) *config_update.TransportOpts {
+	if opts := config_update.TransportOptsFromMap(node.Options); opts != nil {
+		return opts
+	}
+	return &config_update.TransportOpts{Other: map[string]interface{}{}}
+}
+
+// optionInt 读取数值选项（兼容 JSON 反序列化后的 float64）
+func optionInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	return 0
+}
+
+// optionStrings 读取字符串列表选项
+func optionStrings(v interface{}) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		result := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok && s != "" {
+				result = append(result, s)
+			}
+		}
+		return result
+	case string:
+		if list != "" {
+			return strings.Split(list, ",")
+		}
+	}
+	return nil
+}
+
+// splitTarget 拆分目标地址
+func splitTarget(target string) (string, uint16, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", 0, fmt.Errorf("目标地址格式错误: %v", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("目标端口错误: %v", err)
+	}
+	return host, uint16(port), nil
+}
+
+// socksAddr 编码 SOCKS5 格式的目标地址（类型 + 地址 + 端口）
+func socksAddr(host string, port uint16) []byte {
+	var buf []byte
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			buf = append([]byte{socksAtypIPv4}, ip4...)
+		} else {
+			buf = append([]byte{socksAtypIPv6}, ip.To16()...)
+		}
+	} else {
+		buf = append([]byte{socksAtypDomain, byte(len(host))}, host...)
+	}
+	return binary.BigEndian.AppendUint16(buf, port)
+}
+
+// v2rayAddr 编码 V2Ray 格式的目标地址（端口 + 类型 + 地址）
+func v2rayAddr(host string, port uint16) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, port)
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			return append(append(buf, v2rayAtypIPv4), ip4...)
+		}
+		return append(append(buf, v2rayAtypIPv6), ip.To16()...)
+	}
+	return append(append(buf, v2rayAtypDomain, byte(len(host))), host...)
+}
+
+// headerConn 在首次写入时附带协议请求头的连接
+type headerConn struct {
+	net.Conn
+	header []byte
+}
+
+func (c *headerConn) Write(b []byte) (int, error) {
+	if c.header == nil {
+		return c.Conn.Write(b)
+	}
+	buf := append(c.header, b...)
+	c.header = nil
+	if _, err := c.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// newTrojanConn 创建 Trojan 连接：hex(SHA224(密码)) + CRLF + CONNECT + 地址 + CRLF
+func newTrojanConn(conn net.Conn, password, host string, port uint16) net.Conn {
+	sum := sha256.Sum224([]byte(password))
+	header := make([]byte, 0, 64+len(host))
+	header = append(header, hex.EncodeToString(sum[:])...)
+	header = append(header, '\r', '\n', 0x01)
+	header = append(header, socksAddr(host, port)...)
+	header = append(header, '\r', '\n')
+	return &headerConn{Conn: conn, header: header}
+}
+
+// vlessConn VLESS 连接，读取时跳过响应头（版本 + 附加信息）
+type vlessConn struct {
+	headerConn
+	responseRead bool
+}
+
+// newVLESSConn 创建 VLESS 连接：版本 + UUID + 附加信息长度 + TCP 命令 + 地址
+func newVLESSConn(conn net.Conn, id, host string, port uint16) (net.Conn, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("UUID 格式错误: %v", err)
+	}
+	header := make([]byte, 0, 22+len(host))
+	header = append(header, 0x00)
+	header = append(header, uid[:]...)
+	header = append(header, 0x00, 0x01)
+	header = append(header, v2rayAddr(host, port)...)
+	return &vlessConn{headerConn: headerConn{Conn: conn, header: header}}, nil
+}
+
+func (c *vlessConn) Read(b []byte) (int, error) {
+	if !c.responseRead {
+		var head [2]byte
+		if _, err := io.ReadFull(c.Conn, head[:]); err != nil {
+			return 0, err
+		}
+		if head[1] > 0 {
+			if _, err := io.CopyN(io.Discard, c.Conn, int64(head[1])); err != nil {
+				return 0, err
+			}
+		}
+		c.responseRead = true
+	}
+	return c.Conn.Read(b)
+}
@@ -0,0 +1,476 @@
+package node_health
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/config_update"
+
+	"github.com/google/uuid"
+)
+
+const testUUID = "b831381d-6324-4d53-ad4f-8cda48b30811"
+
+// standInHandshake 模拟服务端握手：解析协议请求头，返回数据连接和目标地址
+type standInHandshake func(conn net.Conn) (net.Conn, string, error)
+
+// startStandInServer 启动本地模拟节点服务端，完成握手后将数据转发到目标地址
+func startStandInServer(t *testing.T, handshake standInHandshake) (string, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动模拟服务端失败: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				proxied, target, err := handshake(conn)
+				if err != nil {
+					return
+				}
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, proxied)
+				io.Copy(proxied, upstream)
+			}()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// newTestService 创建使用本地探测地址的检测服务
+func newTestService(t *testing.T) *NodeHealthService {
+	t.Helper()
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(target.Close)
+	return &NodeHealthService{
+		testTimeout: 5 * time.Second,
+		maxLatency:  3000,
+		testURL:     target.URL + "/generate_204",
+	}
+}
+
+// testProxyNode 通过 TestNode 检测节点（与数据库中保存的节点配置格式一致）
+func testProxyNode(t *testing.T, s *NodeHealthService, proxy config_update.ProxyNode) *TestResult {
+	t.Helper()
+	cfg, _ := json.Marshal(proxy)
+	cfgStr := string(cfg)
+	result, err := s.TestNode(&models.Node{ID: 1, Config: &cfgStr})
+	if err != nil {
+		t.Fatalf("检测节点失败: %v", err)
+	}
+	return result
+}
+
+// readSocksAddr 读取 SOCKS5 格式地址
+func readSocksAddr(r io.Reader) (string, error) {
+	var atyp [1]byte
+	if _, err := io.ReadFull(r, atyp[:]); err != nil {
+		return "", err
+	}
+	var host string
+	switch atyp[0] {
+	case socksAtypIPv4, socksAtypIPv6:
+		ip := make([]byte, 4)
+		if atyp[0] == socksAtypIPv6 {
+			ip = make([]byte, 16)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socksAtypDomain:
+		var l [1]byte
+		if _, err := io.ReadFull(r, l[:]); err != nil {
+			return "", err
+		}
+		domain := make([]byte, l[0])
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		return "", errors.New("地址类型错误")
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// parseV2rayAddr 解析 V2Ray 格式地址
+func parseV2rayAddr(b []byte) (string, error) {
+	if len(b) < 4 {
+		return "", errors.New("地址过短")
+	}
+	port := binary.BigEndian.Uint16(b)
+	var host string
+	switch b[2] {
+	case v2rayAtypIPv4:
+		host = net.IP(b[3:7]).String()
+	case v2rayAtypIPv6:
+		host = net.IP(b[3:19]).String()
+	case v2rayAtypDomain:
+		host = string(b[4 : 4+int(b[3])])
+	default:
+		return "", errors.New("地址类型错误")
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// TestShadowsocksHealthCheck 测试 Shadowsocks 节点检测（含密码错误）
+func TestShadowsocksHealthCheck(t *testing.T) {
+	s := newTestService(t)
+	host, port := startStandInServer(t, func(conn net.Conn) (net.Conn, string, error) {
+		ss, err := newShadowsocksConn(conn, "chacha20-ietf-poly1305", "secret", nil)
+		if err != nil {
+			return nil, "", err
+		}
+		target, err := readSocksAddr(ss)
+		return ss, target, err
+	})
+
+	node := config_update.ProxyNode{Type: "ss", Server: host, Port: port, Cipher: "chacha20-ietf-poly1305", Password: "secret"}
+	if result := testProxyNode(t, s, node); result.Status != "online" || result.Method != MethodProxy {
+		t.Fatalf("Shadowsocks 检测结果错误: %+v", result)
+	}
+
+	node.Password = "wrong"
+	if result := testProxyNode(t, s, node); result.Status != "offline" || result.Method != MethodProxy {
+		t.Errorf("密码错误时应检测为离线: %+v", result)
+	}
+}
+
+// TestTrojanHealthCheck 测试 Trojan 节点检测（TLS）
+func TestTrojanHealthCheck(t *testing.T) {
+	s := newTestService(t)
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}}
+	sum := sha256.Sum224([]byte("secret"))
+	expected := hex.EncodeToString(sum[:])
+
+	host, port := startStandInServer(t, func(conn net.Conn) (net.Conn, string, error) {
+		tlsConn := tls.Server(conn, tlsConfig)
+		head := make([]byte, 56+3)
+		if _, err := io.ReadFull(tlsConn, head); err != nil {
+			return nil, "", err
+		}
+		if string(head[:56]) != expected || head[58] != 0x01 {
+			return nil, "", errors.New("认证失败")
+		}
+		target, err := readSocksAddr(tlsConn)
+		if err != nil {
+			return nil, "", err
+		}
+		crlf := make([]byte, 2)
+		_, err = io.ReadFull(tlsConn, crlf)
+		return tlsConn, target, err
+	})
+
+	node := config_update.ProxyNode{
+		Type: "trojan", Server: host, Port: port, Password: "secret",
+		Options: map[string]interface{}{"sni": "localhost", "skip-cert-verify": true},
+	}
+	if result := testProxyNode(t, s, node); result.Status != "online" || result.Method != MethodProxy {
+		t.Fatalf("Trojan 检测结果错误: %+v", result)
+	}
+
+	node.Password = "wrong"
+	if result := testProxyNode(t, s, node); result.Status != "offline" {
+		t.Errorf("密码错误时应检测为离线: %+v", result)
+	}
+}
+
+// TestVLESSWebSocketHealthCheck 测试 VLESS over WebSocket 节点检测
+func TestVLESSWebSocketHealthCheck(t *testing.T) {
+	s := newTestService(t)
+	id := uuid.MustParse(testUUID)
+
+	host, port := startStandInServer(t, func(conn net.Conn) (net.Conn, string, error) {
+		reader := bufio.NewReader(conn)
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return nil, "", err
+		}
+		if req.URL.Path != "/ws" || req.Host != "cdn.example.com" {
+			return nil, "", errors.New("路径或 Host 错误")
+		}
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+			wsAcceptKey(req.Header.Get("Sec-WebSocket-Key")))
+		ws := &wsConn{Conn: conn, reader: reader}
+
+		head := make([]byte, 18)
+		if _, err := io.ReadFull(ws, head); err != nil {
+			return nil, "", err
+		}
+		if !bytes.Equal(head[1:17], id[:]) {
+			return nil, "", errors.New("UUID 错误")
+		}
+		if _, err := io.CopyN(io.Discard, ws, int64(head[17])); err != nil {
+			return nil, "", err
+		}
+		cmd := make([]byte, 1)
+		if _, err := io.ReadFull(ws, cmd); err != nil {
+			return nil, "", err
+		}
+		addr := make([]byte, 3)
+		if _, err := io.ReadFull(ws, addr); err != nil {
+			return nil, "", err
+		}
+		var rest []byte
+		switch addr[2] {
+		case v2rayAtypIPv4:
+			rest = make([]byte, 4)
+		case v2rayAtypIPv6:
+			rest = make([]byte, 16)
+		default:
+			return nil, "", errors.New("地址类型错误")
+		}
+		if _, err := io.ReadFull(ws, rest); err != nil {
+			return nil, "", err
+		}
+		target, err := parseV2rayAddr(append(addr, rest...))
+		return &headerConn{Conn: ws, header: []byte{0x00, 0x00}}, target, err
+	})
+
+	node := config_update.ProxyNode{
+		Type: "vless", Server: host, Port: port, UUID: testUUID, Network: "ws",
+		Options: map[string]interface{}{
+			"ws-opts": map[string]interface{}{"path": "/ws", "headers": map[string]string{"Host": "cdn.example.com"}},
+		},
+	}
+	if result := testProxyNode(t, s, node); result.Status != "online" || result.Method != MethodProxy {
+		t.Fatalf("VLESS 检测结果错误: %+v", result)
+	}
+}
+
+// TestVMessHealthCheck 测试 VMess（AEAD）节点检测
+func TestVMessHealthCheck(t *testing.T) {
+	s := newTestService(t)
+	id := uuid.MustParse(testUUID)
+
+	for _, security := range []string{"auto", "chacha20-poly1305", "none"} {
+		host, port := startStandInServer(t, func(conn net.Conn) (net.Conn, string, error) {
+			return vmessStandIn(conn, id)
+		})
+		node := config_update.ProxyNode{Type: "vmess", Server: host, Port: port, UUID: testUUID, Cipher: security}
+		if result := testProxyNode(t, s, node); result.Status != "online" || result.Method != MethodProxy {
+			t.Fatalf("VMess(%s) 检测结果错误: %+v", security, result)
+		}
+	}
+}
+
+// TestVMessKnownAnswer 使用固定输入校验 VMess AEAD 密钥派生与请求头加密，
+// 避免只与测试中的模拟服务端互相验证。KDF 向量取自 v2fly 的 TestKDFValue，
+// 其余向量按 VMess AEAD 规范由独立实现计算
+func TestVMessKnownAnswer(t *testing.T) {
+	kdf := vmessKDF([]byte("Demo Key for KDF Value Test"),
+		"Demo Path for KDF Value Test", "Demo Path for KDF Value Test2", "Demo Path for KDF Value Test3")
+	if got := hex.EncodeToString(kdf); got != "53e9d7e1bd7bd25022b71ead07d8a596efc8a845c7888652fd684b4903dc8892" {
+		t.Errorf("KDF 结果错误: %s", got)
+	}
+	if got := hex.EncodeToString(vmessKDF([]byte("Demo Key for KDF Value Test"))); got != "5451591560e05bd6f1e3c32b90469d9c924859a1909594c88ce9f67a6cb47f14" {
+		t.Errorf("无路径 KDF 结果错误: %s", got)
+	}
+
+	cmdKey := vmessCmdKey(uuid.MustParse(testUUID))
+	if got := hex.EncodeToString(cmdKey); got != "b50d916ac0cec067981af8e5f38a758f" {
+		t.Fatalf("指令密钥错误: %s", got)
+	}
+
+	authID, err := vmessAuthIDWith(cmdKey, time.Unix(1700000000, 0), []byte{0x01, 0x02, 0x03, 0x04})
+	if err != nil {
+		t.Fatalf("生成认证信息失败: %v", err)
+	}
+	if got := hex.EncodeToString(authID); got != "4774fe5cc901ea4f81f2159909767a36" {
+		t.Errorf("认证信息错误: %s", got)
+	}
+
+	nonce := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07}
+	sealed, err := vmessSealHeaderWith(cmdKey, []byte("Test Header"), authID, nonce)
+	if err != nil {
+		t.Fatalf("加密请求头失败: %v", err)
+	}
+	expected := "4774fe5cc901ea4f81f2159909767a36" + // 认证信息
+		"ca0b01fd8b485e0aa33ceea3414d815e1234" + // 加密长度
+		"0001020304050607" + // 连接随机数
+		"db4011bb28042558589812274ac80bd191199c5c80cee2d8984062" // 加密请求头
+	if got := hex.EncodeToString(sealed); got != expected {
+		t.Errorf("请求头加密结果错误:\n got  %s\n want %s", got, expected)
+	}
+}
+
+// TestUnsupportedFallback 测试暂不支持的协议回退为 TCP 连接测试
+func TestUnsupportedFallback(t *testing.T) {
+	s := newTestService(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动监听失败: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+
+	node := config_update.ProxyNode{
+		Type: "vless", Server: "127.0.0.1", Port: addr.Port, UUID: testUUID, TLS: true,
+		Options: map[string]interface{}{"reality-opts": map[string]interface{}{"public-key": "key"}},
+	}
+	if unsupportedReason(&node) == "" {
+		t.Fatal("Reality 节点应回退为 TCP 测试")
+	}
+	if result := testProxyNode(t, s, node); result.Status != "online" || result.Method != MethodTCP {
+		t.Errorf("回退检测结果错误: %+v", result)
+	}
+}
+
+// vmessStandIn 模拟 VMess 服务端握手
+func vmessStandIn(conn net.Conn, id uuid.UUID) (net.Conn, string, error) {
+	cmdKey := vmessCmdKey(id)
+	head := make([]byte, 16+18+8)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return nil, "", err
+	}
+	authID, lengthSealed, nonce := head[:16], head[16:34], head[34:]
+
+	block, _ := aes.NewCipher(vmessKDF(cmdKey, vmessAuthIDKey)[:16])
+	plainAuth := make([]byte, 16)
+	block.Decrypt(plainAuth, authID)
+	if crc32.ChecksumIEEE(plainAuth[:12]) != binary.BigEndian.Uint32(plainAuth[12:]) {
+		return nil, "", errors.New("认证信息错误")
+	}
+
+	lengthAEAD, _ := newGCM(vmessKDF(cmdKey, vmessHeaderLengthKey, string(authID), string(nonce))[:16])
+	lengthBuf, err := lengthAEAD.Open(nil, vmessKDF(cmdKey, vmessHeaderLengthIV, string(authID), string(nonce))[:12], lengthSealed, authID)
+	if err != nil {
+		return nil, "", err
+	}
+	payloadAEAD, _ := newGCM(vmessKDF(cmdKey, vmessHeaderPayloadKey, string(authID), string(nonce))[:16])
+	sealed := make([]byte, int(binary.BigEndian.Uint16(lengthBuf))+payloadAEAD.Overhead())
+	if _, err := io.ReadFull(conn, sealed); err != nil {
+		return nil, "", err
+	}
+	header, err := payloadAEAD.Open(nil, vmessKDF(cmdKey, vmessHeaderPayloadIV, string(authID), string(nonce))[:12], sealed, authID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	checksum := fnv.New32a()
+	checksum.Write(header[:len(header)-4])
+	if binary.BigEndian.Uint32(header[len(header)-4:]) != checksum.Sum32() {
+		return nil, "", errors.New("请求头校验失败")
+	}
+	reqIV, reqKey, respV, security := header[1:17], header[17:33], header[33], header[35]&0x0f
+	target, err := parseV2rayAddr(header[38 : len(header)-4])
+	if err != nil {
+		return nil, "", err
+	}
+
+	respKey := sha256.Sum256(reqKey)
+	respIV := sha256.Sum256(reqIV)
+	reader, _ := newVMessChunkStream(security, reqKey, reqIV)
+	writer, _ := newVMessChunkStream(security, respKey[:16], respIV[:16])
+
+	respLengthAEAD, _ := newGCM(vmessKDF(respKey[:16], vmessRespHeaderLengthKey)[:16])
+	respPayloadAEAD, _ := newGCM(vmessKDF(respKey[:16], vmessRespHeaderPayloadKey)[:16])
+	respHeader := respLengthAEAD.Seal(nil, vmessKDF(respIV[:16], vmessRespHeaderLengthIV)[:12], []byte{0x00, 0x04}, nil)
+	respHeader = respPayloadAEAD.Seal(respHeader, vmessKDF(respIV[:16], vmessRespHeaderPayloadIV)[:12], []byte{respV, 0, 0, 0}, nil)
+
+	return &vmessServerConn{Conn: conn, reader: reader, writer: writer, header: respHeader}, target, nil
+}
+
+// vmessServerConn 模拟 VMess 服务端数据连接
+type vmessServerConn struct {
+	net.Conn
+	reader  *vmessChunkStream
+	writer  *vmessChunkStream
+	header  []byte
+	readBuf []byte
+}
+
+func (c *vmessServerConn) Read(b []byte) (int, error) {
+	for len(c.readBuf) == 0 {
+		payload, err := c.reader.open(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		c.readBuf = payload
+	}
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+func (c *vmessServerConn) Write(b []byte) (int, error) {
+	out := c.writer.seal(c.header, b)
+	c.header = nil
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// testCertificate 生成本地测试用自签名证书
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("生成证书失败: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,364 @@
+package node_health
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// availabilityWindow 节点在线率（Node.Availability）的统计窗口
+const availabilityWindow = 24 * time.Hour
+
+// HealthRange 健康历史查询范围
+type HealthRange struct {
+	Window time.Duration // 统计窗口
+	Bucket time.Duration // 图表数据点间隔（不小于 1 小时，与小时汇总数据对齐）
+}
+
+// healthRanges 支持的查询范围
+var healthRanges = map[string]HealthRange{
+	"24h": {Window: 24 * time.Hour, Bucket: time.Hour},
+	"7d":  {Window: 7 * 24 * time.Hour, Bucket: 6 * time.Hour},
+	"30d": {Window: 30 * 24 * time.Hour, Bucket: 24 * time.Hour},
+}
+
+// ParseHealthRange 解析查询范围（24h / 7d / 30d），为空时使用 24h
+func ParseHealthRange(value string) (HealthRange, error) {
+	if value == "" {
+		value = "24h"
+	}
+	r, ok := healthRanges[value]
+	if !ok {
+		return HealthRange{}, fmt.Errorf("不支持的时间范围: %s", value)
+	}
+	return r, nil
+}
+
+// HealthStats 节点在统计窗口内的健康指标
+type HealthStats struct {
+	NodeID       uint       `json:"node_id"`
+	Checks       int        `json:"checks"`
+	OnlineChecks int        `json:"online_checks"`
+	Uptime       float64    `json:"uptime"` // 在线率（%），没有检查记录时为 0
+	LatencyP50   int        `json:"latency_p50"`
+	LatencyP95   int        `json:"latency_p95"`
+	StateChanges int        `json:"state_changes"`
+	LastStatus   string     `json:"last_status,omitempty"`
+	LastChecked  *time.Time `json:"last_checked,omitempty"`
+}
+
+// HealthPoint 健康历史图表的数据点
+type HealthPoint struct {
+	Time       time.Time `json:"time"`
+	Checks     int       `json:"checks"`
+	Uptime     float64   `json:"uptime"`
+	LatencyP50 int       `json:"latency_p50"`
+	LatencyP95 int       `json:"latency_p95"`
+}
+
+// latencySample 带权重的延迟样本（小时汇总数据按在线次数加权）
+type latencySample struct {
+	value  int
+	weight int
+}
+
+// healthAgg 汇总原始记录和小时汇总数据
+type healthAgg struct {
+	checks  int
+	online  int
+	changes int
+	p50     []latencySample
+	p95     []latencySample
+
+	lastUp *bool // 上一条原始记录的状态，用于统计状态变化
+	last   *models.NodeHealthCheck
+}
+
+// isUp 检查结果是否为在线（超时视为不可用）
+func isUp(status string) bool {
+	return status == "online"
+}
+
+// addCheck 加入一条原始记录（需按时间顺序加入）
+func (a *healthAgg) addCheck(check *models.NodeHealthCheck) {
+	a.checks++
+	up := isUp(check.Status)
+	if up {
+		a.online++
+		if check.Latency >= 0 {
+			a.p50 = append(a.p50, latencySample{check.Latency, 1})
+			a.p95 = append(a.p95, latencySample{check.Latency, 1})
+		}
+	}
+	if a.lastUp != nil && *a.lastUp != up {
+		a.changes++
+	}
+	a.lastUp = &up
+	a.last = check
+}
+
+// addRollup 加入一条小时汇总数据
+func (a *healthAgg) addRollup(rollup *models.NodeHealthRollup) {
+	a.checks += rollup.Checks
+	a.online += rollup.OnlineChecks
+	a.changes += rollup.StateChanges
+	if rollup.OnlineChecks > 0 {
+		a.p50 = append(a.p50, latencySample{rollup.LatencyP50, rollup.OnlineChecks})
+		a.p95 = append(a.p95, latencySample{rollup.LatencyP95, rollup.OnlineChecks})
+	}
+}
+
+// uptime 在线率（%，保留两位小数）
+func (a *healthAgg) uptime() float64 {
+	if a.checks == 0 {
+		return 0
+	}
+	return math.Round(float64(a.online)*10000/float64(a.checks)) / 100
+}
+
+// weightedPercentile 计算加权分位数（p 取 0-1），没有样本时返回 0
+func weightedPercentile(samples []latencySample, p float64) int {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := append([]latencySample(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].value < sorted[j].value })
+	total := 0
+	for _, sample := range sorted {
+		total += sample.weight
+	}
+	target := p * float64(total)
+	cumulative := 0
+	for _, sample := range sorted {
+		cumulative += sample.weight
+		if float64(cumulative) >= target {
+			return sample.value
+		}
+	}
+	return sorted[len(sorted)-1].value
+}
+
+// countStateChanges 统计按时间排序的检查结果中在线/不可用状态的变化次数
+func countStateChanges(statuses []string) int {
+	changes := 0
+	for i := 1; i < len(statuses); i++ {
+		if isUp(statuses[i]) != isUp(statuses[i-1]) {
+			changes++
+		}
+	}
+	return changes
+}
+
+// recordCheck 保存检查结果
+func (s *NodeHealthService) recordCheck(result *TestResult) error {
+	checkedAt := result.TestedAt
+	if checkedAt.IsZero() {
+		checkedAt = utils.GetBeijingTime()
+	}
+	errMsg := result.Error
+	if len([]rune(errMsg)) > 200 {
+		errMsg = string([]rune(errMsg)[:200])
+	}
+	return s.db.Create(&models.NodeHealthCheck{
+		NodeID:    result.NodeID,
+		Status:    result.Status,
+		Latency:   result.Latency,
+		Method:    result.Method,
+		Error:     errMsg,
+		CheckedAt: checkedAt,
+	}).Error
+}
+
+// isFlapping 节点在统计窗口内的状态变化次数是否达到阈值
+func (s *NodeHealthService) isFlapping(nodeID uint, now time.Time) bool {
+	if s.flapThreshold <= 0 {
+		return false
+	}
+	var statuses []string
+	s.db.Model(&models.NodeHealthCheck{}).
+		Where("node_id = ? AND checked_at >= ?", nodeID, now.Add(-s.flapWindow)).
+		Order("checked_at ASC, id ASC").
+		Pluck("status", &statuses)
+	return countStateChanges(statuses) >= s.flapThreshold
+}
+
+// availability 节点最近 24 小时的在线率
+func (s *NodeHealthService) availability(nodeID uint, now time.Time) float64 {
+	stats, err := s.NodeStats([]uint{nodeID}, now.Add(-availabilityWindow))
+	if err != nil {
+		return 0
+	}
+	return stats[nodeID].Uptime
+}
+
+// NodeStats 统计节点在 since 之后的在线率、延迟分位数和状态变化次数
+func (s *NodeHealthService) NodeStats(nodeIDs []uint, since time.Time) (map[uint]*HealthStats, error) {
+	aggs := make(map[uint]*healthAgg, len(nodeIDs))
+	for _, id := range nodeIDs {
+		aggs[id] = &healthAgg{}
+	}
+	if len(nodeIDs) == 0 {
+		return map[uint]*HealthStats{}, nil
+	}
+
+	var rollups []models.NodeHealthRollup
+	if err := s.db.Where("node_id IN ? AND hour >= ?", nodeIDs, since).Find(&rollups).Error; err != nil {
+		return nil, err
+	}
+	for i := range rollups {
+		aggs[rollups[i].NodeID].addRollup(&rollups[i])
+	}
+
+	var checks []models.NodeHealthCheck
+	if err := s.db.Where("node_id IN ? AND checked_at >= ?", nodeIDs, since).
+		Order("checked_at ASC, id ASC").Find(&checks).Error; err != nil {
+		return nil, err
+	}
+	for i := range checks {
+		aggs[checks[i].NodeID].addCheck(&checks[i])
+	}
+
+	stats := make(map[uint]*HealthStats, len(aggs))
+	for id, agg := range aggs {
+		st := &HealthStats{
+			NodeID:       id,
+			Checks:       agg.checks,
+			OnlineChecks: agg.online,
+			Uptime:       agg.uptime(),
+			LatencyP50:   weightedPercentile(agg.p50, 0.5),
+			LatencyP95:   weightedPercentile(agg.p95, 0.95),
+			StateChanges: agg.changes,
+		}
+		if agg.last != nil {
+			checkedAt := agg.last.CheckedAt
+			st.LastStatus, st.LastChecked = agg.last.Status, &checkedAt
+		}
+		stats[id] = st
+	}
+	return stats, nil
+}
+
+// NodeHistory 按查询范围生成节点健康历史图表数据（没有检查记录的时间段不生成数据点）
+func (s *NodeHealthService) NodeHistory(nodeID uint, r HealthRange, now time.Time) ([]HealthPoint, error) {
+	since := bucketStart(now.Add(-r.Window), r.Bucket)
+	buckets := make(map[int64]*healthAgg)
+	bucketOf := func(t time.Time) *healthAgg {
+		key := bucketStart(t.In(now.Location()), r.Bucket).Unix()
+		agg, ok := buckets[key]
+		if !ok {
+			agg = &healthAgg{}
+			buckets[key] = agg
+		}
+		return agg
+	}
+
+	var rollups []models.NodeHealthRollup
+	if err := s.db.Where("node_id = ? AND hour >= ?", nodeID, since).Find(&rollups).Error; err != nil {
+		return nil, err
+	}
+	for i := range rollups {
+		bucketOf(rollups[i].Hour).addRollup(&rollups[i])
+	}
+
+	var checks []models.NodeHealthCheck
+	if err := s.db.Where("node_id = ? AND checked_at >= ?", nodeID, since).
+		Order("checked_at ASC, id ASC").Find(&checks).Error; err != nil {
+		return nil, err
+	}
+	for i := range checks {
+		bucketOf(checks[i].CheckedAt).addCheck(&checks[i])
+	}
+
+	points := make([]HealthPoint, 0, len(buckets))
+	for key, agg := range buckets {
+		points = append(points, HealthPoint{
+			Time:       time.Unix(key, 0).In(now.Location()),
+			Checks:     agg.checks,
+			Uptime:     agg.uptime(),
+			LatencyP50: weightedPercentile(agg.p50, 0.5),
+			LatencyP95: weightedPercentile(agg.p95, 0.95),
+		})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return points, nil
+}
+
+// RecentChecks 获取节点最近的原始检查记录
+func (s *NodeHealthService) RecentChecks(nodeID uint, limit int) ([]models.NodeHealthCheck, error) {
+	var checks []models.NodeHealthCheck
+	err := s.db.Where("node_id = ?", nodeID).Order("checked_at DESC, id DESC").Limit(limit).Find(&checks).Error
+	return checks, err
+}
+
+// bucketStart 数据点的起始时间（以当地零点为基准对齐）
+func bucketStart(t time.Time, bucket time.Duration) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if bucket >= 24*time.Hour {
+		return day
+	}
+	return day.Add(t.Sub(day).Truncate(bucket))
+}
+
+// CompactHistory 将超过保留期的原始检查记录汇总为小时数据后删除，并清理过期的小时汇总数据
+func (s *NodeHealthService) CompactHistory(now time.Time) error {
+	cutoff := now.Add(-s.rawRetention).Truncate(time.Hour)
+
+	var checks []models.NodeHealthCheck
+	if err := s.db.Where("checked_at < ?", cutoff).Order("node_id ASC, checked_at ASC, id ASC").Find(&checks).Error; err != nil {
+		return err
+	}
+
+	type rollupKey struct {
+		nodeID uint
+		hour   time.Time
+	}
+	aggs := make(map[rollupKey]*healthAgg)
+	keys := make([]rollupKey, 0)
+	lastUp := make(map[uint]bool)
+	for i := range checks {
+		check := &checks[i]
+		key := rollupKey{check.NodeID, check.CheckedAt.Truncate(time.Hour)}
+		agg, ok := aggs[key]
+		if !ok {
+			agg = &healthAgg{}
+			aggs[key] = agg
+			keys = append(keys, key)
+			// 跨小时的状态变化计入后一个小时
+			if up, seen := lastUp[check.NodeID]; seen {
+				agg.lastUp = &up
+			}
+		}
+		agg.addCheck(check)
+		lastUp[check.NodeID] = isUp(check.Status)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, key := range keys {
+			agg := aggs[key]
+			rollup := models.NodeHealthRollup{NodeID: key.nodeID, Hour: key.hour}
+			if err := tx.Where(&rollup).FirstOrInit(&rollup).Error; err != nil {
+				return err
+			}
+			// 同一小时已有汇总数据时合并（分位数按在线次数加权近似）
+			if rollup.ID != 0 {
+				agg.addRollup(&rollup)
+			}
+			rollup.Checks, rollup.OnlineChecks, rollup.StateChanges = agg.checks, agg.online, agg.changes
+			rollup.LatencyP50 = weightedPercentile(agg.p50, 0.5)
+			rollup.LatencyP95 = weightedPercentile(agg.p95, 0.95)
+			if err := tx.Save(&rollup).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("checked_at < ?", cutoff).Delete(&models.NodeHealthCheck{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("hour < ?", now.Add(-s.rollupRetention)).Delete(&models.NodeHealthRollup{}).Error
+	})
+}
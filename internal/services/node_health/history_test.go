@@ -0,0 +1,32 @@
+package node_health
+
+import "testing"
+
+// TestWeightedPercentile 测试延迟分位数（小时汇总数据按在线次数加权）
+func TestWeightedPercentile(t *testing.T) {
+	samples := []latencySample{{300, 1}, {100, 1}, {200, 1}, {1000, 1}}
+	if got := weightedPercentile(samples, 0.5); got != 200 {
+		t.Errorf("p50 期望 200，实际 %d", got)
+	}
+	if got := weightedPercentile(samples, 0.95); got != 1000 {
+		t.Errorf("p95 期望 1000，实际 %d", got)
+	}
+	weighted := []latencySample{{100, 19}, {900, 1}}
+	if got := weightedPercentile(weighted, 0.95); got != 100 {
+		t.Errorf("加权 p95 期望 100，实际 %d", got)
+	}
+	if got := weightedPercentile(nil, 0.5); got != 0 {
+		t.Errorf("没有样本时应返回 0，实际 %d", got)
+	}
+}
+
+// TestCountStateChanges 测试状态变化次数（超时视为不可用）
+func TestCountStateChanges(t *testing.T) {
+	statuses := []string{"online", "online", "offline", "timeout", "online", "offline"}
+	if got := countStateChanges(statuses); got != 3 {
+		t.Errorf("期望 3 次状态变化，实际 %d", got)
+	}
+	if got := countStateChanges([]string{"online"}); got != 0 {
+		t.Errorf("单条记录不应有状态变化，实际 %d", got)
+	}
+}
@@ -7,8 +7,6 @@ import (
 	"io"
 	"net"
 	"net/http"
-	"net/url"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,20 +23,37 @@ import (
 // NodeHealthService 节点健康检查服务
 type NodeHealthService struct {
 	db          *gorm.DB
-	httpClient  *http.Client
 	testTimeout time.Duration
 	maxLatency  int    // 最大允许延迟（毫秒），超过此值视为超时
-	testURL     string // 测速URL，用于HTTP延迟测试（如 ping.pe）
+	testURL     string // 探测URL，通过节点代理请求该地址测量HTTP延迟
+
+	flapThreshold   int           // 统计窗口内状态变化达到该次数视为频繁上下线，0 表示不检测
+	flapWindow      time.Duration // 频繁上下线统计窗口
+	rawRetention    time.Duration // 原始检查记录保留时长，超过后汇总为小时数据
+	rollupRetention time.Duration // 小时汇总数据保留时长
 }
 
+// DefaultTestURL 默认探测地址（返回 204 的轻量地址）
+const DefaultTestURL = "http://www.gstatic.com/generate_204"
+
+// 检测方式
+const (
+	MethodProxy = "proxy" // 协议握手 + HTTP 探测
+	MethodTCP   = "tcp"   // 仅 TCP 连接（协议或传输方式暂不支持）
+)
+
 // NewNodeHealthService 创建节点健康检查服务
 func NewNodeHealthService() *NodeHealthService {
 	service := &NodeHealthService{
 		db:          database.GetDB(),
-		httpClient:  &http.Client{Timeout: 30 * time.Second}, // 增加超时时间，因为需要等待网页响应
 		testTimeout: 5 * time.Second,
-		maxLatency:  3000,              // 默认3秒超时
-		testURL:     "https://ping.pe", // 默认使用ping.pe
+		maxLatency:  3000, // 默认3秒超时
+		testURL:     DefaultTestURL,
+
+		flapThreshold:   4,
+		flapWindow:      time.Hour,
+		rawRetention:    7 * 24 * time.Hour,
+		rollupRetention: 90 * 24 * time.Hour,
 	}
 	service.loadConfig()
 	return service
@@ -54,8 +69,8 @@ func (s *NodeHealthService) loadConfig() {
 		configMap[config.Key] = config.Value
 	}
 
-	// 加载测试URL
-	if testURL, ok := configMap["test_url"]; ok && testURL != "" {
+	// 加载探测URL（旧版本默认的 ping.pe 网页测速已不再使用）
+	if testURL, ok := configMap["test_url"]; ok && testURL != "" && !strings.Contains(testURL, "ping.pe") {
 		s.testURL = testURL
 	}
 
@@ -70,6 +85,20 @@ func (s *NodeHealthService) loadConfig() {
 			s.testTimeout = time.Duration(timeout) * time.Second
 		}
 	}
+
+	// 健康历史相关配置
+	if value, err := strconv.Atoi(configMap["node_flap_threshold"]); err == nil && value >= 0 {
+		s.flapThreshold = value
+	}
+	if value, err := strconv.Atoi(configMap["node_flap_window"]); err == nil && value > 0 {
+		s.flapWindow = time.Duration(value) * time.Minute
+	}
+	if value, err := strconv.Atoi(configMap["node_health_raw_retention_days"]); err == nil && value > 0 {
+		s.rawRetention = time.Duration(value) * 24 * time.Hour
+	}
+	if value, err := strconv.Atoi(configMap["node_health_rollup_retention_days"]); err == nil && value > 0 {
+		s.rollupRetention = time.Duration(value) * 24 * time.Hour
+	}
 }
 
 // TestResult 测试结果
@@ -77,6 +106,7 @@ type TestResult struct {
 	NodeID   uint      `json:"node_id"`
 	Status   string    `json:"status"`  // online, offline, timeout
 	Latency  int       `json:"latency"` // 延迟（毫秒）
+	Method   string    `json:"method"`  // 检测方式：proxy, tcp
 	Error    string    `json:"error,omitempty"`
 	TestedAt time.Time `json:"tested_at"`
 }
@@ -103,7 +133,8 @@ func (s *NodeHealthService) TestNode(node *models.Node) (*TestResult, error) {
 	}
 
 	// 测试节点连接
-	latency, err := s.testConnection(&proxyNode)
+	latency, method, err := s.testConnection(&proxyNode)
+	result.Method = method
 	if err != nil {
 		result.Status = "offline"
 		result.Error = err.Error()
@@ -120,135 +151,56 @@ func (s *NodeHealthService) TestNode(node *models.Node) (*TestResult, error) {
 	return result, nil
 }
 
-// testConnection 测试节点连接
-func (s *NodeHealthService) testConnection(node *config_update.ProxyNode) (int, error) {
-	// 如果配置了测试URL（如ping.pe），使用网页测试
-	if s.testURL != "" {
-		latency, err := s.testViaWebPage(node)
-		if err == nil {
-			return latency, nil
-		}
-		// 如果网页测试失败，回退到TCP测试
-		utils.LogError("网页测试失败，回退到TCP测试", err, map[string]interface{}{
-			"node_server": node.Server,
-			"node_port":   node.Port,
-		})
+// testConnection 测试节点连接，返回延迟和检测方式
+// 支持的协议通过节点完成握手并请求探测地址；其余协议回退为 TCP 连接测试
+func (s *NodeHealthService) testConnection(node *config_update.ProxyNode) (int, string, error) {
+	if unsupportedReason(node) == "" {
+		latency, err := s.testViaProxy(node)
+		return latency, MethodProxy, err
 	}
-
-	// 默认使用TCP连接测试
-	return s.testTCPConnection(node.Server, node.Port)
+	latency, err := s.testTCPConnection(node.Server, node.Port)
+	return latency, MethodTCP, err
 }
 
-// testViaWebPage 通过网页（如ping.pe）测试节点延迟
-func (s *NodeHealthService) testViaWebPage(node *config_update.ProxyNode) (int, error) {
-	testAddress := fmt.Sprintf("%s:%d", node.Server, node.Port)
+// testViaProxy 通过节点代理请求探测地址，返回 HTTP 延迟（含代理握手，至收到响应头为止）
+func (s *NodeHealthService) testViaProxy(node *config_update.ProxyNode) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.testTimeout)
+	defer cancel()
 
-	// 根据测试URL选择不同的测试方式
-	if strings.Contains(s.testURL, "ping.pe") {
-		return s.testViaPingPe(testAddress)
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialNode(ctx, node, addr)
+		},
+		DisableKeepAlives: true,
 	}
-
-	// 默认尝试ping.pe格式
-	return s.testViaPingPe(testAddress)
-}
-
-// testViaPingPe 通过ping.pe网页测试延迟
-func (s *NodeHealthService) testViaPingPe(address string) (int, error) {
-	// ping.pe的测试URL格式: https://ping.pe/{address}
-	testURL := fmt.Sprintf("https://ping.pe/%s", url.QueryEscape(address))
-
-	// 创建请求
-	req, err := http.NewRequest("GET", testURL, nil)
-	if err != nil {
-		return -1, fmt.Errorf("创建请求失败: %v", err)
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
 	}
 
-	// 设置User-Agent，模拟浏览器
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
-
-	start := time.Now()
-	resp, err := s.httpClient.Do(req)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.testURL, nil)
 	if err != nil {
-		return -1, fmt.Errorf("请求失败: %v", err)
+		return -1, fmt.Errorf("探测地址错误: %v", err)
 	}
-	defer resp.Body.Close()
 
-	// 读取响应
-	body, err := io.ReadAll(resp.Body)
+	start := time.Now()
+	resp, err := client.Do(req)
 	if err != nil {
-		return -1, fmt.Errorf("读取响应失败: %v", err)
+		return -1, fmt.Errorf("探测请求失败: %v", err)
 	}
+	latency := int(time.Since(start).Milliseconds())
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
 
-	// 解析HTML，查找延迟数据
-	latency, err := s.parsePingPeResponse(string(body))
-	if err != nil {
-		// 如果解析失败，使用总耗时作为估算
-		totalLatency := int(time.Since(start).Milliseconds())
-		return totalLatency, nil
+	if resp.StatusCode >= http.StatusBadRequest {
+		return latency, fmt.Errorf("探测地址返回状态码 %d", resp.StatusCode)
 	}
-
 	return latency, nil
 }
 
-// parsePingPeResponse 解析ping.pe网页响应，提取延迟数据
-func (s *NodeHealthService) parsePingPeResponse(html string) (int, error) {
-	// ping.pe页面中，延迟数据通常在特定的HTML元素中
-	// 尝试多种方式解析：
-
-	// 方式1: 查找包含"ms"或"毫秒"的数字
-	// 正则表达式匹配延迟数据（例如: "50ms", "100 毫秒"等）
-	latencyPattern := regexp.MustCompile(`(\d+)\s*(?:ms|毫秒)`)
-	matches := latencyPattern.FindAllStringSubmatch(html, -1)
-
-	if len(matches) > 0 {
-		// 尝试找到中国的节点延迟（查找包含"China"、"中国"、"CN"等关键词附近的延迟）
-		chinaPattern := regexp.MustCompile(`(?i)(?:china|中国|cn|beijing|shanghai|guangzhou|shenzhen).*?(\d+)\s*(?:ms|毫秒)`)
-		chinaMatches := chinaPattern.FindAllStringSubmatch(html, -1)
-
-		if len(chinaMatches) > 0 {
-			// 使用第一个中国节点的延迟
-			if latency, err := strconv.Atoi(chinaMatches[0][1]); err == nil {
-				return latency, nil
-			}
-		}
-
-		// 如果没有找到中国节点，使用所有延迟的平均值
-		var latencies []int
-		for _, match := range matches {
-			if latency, err := strconv.Atoi(match[1]); err == nil && latency > 0 && latency < 10000 {
-				latencies = append(latencies, latency)
-			}
-		}
-
-		if len(latencies) > 0 {
-			// 计算平均值
-			sum := 0
-			for _, l := range latencies {
-				sum += l
-			}
-			return sum / len(latencies), nil
-		}
-
-		// 如果都没有，使用第一个匹配的延迟
-		if latency, err := strconv.Atoi(matches[0][1]); err == nil {
-			return latency, nil
-		}
-	}
-
-	// 方式2: 查找JSON数据（如果页面包含JSON）
-	jsonPattern := regexp.MustCompile(`"latency"\s*:\s*(\d+)`)
-	jsonMatches := jsonPattern.FindStringSubmatch(html)
-	if len(jsonMatches) > 1 {
-		if latency, err := strconv.Atoi(jsonMatches[1]); err == nil {
-			return latency, nil
-		}
-	}
-
-	return -1, fmt.Errorf("无法从网页中解析延迟数据")
-}
-
 // testTCPConnection 测试TCP连接
 func (s *NodeHealthService) testTCPConnection(host string, port int) (int, error) {
 	address := net.JoinHostPort(host, strconv.Itoa(port))
@@ -306,31 +258,52 @@ func (s *NodeHealthService) BatchTestNodes(nodeIDs []uint) ([]*TestResult, error
 	return results, nil
 }
 
-// UpdateNodeStatus 更新节点状态
+// UpdateNodeStatus 更新节点状态，并记录检查结果、更新在线率和频繁上下线标记
 func (s *NodeHealthService) UpdateNodeStatus(result *TestResult) error {
 	now := utils.GetBeijingTime()
+	if err := s.recordCheck(result); err != nil {
+		utils.LogError("UpdateNodeStatus: record health check failed", err, map[string]interface{}{
+			"node_id": result.NodeID,
+		})
+	}
+	flapping := s.isFlapping(result.NodeID, now)
 	updates := map[string]interface{}{
-		"status":     result.Status,
-		"latency":    result.Latency,
-		"last_test":  now,
-		"updated_at": now,
+		"status":       result.Status,
+		"latency":      result.Latency,
+		"last_test":    now,
+		"updated_at":   now,
+		"flapping":     flapping,
+		"availability": s.availability(result.NodeID, now),
 	}
 
 	// 如果节点超时或离线，自动禁用
 	if result.Status == "timeout" || result.Status == "offline" {
 		updates["is_active"] = false
-	} else if result.Status == "online" {
-		// 如果节点在线，确保启用
+		updates["health_disabled"] = true
+	} else if result.Status == "online" && !flapping {
+		// 如果节点在线，确保启用（频繁上下线的节点等状态稳定后再启用）
 		updates["is_active"] = true
+		updates["health_disabled"] = false
 	}
 
-	return s.db.Model(&models.Node{}).Where("id = ?", result.NodeID).Updates(updates).Error
+	// 只有启用状态或超时状态变化会影响订阅内容，此时才使订阅渲染缓存失效
+	var before models.Node
+	s.db.Select("id", "is_active", "status").First(&before, result.NodeID)
+	if err := s.db.Model(&models.Node{}).Where("id = ?", result.NodeID).Updates(updates).Error; err != nil {
+		return err
+	}
+	if active, ok := updates["is_active"].(bool); (ok && active != before.IsActive) ||
+		(result.Status == "timeout") != (before.Status == "timeout") {
+		config_update.InvalidateSubscriptionCache()
+	}
+	return nil
 }
 
 // CheckAllNodes 检查所有节点
 func (s *NodeHealthService) CheckAllNodes() error {
+	// 包括被健康检查自动禁用的节点，恢复在线后自动启用
 	var nodes []models.Node
-	if err := s.db.Where("is_active = ?", true).Find(&nodes).Error; err != nil {
+	if err := s.db.Where("is_active = ? OR health_disabled = ?", true, true).Find(&nodes).Error; err != nil {
 		return err
 	}
 
@@ -0,0 +1,186 @@
+package node_health
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ssMaxPayload Shadowsocks AEAD 单个数据块的最大长度
+const ssMaxPayload = 0x3FFF
+
+// ssCipher Shadowsocks AEAD 加密方式
+type ssCipher struct {
+	keySize int
+	newAEAD func(key []byte) (cipher.AEAD, error)
+}
+
+// ssCiphers 支持的 Shadowsocks AEAD 加密方式（盐长度与密钥长度相同）
+var ssCiphers = map[string]ssCipher{
+	"aes-128-gcm":             {16, newGCM},
+	"aes-192-gcm":             {24, newGCM},
+	"aes-256-gcm":             {32, newGCM},
+	"chacha20-ietf-poly1305":  {32, chacha20poly1305.New},
+	"chacha20-poly1305":       {32, chacha20poly1305.New},
+	"xchacha20-ietf-poly1305": {32, chacha20poly1305.NewX},
+}
+
+// newGCM 创建 AES-GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// evpBytesToKey 由密码派生主密钥（OpenSSL EVP_BytesToKey，MD5）
+func evpBytesToKey(password string, keyLen int) []byte {
+	var key, prev []byte
+	for len(key) < keyLen {
+		h := md5.New()
+		h.Write(prev)
+		h.Write([]byte(password))
+		prev = h.Sum(nil)
+		key = append(key, prev...)
+	}
+	return key[:keyLen]
+}
+
+// shadowsocksConn Shadowsocks AEAD 连接
+// 每个方向以随机盐开头，之后为 [加密长度][加密数据] 数据块；首个数据块携带目标地址
+type shadowsocksConn struct {
+	net.Conn
+	cipher  ssCipher
+	key     []byte
+	pending []byte // 首次写入时附带的数据（目标地址）
+
+	writer     cipher.AEAD
+	writeNonce []byte
+	reader     cipher.AEAD
+	readNonce  []byte
+	readBuf    []byte
+}
+
+// newShadowsocksConn 创建 Shadowsocks 连接，target 为首次写入时附带的目标地址
+func newShadowsocksConn(conn net.Conn, method, password string, target []byte) (net.Conn, error) {
+	c, ok := ssCiphers[method]
+	if !ok {
+		return nil, errors.New("不支持的 Shadowsocks 加密方式: " + method)
+	}
+	return &shadowsocksConn{
+		Conn:    conn,
+		cipher:  c,
+		key:     evpBytesToKey(password, c.keySize),
+		pending: target,
+	}, nil
+}
+
+// newSubkeyAEAD 使用 HKDF-SHA1 由主密钥和盐派生会话密钥
+func (c *shadowsocksConn) newSubkeyAEAD(salt []byte) (cipher.AEAD, error) {
+	subkey := make([]byte, c.cipher.keySize)
+	if _, err := io.ReadFull(hkdf.New(sha1.New, c.key, salt, []byte("ss-subkey")), subkey); err != nil {
+		return nil, err
+	}
+	return c.cipher.newAEAD(subkey)
+}
+
+func (c *shadowsocksConn) Write(b []byte) (int, error) {
+	var out []byte
+	if c.writer == nil {
+		salt := make([]byte, c.cipher.keySize)
+		if _, err := rand.Read(salt); err != nil {
+			return 0, err
+		}
+		aead, err := c.newSubkeyAEAD(salt)
+		if err != nil {
+			return 0, err
+		}
+		c.writer = aead
+		c.writeNonce = make([]byte, aead.NonceSize())
+		out = salt
+	}
+
+	payload := b
+	if c.pending != nil {
+		payload = append(c.pending, b...)
+		c.pending = nil
+	}
+	for len(payload) > 0 {
+		size := len(payload)
+		if size > ssMaxPayload {
+			size = ssMaxPayload
+		}
+		out = c.writer.Seal(out, c.writeNonce, binary.BigEndian.AppendUint16(nil, uint16(size)), nil)
+		increaseNonce(c.writeNonce)
+		out = c.writer.Seal(out, c.writeNonce, payload[:size], nil)
+		increaseNonce(c.writeNonce)
+		payload = payload[size:]
+	}
+
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *shadowsocksConn) Read(b []byte) (int, error) {
+	if c.reader == nil {
+		salt := make([]byte, c.cipher.keySize)
+		if _, err := io.ReadFull(c.Conn, salt); err != nil {
+			return 0, err
+		}
+		aead, err := c.newSubkeyAEAD(salt)
+		if err != nil {
+			return 0, err
+		}
+		c.reader = aead
+		c.readNonce = make([]byte, aead.NonceSize())
+	}
+
+	for len(c.readBuf) == 0 {
+		overhead := c.reader.Overhead()
+		buf := make([]byte, 2+overhead)
+		if _, err := io.ReadFull(c.Conn, buf); err != nil {
+			return 0, err
+		}
+		sizeBuf, err := c.reader.Open(buf[:0], c.readNonce, buf, nil)
+		if err != nil {
+			return 0, errors.New("Shadowsocks 解密失败（密码或加密方式错误）")
+		}
+		increaseNonce(c.readNonce)
+
+		size := int(binary.BigEndian.Uint16(sizeBuf)) & ssMaxPayload
+		buf = make([]byte, size+overhead)
+		if _, err := io.ReadFull(c.Conn, buf); err != nil {
+			return 0, err
+		}
+		if c.readBuf, err = c.reader.Open(buf[:0], c.readNonce, buf, nil); err != nil {
+			return 0, errors.New("Shadowsocks 解密失败（密码或加密方式错误）")
+		}
+		increaseNonce(c.readNonce)
+	}
+
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// increaseNonce 小端序递增 nonce
+func increaseNonce(nonce []byte) {
+	for i := range nonce {
+		nonce[i]++
+		if nonce[i] != 0 {
+			return
+		}
+	}
+}
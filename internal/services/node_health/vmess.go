@@ -0,0 +1,341 @@
+package node_health
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// VMess 数据加密方式
+const (
+	vmessSecurityAES128GCM = 0x03
+	vmessSecurityChacha20  = 0x04
+	vmessSecurityNone      = 0x05
+)
+
+// vmessSecurities 支持的 VMess 加密方式（auto 按 aes-128-gcm 处理）
+var vmessSecurities = map[string]byte{
+	"aes-128-gcm":       vmessSecurityAES128GCM,
+	"chacha20-poly1305": vmessSecurityChacha20,
+	"none":              vmessSecurityNone,
+}
+
+// VMess AEAD 密钥派生使用的固定字符串
+const (
+	vmessKDFSalt              = "VMess AEAD KDF"
+	vmessAuthIDKey            = "AES Auth ID Encryption"
+	vmessHeaderLengthKey      = "VMess Header AEAD Key_Length"
+	vmessHeaderLengthIV       = "VMess Header AEAD Nonce_Length"
+	vmessHeaderPayloadKey     = "VMess Header AEAD Key"
+	vmessHeaderPayloadIV      = "VMess Header AEAD Nonce"
+	vmessRespHeaderLengthKey  = "AEAD Resp Header Len Key"
+	vmessRespHeaderLengthIV   = "AEAD Resp Header Len IV"
+	vmessRespHeaderPayloadKey = "AEAD Resp Header Key"
+	vmessRespHeaderPayloadIV  = "AEAD Resp Header IV"
+	vmessCmdKeySalt           = "c48619fe-8f02-49e0-b9e9-edf763e17e21"
+)
+
+// vmessMaxChunk VMess 单个数据块的最大明文长度
+const vmessMaxChunk = 16 * 1024
+
+// vmessSecurityName 规范化 VMess 加密方式名称
+func vmessSecurityName(cipherName string) string {
+	name := strings.ToLower(strings.TrimSpace(cipherName))
+	if name == "" || name == "auto" {
+		return "aes-128-gcm"
+	}
+	return name
+}
+
+// vmessKDF VMess AEAD 密钥派生（逐层嵌套的 HMAC-SHA256）
+func vmessKDF(key []byte, path ...string) []byte {
+	newHash := func() hash.Hash { return hmac.New(sha256.New, []byte(vmessKDFSalt)) }
+	for _, p := range path {
+		parent, value := newHash, []byte(p)
+		newHash = func() hash.Hash { return hmac.New(parent, value) }
+	}
+	h := newHash()
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+// vmessCmdKey 由 UUID 计算指令密钥
+func vmessCmdKey(id uuid.UUID) []byte {
+	sum := md5.Sum(append(id[:], vmessCmdKeySalt...))
+	return sum[:]
+}
+
+// vmessAuthID 生成认证信息：时间戳 + 随机数 + CRC32，使用指令密钥派生的 AES 加密
+func vmessAuthID(cmdKey []byte, now time.Time) ([]byte, error) {
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return vmessAuthIDWith(cmdKey, now, random)
+}
+
+// vmessAuthIDWith 使用给定的随机数生成认证信息
+func vmessAuthIDWith(cmdKey []byte, now time.Time, random []byte) ([]byte, error) {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf, uint64(now.Unix()))
+	copy(buf[8:12], random)
+	binary.BigEndian.PutUint32(buf[12:], crc32.ChecksumIEEE(buf[:12]))
+	block, err := aes.NewCipher(vmessKDF(cmdKey, vmessAuthIDKey)[:16])
+	if err != nil {
+		return nil, err
+	}
+	block.Encrypt(buf, buf)
+	return buf, nil
+}
+
+// vmessSealHeader 加密请求头：认证信息 + 加密长度 + 连接随机数 + 加密请求头
+func vmessSealHeader(cmdKey, header []byte) ([]byte, error) {
+	authID, err := vmessAuthID(cmdKey, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return vmessSealHeaderWith(cmdKey, header, authID, nonce)
+}
+
+// vmessSealHeaderWith 使用给定的认证信息和连接随机数加密请求头
+func vmessSealHeaderWith(cmdKey, header, authID, nonce []byte) ([]byte, error) {
+	lengthAEAD, err := newGCM(vmessKDF(cmdKey, vmessHeaderLengthKey, string(authID), string(nonce))[:16])
+	if err != nil {
+		return nil, err
+	}
+	payloadAEAD, err := newGCM(vmessKDF(cmdKey, vmessHeaderPayloadKey, string(authID), string(nonce))[:16])
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, authID...)
+	out = lengthAEAD.Seal(out, vmessKDF(cmdKey, vmessHeaderLengthIV, string(authID), string(nonce))[:12],
+		binary.BigEndian.AppendUint16(nil, uint16(len(header))), authID)
+	out = append(out, nonce...)
+	out = payloadAEAD.Seal(out, vmessKDF(cmdKey, vmessHeaderPayloadIV, string(authID), string(nonce))[:12],
+		header, authID)
+	return out, nil
+}
+
+// vmessBodyAEAD 创建数据块加密器，加密方式为 none 时返回 nil
+func vmessBodyAEAD(security byte, key []byte) (cipher.AEAD, error) {
+	switch security {
+	case vmessSecurityAES128GCM:
+		return newGCM(key)
+	case vmessSecurityChacha20:
+		first := md5.Sum(key)
+		second := md5.Sum(first[:])
+		return chacha20poly1305.New(append(first[:], second[:]...))
+	}
+	return nil, nil
+}
+
+// vmessChunkStream VMess 数据块流：[2 字节长度][数据]，AEAD 加密时 nonce 为 计数 + IV[2:12]
+type vmessChunkStream struct {
+	aead  cipher.AEAD
+	iv    []byte
+	count uint16
+}
+
+func newVMessChunkStream(security byte, key, iv []byte) (*vmessChunkStream, error) {
+	aead, err := vmessBodyAEAD(security, key)
+	if err != nil {
+		return nil, err
+	}
+	return &vmessChunkStream{aead: aead, iv: iv}, nil
+}
+
+func (s *vmessChunkStream) nonce() []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint16(nonce, s.count)
+	copy(nonce[2:], s.iv[2:12])
+	s.count++
+	return nonce
+}
+
+// seal 编码一个数据块
+func (s *vmessChunkStream) seal(dst, payload []byte) []byte {
+	if s.aead == nil {
+		dst = binary.BigEndian.AppendUint16(dst, uint16(len(payload)))
+		return append(dst, payload...)
+	}
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(payload)+s.aead.Overhead()))
+	return s.aead.Seal(dst, s.nonce(), payload, nil)
+}
+
+// open 读取并解码一个数据块，长度为 0 表示数据结束
+func (s *vmessChunkStream) open(r io.Reader) ([]byte, error) {
+	var sizeBuf [2]byte
+	if _, err := io.ReadFull(r, sizeBuf[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(sizeBuf[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if s.aead == nil {
+		if len(buf) == 0 {
+			return nil, io.EOF
+		}
+		return buf, nil
+	}
+	payload, err := s.aead.Open(buf[:0], s.nonce(), buf, nil)
+	if err != nil {
+		return nil, errors.New("VMess 数据解密失败")
+	}
+	if len(payload) == 0 {
+		return nil, io.EOF
+	}
+	return payload, nil
+}
+
+// vmessConn VMess（AEAD 请求头，alterId 为 0）连接
+type vmessConn struct {
+	net.Conn
+	writer *vmessChunkStream
+	reader *vmessChunkStream
+
+	respKey, respIV []byte
+	respV           byte
+	responseRead    bool
+	readBuf         []byte
+}
+
+// newVMessConn 创建 VMess 连接并发送请求头
+func newVMessConn(conn net.Conn, id, securityName, host string, port uint16) (net.Conn, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("UUID 格式错误: %v", err)
+	}
+	security, ok := vmessSecurities[securityName]
+	if !ok {
+		return nil, errors.New("不支持的 VMess 加密方式: " + securityName)
+	}
+
+	// 请求头：版本 + 数据IV + 数据密钥 + 响应认证 + 选项(标准数据流) + 加密方式 + 保留 + TCP 命令 + 地址 + FNV1a 校验
+	random := make([]byte, 33)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	reqIV, reqKey, respV := random[:16], random[16:32], random[32]
+	header := []byte{0x01}
+	header = append(header, reqIV...)
+	header = append(header, reqKey...)
+	header = append(header, respV, 0x01, security, 0x00, 0x01)
+	header = append(header, v2rayAddr(host, port)...)
+	checksum := fnv.New32a()
+	checksum.Write(header)
+	header = checksum.Sum(header)
+
+	sealed, err := vmessSealHeader(vmessCmdKey(uid), header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(sealed); err != nil {
+		return nil, err
+	}
+
+	writer, err := newVMessChunkStream(security, reqKey, reqIV)
+	if err != nil {
+		return nil, err
+	}
+	respKey := sha256.Sum256(reqKey)
+	respIV := sha256.Sum256(reqIV)
+	reader, err := newVMessChunkStream(security, respKey[:16], respIV[:16])
+	if err != nil {
+		return nil, err
+	}
+	return &vmessConn{
+		Conn:    conn,
+		writer:  writer,
+		reader:  reader,
+		respKey: respKey[:16],
+		respIV:  respIV[:16],
+		respV:   respV,
+	}, nil
+}
+
+func (c *vmessConn) Write(b []byte) (int, error) {
+	var out []byte
+	for payload := b; len(payload) > 0; {
+		size := len(payload)
+		if size > vmessMaxChunk {
+			size = vmessMaxChunk
+		}
+		out = c.writer.seal(out, payload[:size])
+		payload = payload[size:]
+	}
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *vmessConn) Read(b []byte) (int, error) {
+	if !c.responseRead {
+		if err := c.readResponseHeader(); err != nil {
+			return 0, err
+		}
+		c.responseRead = true
+	}
+	for len(c.readBuf) == 0 {
+		payload, err := c.reader.open(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		c.readBuf = payload
+	}
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// readResponseHeader 读取并校验 AEAD 响应头
+func (c *vmessConn) readResponseHeader() error {
+	lengthAEAD, err := newGCM(vmessKDF(c.respKey, vmessRespHeaderLengthKey)[:16])
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 2+lengthAEAD.Overhead())
+	if _, err := io.ReadFull(c.Conn, buf); err != nil {
+		return err
+	}
+	lengthBuf, err := lengthAEAD.Open(buf[:0], vmessKDF(c.respIV, vmessRespHeaderLengthIV)[:12], buf, nil)
+	if err != nil {
+		return errors.New("VMess 响应头解密失败（UUID 错误或时间不同步）")
+	}
+
+	payloadAEAD, err := newGCM(vmessKDF(c.respKey, vmessRespHeaderPayloadKey)[:16])
+	if err != nil {
+		return err
+	}
+	buf = make([]byte, int(binary.BigEndian.Uint16(lengthBuf))+payloadAEAD.Overhead())
+	if _, err := io.ReadFull(c.Conn, buf); err != nil {
+		return err
+	}
+	header, err := payloadAEAD.Open(buf[:0], vmessKDF(c.respIV, vmessRespHeaderPayloadIV)[:12], buf, nil)
+	if err != nil || len(header) < 4 || header[0] != c.respV {
+		return errors.New("VMess 响应头校验失败")
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package node_health
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// WebSocket 帧类型
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// wsAcceptGUID 计算 Sec-WebSocket-Accept 使用的固定 GUID
+const wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// dialWebSocket 在已建立的连接上完成 WebSocket（或 V2Ray HTTPUpgrade）握手
+func dialWebSocket(conn net.Conn, host, path string, headers map[string]string, httpUpgrade bool) (net.Conn, error) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+host+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("WebSocket 路径错误: %v", err)
+	}
+	req.Host = host
+	for k, v := range headers {
+		if !strings.EqualFold(k, "Host") {
+			req.Header.Set(k, v)
+		}
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	if !httpUpgrade {
+		req.Header.Set("Sec-WebSocket-Key", key)
+		req.Header.Set("Sec-WebSocket-Version", "13")
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("发送 WebSocket 握手失败: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, fmt.Errorf("读取 WebSocket 握手响应失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("WebSocket 握手失败: 状态码 %d", resp.StatusCode)
+	}
+	if httpUpgrade {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		return nil, errors.New("WebSocket 握手失败: Sec-WebSocket-Accept 不匹配")
+	}
+	return &wsConn{Conn: conn, reader: reader, client: true}, nil
+}
+
+// wsAcceptKey 计算握手响应中的 Sec-WebSocket-Accept
+func wsAcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// bufferedConn 读取时优先消费握手阶段已缓冲数据的连接
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// wsConn 将 WebSocket 二进制帧封装为字节流的连接
+// 客户端写入的帧需要掩码；读取时兼容带掩码的帧（用于本地模拟服务端）
+type wsConn struct {
+	net.Conn
+	reader    *bufio.Reader
+	client    bool
+	remaining int64  // 当前数据帧未读取的长度
+	mask      []byte // 当前数据帧的掩码
+	maskPos   int    // 掩码偏移
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for c.remaining == 0 {
+		opcode, length, err := c.readFrameHeader()
+		if err != nil {
+			return 0, err
+		}
+		switch opcode {
+		case wsOpContinuation, wsOpText, wsOpBinary:
+			c.remaining = length
+		case wsOpClose:
+			return 0, io.EOF
+		default:
+			// 控制帧直接丢弃
+			if _, err := io.CopyN(io.Discard, c.reader, length); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if int64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.reader.Read(b)
+	if c.mask != nil {
+		for i := 0; i < n; i++ {
+			b[i] ^= c.mask[c.maskPos%4]
+			c.maskPos++
+		}
+	}
+	c.remaining -= int64(n)
+	return n, err
+}
+
+// readFrameHeader 读取帧头，返回帧类型和负载长度
+func (c *wsConn) readFrameHeader() (byte, int64, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		return 0, 0, err
+	}
+	opcode := head[0] & 0x0f
+	length := int64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return 0, 0, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return 0, 0, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	c.mask, c.maskPos = nil, 0
+	if head[1]&0x80 != 0 {
+		c.mask = make([]byte, 4)
+		if _, err := io.ReadFull(c.reader, c.mask); err != nil {
+			return 0, 0, err
+		}
+	}
+	return opcode, length, nil
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	frame := make([]byte, 0, len(b)+14)
+	frame = append(frame, 0x80|wsOpBinary)
+
+	maskBit := byte(0)
+	if c.client {
+		maskBit = 0x80
+	}
+	switch {
+	case len(b) < 126:
+		frame = append(frame, maskBit|byte(len(b)))
+	case len(b) <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(b)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(b)))
+	}
+
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return 0, err
+		}
+		frame = append(frame, mask[:]...)
+		for i, v := range b {
+			frame = append(frame, v^mask[i%4])
+		}
+	} else {
+		frame = append(frame, b...)
+	}
+
+	if _, err := c.Conn.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -242,6 +242,8 @@ func getNotificationSubject(notificationType string) string {
 		"subscription_expired": "⏰ 订阅已过期",
 		"user_created":         "📋 管理员创建用户",
 		"subscription_created": "📦 订阅创建",
+		"bank_transfer":        "🏦 银行转账待审核",
+		"crypto_late":          "⚠️ USDT 逾期到账待处理",
 	}
 	if subject, ok := subjectMap[notificationType]; ok {
 		return subject
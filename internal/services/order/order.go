@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"cboard-go/internal/core/database"
 	"cboard-go/internal/models"
@@ -193,9 +194,13 @@ func (s *OrderService) CreateOrder(userID uint, params CreateOrderParams) (*mode
 
 // generatePaymentURL 生成支付链接
 func (s *OrderService) generatePaymentURL(order *models.Order, payType string, amount float64) (string, error) {
-	var paymentConfig models.PaymentConfig
-	if err := s.db.Where("LOWER(pay_type) = LOWER(?) AND status = ?", payType, 1).Order("sort_order ASC").First(&paymentConfig).Error; err != nil {
-		return "", fmt.Errorf("未找到启用的支付配置")
+	paymentConfig, err := payment.ActiveConfig(s.db, payType)
+	if err != nil {
+		return "", err
+	}
+	provider, err := payment.NewProvider(paymentConfig)
+	if err != nil {
+		return "", err
 	}
 
 	// 创建支付交易记录
@@ -209,34 +214,7 @@ func (s *OrderService) generatePaymentURL(order *models.Order, payType string, a
 	}
 	s.db.Create(&transaction)
 
-	switch paymentConfig.PayType {
-	case "alipay":
-		svc, err := payment.NewAlipayService(&paymentConfig)
-		if err != nil {
-			return "", err
-		}
-		return svc.CreatePayment(order, amount)
-	case "wechat":
-		svc, err := payment.NewWechatService(&paymentConfig)
-		if err != nil {
-			return "", err
-		}
-		return svc.CreatePayment(order, amount)
-	case "paypal":
-		svc, err := payment.NewPayPalService(&paymentConfig)
-		if err != nil {
-			return "", err
-		}
-		return svc.CreatePayment(order, amount)
-	case "applepay":
-		svc, err := payment.NewApplePayService(&paymentConfig)
-		if err != nil {
-			return "", err
-		}
-		return svc.CreatePayment(order, amount)
-	default:
-		return "", fmt.Errorf("不支持的支付方式: %s", paymentConfig.PayType)
-	}
+	return provider.CreatePayment(order, amount)
 }
 
 // sendPaymentSuccessEmail 发送支付成功邮件
@@ -256,6 +234,27 @@ func (s *OrderService) sendPaymentSuccessEmail(user *models.User, order *models.
 	_ = emailService.QueueEmail(user.Email, "支付成功通知", content, "payment_success")
 }
 
+// payableOrderStatuses 可以被支付结果入账的订单状态
+// 已支付和已退款（refunded）的订单不在其中，迟到或重复的支付回调不会重新开通
+var payableOrderStatuses = []string{"pending", "cancelled", "expired", "failed"}
+
+// MarkOrderPaid 将订单标记为已支付（条件更新，仅更新待支付、已取消或已过期的订单）
+// 返回 false 表示订单已被其他回调或状态查询处理（或已退款），调用方不应再次开通
+func MarkOrderPaid(tx *gorm.DB, order *models.Order) (bool, error) {
+	now := utils.GetBeijingTime()
+	result := tx.Model(&models.Order{}).Where("id = ? AND status IN ?", order.ID, payableOrderStatuses).
+		Updates(map[string]interface{}{"status": "paid", "payment_time": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	order.Status = "paid"
+	order.PaymentTime = database.NullTime(now)
+	return true, nil
+}
+
 // ProcessPaidOrder 处理已支付订单的后续逻辑（开通/续费订阅、更新消费、升级等级）
 // 调用此方法前，订单状态应已更新为 paid
 // 支持套餐订单（PackageID > 0）和设备升级订单（PackageID = 0）
@@ -327,6 +326,7 @@ func (s *OrderService) processPackageOrder(order *models.Order, user *models.Use
 			Status:          "active",
 			ExpireTime:      expireTime,
 		}
+		applyPackageTraffic(&subscription, &pkg, now)
 		if err := s.db.Create(&subscription).Error; err != nil {
 			return nil, fmt.Errorf("创建订阅失败: %v", err)
 		}
@@ -348,6 +348,7 @@ func (s *OrderService) processPackageOrder(order *models.Order, user *models.Use
 		subscription.Status = "active"
 		pkgID := int64(pkg.ID)
 		subscription.PackageID = &pkgID
+		applyPackageTraffic(&subscription, &pkg, now)
 
 		if err := s.db.Save(&subscription).Error; err != nil {
 			return nil, fmt.Errorf("更新订阅失败: %v", err)
@@ -361,6 +362,19 @@ func (s *OrderService) processPackageOrder(order *models.Order, user *models.Use
 	return &subscription, nil
 }
 
+// applyPackageTraffic 将套餐的流量配额应用到订阅，并清零已用流量
+func applyPackageTraffic(subscription *models.Subscription, pkg *models.Package, now time.Time) {
+	subscription.TrafficLimit = pkg.TrafficLimit
+	subscription.TrafficResetMode = pkg.TrafficResetMode
+	if subscription.TrafficResetMode == "" {
+		subscription.TrafficResetMode = utils.TrafficResetNone
+	}
+	subscription.TrafficResetDays = pkg.TrafficResetDays
+	subscription.UploadTraffic = 0
+	subscription.DownloadTraffic = 0
+	subscription.TrafficResetAt = &now
+}
+
 // processDeviceUpgradeOrder 处理设备升级订单
 func (s *OrderService) processDeviceUpgradeOrder(order *models.Order, user *models.User) (*models.Subscription, error) {
 	// 从 ExtraData 中解析升级信息
@@ -0,0 +1,362 @@
+package order
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/email"
+	"cboard-go/internal/services/notification"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// 支付结果无法入账的原因（支付回调据此返回 400，网关会重试或人工处理）
+var (
+	ErrPaymentTargetNotFound  = errors.New("订单或充值记录不存在")
+	ErrRechargeAmountMismatch = errors.New("充值金额不匹配")
+	ErrOrderAmountMismatch    = errors.New("订单金额不匹配")
+)
+
+// PaymentResult 已确认的第三方支付结果（支付回调、链上确认、人工审核等）
+type PaymentResult struct {
+	OrderNo string            // 订单号或充值单号
+	TradeNo string            // 第三方交易号（交易哈希、转账参考号等）
+	Amount  float64           // 实付金额（元），0 表示不校验金额
+	Raw     map[string]string // 原始回调数据，保存到交易记录
+}
+
+// CompletePayment 将支付结果入账：充值记录增加余额，订单标记为已支付并开通套餐、发送通知
+// 重复的支付结果（网关重复通知、并发回调）直接返回 nil，不会重复入账
+func (s *OrderService) CompletePayment(p PaymentResult) error {
+	db := s.db
+	orderNo := p.OrderNo
+	externalTransactionID := p.TradeNo
+
+	var order models.Order
+	var recharge models.RechargeRecord
+	isRecharge := false
+
+	// 先尝试查找订单
+	if err := db.Preload("Package").Where("order_no = ?", orderNo).First(&order).Error; err != nil {
+		// 如果不是订单，尝试查找充值记录
+		if err2 := db.Where("order_no = ?", orderNo).First(&recharge).Error; err2 == nil {
+			isRecharge = true
+		} else {
+			utils.LogError("CompletePayment: order or recharge not found", err, map[string]interface{}{
+				"order_no": orderNo,
+			})
+			return ErrPaymentTargetNotFound
+		}
+	}
+
+	if isRecharge {
+		if externalTransactionID != "" {
+			var existingTransaction models.PaymentTransaction
+			if err := db.Where("external_transaction_id = ? AND status = ?", externalTransactionID, "success").First(&existingTransaction).Error; err == nil {
+				return nil
+			}
+		}
+		// 验证充值金额（回调中携带金额时）
+		if p.Amount > 0 {
+			callbackAmount := p.Amount
+			if callbackAmount < recharge.Amount-0.01 || callbackAmount > recharge.Amount+0.01 {
+				utils.LogError("CompletePayment: recharge amount mismatch", nil, map[string]interface{}{
+					"order_no":        orderNo,
+					"expected_amount": recharge.Amount,
+					"callback_amount": callbackAmount,
+				})
+				return ErrRechargeAmountMismatch
+			}
+		}
+
+		if recharge.Status == "paid" {
+			return nil
+		}
+
+		// 使用事务处理充值；条件更新保证网关重复通知或并发回调时余额只增加一次
+		err := utils.WithTransaction(db, func(tx *gorm.DB) error {
+			updates := map[string]interface{}{"status": "paid", "paid_at": utils.GetBeijingTime()}
+			if externalTransactionID != "" {
+				updates["payment_transaction_id"] = externalTransactionID
+			}
+			result := tx.Model(&models.RechargeRecord{}).Where("id = ? AND status <> ?", recharge.ID, "paid").Updates(updates)
+			if result.Error != nil {
+				utils.LogError("CompletePayment: failed to update recharge", result.Error, map[string]interface{}{
+					"order_no": orderNo,
+				})
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return nil
+			}
+
+			var user models.User
+			if err := tx.First(&user, recharge.UserID).Error; err == nil {
+				user.Balance += recharge.Amount
+				if err := tx.Save(&user).Error; err != nil {
+					utils.LogError("CompletePayment: failed to update user balance", err, map[string]interface{}{
+						"order_no": orderNo,
+						"user_id":  user.ID,
+					})
+					return err
+				}
+			}
+			return nil
+		})
+
+		if err != nil {
+			utils.LogError("CompletePayment: failed to process recharge transaction", err, map[string]interface{}{
+				"order_no": orderNo,
+			})
+			return err
+		}
+
+		return nil
+	}
+
+	// 验证订单金额（防止金额篡改，回调中携带金额时）
+	if p.Amount > 0 {
+		callbackAmount := p.Amount
+		// 混合支付时，回调金额可能只是第三方支付部分，需要加上余额部分
+		expectedAmount := order.Amount
+		if order.FinalAmount.Valid {
+			expectedAmount = order.FinalAmount.Float64
+		}
+
+		var balanceUsedInOrder float64 = 0
+		if order.ExtraData.Valid && order.ExtraData.String != "" {
+			var extraData map[string]interface{}
+			if err := json.Unmarshal([]byte(order.ExtraData.String), &extraData); err == nil {
+				if balanceUsedVal, ok := extraData["balance_used"].(float64); ok {
+					balanceUsedInOrder = balanceUsedVal
+				}
+			}
+		}
+
+		expectedCallbackAmount := expectedAmount - balanceUsedInOrder
+		if balanceUsedInOrder > 0 {
+			if callbackAmount < expectedCallbackAmount-0.01 || callbackAmount > expectedCallbackAmount+0.01 {
+				utils.LogError("CompletePayment: amount mismatch (mixed payment)", nil, map[string]interface{}{
+					"order_no":              orderNo,
+					"expected_callback":     expectedCallbackAmount,
+					"callback_amount":       callbackAmount,
+					"balance_used":          balanceUsedInOrder,
+					"total_expected_amount": expectedAmount,
+				})
+				return ErrOrderAmountMismatch
+			}
+		} else {
+			if callbackAmount < expectedAmount-0.01 || callbackAmount > expectedAmount+0.01 {
+				utils.LogError("CompletePayment: amount mismatch", nil, map[string]interface{}{
+					"order_no":        orderNo,
+					"expected_amount": expectedAmount,
+					"callback_amount": callbackAmount,
+				})
+				return ErrOrderAmountMismatch
+			}
+		}
+	}
+
+	// 幂等性检查：如果订单已支付，直接返回成功
+	if order.Status == "paid" {
+		utils.LogError("CompletePayment: order already paid", nil, map[string]interface{}{
+			"order_no": orderNo,
+		})
+		return nil
+	}
+	// 已退款的订单视为已处理：网关重发的支付通知不能让订单重新生效
+	if order.Status == utils.OrderStatusRefunded {
+		utils.LogError("CompletePayment: order already refunded, ignore payment notify", nil, map[string]interface{}{
+			"order_no": orderNo,
+		})
+		return nil
+	}
+
+	// 条件更新订单状态：并发回调（或回调与主动查询同时到达）时只有一个能更新成功，避免重复开通
+	marked := false
+	err := utils.WithTransaction(db, func(tx *gorm.DB) error {
+		ok, err := MarkOrderPaid(tx, &order)
+		if err != nil {
+			utils.LogError("CompletePayment: failed to update order", err, map[string]interface{}{
+				"order_no": orderNo,
+			})
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		marked = true
+
+		var transaction models.PaymentTransaction
+		if err := tx.Where("order_id = ?", order.ID).First(&transaction).Error; err == nil {
+			transaction.Status = "success"
+			if externalTransactionID != "" {
+				transaction.ExternalTransactionID = database.NullString(externalTransactionID)
+			}
+			if callbackData, err := json.Marshal(p.Raw); err == nil {
+				transaction.CallbackData = database.NullString(string(callbackData))
+			}
+			if err := tx.Save(&transaction).Error; err != nil {
+				utils.LogError("CompletePayment: failed to update transaction", err, map[string]interface{}{
+					"order_no": orderNo,
+				})
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		utils.LogError("CompletePayment: failed to process payment transaction", err, map[string]interface{}{
+			"order_no": orderNo,
+		})
+		return err
+	}
+	if !marked {
+		return nil
+	}
+
+	var balanceUsed float64 = 0
+	if order.ExtraData.Valid && order.ExtraData.String != "" {
+		var extraData map[string]interface{}
+		if err := json.Unmarshal([]byte(order.ExtraData.String), &extraData); err == nil {
+			if balanceUsedVal, ok := extraData["balance_used"].(float64); ok {
+				balanceUsed = balanceUsedVal
+			}
+		}
+	}
+
+	if balanceUsed > 0 {
+		var user models.User
+		if err := db.First(&user, order.UserID).Error; err == nil {
+			if user.Balance >= balanceUsed {
+				user.Balance -= balanceUsed
+				if err := db.Save(&user).Error; err != nil {
+					utils.LogError("CompletePayment: failed to deduct balance", err, map[string]interface{}{
+						"order_id":     order.ID,
+						"balance_used": balanceUsed,
+					})
+				} else {
+					utils.LogError("CompletePayment: balance deducted", nil, map[string]interface{}{
+						"order_id":     order.ID,
+						"balance_used": balanceUsed,
+						"user_id":      user.ID,
+					})
+				}
+			} else {
+				utils.LogError("CompletePayment: insufficient balance", nil, map[string]interface{}{
+					"order_id":     order.ID,
+					"balance_used": balanceUsed,
+					"user_balance": user.Balance,
+				})
+			}
+		}
+	}
+
+	// ProcessPaidOrder 统一处理所有订单类型
+	_, processErr := s.ProcessPaidOrder(&order)
+	if processErr != nil {
+		utils.LogError("CompletePayment: process paid order failed", processErr, map[string]interface{}{
+			"order_id": order.ID,
+		})
+		// 支付已成功，后续可通过补偿机制修复
+	}
+
+	go func() {
+		var latestOrder models.Order
+		if err := db.Preload("Package").Where("id = ?", order.ID).First(&latestOrder).Error; err != nil {
+			return
+		}
+		var latestUser models.User
+		if err := db.First(&latestUser, latestOrder.UserID).Error; err != nil {
+			return
+		}
+
+		paymentTime := utils.GetBeijingTime().Format("2006-01-02 15:04:05")
+		paidAmount := latestOrder.Amount
+		if latestOrder.FinalAmount.Valid {
+			paidAmount = latestOrder.FinalAmount.Float64
+		}
+		paymentMethod := "在线支付"
+		if latestOrder.PaymentMethodName.Valid {
+			paymentMethod = latestOrder.PaymentMethodName.String
+		}
+		packageName := "未知套餐"
+		if latestOrder.Package.ID > 0 {
+			packageName = latestOrder.Package.Name
+		} else if latestOrder.ExtraData.Valid {
+			packageName = "设备/时长升级"
+		}
+
+		// 发送客户付款成功通知邮件
+		if latestOrder.PackageID > 0 && notification.ShouldSendCustomerNotification("new_order") {
+			emailService := email.NewEmailService()
+			templateBuilder := email.NewEmailTemplateBuilder()
+
+			// 1. 发送付款成功通知邮件
+			paymentSuccessContent := templateBuilder.GetPaymentSuccessTemplate(
+				latestUser.Username,
+				latestOrder.OrderNo,
+				packageName,
+				paidAmount,
+				paymentMethod,
+				paymentTime,
+			)
+			if err := emailService.QueueEmail(latestUser.Email, "支付成功通知", paymentSuccessContent, "payment_success"); err != nil {
+				utils.LogErrorMsg("发送付款成功邮件失败: order_no=%s, email=%s, error=%v", latestOrder.OrderNo, latestUser.Email, err)
+			} else {
+				utils.LogInfo("付款成功邮件已加入队列: order_no=%s, email=%s", latestOrder.OrderNo, latestUser.Email)
+			}
+
+			// 2. 发送订阅配置信息邮件
+			var subscriptionInfo models.Subscription
+			if err := db.Where("user_id = ?", latestUser.ID).First(&subscriptionInfo).Error; err == nil {
+				baseURL := templateBuilder.GetBaseURL()
+				timestamp := fmt.Sprintf("%d", utils.GetBeijingTime().Unix())
+				universalURL := fmt.Sprintf("%s/api/v1/subscriptions/universal/%s?t=%s", baseURL, subscriptionInfo.SubscriptionURL, timestamp)
+				clashURL := fmt.Sprintf("%s/api/v1/subscriptions/clash/%s?t=%s", baseURL, subscriptionInfo.SubscriptionURL, timestamp)
+
+				expireTime := "未设置"
+				remainingDays := 0
+				if !subscriptionInfo.ExpireTime.IsZero() {
+					expireTime = subscriptionInfo.ExpireTime.Format("2006-01-02 15:04:05")
+					diff := subscriptionInfo.ExpireTime.Sub(utils.GetBeijingTime())
+					if diff > 0 {
+						remainingDays = int(diff.Hours() / 24)
+					}
+				}
+
+				content := templateBuilder.GetSubscriptionTemplate(
+					latestUser.Username,
+					universalURL,
+					clashURL,
+					expireTime,
+					remainingDays,
+					subscriptionInfo.DeviceLimit,
+					subscriptionInfo.CurrentDevices,
+				)
+				if err := emailService.QueueEmail(latestUser.Email, "服务配置信息", content, "subscription"); err != nil {
+					utils.LogErrorMsg("发送订阅配置邮件失败: order_no=%s, email=%s, error=%v", latestOrder.OrderNo, latestUser.Email, err)
+				} else {
+					utils.LogInfo("订阅配置邮件已加入队列: order_no=%s, email=%s", latestOrder.OrderNo, latestUser.Email)
+				}
+			}
+		}
+
+		notificationService := notification.NewNotificationService()
+		_ = notificationService.SendAdminNotification("order_paid", map[string]interface{}{
+			"order_no":       latestOrder.OrderNo,
+			"username":       latestUser.Username,
+			"amount":         paidAmount,
+			"package_name":   packageName,
+			"payment_method": paymentMethod,
+			"payment_time":   paymentTime,
+		})
+	}()
+
+	return nil
+}
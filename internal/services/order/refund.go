@@ -0,0 +1,500 @@
+package order
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/email"
+	"cboard-go/internal/services/payment"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// 退款去向
+const (
+	RefundToOriginal = "original" // 原路退回支付网关
+	RefundToBalance  = "balance"  // 退回用户余额
+)
+
+// 退款交易记录状态（PaymentTransaction.Status，金额为负数）
+const (
+	RefundTransactionStatus = "refunded"       // 退款已完成
+	RefundPendingStatus     = "refund_pending" // 已提交网关但结果不确定，待对账（占用的退款金额不释放）
+	RefundFailedStatus      = "refund_failed"  // 网关明确拒绝，占用的退款金额已释放
+)
+
+var (
+	ErrOrderNotRefundable = errors.New("只有已支付的订单可以退款")
+	ErrRefundAmount       = errors.New("退款金额无效或超过可退金额")
+	ErrRefundDestination  = errors.New("退款去向只能是 original 或 balance")
+	ErrRefundConflict     = errors.New("订单正在退款或可退金额已变化，请刷新后重试")
+	ErrRefundPending      = errors.New("网关退款结果不确定，已标记为待对账，请稍后在退款记录中重试确认")
+	ErrRefundNotPending   = errors.New("退款记录不存在或不是待对账状态")
+)
+
+// RefundParams 管理员退款参数
+type RefundParams struct {
+	Amount      float64 // 退款金额（元），0 表示退还全部可退金额
+	Destination string  // original / balance
+	Reason      string
+	OperatorID  uint
+}
+
+// RefundOutcome 退款结果
+type RefundOutcome struct {
+	RefundNo        string     `json:"refund_no"`
+	Amount          float64    `json:"amount"`
+	Destination     string     `json:"destination"`
+	GatewayRefundID string     `json:"gateway_refund_id,omitempty"`
+	DeductedHours   float64    `json:"deducted_hours"` // 扣减的订阅时长（小时）
+	ExpireTime      *time.Time `json:"expire_time,omitempty"`
+	RefundAmount    float64    `json:"refund_amount"` // 订单累计已退款金额（含待对账）
+	OrderStatus     string     `json:"order_status"`
+}
+
+// refundDetail 保存在退款交易 PaymentData 中的退款信息，重试对账时使用
+type refundDetail struct {
+	Destination string `json:"destination"`
+	Reason      string `json:"reason"`
+	OperatorID  uint   `json:"operator_id"`
+}
+
+// RefundOrder 对已支付订单退款（全额或部分）
+// 原路退回时调用支付网关退款接口，混合支付的余额部分需退回余额；
+// 按退款比例扣减订阅时长和累计消费，全额退款时收回邀请奖励，最后邮件通知用户。
+// 网关返回不确定的错误（超时、系统繁忙）时退款保持待对账并返回 ErrRefundPending，
+// 之后通过 RetryRefund 用同一退款单号重试，网关按退款单号幂等处理
+func (s *OrderService) RefundOrder(orderID uint, p RefundParams) (*RefundOutcome, error) {
+	if p.Destination == "" {
+		p.Destination = RefundToOriginal
+	}
+	if p.Destination != RefundToOriginal && p.Destination != RefundToBalance {
+		return nil, ErrRefundDestination
+	}
+
+	var order models.Order
+	if err := s.db.First(&order, orderID).Error; err != nil {
+		return nil, fmt.Errorf("订单不存在: %v", err)
+	}
+	if order.Status != "paid" {
+		return nil, ErrOrderNotRefundable
+	}
+
+	paidAmount := orderPaidAmount(&order)
+	refundable := roundMoney(paidAmount - order.RefundAmount)
+	amount := roundMoney(p.Amount)
+	if amount == 0 {
+		amount = refundable
+	}
+	if amount <= 0 || amount > refundable+0.001 {
+		return nil, ErrRefundAmount
+	}
+
+	// 原路退回：找到支付成功的网关交易，只能退回网关实付部分
+	var gatewayCfg *models.PaymentConfig
+	var provider payment.Provider
+	if p.Destination == RefundToOriginal {
+		cfg, remaining, err := s.gatewayRefundable(&order)
+		if err != nil {
+			return nil, err
+		}
+		if amount > remaining+0.001 {
+			return nil, fmt.Errorf("原路最多可退 %.2f 元（余额支付部分请选择退回余额）", remaining)
+		}
+		if provider, err = payment.NewProvider(cfg); err != nil {
+			return nil, fmt.Errorf("初始化支付网关失败: %v", err)
+		}
+		gatewayCfg = cfg
+	}
+
+	record := models.PaymentTransaction{
+		OrderID:       order.ID,
+		UserID:        order.UserID,
+		Amount:        -int(math.Round(amount * 100)),
+		Currency:      "CNY",
+		TransactionID: database.NullString(generateRefundNo(order.ID)),
+		Status:        RefundTransactionStatus,
+	}
+	if gatewayCfg != nil {
+		record.PaymentMethodID = gatewayCfg.ID
+		record.Status = RefundPendingStatus
+	}
+	if data, err := json.Marshal(refundDetail{Destination: p.Destination, Reason: p.Reason, OperatorID: p.OperatorID}); err == nil {
+		record.PaymentData = database.NullString(string(data))
+	}
+
+	// 占用可退金额（条件更新）并写入退款记录：防止并发退款超过实付金额，
+	// 网关退款先记为待对账，进程在调用网关期间退出也能在退款记录中找到并重试
+	var outcome *RefundOutcome
+	err := utils.WithTransaction(s.db, func(tx *gorm.DB) error {
+		result := tx.Model(&models.Order{}).
+			Where("id = ? AND status = ? AND refund_amount + ? <= ?", order.ID, "paid", amount, paidAmount+0.001).
+			Update("refund_amount", gorm.Expr("refund_amount + ?", amount))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefundConflict
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		if gatewayCfg != nil {
+			return nil
+		}
+		var err error
+		outcome, err = applyRefund(tx, &order, &record, p.Destination)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if gatewayCfg == nil {
+		s.notifyRefund(&order, outcome, p.Reason)
+		return outcome, nil
+	}
+	return s.settleGatewayRefund(&order, &record, gatewayCfg, provider, p.Reason)
+}
+
+// RetryRefund 重试待对账的网关退款（使用原退款单号，网关按退款单号幂等，不会重复退款）
+func (s *OrderService) RetryRefund(orderID uint, refundNo string) (*RefundOutcome, error) {
+	var record models.PaymentTransaction
+	if err := s.db.Where("order_id = ? AND transaction_id = ? AND status = ?", orderID, refundNo, RefundPendingStatus).
+		First(&record).Error; err != nil {
+		return nil, ErrRefundNotPending
+	}
+	var order models.Order
+	if err := s.db.First(&order, orderID).Error; err != nil {
+		return nil, fmt.Errorf("订单不存在: %v", err)
+	}
+	var cfg models.PaymentConfig
+	if err := s.db.First(&cfg, record.PaymentMethodID).Error; err != nil {
+		return nil, fmt.Errorf("原支付方式配置不存在: %v", err)
+	}
+	provider, err := payment.NewProvider(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("初始化支付网关失败: %v", err)
+	}
+	var detail refundDetail
+	if record.PaymentData.Valid {
+		_ = json.Unmarshal([]byte(record.PaymentData.String), &detail)
+	}
+	return s.settleGatewayRefund(&order, &record, &cfg, provider, detail.Reason)
+}
+
+// settleGatewayRefund 调用网关退款并根据结果处理待对账的退款记录：
+// 成功时完成退款，网关明确拒绝时释放占用金额，结果不确定时保持待对账
+func (s *OrderService) settleGatewayRefund(order *models.Order, record *models.PaymentTransaction, cfg *models.PaymentConfig, provider payment.Provider, reason string) (*RefundOutcome, error) {
+	refundNo := record.TransactionID.String
+	amount := float64(-record.Amount) / 100
+
+	refund, err := provider.Refund(order.OrderNo, refundNo, amount, reason)
+	if err != nil {
+		if !errors.Is(err, payment.ErrNotSupported) && !errors.Is(err, payment.ErrRefundRejected) {
+			utils.LogError("RefundOrder: gateway refund result unknown, pending reconciliation", err, map[string]interface{}{
+				"order_no":  order.OrderNo,
+				"refund_no": refundNo,
+				"pay_type":  cfg.PayType,
+			})
+			return nil, fmt.Errorf("%w: %v", ErrRefundPending, err)
+		}
+		if releaseErr := releaseRefund(s.db, order.ID, record); releaseErr != nil {
+			utils.LogError("RefundOrder: failed to release rejected refund", releaseErr, map[string]interface{}{
+				"order_no":  order.OrderNo,
+				"refund_no": refundNo,
+			})
+		}
+		if errors.Is(err, payment.ErrNotSupported) {
+			return nil, fmt.Errorf("%s 不支持原路退款，请选择退回余额", cfg.PayType)
+		}
+		return nil, err
+	}
+
+	record.ExternalTransactionID = database.NullString(refund.TradeNo)
+	var outcome *RefundOutcome
+	err = utils.WithTransaction(s.db, func(tx *gorm.DB) error {
+		// 条件更新：并发重试同一笔待对账退款时只有一方完成入账
+		result := tx.Model(&models.PaymentTransaction{}).
+			Where("id = ? AND status = ?", record.ID, RefundPendingStatus).
+			Updates(map[string]interface{}{"status": RefundTransactionStatus, "external_transaction_id": record.ExternalTransactionID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefundNotPending
+		}
+		var err error
+		outcome, err = applyRefund(tx, order, record, RefundToOriginal)
+		return err
+	})
+	if err != nil {
+		// 网关已退款，本地记录保持待对账，重试时网关幂等返回成功后再次入账
+		utils.LogError("RefundOrder: failed to record refund", err, map[string]interface{}{
+			"order_no":          order.OrderNo,
+			"refund_no":         refundNo,
+			"gateway_refund_id": refund.TradeNo,
+		})
+		return nil, fmt.Errorf("网关已退款，但退款记录保存失败（已保留待对账）: %v", err)
+	}
+	s.notifyRefund(order, outcome, reason)
+	return outcome, nil
+}
+
+// releaseRefund 网关明确拒绝后将退款记录标记为失败并释放占用的退款金额
+func releaseRefund(db *gorm.DB, orderID uint, record *models.PaymentTransaction) error {
+	amount := float64(-record.Amount) / 100
+	return utils.WithTransaction(db, func(tx *gorm.DB) error {
+		result := tx.Model(&models.PaymentTransaction{}).
+			Where("id = ? AND status = ?", record.ID, RefundPendingStatus).
+			Update("status", RefundFailedStatus)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&models.Order{}).Where("id = ?", orderID).
+			Update("refund_amount", gorm.Expr("refund_amount - ?", amount)).Error
+	})
+}
+
+// applyRefund 在事务中完成退款的本地处理：退回余额、扣回累计消费、按比例缩短订阅，
+// 订单全部退完（且没有待对账的退款）时收回邀请奖励并将订单标记为已退款
+func applyRefund(tx *gorm.DB, order *models.Order, record *models.PaymentTransaction, destination string) (*RefundOutcome, error) {
+	amount := float64(-record.Amount) / 100
+	paidAmount := orderPaidAmount(order)
+	fraction := 1.0
+	if paidAmount > 0 {
+		fraction = math.Min(amount/paidAmount, 1)
+	}
+	outcome := &RefundOutcome{
+		RefundNo:        record.TransactionID.String,
+		Amount:          amount,
+		Destination:     destination,
+		GatewayRefundID: record.ExternalTransactionID.String,
+	}
+
+	var user models.User
+	if err := tx.First(&user, order.UserID).Error; err != nil {
+		return nil, err
+	}
+	if destination == RefundToBalance {
+		user.Balance += amount
+	}
+	// 累计消费按原价（Amount）计入，按同样比例扣回
+	user.TotalConsumption = math.Max(roundMoney(user.TotalConsumption-order.Amount*fraction), 0)
+	if err := tx.Save(&user).Error; err != nil {
+		return nil, err
+	}
+
+	if days := orderDurationDays(tx, order); days > 0 {
+		var subscription models.Subscription
+		if err := tx.Where("user_id = ?", order.UserID).First(&subscription).Error; err == nil {
+			now := utils.GetBeijingTime()
+			newExpire := shortenExpireTime(subscription.ExpireTime, proportionalDuration(days, fraction), now)
+			outcome.DeductedHours = math.Round(subscription.ExpireTime.Sub(newExpire).Hours()*100) / 100
+			if err := tx.Model(&subscription).Update("expire_time", newExpire).Error; err != nil {
+				return nil, err
+			}
+			outcome.ExpireTime = &newExpire
+		}
+	}
+
+	var current models.Order
+	if err := tx.First(&current, order.ID).Error; err != nil {
+		return nil, err
+	}
+	var pending int64
+	if err := tx.Model(&models.PaymentTransaction{}).
+		Where("order_id = ? AND status = ?", order.ID, RefundPendingStatus).Count(&pending).Error; err != nil {
+		return nil, err
+	}
+	outcome.RefundAmount = roundMoney(current.RefundAmount)
+	outcome.OrderStatus = current.Status
+	if pending == 0 && current.RefundAmount >= paidAmount-0.001 {
+		if err := reverseInviteRewards(tx, order, paidAmount); err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&models.Order{}).Where("id = ?", order.ID).Update("status", utils.OrderStatusRefunded).Error; err != nil {
+			return nil, err
+		}
+		outcome.OrderStatus = utils.OrderStatusRefunded
+	}
+	return outcome, nil
+}
+
+// GetRefunds 获取订单的退款记录（含待对账和失败的退款）
+func (s *OrderService) GetRefunds(orderID uint) ([]models.PaymentTransaction, error) {
+	var refunds []models.PaymentTransaction
+	err := s.db.Where("order_id = ? AND status IN ?", orderID,
+		[]string{RefundTransactionStatus, RefundPendingStatus, RefundFailedStatus}).
+		Order("created_at DESC").Find(&refunds).Error
+	return refunds, err
+}
+
+// gatewayRefundable 返回订单支付成功的网关配置及原路剩余可退金额
+func (s *OrderService) gatewayRefundable(order *models.Order) (*models.PaymentConfig, float64, error) {
+	var paid models.PaymentTransaction
+	if err := s.db.Where("order_id = ? AND status = ? AND amount > 0", order.ID, "success").
+		Order("id DESC").First(&paid).Error; err != nil {
+		return nil, 0, fmt.Errorf("订单没有第三方支付记录（余额支付或人工入账），请选择退回余额")
+	}
+	var cfg models.PaymentConfig
+	if err := s.db.First(&cfg, paid.PaymentMethodID).Error; err != nil {
+		return nil, 0, fmt.Errorf("原支付方式配置不存在，请选择退回余额")
+	}
+
+	var refunded sql.NullInt64
+	s.db.Model(&models.PaymentTransaction{}).
+		Where("order_id = ? AND status IN ? AND payment_method_id = ?", order.ID,
+			[]string{RefundTransactionStatus, RefundPendingStatus}, cfg.ID).
+		Select("SUM(-amount)").Scan(&refunded)
+	return &cfg, float64(int64(paid.Amount)-refunded.Int64) / 100, nil
+}
+
+// notifyRefund 站内通知并邮件告知用户退款结果
+func (s *OrderService) notifyRefund(order *models.Order, outcome *RefundOutcome, reason string) {
+	var user models.User
+	if err := s.db.First(&user, order.UserID).Error; err != nil {
+		return
+	}
+	destination := "原路退回"
+	if outcome.Destination == RefundToBalance {
+		destination = "账户余额"
+	}
+	itemName := "设备升级"
+	if order.PackageID > 0 {
+		var pkg models.Package
+		if err := s.db.First(&pkg, order.PackageID).Error; err == nil {
+			itemName = pkg.Name
+		}
+	}
+	expireTime := ""
+	if outcome.ExpireTime != nil {
+		expireTime = outcome.ExpireTime.Format("2006-01-02 15:04:05")
+	}
+
+	s.db.Create(&models.Notification{
+		UserID:   sql.NullInt64{Int64: int64(user.ID), Valid: true},
+		Title:    "订单退款通知",
+		Content:  fmt.Sprintf("订单 %s 已退款 %.2f 元（%s），订阅时长已按比例扣减。", order.OrderNo, outcome.Amount, destination),
+		Type:     "payment",
+		IsActive: true,
+	})
+	if user.Email == "" {
+		return
+	}
+	content := email.NewEmailTemplateBuilder().GetRefundTemplate(
+		user.Username, order.OrderNo, itemName, outcome.Amount, destination, reason, expireTime)
+	if err := email.NewEmailService().QueueEmail(user.Email, "订单退款通知", content, "order_refund"); err != nil {
+		utils.LogError("RefundOrder: queue email", err, map[string]interface{}{"order_no": order.OrderNo})
+	}
+}
+
+// reverseInviteRewards 订单全额退款时，收回由该订单触发的邀请奖励
+// 奖励发放标记会重置，被邀请者之后的有效订单可以重新触发奖励
+func reverseInviteRewards(tx *gorm.DB, order *models.Order, paidAmount float64) error {
+	var relation models.InviteRelation
+	if err := tx.Where("invitee_id = ?", order.UserID).First(&relation).Error; err != nil {
+		return nil
+	}
+	relation.InviteeTotalConsumption = math.Max(roundMoney(relation.InviteeTotalConsumption-paidAmount), 0)
+	if !relation.InviteeFirstOrderID.Valid || relation.InviteeFirstOrderID.Int64 != int64(order.ID) {
+		return tx.Save(&relation).Error
+	}
+
+	if relation.InviterRewardGiven && relation.InviterRewardAmount > 0 {
+		var inviter models.User
+		if err := tx.First(&inviter, relation.InviterID).Error; err == nil {
+			inviter.Balance = math.Max(roundMoney(inviter.Balance-relation.InviterRewardAmount), 0)
+			inviter.TotalInviteReward = math.Max(roundMoney(inviter.TotalInviteReward-relation.InviterRewardAmount), 0)
+			if inviter.TotalInviteCount > 0 {
+				inviter.TotalInviteCount--
+			}
+			if err := tx.Save(&inviter).Error; err != nil {
+				return err
+			}
+		}
+		relation.InviterRewardGiven = false
+	}
+	if relation.InviteeRewardGiven && relation.InviteeRewardAmount > 0 {
+		var invitee models.User
+		if err := tx.First(&invitee, relation.InviteeID).Error; err == nil {
+			invitee.Balance = math.Max(roundMoney(invitee.Balance-relation.InviteeRewardAmount), 0)
+			if err := tx.Save(&invitee).Error; err != nil {
+				return err
+			}
+		}
+		relation.InviteeRewardGiven = false
+	}
+	relation.InviteeFirstOrderID = sql.NullInt64{}
+	return tx.Save(&relation).Error
+}
+
+// orderPaidAmount 订单实付金额（含余额支付部分）
+func orderPaidAmount(order *models.Order) float64 {
+	if order.FinalAmount.Valid {
+		return order.FinalAmount.Float64
+	}
+	return order.Amount
+}
+
+// orderDurationDays 订单开通的订阅天数：套餐订单为套餐时长，设备升级订单为延长天数
+func orderDurationDays(db *gorm.DB, order *models.Order) int {
+	if order.PackageID > 0 {
+		var pkg models.Package
+		if err := db.First(&pkg, order.PackageID).Error; err != nil {
+			return 0
+		}
+		return pkg.DurationDays
+	}
+	if !order.ExtraData.Valid || order.ExtraData.String == "" {
+		return 0
+	}
+	var extraData map[string]interface{}
+	if err := json.Unmarshal([]byte(order.ExtraData.String), &extraData); err != nil {
+		return 0
+	}
+	if days, ok := extraData["additional_days"].(float64); ok {
+		return int(days)
+	}
+	return 0
+}
+
+// proportionalDuration 按退款比例折算需要扣回的订阅时长
+func proportionalDuration(days int, fraction float64) time.Duration {
+	if days <= 0 || fraction <= 0 {
+		return 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	return time.Duration(float64(days) * fraction * float64(24*time.Hour)).Round(time.Second)
+}
+
+// shortenExpireTime 从到期时间中扣除时长，最多扣到当前时间
+func shortenExpireTime(expire time.Time, d time.Duration, now time.Time) time.Time {
+	if !expire.After(now) {
+		return expire
+	}
+	shortened := expire.Add(-d)
+	if shortened.Before(now) {
+		return now
+	}
+	return shortened
+}
+
+// roundMoney 金额保留两位小数
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// generateRefundNo 生成退款单号（支付宝 out_request_no / Stripe 幂等键）
+func generateRefundNo(orderID uint) string {
+	return fmt.Sprintf("RF%s%d%03d", utils.GetBeijingTime().Format("20060102150405"), orderID, rand.Intn(1000))
+}
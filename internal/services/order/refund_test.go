@@ -0,0 +1,253 @@
+package order
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/services/payment"
+	"cboard-go/internal/utils"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestProportionalDuration 测试按退款比例折算订阅时长
+func TestProportionalDuration(t *testing.T) {
+	cases := []struct {
+		days     int
+		fraction float64
+		want     time.Duration
+	}{
+		{30, 1, 30 * 24 * time.Hour},
+		{30, 0.5, 15 * 24 * time.Hour},
+		{30, 0.1, 72 * time.Hour},
+		{30, 1.5, 30 * 24 * time.Hour},
+		{30, 0, 0},
+		{0, 1, 0},
+	}
+	for _, tc := range cases {
+		if got := proportionalDuration(tc.days, tc.fraction); got != tc.want {
+			t.Errorf("proportionalDuration(%d, %.2f) = %v, 期望 %v", tc.days, tc.fraction, got, tc.want)
+		}
+	}
+}
+
+// TestShortenExpireTime 测试扣减到期时间不会早于当前时间
+func TestShortenExpireTime(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if got := shortenExpireTime(now.AddDate(0, 0, 30), 10*24*time.Hour, now); !got.Equal(now.AddDate(0, 0, 20)) {
+		t.Errorf("应扣减 10 天，实际到期时间 %v", got)
+	}
+	if got := shortenExpireTime(now.AddDate(0, 0, 5), 10*24*time.Hour, now); !got.Equal(now) {
+		t.Errorf("扣减超过剩余时长时应到期于当前时间，实际 %v", got)
+	}
+	expired := now.AddDate(0, 0, -3)
+	if got := shortenExpireTime(expired, 24*time.Hour, now); !got.Equal(expired) {
+		t.Errorf("已过期的订阅不应修改到期时间，实际 %v", got)
+	}
+}
+
+// fakeRefundProvider 模拟支付网关退款，fakeRefundErr 为 nil 时退款成功
+type fakeRefundProvider struct{}
+
+var (
+	fakeRefundErr   error
+	fakeRefundCalls []string
+)
+
+func (fakeRefundProvider) CreatePayment(order *models.Order, amount float64) (string, error) {
+	return "", payment.ErrNotSupported
+}
+func (fakeRefundProvider) ParseNotify(req *payment.NotifyRequest) (*payment.Notification, error) {
+	return nil, payment.ErrNotSupported
+}
+func (fakeRefundProvider) QueryStatus(orderNo string) (*payment.QueryResult, error) {
+	return nil, payment.ErrNotSupported
+}
+func (fakeRefundProvider) Close(orderNo string) error { return payment.ErrNotSupported }
+func (fakeRefundProvider) Refund(orderNo, refundNo string, amount float64, reason string) (*payment.RefundResult, error) {
+	fakeRefundCalls = append(fakeRefundCalls, refundNo)
+	if fakeRefundErr != nil {
+		return nil, fakeRefundErr
+	}
+	return &payment.RefundResult{RefundNo: refundNo, TradeNo: "GW-" + refundNo, Amount: amount}, nil
+}
+
+func init() {
+	payment.Register("fake_refund", func(cfg *models.PaymentConfig) (payment.Provider, error) {
+		return fakeRefundProvider{}, nil
+	})
+}
+
+// newRefundTestService 创建使用内存 SQLite 的订单服务，并准备用户、套餐和 60 天后到期的订阅
+func newRefundTestService(t *testing.T) (*OrderService, time.Time) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.Order{}, &models.Package{}, &models.Subscription{},
+		&models.PaymentTransaction{}, &models.PaymentConfig{}, &models.InviteRelation{}, &models.Notification{}); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	expire := utils.GetBeijingTime().Add(60 * 24 * time.Hour).Truncate(time.Second)
+	db.Create(&models.User{ID: 1, Username: "buyer", Password: "x", Balance: 5, TotalConsumption: 100})
+	db.Create(&models.User{ID: 2, Username: "inviter", Password: "x", Balance: 10, TotalInviteReward: 10, TotalInviteCount: 1})
+	db.Create(&models.Package{ID: 1, Name: "月付", Price: 100, DurationDays: 30})
+	db.Create(&models.Subscription{UserID: 1, SubscriptionURL: "sub-1", ExpireTime: expire})
+	return &OrderService{db: db}, expire
+}
+
+// TestRefundOrderToBalance 测试超额拒绝、部分退款后全额退款、退回余额和收回邀请奖励
+func TestRefundOrderToBalance(t *testing.T) {
+	s, expire := newRefundTestService(t)
+	s.db.Create(&models.Order{ID: 1, OrderNo: "ORD1", UserID: 1, PackageID: 1, Amount: 100,
+		FinalAmount: sql.NullFloat64{Float64: 80, Valid: true}, Status: "paid"})
+	s.db.Create(&models.InviteRelation{InviteCodeID: 1, InviterID: 2, InviteeID: 1,
+		InviterRewardGiven: true, InviteeRewardGiven: true, InviterRewardAmount: 10, InviteeRewardAmount: 5,
+		InviteeFirstOrderID: sql.NullInt64{Int64: 1, Valid: true}, InviteeTotalConsumption: 80})
+
+	if _, err := s.RefundOrder(1, RefundParams{Amount: 80.01, Destination: RefundToBalance}); !errors.Is(err, ErrRefundAmount) {
+		t.Fatalf("超过实付金额应拒绝，实际 %v", err)
+	}
+	if _, err := s.RefundOrder(1, RefundParams{Amount: 10, Destination: RefundToOriginal}); err == nil {
+		t.Fatal("没有第三方支付记录时不应允许原路退回")
+	}
+
+	outcome, err := s.RefundOrder(1, RefundParams{Amount: 40, Destination: RefundToBalance})
+	if err != nil {
+		t.Fatalf("部分退款失败: %v", err)
+	}
+	if outcome.OrderStatus != "paid" || outcome.RefundAmount != 40 || outcome.DeductedHours != 15*24 {
+		t.Errorf("部分退款结果不正确: %+v", outcome)
+	}
+	var user models.User
+	s.db.First(&user, 1)
+	if user.Balance != 45 || user.TotalConsumption != 50 {
+		t.Errorf("部分退款后余额应为 45、累计消费 50，实际 %.2f、%.2f", user.Balance, user.TotalConsumption)
+	}
+
+	// 金额为 0 表示退还剩余全部金额
+	outcome, err = s.RefundOrder(1, RefundParams{Destination: RefundToBalance})
+	if err != nil {
+		t.Fatalf("全额退款失败: %v", err)
+	}
+	if outcome.Amount != 40 || outcome.OrderStatus != utils.OrderStatusRefunded {
+		t.Errorf("全额退款结果不正确: %+v", outcome)
+	}
+	s.db.First(&user, 1)
+	if user.Balance != 80 || user.TotalConsumption != 0 {
+		t.Errorf("全额退款后余额应为 80（扣回被邀请奖励 5）、累计消费 0，实际 %.2f、%.2f", user.Balance, user.TotalConsumption)
+	}
+	var inviter models.User
+	s.db.First(&inviter, 2)
+	if inviter.Balance != 0 || inviter.TotalInviteReward != 0 || inviter.TotalInviteCount != 0 {
+		t.Errorf("邀请者奖励应被收回: %+v", inviter)
+	}
+	var relation models.InviteRelation
+	s.db.First(&relation)
+	if relation.InviterRewardGiven || relation.InviteeRewardGiven || relation.InviteeFirstOrderID.Valid {
+		t.Errorf("邀请奖励发放标记应被重置: %+v", relation)
+	}
+	var subscription models.Subscription
+	s.db.First(&subscription)
+	if got := expire.Sub(subscription.ExpireTime); got != 30*24*time.Hour {
+		t.Errorf("订阅应共扣减 30 天，实际 %v", got)
+	}
+	if refunds, _ := s.GetRefunds(1); len(refunds) != 2 {
+		t.Errorf("应记录 2 笔退款，实际 %d", len(refunds))
+	}
+	if _, err := s.RefundOrder(1, RefundParams{Destination: RefundToBalance}); !errors.Is(err, ErrOrderNotRefundable) {
+		t.Errorf("已退款订单不应再次退款，实际 %v", err)
+	}
+
+	// 网关重发的支付通知不能让已退款订单重新生效
+	if err := s.CompletePayment(PaymentResult{OrderNo: "ORD1", TradeNo: "T1", Amount: 80}); err != nil {
+		t.Fatalf("重放支付通知应视为已处理，实际 %v", err)
+	}
+	var order models.Order
+	s.db.First(&order, 1)
+	var after models.Subscription
+	s.db.First(&after)
+	if order.Status != utils.OrderStatusRefunded || !after.ExpireTime.Equal(subscription.ExpireTime) {
+		t.Errorf("重放支付通知后订单状态 %s，订阅到期时间 %v -> %v", order.Status, subscription.ExpireTime, after.ExpireTime)
+	}
+	if ok, err := MarkOrderPaid(s.db, &order); ok || err != nil {
+		t.Errorf("MarkOrderPaid 不应更新已退款订单: %v, %v", ok, err)
+	}
+}
+
+// TestRefundOrderGateway 测试网关拒绝时释放金额、结果不确定时保持待对账并可重试
+func TestRefundOrderGateway(t *testing.T) {
+	s, _ := newRefundTestService(t)
+	s.db.Create(&models.PaymentConfig{ID: 9, PayType: "fake_refund", Status: 1})
+	s.db.Create(&models.Order{ID: 2, OrderNo: "ORD2", UserID: 1, PackageID: 1, Amount: 50, Status: "paid"})
+	s.db.Create(&models.PaymentTransaction{OrderID: 2, UserID: 1, PaymentMethodID: 9, Amount: 5000, Status: "success"})
+	refundAmount := func() float64 {
+		var order models.Order
+		s.db.First(&order, 2)
+		return order.RefundAmount
+	}
+
+	fakeRefundErr = payment.ErrNotSupported
+	if _, err := s.RefundOrder(2, RefundParams{Amount: 10}); err == nil || refundAmount() != 0 {
+		t.Errorf("网关不支持退款时应释放占用金额: %v, %.2f", err, refundAmount())
+	}
+
+	// 结果不确定：保留占用金额和待对账记录，剩余可退金额相应减少
+	fakeRefundErr = errors.New("timeout")
+	if _, err := s.RefundOrder(2, RefundParams{Amount: 30}); !errors.Is(err, ErrRefundPending) {
+		t.Fatalf("网关超时应返回 ErrRefundPending，实际 %v", err)
+	}
+	if refundAmount() != 30 {
+		t.Errorf("待对账退款应保留占用金额，实际 %.2f", refundAmount())
+	}
+	if _, err := s.RefundOrder(2, RefundParams{Amount: 30, Destination: RefundToBalance}); !errors.Is(err, ErrRefundAmount) {
+		t.Errorf("待对账金额不应再次退款，实际 %v", err)
+	}
+	var pending models.PaymentTransaction
+	if err := s.db.Where("status = ?", RefundPendingStatus).First(&pending).Error; err != nil {
+		t.Fatalf("应有待对账的退款记录: %v", err)
+	}
+
+	// 重试时复用原退款单号，成功后完成退款
+	fakeRefundErr = nil
+	outcome, err := s.RetryRefund(2, pending.TransactionID.String)
+	if err != nil {
+		t.Fatalf("重试退款失败: %v", err)
+	}
+	if outcome.GatewayRefundID != "GW-"+pending.TransactionID.String || fakeRefundCalls[len(fakeRefundCalls)-1] != pending.TransactionID.String {
+		t.Errorf("重试应使用原退款单号: %+v", outcome)
+	}
+	if _, err := s.RetryRefund(2, pending.TransactionID.String); !errors.Is(err, ErrRefundNotPending) {
+		t.Errorf("已完成的退款不应再次重试，实际 %v", err)
+	}
+
+	// 网关明确拒绝：记录标记失败并释放金额
+	fakeRefundErr = fmt.Errorf("%w: 余额不足", payment.ErrRefundRejected)
+	if _, err := s.RefundOrder(2, RefundParams{Amount: 20}); err == nil || errors.Is(err, ErrRefundPending) {
+		t.Errorf("网关拒绝时应直接返回错误，实际 %v", err)
+	}
+	if refundAmount() != 30 {
+		t.Errorf("网关拒绝后应释放占用金额，实际 %.2f", refundAmount())
+	}
+	var failed int64
+	s.db.Model(&models.PaymentTransaction{}).Where("status = ?", RefundFailedStatus).Count(&failed)
+	if failed != 2 {
+		t.Errorf("应有 2 笔失败的退款记录，实际 %d", failed)
+	}
+
+	fakeRefundErr = nil
+	outcome, err = s.RefundOrder(2, RefundParams{})
+	if err != nil || outcome.Amount != 20 || outcome.OrderStatus != utils.OrderStatusRefunded {
+		t.Errorf("原路退还剩余金额后订单应为已退款: %+v, %v", outcome, err)
+	}
+}
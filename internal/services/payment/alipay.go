@@ -397,3 +397,83 @@ type AlipayNotification struct {
 	SellerEmail   string
 	GmtPayment    string
 }
+
+// ParseNotify 验证并解析支付宝异步通知
+// trade_status: TRADE_SUCCESS / TRADE_FINISHED 为已支付，WAIT_BUYER_PAY / TRADE_CLOSED 为未支付
+func (s *AlipayService) ParseNotify(req *NotifyRequest) (*Notification, error) {
+	if !s.VerifyNotify(req.Params) {
+		return nil, fmt.Errorf("支付宝回调签名验证失败")
+	}
+	status := req.Params["trade_status"]
+	return &Notification{
+		OrderNo: req.Params["out_trade_no"],
+		TradeNo: req.Params["trade_no"],
+		Amount:  parseAmount(req.Params["total_amount"]),
+		Status:  status,
+		Paid:    status == "TRADE_SUCCESS" || status == "TRADE_FINISHED",
+		Raw:     req.Params,
+	}, nil
+}
+
+// QueryStatus 查询交易状态
+func (s *AlipayService) QueryStatus(orderNo string) (*QueryResult, error) {
+	result, err := s.QueryOrder(orderNo)
+	if err != nil {
+		return nil, err
+	}
+	return &QueryResult{
+		OrderNo: result.OutTradeNo,
+		TradeNo: result.TradeNo,
+		Amount:  parseAmount(result.TotalAmount),
+		Status:  result.TradeStatus,
+		Paid:    result.IsPaid(),
+	}, nil
+}
+
+// Refund 退款（统一收单交易退款接口），同一笔交易多次部分退款时 refundNo 需唯一
+func (s *AlipayService) Refund(orderNo, refundNo string, amount float64, reason string) (*RefundResult, error) {
+	if orderNo == "" || refundNo == "" {
+		return nil, rejectRefund(fmt.Errorf("订单号和退款单号不能为空"))
+	}
+	if amount <= 0 {
+		return nil, rejectRefund(fmt.Errorf("退款金额必须大于0"))
+	}
+
+	param := alipay.TradeRefund{}
+	param.OutTradeNo = orderNo
+	param.OutRequestNo = refundNo
+	param.RefundAmount = fmt.Sprintf("%.2f", amount)
+	param.RefundReason = reason
+
+	rsp, err := s.client.TradeRefund(context.Background(), param)
+	if err != nil {
+		return nil, fmt.Errorf("支付宝退款请求失败: %v", err)
+	}
+	if rsp.IsFailure() {
+		err := fmt.Errorf("支付宝退款失败: Code=%s, Msg=%s, SubMsg=%s", rsp.Code, rsp.Msg, rsp.SubMsg)
+		// 系统繁忙时退款结果未知，支付宝要求使用同一 out_request_no 重试
+		if rsp.Code == alipay.CodeUnknowError || rsp.SubCode == "ACQ.SYSTEM_ERROR" {
+			return nil, err
+		}
+		return nil, rejectRefund(err)
+	}
+	return &RefundResult{
+		RefundNo: refundNo,
+		TradeNo:  rsp.TradeNo,
+		Amount:   amount,
+	}, nil
+}
+
+// Close 关闭未支付的交易；交易不存在（用户未扫码）时视为成功
+func (s *AlipayService) Close(orderNo string) error {
+	param := alipay.TradeClose{}
+	param.OutTradeNo = orderNo
+	rsp, err := s.client.TradeClose(context.Background(), param)
+	if err != nil {
+		return fmt.Errorf("支付宝关闭交易失败: %v", err)
+	}
+	if rsp.IsFailure() && rsp.SubCode != "ACQ.TRADE_NOT_EXIST" {
+		return fmt.Errorf("支付宝关闭交易失败: Code=%s, Msg=%s, SubMsg=%s", rsp.Code, rsp.Msg, rsp.SubMsg)
+	}
+	return nil
+}
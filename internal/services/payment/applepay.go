@@ -114,3 +114,33 @@ func (s *ApplePayService) VerifyNotify(params map[string]string) bool {
 	return true
 }
 
+
+// ParseNotify 解析 Apple Pay 支付结果
+func (s *ApplePayService) ParseNotify(req *NotifyRequest) (*Notification, error) {
+	if !s.VerifyNotify(req.Params) {
+		return nil, fmt.Errorf("Apple Pay 回调验证失败")
+	}
+	return &Notification{
+		OrderNo: req.Params["out_trade_no"],
+		TradeNo: req.Params["trade_no"],
+		Amount:  parseAmount(req.Params["total_amount"]),
+		Status:  "SUCCESS",
+		Paid:    true,
+		Raw:     req.Params,
+	}, nil
+}
+
+// QueryStatus Apple Pay 由客户端发起，不支持主动查询
+func (s *ApplePayService) QueryStatus(orderNo string) (*QueryResult, error) {
+	return nil, ErrNotSupported
+}
+
+// Refund Apple Pay 暂不支持退款
+func (s *ApplePayService) Refund(orderNo, refundNo string, amount float64, reason string) (*RefundResult, error) {
+	return nil, ErrNotSupported
+}
+
+// Close Apple Pay 无需关闭交易
+func (s *ApplePayService) Close(orderNo string) error {
+	return ErrNotSupported
+}
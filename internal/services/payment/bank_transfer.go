@@ -0,0 +1,241 @@
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// 银行转账支付单状态
+const (
+	BankTransferAwaitingReceipt = "awaiting_receipt" // 等待用户转账并上传回执
+	BankTransferPendingReview   = "pending_review"   // 已上传回执，等待管理员审核
+	BankTransferApproved        = "approved"         // 审核通过，订单已入账
+	BankTransferRejected        = "rejected"         // 审核驳回，用户可重新上传回执
+	BankTransferCancelled       = "cancelled"        // 订单已取消或重新下单
+)
+
+// BankAccount 银行转账收款信息
+// 优先读取 ConfigJSON（bank_name、bank_account、bank_branch、account_holder、instructions），
+// 兼容 PaymentConfig 的 BankName / AccountNumber / AccountName 字段
+type BankAccount struct {
+	BankName      string `json:"bank_name"`
+	BankAccount   string `json:"bank_account"`
+	BankBranch    string `json:"bank_branch,omitempty"`
+	AccountHolder string `json:"account_holder"`
+	Instructions  string `json:"instructions,omitempty"` // 额外的转账说明
+}
+
+// ParseBankAccount 解析银行转账收款信息
+func ParseBankAccount(paymentConfig *models.PaymentConfig) (*BankAccount, error) {
+	account := &BankAccount{}
+	if paymentConfig.ConfigJSON.Valid && paymentConfig.ConfigJSON.String != "" {
+		_ = json.Unmarshal([]byte(paymentConfig.ConfigJSON.String), account)
+	}
+	if account.BankName == "" && paymentConfig.BankName.Valid {
+		account.BankName = paymentConfig.BankName.String
+	}
+	if account.BankAccount == "" && paymentConfig.AccountNumber.Valid {
+		account.BankAccount = paymentConfig.AccountNumber.String
+	}
+	if account.AccountHolder == "" && paymentConfig.AccountName.Valid {
+		account.AccountHolder = paymentConfig.AccountName.String
+	}
+	account.BankName = strings.TrimSpace(account.BankName)
+	account.BankAccount = strings.TrimSpace(account.BankAccount)
+	account.AccountHolder = strings.TrimSpace(account.AccountHolder)
+	if account.BankName == "" || account.BankAccount == "" || account.AccountHolder == "" {
+		return nil, fmt.Errorf("银行转账收款信息不完整，请配置银行名称、银行账号和账户持有人")
+	}
+	return account, nil
+}
+
+// BankTransferService 银行转账支付服务（线下转账 + 人工审核）
+type BankTransferService struct {
+	db       *gorm.DB
+	configID uint
+	account  *BankAccount
+}
+
+// NewBankTransferService 创建银行转账支付服务
+func NewBankTransferService(paymentConfig *models.PaymentConfig) (*BankTransferService, error) {
+	account, err := ParseBankAccount(paymentConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &BankTransferService{db: database.GetDB(), configID: paymentConfig.ID, account: account}, nil
+}
+
+// CreatePayment 创建银行转账支付单，返回转账参考号
+// 转账说明通过 GetBankTransfer 查询；同一订单金额不变时复用未完成的支付单
+func (s *BankTransferService) CreatePayment(order *models.Order, amount float64) (string, error) {
+	if order == nil || order.OrderNo == "" {
+		return "", fmt.Errorf("订单号不能为空")
+	}
+	if amount <= 0 {
+		return "", fmt.Errorf("支付金额必须大于0，当前金额: %.2f", amount)
+	}
+
+	var transfer models.BankTransfer
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("order_no = ? AND status IN ?", order.OrderNo,
+			[]string{BankTransferAwaitingReceipt, BankTransferPendingReview, BankTransferRejected}).
+			Order("id DESC").First(&transfer).Error
+		if err == nil && math.Abs(transfer.Amount-amount) < 0.005 {
+			return nil
+		}
+		// 金额变化（如重新计算了优惠）时作废旧的支付单，用户需按新金额转账并重新上传回执
+		if err := tx.Model(&models.BankTransfer{}).Where("order_no = ? AND status IN ?", order.OrderNo,
+			[]string{BankTransferAwaitingReceipt, BankTransferPendingReview, BankTransferRejected}).
+			Update("status", BankTransferCancelled).Error; err != nil {
+			return err
+		}
+
+		code, err := newReferenceCode(tx)
+		if err != nil {
+			return err
+		}
+		transfer = models.BankTransfer{
+			OrderNo:         order.OrderNo,
+			UserID:          order.UserID,
+			PaymentConfigID: s.configID,
+			Amount:          amount,
+			ReferenceCode:   code,
+			Status:          BankTransferAwaitingReceipt,
+		}
+		return tx.Create(&transfer).Error
+	})
+	if err != nil {
+		return "", fmt.Errorf("创建银行转账支付单失败: %v", err)
+	}
+	return transfer.ReferenceCode, nil
+}
+
+// referenceCharset 参考号字符集（去掉易混淆的 0/O/1/I）
+const referenceCharset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newReferenceCode 生成唯一的转账参考号，格式：BT + 8 位字母数字
+func newReferenceCode(tx *gorm.DB) (string, error) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < 5; i++ {
+		code := make([]byte, 8)
+		for j := range code {
+			code[j] = referenceCharset[r.Intn(len(referenceCharset))]
+		}
+		reference := "BT" + string(code)
+		var count int64
+		if err := tx.Model(&models.BankTransfer{}).Where("reference_code = ?", reference).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return reference, nil
+		}
+	}
+	return "", fmt.Errorf("生成转账参考号失败，请重试")
+}
+
+// ParseNotify 银行转账由管理员审核入账，不接受回调
+func (s *BankTransferService) ParseNotify(req *NotifyRequest) (*Notification, error) {
+	return nil, fmt.Errorf("银行转账需管理员审核入账，不接受回调")
+}
+
+// QueryStatus 查询支付单审核状态
+func (s *BankTransferService) QueryStatus(orderNo string) (*QueryResult, error) {
+	transfer, err := GetBankTransfer(s.db, orderNo)
+	if err != nil {
+		return nil, fmt.Errorf("未找到订单 %s 的银行转账支付单", orderNo)
+	}
+	return &QueryResult{
+		OrderNo: orderNo,
+		TradeNo: transfer.ReferenceCode,
+		Amount:  transfer.Amount,
+		Status:  transfer.Status,
+		Paid:    transfer.Status == BankTransferApproved,
+	}, nil
+}
+
+// Refund 银行转账需线下退款
+func (s *BankTransferService) Refund(orderNo, refundNo string, amount float64, reason string) (*RefundResult, error) {
+	return nil, ErrNotSupported
+}
+
+// Close 作废订单未审核的支付单
+func (s *BankTransferService) Close(orderNo string) error {
+	return s.db.Model(&models.BankTransfer{}).Where("order_no = ? AND status IN ?", orderNo,
+		[]string{BankTransferAwaitingReceipt, BankTransferRejected}).
+		Update("status", BankTransferCancelled).Error
+}
+
+// GetBankTransfer 获取订单最新的银行转账支付单
+func GetBankTransfer(db *gorm.DB, orderNo string) (*models.BankTransfer, error) {
+	var transfer models.BankTransfer
+	if err := db.Where("order_no = ?", orderNo).Order("id DESC").First(&transfer).Error; err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+// SubmitBankTransferReceipt 记录用户上传的回执，支付单进入待审核状态（驳回后可重新提交）
+func SubmitBankTransferReceipt(db *gorm.DB, transfer *models.BankTransfer, receiptFile string) error {
+	if transfer.Status != BankTransferAwaitingReceipt && transfer.Status != BankTransferRejected &&
+		transfer.Status != BankTransferPendingReview {
+		return fmt.Errorf("当前状态不能上传回执")
+	}
+	now := utils.GetBeijingTime()
+	result := db.Model(transfer).Where("status = ?", transfer.Status).Updates(map[string]interface{}{
+		"receipt_file":        receiptFile,
+		"receipt_uploaded_at": now,
+		"status":              BankTransferPendingReview,
+		"reject_reason":       "",
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("支付单状态已变化，请刷新后重试")
+	}
+	transfer.ReceiptFile = receiptFile
+	transfer.ReceiptUploadedAt = &now
+	transfer.Status = BankTransferPendingReview
+	transfer.RejectReason = ""
+	return nil
+}
+
+// ReviewBankTransfer 将待审核的支付单标记为审核通过或驳回（条件更新，避免重复审核）
+func ReviewBankTransfer(db *gorm.DB, transfer *models.BankTransfer, adminID uint, approved bool, reason string) error {
+	if transfer.Status != BankTransferPendingReview {
+		return fmt.Errorf("只能审核待审核的转账")
+	}
+	status := BankTransferRejected
+	if approved {
+		status = BankTransferApproved
+		reason = ""
+	}
+	now := utils.GetBeijingTime()
+	result := db.Model(transfer).Where("status = ?", BankTransferPendingReview).Updates(map[string]interface{}{
+		"status":        status,
+		"reject_reason": reason,
+		"reviewed_by":   adminID,
+		"reviewed_at":   now,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("该转账已被审核")
+	}
+	transfer.Status = status
+	transfer.RejectReason = reason
+	transfer.ReviewedBy = &adminID
+	transfer.ReviewedAt = &now
+	return nil
+}
@@ -0,0 +1,48 @@
+package payment
+
+import (
+	"database/sql"
+	"testing"
+
+	"cboard-go/internal/models"
+)
+
+// TestParseBankAccount 测试读取 ConfigJSON 和兼容旧字段
+func TestParseBankAccount(t *testing.T) {
+	account, err := ParseBankAccount(&models.PaymentConfig{
+		ConfigJSON: sql.NullString{String: `{"bank_name":" 招商银行 ","bank_account":"6225880000000000","bank_branch":"深圳分行","account_holder":"张三","instructions":"1 个工作日内审核"}`, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("解析收款信息失败: %v", err)
+	}
+	if account.BankName != "招商银行" || account.BankBranch != "深圳分行" || account.Instructions == "" {
+		t.Errorf("收款信息解析不正确: %+v", account)
+	}
+
+	account, err = ParseBankAccount(&models.PaymentConfig{
+		BankName:      sql.NullString{String: "工商银行", Valid: true},
+		AccountNumber: sql.NullString{String: "6222020000000000", Valid: true},
+		AccountName:   sql.NullString{String: "李四", Valid: true},
+	})
+	if err != nil || account.BankAccount != "6222020000000000" || account.AccountHolder != "李四" {
+		t.Errorf("应兼容 BankName / AccountNumber / AccountName 字段: %+v, %v", account, err)
+	}
+
+	if _, err := ParseBankAccount(&models.PaymentConfig{
+		ConfigJSON: sql.NullString{String: `{"bank_name":"招商银行"}`, Valid: true},
+	}); err == nil {
+		t.Error("收款信息不完整时应返回错误")
+	}
+}
+
+// TestReviewBankTransferStatus 测试只能审核待审核的转账
+func TestReviewBankTransferStatus(t *testing.T) {
+	for _, status := range []string{BankTransferAwaitingReceipt, BankTransferApproved, BankTransferRejected, BankTransferCancelled} {
+		if err := ReviewBankTransfer(nil, &models.BankTransfer{Status: status}, 1, true, ""); err == nil {
+			t.Errorf("状态 %s 不应允许审核", status)
+		}
+	}
+	if err := SubmitBankTransferReceipt(nil, &models.BankTransfer{Status: BankTransferApproved}, "r.png"); err == nil {
+		t.Error("已通过的转账不应允许重新上传回执")
+	}
+}
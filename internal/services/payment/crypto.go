@@ -0,0 +1,519 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 加密货币支付单状态
+const (
+	CryptoStatusPending    = "pending"    // 等待转账
+	CryptoStatusConfirming = "confirming" // 已检测到转账，等待确认数
+	CryptoStatusPaid       = "paid"       // 已确认并入账
+	CryptoStatusExpired    = "expired"    // 超时未支付
+	CryptoStatusLate       = "late"       // 过期后才到账，需管理员人工处理
+	CryptoStatusIgnored    = "ignored"    // 逾期到账经管理员处理，不予入账（如已线下退回）
+)
+
+// cryptoUniqueSlots 同一地址同时待支付的订单最多可区分的金额尾数个数（尾数步长 0.0001 USDT）
+const cryptoUniqueSlots = 9999
+
+// cryptoAmountDecimals 支付单金额统一使用的精度（AmountUnits 的单位为 10^-6 USDT），
+// 与代币精度无关，18 位精度的代币（如 BSC 上的 USDT）换算后也不会超出 int64
+const cryptoAmountDecimals = 6
+
+// cryptoAmountCooldown 支付单过期后其金额继续保留的时间：期间不分配给新支付单，到账的转账交由管理员处理
+const cryptoAmountCooldown = 24 * time.Hour
+
+// cryptoAllocMu 金额分配互斥锁：读取已占用金额到写入新支付单之间不能有其他分配，避免并发下单分到相同金额
+var cryptoAllocMu sync.Mutex
+
+// 默认配置：波场 USDT（TRC20）
+const (
+	defaultTronAPIBase  = "https://api.trongrid.io"
+	defaultTronUSDT     = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+	defaultEVMAPIBase   = "https://api.etherscan.io/api"
+	defaultEVMUSDT      = "0xdAC17F958D2ee523a2206206994597C13D831ec7"
+	defaultCryptoExpire = 30 * time.Minute
+)
+
+// CryptoConfig 加密货币支付配置（PaymentConfig.WalletAddress + ConfigJSON）
+type CryptoConfig struct {
+	Address       string        // 收款地址
+	Chain         string        // tron / evm
+	APIBase       string        // 区块浏览器 API 地址
+	APIKey        string        // 区块浏览器 API Key
+	TokenContract string        // 代币合约地址
+	Decimals      int           // 代币精度
+	Confirmations int           // 入账所需确认数
+	ExchangeRate  float64       // 1 USDT 兑换的人民币
+	Expire        time.Duration // 支付单有效期
+}
+
+// ParseCryptoConfig 解析加密货币支付配置
+// ConfigJSON：chain（tron/evm，默认 tron）、api_base、api_key、token_contract、token_decimals（默认 6）、
+// confirmations（默认波场 19、EVM 12）、exchange_rate（必填，1 USDT 兑换的人民币）、expire_minutes（默认 30）
+func ParseCryptoConfig(paymentConfig *models.PaymentConfig) (*CryptoConfig, error) {
+	cfg := &CryptoConfig{Chain: "tron", Decimals: 6, Expire: defaultCryptoExpire}
+	if paymentConfig.WalletAddress.Valid {
+		cfg.Address = strings.TrimSpace(paymentConfig.WalletAddress.String)
+	}
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("收款钱包地址未配置")
+	}
+
+	configData := map[string]interface{}{}
+	if paymentConfig.ConfigJSON.Valid {
+		_ = json.Unmarshal([]byte(paymentConfig.ConfigJSON.String), &configData)
+	}
+	str := func(key string) string {
+		v, _ := configData[key].(string)
+		return strings.TrimSpace(v)
+	}
+	num := func(key string) float64 {
+		switch v := configData[key].(type) {
+		case float64:
+			return v
+		case string:
+			f, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			return f
+		}
+		return 0
+	}
+
+	if chain := strings.ToLower(str("chain")); chain != "" {
+		cfg.Chain = chain
+	}
+	cfg.APIBase = strings.TrimRight(str("api_base"), "/")
+	cfg.APIKey = str("api_key")
+	cfg.TokenContract = str("token_contract")
+	cfg.Confirmations = int(num("confirmations"))
+	switch cfg.Chain {
+	case "tron":
+		if cfg.APIBase == "" {
+			cfg.APIBase = defaultTronAPIBase
+		}
+		if cfg.TokenContract == "" {
+			cfg.TokenContract = defaultTronUSDT
+		}
+		if cfg.Confirmations <= 0 {
+			cfg.Confirmations = 19
+		}
+	case "evm":
+		if cfg.APIBase == "" {
+			cfg.APIBase = defaultEVMAPIBase
+		}
+		if cfg.TokenContract == "" {
+			cfg.TokenContract = defaultEVMUSDT
+		}
+		if cfg.Confirmations <= 0 {
+			cfg.Confirmations = 12
+		}
+	default:
+		return nil, fmt.Errorf("不支持的链: %s（可选 tron、evm）", cfg.Chain)
+	}
+	if d := int(num("token_decimals")); d > 0 {
+		cfg.Decimals = d
+	}
+	if cfg.Decimals < 4 || cfg.Decimals > 18 {
+		return nil, fmt.Errorf("代币精度无效: %d", cfg.Decimals)
+	}
+	if m := int(num("expire_minutes")); m > 0 {
+		cfg.Expire = time.Duration(m) * time.Minute
+	}
+	cfg.ExchangeRate = num("exchange_rate")
+	if cfg.ExchangeRate <= 0 {
+		return nil, fmt.Errorf("未配置 USDT 汇率 exchange_rate（1 USDT 兑换的人民币）")
+	}
+	return cfg, nil
+}
+
+// baseUnits 根据人民币金额计算付款金额（10^-6 USDT）：按汇率换算后向上取整到 0.01 USDT
+func (c *CryptoConfig) baseUnits(amountCNY float64) int64 {
+	cents := int64(math.Ceil(math.Round(amountCNY/c.ExchangeRate*1e6) / 1e4))
+	return cents * c.unit(2)
+}
+
+// unit 小数点后第 digits 位对应的金额单位数量
+func (c *CryptoConfig) unit(digits int) int64 {
+	return int64(math.Pow10(cryptoAmountDecimals - digits))
+}
+
+// FormatUnits 将金额单位格式化为代币金额（去掉末尾的 0）
+func (c *CryptoConfig) FormatUnits(units int64) string {
+	s := strconv.FormatFloat(float64(units)/math.Pow10(cryptoAmountDecimals), 'f', cryptoAmountDecimals, 64)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// amountUnits 将区块浏览器返回的代币最小单位数量换算为金额单位（10^-6 USDT），
+// 超出 6 位的小数舍去；数值无效或超出 int64 时返回 false
+func (c *CryptoConfig) amountUnits(value string) (int64, bool) {
+	v, ok := new(big.Int).SetString(strings.TrimSpace(value), 10)
+	if !ok || v.Sign() < 0 {
+		return 0, false
+	}
+	if shift := c.Decimals - cryptoAmountDecimals; shift > 0 {
+		v.Quo(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(shift)), nil))
+	} else if shift < 0 {
+		v.Mul(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-shift)), nil))
+	}
+	if !v.IsInt64() {
+		return 0, false
+	}
+	return v.Int64(), true
+}
+
+// CryptoService 加密货币（USDT）支付服务
+type CryptoService struct {
+	db       *gorm.DB
+	configID uint
+	cfg      *CryptoConfig
+}
+
+// NewCryptoService 创建加密货币支付服务
+func NewCryptoService(paymentConfig *models.PaymentConfig) (*CryptoService, error) {
+	cfg, err := ParseCryptoConfig(paymentConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &CryptoService{db: database.GetDB(), configID: paymentConfig.ID, cfg: cfg}, nil
+}
+
+// CreatePayment 为订单分配唯一的付款金额并创建支付单，返回收款地址（用于生成二维码）
+// 付款金额和有效期通过 GetCryptoPayment 查询；同一订单重复发起支付时复用未过期的支付单
+func (s *CryptoService) CreatePayment(order *models.Order, amount float64) (string, error) {
+	if order == nil || order.OrderNo == "" {
+		return "", fmt.Errorf("订单号不能为空")
+	}
+	if amount <= 0 {
+		return "", fmt.Errorf("支付金额必须大于0，当前金额: %.2f", amount)
+	}
+	now := utils.GetBeijingTime()
+
+	cryptoAllocMu.Lock()
+	defer cryptoAllocMu.Unlock()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 多实例部署时锁定支付配置行，使同一收款地址的金额分配跨进程串行（SQLite 不支持行锁，由进程内互斥锁保证）
+		if tx.Dialector.Name() != "sqlite" {
+			var locked models.PaymentConfig
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&locked, s.configID).Error; err != nil {
+				return err
+			}
+		}
+
+		var existing models.CryptoPayment
+		err := tx.Where("order_no = ? AND status = ? AND payment_config_id = ? AND expires_at > ?",
+			order.OrderNo, CryptoStatusPending, s.configID, now).Order("id DESC").First(&existing).Error
+		if err == nil && math.Abs(existing.AmountCNY-amount) < 0.005 {
+			return nil
+		}
+		// 金额变化（如重新计算了优惠）时作废旧的支付单
+		if err := tx.Model(&models.CryptoPayment{}).Where("order_no = ? AND status = ?", order.OrderNo, CryptoStatusPending).
+			Update("status", CryptoStatusExpired).Error; err != nil {
+			return err
+		}
+
+		units, err := s.allocateUnits(tx, s.cfg.baseUnits(amount))
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.CryptoPayment{
+			OrderNo:         order.OrderNo,
+			UserID:          order.UserID,
+			PaymentConfigID: s.configID,
+			Chain:           s.cfg.Chain,
+			Address:         s.cfg.Address,
+			AmountUnits:     units,
+			Amount:          s.cfg.FormatUnits(units),
+			AmountCNY:       amount,
+			ExchangeRate:    s.cfg.ExchangeRate,
+			Status:          CryptoStatusPending,
+			ExpiresAt:       now.Add(s.cfg.Expire),
+		}).Error
+	})
+	if err != nil {
+		return "", fmt.Errorf("创建加密货币支付单失败: %v", err)
+	}
+	return s.cfg.Address, nil
+}
+
+// allocateUnits 在基础金额上增加 0.0001 USDT 步长的尾数，使同一收款地址的未完成支付单金额互不相同
+// 近期过期的支付单金额在冷却期内同样保留，避免用户逾期付款被记到新订单上
+func (s *CryptoService) allocateUnits(tx *gorm.DB, base int64) (int64, error) {
+	var used []int64
+	cooldown := utils.GetBeijingTime().Add(-cryptoAmountCooldown)
+	if err := tx.Model(&models.CryptoPayment{}).
+		Where("address = ? AND amount_units BETWEEN ? AND ?", s.cfg.Address, base, base+cryptoUniqueSlots*s.cfg.unit(4)).
+		Where("status IN ? OR (status IN ? AND expires_at > ?)",
+			[]string{CryptoStatusPending, CryptoStatusConfirming},
+			[]string{CryptoStatusExpired, CryptoStatusLate, CryptoStatusIgnored}, cooldown).
+		Pluck("amount_units", &used).Error; err != nil {
+		return 0, err
+	}
+	return pickUniqueUnits(base, s.cfg.unit(4), used)
+}
+
+// pickUniqueUnits 选择 base + k*step（k 从 1 开始）中第一个未被占用的金额
+func pickUniqueUnits(base, step int64, used []int64) (int64, error) {
+	taken := make(map[int64]bool, len(used))
+	for _, u := range used {
+		taken[u] = true
+	}
+	for k := int64(1); k <= cryptoUniqueSlots; k++ {
+		if units := base + k*step; !taken[units] {
+			return units, nil
+		}
+	}
+	return 0, fmt.Errorf("待支付订单过多，请稍后再试")
+}
+
+// ParseNotify 加密货币支付由链上监听确认，不接受外部回调
+func (s *CryptoService) ParseNotify(req *NotifyRequest) (*Notification, error) {
+	return nil, fmt.Errorf("加密货币支付通过链上确认入账，不接受回调")
+}
+
+// QueryStatus 查询支付单状态（由链上监听任务更新）
+func (s *CryptoService) QueryStatus(orderNo string) (*QueryResult, error) {
+	var payment models.CryptoPayment
+	if err := s.db.Where("order_no = ?", orderNo).Order("id DESC").First(&payment).Error; err != nil {
+		return nil, fmt.Errorf("未找到订单 %s 的加密货币支付单", orderNo)
+	}
+	return &QueryResult{
+		OrderNo: orderNo,
+		TradeNo: payment.TxHash,
+		Amount:  payment.AmountCNY,
+		Status:  payment.Status,
+		Paid:    payment.Status == CryptoStatusPaid,
+	}, nil
+}
+
+// Refund 链上转账无法原路退回，需要管理员手动处理
+func (s *CryptoService) Refund(orderNo, refundNo string, amount float64, reason string) (*RefundResult, error) {
+	return nil, ErrNotSupported
+}
+
+// Close 作废订单未支付的支付单
+func (s *CryptoService) Close(orderNo string) error {
+	return s.db.Model(&models.CryptoPayment{}).Where("order_no = ? AND status = ?", orderNo, CryptoStatusPending).
+		Update("status", CryptoStatusExpired).Error
+}
+
+// GetCryptoPayment 获取订单最新的加密货币支付单
+func GetCryptoPayment(db *gorm.DB, orderNo string) (*models.CryptoPayment, error) {
+	var payment models.CryptoPayment
+	if err := db.Where("order_no = ?", orderNo).Order("id DESC").First(&payment).Error; err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// CryptoCompleteFunc 支付单确认后的入账处理（由订单服务提供，避免 payment 包依赖订单逻辑）
+type CryptoCompleteFunc func(payment *models.CryptoPayment) error
+
+// CryptoLateFunc 过期支付单检测到到账时的处理（通知管理员人工核实）
+type CryptoLateFunc func(payment *models.CryptoPayment)
+
+// PollCryptoPayments 查询所有未完成的加密货币支付单：匹配链上金额一致的转账，达到确认数后调用 complete 入账，
+// 超过有效期仍未检测到转账的支付单标记为过期；冷却期内过期支付单收到的转账标记为逾期到账并调用 late
+func PollCryptoPayments(ctx context.Context, db *gorm.DB, complete CryptoCompleteFunc, late CryptoLateFunc) error {
+	var open []models.CryptoPayment
+	if err := db.Where("status IN ? OR (status = ? AND tx_hash = '' AND expires_at > ?)",
+		[]string{CryptoStatusPending, CryptoStatusConfirming},
+		CryptoStatusExpired, utils.GetBeijingTime().Add(-cryptoAmountCooldown)).
+		Order("id ASC").Find(&open).Error; err != nil {
+		return err
+	}
+	if len(open) == 0 {
+		return nil
+	}
+
+	byConfig := make(map[uint][]*models.CryptoPayment)
+	for i := range open {
+		byConfig[open[i].PaymentConfigID] = append(byConfig[open[i].PaymentConfigID], &open[i])
+	}
+	for configID, payments := range byConfig {
+		var paymentConfig models.PaymentConfig
+		if err := db.First(&paymentConfig, configID).Error; err != nil {
+			utils.LogError("PollCryptoPayments: payment config not found", err, map[string]interface{}{"payment_config_id": configID})
+			continue
+		}
+		cfg, err := ParseCryptoConfig(&paymentConfig)
+		if err != nil {
+			utils.LogError("PollCryptoPayments: invalid crypto config", err, map[string]interface{}{"payment_config_id": configID})
+			continue
+		}
+		client, err := newChainClient(cfg)
+		if err != nil {
+			utils.LogError("PollCryptoPayments: create chain client failed", err, nil)
+			continue
+		}
+		if err := pollConfigPayments(ctx, db, cfg, client, payments, complete, late); err != nil {
+			utils.LogError("PollCryptoPayments: poll failed", err, map[string]interface{}{"payment_config_id": configID})
+		}
+	}
+	return nil
+}
+
+// pollConfigPayments 处理同一支付配置（同一收款地址）下的未完成支付单和冷却期内的过期支付单
+// 先匹配过期支付单，被其认领的转账不会再记到金额相同的其他支付单上
+func pollConfigPayments(ctx context.Context, db *gorm.DB, cfg *CryptoConfig, client ChainClient,
+	payments []*models.CryptoPayment, complete CryptoCompleteFunc, late CryptoLateFunc) error {
+	since := payments[0].CreatedAt
+	for _, p := range payments {
+		if p.CreatedAt.Before(since) {
+			since = p.CreatedAt
+		}
+	}
+	// 预留时钟偏差
+	transfers, err := client.IncomingTransfers(ctx, cfg.Address, since.Add(-5*time.Minute))
+	if err != nil {
+		return err
+	}
+
+	now := utils.GetBeijingTime()
+	claimed := claimedTransfers(db, transfers)
+	for _, p := range payments {
+		if p.Status != CryptoStatusExpired {
+			continue
+		}
+		if transfer := matchTransfer(p, transfers, claimed); transfer != nil {
+			markCryptoLate(db, p, transfer, claimed, late)
+		}
+	}
+
+	for _, p := range payments {
+		if p.Status != CryptoStatusPending && p.Status != CryptoStatusConfirming {
+			continue
+		}
+		transfer := matchTransfer(p, transfers, claimed)
+		if transfer == nil {
+			if p.Status == CryptoStatusPending && now.After(p.ExpiresAt) {
+				db.Model(p).Where("status = ?", CryptoStatusPending).Update("status", CryptoStatusExpired)
+			}
+			continue
+		}
+		// 有效期之后才到账的转账（轮询尚未将支付单标记为过期）同样交由管理员处理
+		if p.TxHash == "" && transfer.Time.After(p.ExpiresAt) {
+			markCryptoLate(db, p, transfer, claimed, late)
+			continue
+		}
+		claimed[transfer.TxHash] = p.ID
+
+		updates := map[string]interface{}{"tx_hash": transfer.TxHash, "confirmations": transfer.Confirmations}
+		if transfer.Confirmations < cfg.Confirmations {
+			updates["status"] = CryptoStatusConfirming
+			db.Model(p).Updates(updates)
+			continue
+		}
+
+		p.TxHash = transfer.TxHash
+		p.Confirmations = transfer.Confirmations
+		if err := complete(p); err != nil {
+			utils.LogError("PollCryptoPayments: complete payment failed", err, map[string]interface{}{
+				"order_no": p.OrderNo,
+				"tx_hash":  transfer.TxHash,
+			})
+			updates["status"] = CryptoStatusConfirming
+			db.Model(p).Updates(updates)
+			continue
+		}
+		updates["status"] = CryptoStatusPaid
+		updates["paid_at"] = now
+		db.Model(p).Updates(updates)
+		utils.LogInfo("加密货币支付已确认: order_no=%s, amount=%s, tx=%s, confirmations=%d",
+			p.OrderNo, p.Amount, transfer.TxHash, transfer.Confirmations)
+	}
+	return nil
+}
+
+// ResolveLateCryptoPayment 管理员处理逾期到账的支付单：credited 为 true 表示已手动入账，否则标记为不予入账
+func ResolveLateCryptoPayment(db *gorm.DB, p *models.CryptoPayment, credited bool) error {
+	updates := map[string]interface{}{"status": CryptoStatusIgnored}
+	if credited {
+		now := utils.GetBeijingTime()
+		updates = map[string]interface{}{"status": CryptoStatusPaid, "paid_at": now}
+		p.PaidAt = &now
+	}
+	result := db.Model(p).Where("status = ?", CryptoStatusLate).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("支付单已被处理")
+	}
+	p.Status = updates["status"].(string)
+	return nil
+}
+
+// markCryptoLate 将收到转账的过期支付单标记为逾期到账并通知管理员
+func markCryptoLate(db *gorm.DB, p *models.CryptoPayment, transfer *ChainTransfer, claimed map[string]uint, late CryptoLateFunc) {
+	if db.Model(p).Where("status = ?", p.Status).Updates(map[string]interface{}{
+		"status":        CryptoStatusLate,
+		"tx_hash":       transfer.TxHash,
+		"confirmations": transfer.Confirmations,
+	}).RowsAffected == 0 {
+		return
+	}
+	claimed[transfer.TxHash] = p.ID
+	p.Status = CryptoStatusLate
+	p.TxHash = transfer.TxHash
+	p.Confirmations = transfer.Confirmations
+	utils.LogWarn("加密货币支付单过期后到账，需人工处理: order_no=%s, amount=%s, tx=%s", p.OrderNo, p.Amount, transfer.TxHash)
+	if late != nil {
+		late(p)
+	}
+}
+
+// claimedTransfers 查询已被支付单认领的转账（交易哈希 -> 支付单 ID），同一笔转账只能用于一个支付单
+func claimedTransfers(db *gorm.DB, transfers []ChainTransfer) map[string]uint {
+	claimed := make(map[string]uint)
+	if len(transfers) == 0 {
+		return claimed
+	}
+	hashes := make([]string, 0, len(transfers))
+	for _, t := range transfers {
+		hashes = append(hashes, t.TxHash)
+	}
+	var rows []models.CryptoPayment
+	db.Select("id", "tx_hash").Where("tx_hash IN ?", hashes).Find(&rows)
+	for _, row := range rows {
+		claimed[row.TxHash] = row.ID
+	}
+	return claimed
+}
+
+// matchTransfer 查找金额与支付单完全一致、在支付单创建后（允许 5 分钟时钟偏差）到账且未被其他支付单认领的转账
+// 已检测到转账的支付单只跟踪同一笔交易的确认数
+func matchTransfer(p *models.CryptoPayment, transfers []ChainTransfer, claimed map[string]uint) *ChainTransfer {
+	for i := range transfers {
+		t := &transfers[i]
+		if p.TxHash != "" {
+			if t.TxHash == p.TxHash {
+				return t
+			}
+			continue
+		}
+		if owner, ok := claimed[t.TxHash]; ok && owner != p.ID {
+			continue
+		}
+		if t.Amount == p.AmountUnits && !t.Time.Before(p.CreatedAt.Add(-5*time.Minute)) {
+			return t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cboard-go/internal/utils"
+)
+
+// ChainTransfer 链上的一笔代币转入记录
+type ChainTransfer struct {
+	TxHash        string
+	From          string
+	To            string
+	Amount        int64 // 金额（10^-6 USDT，已按代币精度换算）
+	Confirmations int
+	Time          time.Time
+}
+
+// ChainClient 区块浏览器客户端：查询收款地址收到的代币转账
+type ChainClient interface {
+	// IncomingTransfers 查询 address 在 since 之后收到的代币（token_contract）转账
+	IncomingTransfers(ctx context.Context, address string, since time.Time) ([]ChainTransfer, error)
+}
+
+// ChainFactory 根据加密货币支付配置创建区块浏览器客户端
+type ChainFactory func(cfg *CryptoConfig) ChainClient
+
+var (
+	chainMu        sync.RWMutex
+	chainFactories = make(map[string]ChainFactory)
+)
+
+// RegisterChain 注册区块浏览器客户端，key 为配置中的 chain
+func RegisterChain(chain string, factory ChainFactory) {
+	chainMu.Lock()
+	defer chainMu.Unlock()
+	chainFactories[strings.ToLower(chain)] = factory
+}
+
+// newChainClient 创建配置对应的区块浏览器客户端
+func newChainClient(cfg *CryptoConfig) (ChainClient, error) {
+	chainMu.RLock()
+	factory, ok := chainFactories[cfg.Chain]
+	chainMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("不支持的链: %s", cfg.Chain)
+	}
+	return factory(cfg), nil
+}
+
+func init() {
+	RegisterChain("tron", func(cfg *CryptoConfig) ChainClient { return &tronGridClient{cfg: cfg} })
+	RegisterChain("evm", func(cfg *CryptoConfig) ChainClient { return &evmExplorerClient{cfg: cfg} })
+}
+
+// explorerPageSize 区块浏览器每页返回的转账数
+const explorerPageSize = 200
+
+// explorerMaxPages 单次轮询最多翻页数（Etherscan 限制 page × offset 不超过 10000）
+const explorerMaxPages = 50
+
+// explorerHTTPClient 区块浏览器请求使用的 HTTP 客户端
+var explorerHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// getJSON 请求区块浏览器并解析 JSON 响应
+func getJSON(ctx context.Context, rawURL string, header http.Header, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := explorerHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求区块浏览器失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("区块浏览器返回错误状态: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// tronGridClient TronGrid 兼容 API（/v1/accounts/{address}/transactions/trc20）
+// 只查询已固化（only_confirmed）的转账，并通过固化节点的交易回执确认执行成功，
+// 确认数按当前区块高度与交易所在区块计算
+type tronGridClient struct {
+	cfg *CryptoConfig
+}
+
+// tronTxInfo 固化节点返回的交易回执（已固化的交易不会再变化，可以缓存）
+type tronTxInfo struct {
+	ID          string `json:"id"`
+	BlockNumber int64  `json:"blockNumber"`
+	Receipt     struct {
+		Result string `json:"result"`
+	} `json:"receipt"`
+}
+
+var (
+	tronTxInfoMu    sync.Mutex
+	tronTxInfoCache = make(map[string]tronTxInfo)
+)
+
+// tronTxInfoCacheLimit 回执缓存上限，超过后清空（轮询只查询未过期支付单时间窗口内的转账）
+const tronTxInfoCacheLimit = 10000
+
+func (c *tronGridClient) header() http.Header {
+	header := http.Header{}
+	if c.cfg.APIKey != "" {
+		header.Set("TRON-PRO-API-KEY", c.cfg.APIKey)
+	}
+	return header
+}
+
+// nowBlock 当前区块高度
+func (c *tronGridClient) nowBlock(ctx context.Context) (int64, error) {
+	var block struct {
+		BlockHeader struct {
+			RawData struct {
+				Number int64 `json:"number"`
+			} `json:"raw_data"`
+		} `json:"block_header"`
+	}
+	if err := getJSON(ctx, c.cfg.APIBase+"/wallet/getnowblock", c.header(), &block); err != nil {
+		return 0, err
+	}
+	if block.BlockHeader.RawData.Number <= 0 {
+		return 0, fmt.Errorf("TronGrid 未返回区块高度")
+	}
+	return block.BlockHeader.RawData.Number, nil
+}
+
+// txInfo 从固化节点查询交易回执，交易尚未固化时返回 ok=false
+func (c *tronGridClient) txInfo(ctx context.Context, txID string) (tronTxInfo, bool, error) {
+	tronTxInfoMu.Lock()
+	info, cached := tronTxInfoCache[txID]
+	tronTxInfoMu.Unlock()
+	if cached {
+		return info, true, nil
+	}
+
+	rawURL := fmt.Sprintf("%s/walletsolidity/gettransactioninfobyid?value=%s", c.cfg.APIBase, url.QueryEscape(txID))
+	if err := getJSON(ctx, rawURL, c.header(), &info); err != nil {
+		return info, false, err
+	}
+	if info.ID == "" || info.BlockNumber <= 0 {
+		return info, false, nil
+	}
+	tronTxInfoMu.Lock()
+	if len(tronTxInfoCache) >= tronTxInfoCacheLimit {
+		tronTxInfoCache = make(map[string]tronTxInfo)
+	}
+	tronTxInfoCache[txID] = info
+	tronTxInfoMu.Unlock()
+	return info, true, nil
+}
+
+// tronTransfer TronGrid 返回的 TRC20 转账记录
+type tronTransfer struct {
+	TransactionID  string `json:"transaction_id"`
+	BlockTimestamp int64  `json:"block_timestamp"`
+	From           string `json:"from"`
+	To             string `json:"to"`
+	Type           string `json:"type"`
+	Value          string `json:"value"`
+}
+
+// IncomingTransfers 按 fingerprint 翻页，直到取完 since 之后的全部转账
+func (c *tronGridClient) IncomingTransfers(ctx context.Context, address string, since time.Time) ([]ChainTransfer, error) {
+	query := url.Values{}
+	query.Set("only_to", "true")
+	query.Set("only_confirmed", "true")
+	query.Set("limit", strconv.Itoa(explorerPageSize))
+	query.Set("contract_address", c.cfg.TokenContract)
+	query.Set("min_timestamp", strconv.FormatInt(since.UnixMilli(), 10))
+
+	var items []tronTransfer
+	for page := 1; ; page++ {
+		var result struct {
+			Success bool           `json:"success"`
+			Data    []tronTransfer `json:"data"`
+			Meta    struct {
+				Fingerprint string `json:"fingerprint"`
+			} `json:"meta"`
+		}
+		rawURL := fmt.Sprintf("%s/v1/accounts/%s/transactions/trc20?%s", c.cfg.APIBase, url.PathEscape(address), query.Encode())
+		if err := getJSON(ctx, rawURL, c.header(), &result); err != nil {
+			return nil, err
+		}
+		if !result.Success {
+			return nil, fmt.Errorf("TronGrid 查询失败")
+		}
+		items = append(items, result.Data...)
+		if result.Meta.Fingerprint == "" || len(result.Data) == 0 {
+			break
+		}
+		if page >= explorerMaxPages {
+			utils.LogWarn("TronGrid 转账记录超过 %d 页，更早的转账本次未查询: address=%s", explorerMaxPages, address)
+			break
+		}
+		query.Set("fingerprint", result.Meta.Fingerprint)
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	head, err := c.nowBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transfers := make([]ChainTransfer, 0, len(items))
+	for _, item := range items {
+		if item.Type != "" && item.Type != "Transfer" {
+			continue
+		}
+		amount, ok := c.cfg.amountUnits(item.Value)
+		if !ok {
+			continue
+		}
+		info, ok, err := c.txInfo(ctx, item.TransactionID)
+		if err != nil {
+			return nil, err
+		}
+		// 未固化或执行失败（合约回滚、能量不足）的交易不计入
+		if !ok || info.Receipt.Result != "SUCCESS" {
+			continue
+		}
+		confirmations := int(head - info.BlockNumber + 1)
+		if confirmations < 0 {
+			confirmations = 0
+		}
+		transfers = append(transfers, ChainTransfer{
+			TxHash:        item.TransactionID,
+			From:          item.From,
+			To:            item.To,
+			Amount:        amount,
+			Confirmations: confirmations,
+			Time:          time.UnixMilli(item.BlockTimestamp),
+		})
+	}
+	return transfers, nil
+}
+
+// evmExplorerClient Etherscan 兼容 API（module=account&action=tokentx），适用于 Etherscan / BscScan / PolygonScan 等
+type evmExplorerClient struct {
+	cfg *CryptoConfig
+}
+
+// evmTransfer Etherscan 兼容 API 返回的代币转账记录
+type evmTransfer struct {
+	Hash          string `json:"hash"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Value         string `json:"value"`
+	TimeStamp     string `json:"timeStamp"`
+	Confirmations string `json:"confirmations"`
+}
+
+// IncomingTransfers 按时间倒序逐页查询，直到某页不满或已早于 since
+func (c *evmExplorerClient) IncomingTransfers(ctx context.Context, address string, since time.Time) ([]ChainTransfer, error) {
+	query := url.Values{}
+	query.Set("module", "account")
+	query.Set("action", "tokentx")
+	query.Set("contractaddress", c.cfg.TokenContract)
+	query.Set("address", address)
+	query.Set("offset", strconv.Itoa(explorerPageSize))
+	query.Set("sort", "desc")
+	if c.cfg.APIKey != "" {
+		query.Set("apikey", c.cfg.APIKey)
+	}
+
+	var transfers []ChainTransfer
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		items, err := c.fetchPage(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		reachedSince := false
+		for _, item := range items {
+			ts, _ := strconv.ParseInt(item.TimeStamp, 10, 64)
+			blockTime := time.Unix(ts, 0)
+			if blockTime.Before(since) {
+				reachedSince = true
+				continue
+			}
+			if transfer, ok := c.toTransfer(item, address, blockTime); ok {
+				transfers = append(transfers, transfer)
+			}
+		}
+		if reachedSince || len(items) < explorerPageSize {
+			break
+		}
+		if page >= explorerMaxPages {
+			utils.LogWarn("区块浏览器转账记录超过 %d 页，更早的转账本次未查询: address=%s", explorerMaxPages, address)
+			break
+		}
+	}
+	return transfers, nil
+}
+
+// fetchPage 查询一页代币转账，没有更多交易时返回空列表
+func (c *evmExplorerClient) fetchPage(ctx context.Context, query url.Values) ([]evmTransfer, error) {
+	var result struct {
+		Status  string          `json:"status"`
+		Message string          `json:"message"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if err := getJSON(ctx, c.cfg.APIBase+"?"+query.Encode(), nil, &result); err != nil {
+		return nil, err
+	}
+	if result.Status != "1" {
+		// 没有交易时 status 为 0，result 为空数组
+		if strings.Contains(strings.ToLower(result.Message), "no transactions") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("区块浏览器查询失败: %s", result.Message)
+	}
+	var items []evmTransfer
+	if err := json.Unmarshal(result.Result, &items); err != nil {
+		return nil, fmt.Errorf("解析区块浏览器响应失败: %v", err)
+	}
+	return items, nil
+}
+
+// toTransfer 转换转入收款地址的转账记录
+func (c *evmExplorerClient) toTransfer(item evmTransfer, address string, blockTime time.Time) (ChainTransfer, bool) {
+	if !strings.EqualFold(item.To, address) {
+		return ChainTransfer{}, false
+	}
+	amount, ok := c.cfg.amountUnits(item.Value)
+	if !ok {
+		return ChainTransfer{}, false
+	}
+	confirmations, _ := strconv.Atoi(item.Confirmations)
+	return ChainTransfer{
+		TxHash:        item.Hash,
+		From:          item.From,
+		To:            item.To,
+		Amount:        amount,
+		Confirmations: confirmations,
+		Time:          blockTime,
+	}, true
+}
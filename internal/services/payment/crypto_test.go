@@ -0,0 +1,483 @@
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestCryptoConfig 创建指向本地模拟区块浏览器的配置
+func newTestCryptoConfig(t *testing.T, configJSON string) *CryptoConfig {
+	t.Helper()
+	cfg, err := ParseCryptoConfig(&models.PaymentConfig{
+		PayType:       "crypto",
+		WalletAddress: sql.NullString{String: "TAddr", Valid: true},
+		ConfigJSON:    sql.NullString{String: configJSON, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("解析配置失败: %v", err)
+	}
+	return cfg
+}
+
+// TestParseCryptoConfig 测试默认值和必填项
+func TestParseCryptoConfig(t *testing.T) {
+	cfg := newTestCryptoConfig(t, `{"exchange_rate":"7.2"}`)
+	if cfg.Chain != "tron" || cfg.APIBase != defaultTronAPIBase || cfg.TokenContract != defaultTronUSDT ||
+		cfg.Decimals != 6 || cfg.Confirmations != 19 || cfg.Expire != defaultCryptoExpire {
+		t.Errorf("默认配置不正确: %+v", cfg)
+	}
+	cfg = newTestCryptoConfig(t, `{"chain":"EVM","exchange_rate":7,"confirmations":3,"token_decimals":18}`)
+	if cfg.Chain != "evm" || cfg.Confirmations != 3 || cfg.Decimals != 18 || cfg.APIBase != defaultEVMAPIBase {
+		t.Errorf("EVM 配置不正确: %+v", cfg)
+	}
+
+	if _, err := ParseCryptoConfig(&models.PaymentConfig{
+		WalletAddress: sql.NullString{String: "TAddr", Valid: true},
+	}); err == nil {
+		t.Error("未配置汇率时应返回错误")
+	}
+	if _, err := ParseCryptoConfig(&models.PaymentConfig{
+		ConfigJSON: sql.NullString{String: `{"exchange_rate":7}`, Valid: true},
+	}); err == nil {
+		t.Error("未配置收款地址时应返回错误")
+	}
+}
+
+// TestCryptoAmountAllocation 测试金额换算和唯一尾数分配
+func TestCryptoAmountAllocation(t *testing.T) {
+	cfg := newTestCryptoConfig(t, `{"exchange_rate":7.2}`)
+	// 100 元 / 7.2 = 13.888... USDT，向上取整到 13.89
+	base := cfg.baseUnits(100)
+	if base != 13890000 {
+		t.Fatalf("基础金额应为 13890000，实际 %d", base)
+	}
+	if got := cfg.baseUnits(72); got != 10000000 {
+		t.Errorf("整除时不应多收，期望 10000000，实际 %d", got)
+	}
+
+	step := cfg.unit(4)
+	units, err := pickUniqueUnits(base, step, nil)
+	if err != nil || units != 13890100 {
+		t.Errorf("第一个支付单应为 13.8901，实际 %d, %v", units, err)
+	}
+	units, _ = pickUniqueUnits(base, step, []int64{13890100, 13890200, 13890400})
+	if units != 13890300 {
+		t.Errorf("应跳过已占用的金额，实际 %d", units)
+	}
+	if got := cfg.FormatUnits(units); got != "13.8903" {
+		t.Errorf("金额格式化不正确: %s", got)
+	}
+}
+
+// TestCryptoEighteenDecimals 测试 18 位精度代币（如 BSC 上的 USDT）从下单到链上确认入账的完整流程
+func TestCryptoEighteenDecimals(t *testing.T) {
+	db := newCryptoTestDB(t)
+	now := utils.GetBeijingTime()
+	var txTime time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts := fmt.Sprint(txTime.Unix())
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "1", "message": "OK",
+			"result": []map[string]string{
+				{"hash": "0xshort", "from": "0xf", "to": "TAddr", "value": "13890099999999999999", "timeStamp": ts, "confirmations": "20"},
+				{"hash": "0xpaid", "from": "0xf", "to": "TAddr", "value": "13890100000000000000", "timeStamp": ts, "confirmations": "20"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	cfg := newTestCryptoConfig(t, fmt.Sprintf(`{"chain":"evm","exchange_rate":7.2,"token_decimals":18,"confirmations":12,"api_base":%q}`, server.URL))
+	s := &CryptoService{db: db, cfg: cfg}
+	if _, err := s.CreatePayment(&models.Order{OrderNo: "BSC1", UserID: 1}, 100); err != nil {
+		t.Fatalf("创建支付单失败: %v", err)
+	}
+	p, err := GetCryptoPayment(db, "BSC1")
+	if err != nil {
+		t.Fatalf("查询支付单失败: %v", err)
+	}
+	if p.AmountUnits != 13890100 || p.Amount != "13.8901" {
+		t.Fatalf("18 位精度下付款金额错误: %d %s", p.AmountUnits, p.Amount)
+	}
+
+	txTime = now
+	client, _ := newChainClient(cfg)
+	var completed []string
+	complete := func(p *models.CryptoPayment) error {
+		completed = append(completed, p.TxHash)
+		return nil
+	}
+	if err := pollConfigPayments(context.Background(), db, cfg, client, []*models.CryptoPayment{p}, complete, nil); err != nil {
+		t.Fatalf("轮询失败: %v", err)
+	}
+	if len(completed) != 1 || completed[0] != "0xpaid" {
+		t.Errorf("应匹配金额完全一致的 18 位精度转账: %v", completed)
+	}
+
+	if _, ok := cfg.amountUnits("1000000000000000000000000000000000000000"); ok {
+		t.Error("超出范围的金额应被忽略")
+	}
+	if _, ok := cfg.amountUnits("-1"); ok {
+		t.Error("负数金额应被忽略")
+	}
+}
+
+// TestMatchTransfer 测试按金额和交易哈希匹配转账
+func TestMatchTransfer(t *testing.T) {
+	created := time.Now().Add(-10 * time.Minute)
+	transfers := []ChainTransfer{
+		{TxHash: "old", Amount: 13890100, Time: created.Add(-time.Hour)},
+		{TxHash: "other", Amount: 13890200, Time: created.Add(time.Minute)},
+		{TxHash: "tx1", Amount: 13890100, Time: created.Add(time.Minute), Confirmations: 5},
+	}
+
+	p := &models.CryptoPayment{AmountUnits: 13890100, CreatedAt: created}
+	if got := matchTransfer(p, transfers, nil); got == nil || got.TxHash != "tx1" {
+		t.Errorf("应匹配下单后金额一致的转账，实际 %+v", got)
+	}
+	p.TxHash = "other"
+	if got := matchTransfer(p, transfers, nil); got == nil || got.TxHash != "other" {
+		t.Errorf("已检测到转账后应按交易哈希跟踪，实际 %+v", got)
+	}
+	p = &models.CryptoPayment{AmountUnits: 13890300, CreatedAt: created}
+	if got := matchTransfer(p, transfers, nil); got != nil {
+		t.Errorf("金额不一致时不应匹配，实际 %+v", got)
+	}
+
+	// 金额相同的转账已被其他支付单认领时，继续匹配下一笔
+	transfers = append(transfers, ChainTransfer{TxHash: "tx2", Amount: 13890100, Time: created.Add(2 * time.Minute)})
+	p = &models.CryptoPayment{ID: 2, AmountUnits: 13890100, CreatedAt: created}
+	if got := matchTransfer(p, transfers, map[string]uint{"tx1": 1}); got == nil || got.TxHash != "tx2" {
+		t.Errorf("应跳过已被认领的转账，实际 %+v", got)
+	}
+	if got := matchTransfer(p, transfers, map[string]uint{"tx1": 2}); got == nil || got.TxHash != "tx1" {
+		t.Errorf("支付单自己认领的转账应继续匹配，实际 %+v", got)
+	}
+}
+
+// fakeChainClient 返回固定转账列表的区块浏览器客户端
+type fakeChainClient []ChainTransfer
+
+func (f fakeChainClient) IncomingTransfers(ctx context.Context, address string, since time.Time) ([]ChainTransfer, error) {
+	return f, nil
+}
+
+// newCryptoTestDB 创建内存数据库
+func newCryptoTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.CryptoPayment{}); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	return db
+}
+
+// TestAllocateUnitsCooldown 测试近期过期的支付单金额在冷却期内不会分配给新支付单
+func TestAllocateUnitsCooldown(t *testing.T) {
+	db := newCryptoTestDB(t)
+	cfg := newTestCryptoConfig(t, `{"exchange_rate":7.2}`)
+	now := utils.GetBeijingTime()
+	db.Create(&models.CryptoPayment{OrderNo: "A", Address: "TAddr", AmountUnits: 13890100, Status: CryptoStatusExpired, ExpiresAt: now.Add(-time.Hour)})
+	db.Create(&models.CryptoPayment{OrderNo: "B", Address: "TAddr", AmountUnits: 13890200, Status: CryptoStatusLate, ExpiresAt: now.Add(-time.Hour)})
+	db.Create(&models.CryptoPayment{OrderNo: "C", Address: "TAddr", AmountUnits: 13890300, Status: CryptoStatusExpired, ExpiresAt: now.Add(-cryptoAmountCooldown - time.Hour)})
+	db.Create(&models.CryptoPayment{OrderNo: "D", Address: "TOther", AmountUnits: 13890300, Status: CryptoStatusPending, ExpiresAt: now.Add(time.Hour)})
+
+	s := &CryptoService{db: db, cfg: cfg}
+	units, err := s.allocateUnits(db, cfg.baseUnits(100))
+	if err != nil || units != 13890300 {
+		t.Errorf("应跳过冷却期内的过期金额并复用冷却期外的金额，实际 %d, %v", units, err)
+	}
+}
+
+// TestPollLateTransfer 测试过期支付单收到转账时标记为逾期到账，而不是记到金额相同的新支付单上
+func TestPollLateTransfer(t *testing.T) {
+	db := newCryptoTestDB(t)
+	cfg := newTestCryptoConfig(t, `{"exchange_rate":7.2,"confirmations":1}`)
+	now := utils.GetBeijingTime()
+	expired := models.CryptoPayment{OrderNo: "OLD", Address: "TAddr", AmountUnits: 13890100, AmountCNY: 100,
+		Status: CryptoStatusExpired, ExpiresAt: now.Add(-30 * time.Minute), CreatedAt: now.Add(-time.Hour)}
+	pending := models.CryptoPayment{OrderNo: "NEW", Address: "TAddr", AmountUnits: 13890100, AmountCNY: 100,
+		Status: CryptoStatusPending, ExpiresAt: now.Add(time.Hour), CreatedAt: now.Add(-10 * time.Minute)}
+	db.Create(&expired)
+	db.Create(&pending)
+
+	client := fakeChainClient{{TxHash: "tx1", Amount: 13890100, Confirmations: 5, Time: now.Add(-2 * time.Minute)}}
+	var completed, late []string
+	complete := func(p *models.CryptoPayment) error {
+		completed = append(completed, p.OrderNo)
+		return nil
+	}
+	notify := func(p *models.CryptoPayment) { late = append(late, p.OrderNo) }
+	if err := pollConfigPayments(context.Background(), db, cfg, client,
+		[]*models.CryptoPayment{&expired, &pending}, complete, notify); err != nil {
+		t.Fatalf("轮询失败: %v", err)
+	}
+	if len(completed) != 0 {
+		t.Errorf("转账不应记到新支付单上: %v", completed)
+	}
+	if len(late) != 1 || late[0] != "OLD" {
+		t.Errorf("应通知管理员处理过期支付单的到账: %v", late)
+	}
+	var got models.CryptoPayment
+	db.First(&got, expired.ID)
+	if got.Status != CryptoStatusLate || got.TxHash != "tx1" {
+		t.Errorf("过期支付单应标记为逾期到账: %+v", got)
+	}
+	got = models.CryptoPayment{}
+	db.First(&got, pending.ID)
+	if got.Status != CryptoStatusPending || got.TxHash != "" {
+		t.Errorf("新支付单应保持待支付: %+v", got)
+	}
+
+	// 再次轮询不应重复通知
+	if err := pollConfigPayments(context.Background(), db, cfg, client,
+		[]*models.CryptoPayment{&pending}, complete, notify); err != nil {
+		t.Fatalf("轮询失败: %v", err)
+	}
+	if len(completed) != 0 || len(late) != 1 {
+		t.Errorf("已被认领的转账不应再次匹配: completed=%v late=%v", completed, late)
+	}
+
+	if err := ResolveLateCryptoPayment(db, &expired, true); err != nil || expired.Status != CryptoStatusPaid {
+		t.Errorf("管理员入账后应标记为已支付: %+v, %v", expired, err)
+	}
+	if err := ResolveLateCryptoPayment(db, &expired, false); err == nil {
+		t.Error("重复处理应返回错误")
+	}
+}
+
+// TestPollSameAmountPayments 测试金额相同的两个支付单各自匹配一笔转账，有效期之后到账的转账交由管理员处理
+func TestPollSameAmountPayments(t *testing.T) {
+	db := newCryptoTestDB(t)
+	cfg := newTestCryptoConfig(t, `{"exchange_rate":7.2,"confirmations":1}`)
+	now := utils.GetBeijingTime()
+	first := models.CryptoPayment{OrderNo: "A", Address: "TAddr", AmountUnits: 13890100, AmountCNY: 100,
+		Status: CryptoStatusPending, ExpiresAt: now.Add(time.Hour), CreatedAt: now.Add(-10 * time.Minute)}
+	second := models.CryptoPayment{OrderNo: "B", Address: "TAddr", AmountUnits: 13890100, AmountCNY: 100,
+		Status: CryptoStatusPending, ExpiresAt: now.Add(time.Hour), CreatedAt: now.Add(-10 * time.Minute)}
+	// 有效期已过但尚未被标记为过期的支付单
+	overdue := models.CryptoPayment{OrderNo: "C", Address: "TAddr", AmountUnits: 13890200, AmountCNY: 100,
+		Status: CryptoStatusPending, ExpiresAt: now.Add(-5 * time.Minute), CreatedAt: now.Add(-35 * time.Minute)}
+	db.Create(&first)
+	db.Create(&second)
+	db.Create(&overdue)
+
+	client := fakeChainClient{
+		{TxHash: "tx1", Amount: 13890100, Confirmations: 5, Time: now.Add(-2 * time.Minute)},
+		{TxHash: "tx2", Amount: 13890100, Confirmations: 5, Time: now.Add(-time.Minute)},
+		{TxHash: "tx3", Amount: 13890200, Confirmations: 5, Time: now.Add(-time.Minute)},
+	}
+	completed := map[string]string{}
+	complete := func(p *models.CryptoPayment) error {
+		completed[p.OrderNo] = p.TxHash
+		return nil
+	}
+	var late []string
+	notify := func(p *models.CryptoPayment) { late = append(late, p.OrderNo) }
+	if err := pollConfigPayments(context.Background(), db, cfg, client,
+		[]*models.CryptoPayment{&first, &second, &overdue}, complete, notify); err != nil {
+		t.Fatalf("轮询失败: %v", err)
+	}
+	if len(completed) != 2 || completed["A"] != "tx1" || completed["B"] != "tx2" {
+		t.Errorf("金额相同的支付单应各自匹配一笔转账: %v", completed)
+	}
+	if len(late) != 1 || late[0] != "C" {
+		t.Errorf("有效期之后到账的转账应交由管理员处理: %v", late)
+	}
+	var got models.CryptoPayment
+	db.First(&got, overdue.ID)
+	if got.Status != CryptoStatusLate || got.TxHash != "tx3" {
+		t.Errorf("支付单应标记为逾期到账: %+v", got)
+	}
+}
+
+// TestTronGridClient 测试 TronGrid 兼容接口的解析：只查询已固化转账，按区块高度计算确认数，跳过执行失败的交易
+func TestTronGridClient(t *testing.T) {
+	blockTime := time.Now().Add(-time.Minute)
+	infos := map[string]map[string]interface{}{
+		"tx1": {"id": "tx1", "blockNumber": 1000, "receipt": map[string]string{"result": "SUCCESS"}},
+		"tx3": {"id": "tx3", "blockNumber": 1001, "receipt": map[string]string{"result": "REVERT"}},
+		"tx4": {}, // 尚未固化
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("TRON-PRO-API-KEY") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/accounts/TAddr/transactions/trc20":
+			if r.URL.Query().Get("only_to") != "true" || r.URL.Query().Get("only_confirmed") != "true" {
+				http.NotFound(w, r)
+				return
+			}
+			item := func(id, typ, value string) map[string]interface{} {
+				return map[string]interface{}{"transaction_id": id, "block_timestamp": blockTime.UnixMilli(), "from": "TFrom", "to": "TAddr", "type": typ, "value": value}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": true,
+				"data": []map[string]interface{}{
+					item("tx1", "Transfer", "13890100"),
+					item("tx2", "Approval", "1"),
+					item("tx3", "Transfer", "13890200"),
+					item("tx4", "Transfer", "13890300"),
+				},
+			})
+		case "/wallet/getnowblock":
+			json.NewEncoder(w).Encode(map[string]interface{}{"block_header": map[string]interface{}{"raw_data": map[string]interface{}{"number": 1019}}})
+		case "/walletsolidity/gettransactioninfobyid":
+			json.NewEncoder(w).Encode(infos[r.URL.Query().Get("value")])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestCryptoConfig(t, fmt.Sprintf(`{"exchange_rate":7.2,"api_base":%q,"api_key":"key"}`, server.URL))
+	client, err := newChainClient(cfg)
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	transfers, err := client.IncomingTransfers(context.Background(), "TAddr", blockTime.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("查询转账失败: %v", err)
+	}
+	if len(transfers) != 1 || transfers[0].TxHash != "tx1" || transfers[0].Amount != 13890100 {
+		t.Fatalf("应只保留已固化且执行成功的转账: %+v", transfers)
+	}
+	if c := transfers[0].Confirmations; c != 20 {
+		t.Errorf("区块 1000 在高度 1019 时应有 20 个确认，实际 %d", c)
+	}
+}
+
+// TestEVMExplorerClient 测试 Etherscan 兼容接口的解析
+func TestEVMExplorerClient(t *testing.T) {
+	now := time.Now()
+	empty := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("action") != "tokentx" {
+			http.NotFound(w, r)
+			return
+		}
+		if empty {
+			fmt.Fprint(w, `{"status":"0","message":"No transactions found","result":[]}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "1", "message": "OK",
+			"result": []map[string]string{
+				{"hash": "0x1", "from": "0xf", "to": "0xABC", "value": "5000000", "timeStamp": fmt.Sprint(now.Unix()), "confirmations": "15"},
+				{"hash": "0x2", "from": "0xABC", "to": "0xf", "value": "5000000", "timeStamp": fmt.Sprint(now.Unix()), "confirmations": "15"},
+				{"hash": "0x3", "from": "0xf", "to": "0xabc", "value": "5000000", "timeStamp": fmt.Sprint(now.Add(-2 * time.Hour).Unix()), "confirmations": "900"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	cfg := newTestCryptoConfig(t, fmt.Sprintf(`{"chain":"evm","exchange_rate":7.2,"api_base":%q}`, server.URL))
+	client, _ := newChainClient(cfg)
+	transfers, err := client.IncomingTransfers(context.Background(), "0xabc", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("查询转账失败: %v", err)
+	}
+	if len(transfers) != 1 || transfers[0].TxHash != "0x1" || transfers[0].Confirmations != 15 {
+		t.Errorf("应只返回时间范围内转入收款地址的转账: %+v", transfers)
+	}
+
+	empty = true
+	transfers, err = client.IncomingTransfers(context.Background(), "0xabc", now.Add(-time.Hour))
+	if err != nil || len(transfers) != 0 {
+		t.Errorf("没有交易时应返回空结果: %+v, %v", transfers, err)
+	}
+}
+
+// TestTronGridPagination 测试 TronGrid 按 fingerprint 翻页取完时间窗口内的转账
+func TestTronGridPagination(t *testing.T) {
+	blockTime := time.Now().Add(-time.Minute)
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/accounts/TAddr/transactions/trc20":
+			fingerprint := r.URL.Query().Get("fingerprint")
+			pages = append(pages, fingerprint)
+			item := func(id string) map[string]interface{} {
+				return map[string]interface{}{"transaction_id": id, "block_timestamp": blockTime.UnixMilli(), "to": "TAddr", "type": "Transfer", "value": "1000000"}
+			}
+			resp := map[string]interface{}{"success": true, "data": []map[string]interface{}{item("tx" + fingerprint)}}
+			if fingerprint == "" {
+				resp["meta"] = map[string]string{"fingerprint": "p2"}
+			}
+			json.NewEncoder(w).Encode(resp)
+		case "/wallet/getnowblock":
+			json.NewEncoder(w).Encode(map[string]interface{}{"block_header": map[string]interface{}{"raw_data": map[string]interface{}{"number": 1019}}})
+		case "/walletsolidity/gettransactioninfobyid":
+			id := r.URL.Query().Get("value")
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "blockNumber": 1000, "receipt": map[string]string{"result": "SUCCESS"}})
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestCryptoConfig(t, fmt.Sprintf(`{"exchange_rate":7.2,"api_base":%q}`, server.URL))
+	client, _ := newChainClient(cfg)
+	transfers, err := client.IncomingTransfers(context.Background(), "TAddr", blockTime.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("查询转账失败: %v", err)
+	}
+	if len(pages) != 2 || pages[1] != "p2" {
+		t.Errorf("应按 fingerprint 请求下一页: %v", pages)
+	}
+	if len(transfers) != 2 || transfers[1].TxHash != "txp2" {
+		t.Errorf("应返回所有页的转账: %+v", transfers)
+	}
+}
+
+// TestEVMExplorerPagination 测试 Etherscan 兼容接口逐页查询，直到转账早于时间窗口
+func TestEVMExplorerPagination(t *testing.T) {
+	now := time.Now()
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		pages = append(pages, page)
+		// 第 1、2 页各为一整页窗口内的转账，第 3 页开始早于时间窗口
+		var result []map[string]string
+		for i := 0; i < explorerPageSize; i++ {
+			ts := now.Add(-time.Minute)
+			if page == "3" && i > 0 {
+				ts = now.Add(-2 * time.Hour)
+			}
+			result = append(result, map[string]string{"hash": fmt.Sprintf("0x%s-%d", page, i), "to": "0xabc", "value": "1000000",
+				"timeStamp": fmt.Sprint(ts.Unix()), "confirmations": "15"})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "1", "message": "OK", "result": result})
+	}))
+	defer server.Close()
+
+	cfg := newTestCryptoConfig(t, fmt.Sprintf(`{"chain":"evm","exchange_rate":7.2,"api_base":%q}`, server.URL))
+	client, _ := newChainClient(cfg)
+	transfers, err := client.IncomingTransfers(context.Background(), "0xabc", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("查询转账失败: %v", err)
+	}
+	if len(pages) != 3 {
+		t.Errorf("应在转账早于时间窗口后停止翻页: %v", pages)
+	}
+	if len(transfers) != 2*explorerPageSize+1 {
+		t.Errorf("应返回时间窗口内所有页的转账，实际 %d 条", len(transfers))
+	}
+}
@@ -232,3 +232,109 @@ func (s *PayPalService) VerifyNotify(params map[string]string) bool {
 	return true
 }
 
+
+// paypalPayment PayPal 支付详情（/v1/payments/payment/{id}）
+type paypalPayment struct {
+	ID           string `json:"id"`
+	State        string `json:"state"` // created / approved / failed
+	Transactions []struct {
+		InvoiceNumber string `json:"invoice_number"`
+		Amount        struct {
+			Total    string `json:"total"`
+			Currency string `json:"currency"`
+		} `json:"amount"`
+	} `json:"transactions"`
+}
+
+// paymentRequest 调用 PayPal 支付接口（payload 为空时发送 GET 请求）
+func (s *PayPalService) paymentRequest(path string, payload interface{}) (*paypalPayment, error) {
+	accessToken, err := s.getAccessToken()
+	if err != nil {
+		return nil, fmt.Errorf("获取访问令牌失败: %v", err)
+	}
+
+	method := http.MethodGet
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		method = http.MethodPost
+		body = bytes.NewBuffer(data)
+	}
+	req, err := http.NewRequest(method, s.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("PayPal 返回错误状态: %d", resp.StatusCode)
+	}
+	var payment paypalPayment
+	if err := json.NewDecoder(resp.Body).Decode(&payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// ParseNotify 解析 PayPal 支付返回：通过 paymentId 向 PayPal 查询支付详情，
+// 买家已授权（带 PayerID）但尚未执行的支付会先执行扣款
+func (s *PayPalService) ParseNotify(req *NotifyRequest) (*Notification, error) {
+	paymentID := req.Params["paymentId"]
+	if paymentID == "" {
+		return nil, fmt.Errorf("PayPal 回调缺少 paymentId")
+	}
+
+	payment, err := s.paymentRequest("/v1/payments/payment/"+paymentID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("查询 PayPal 支付失败: %v", err)
+	}
+	if payerID := req.Params["PayerID"]; payment.State == "created" && payerID != "" {
+		payment, err = s.paymentRequest("/v1/payments/payment/"+paymentID+"/execute", map[string]string{"payer_id": payerID})
+		if err != nil {
+			return nil, fmt.Errorf("执行 PayPal 支付失败: %v", err)
+		}
+	}
+
+	notification := &Notification{
+		OrderNo: req.Params["order_no"],
+		TradeNo: payment.ID,
+		Status:  payment.State,
+		Paid:    payment.State == "approved",
+		Raw:     req.Params,
+	}
+	if len(payment.Transactions) > 0 {
+		txn := payment.Transactions[0]
+		if txn.InvoiceNumber != "" {
+			notification.OrderNo = txn.InvoiceNumber
+		}
+		notification.Amount = parseAmount(txn.Amount.Total)
+		notification.Currency = txn.Amount.Currency
+	}
+	return notification, nil
+}
+
+// QueryStatus PayPal 需要 paymentId 查询，暂不支持按订单号查询
+func (s *PayPalService) QueryStatus(orderNo string) (*QueryResult, error) {
+	return nil, ErrNotSupported
+}
+
+// Refund PayPal 暂不支持退款
+func (s *PayPalService) Refund(orderNo, refundNo string, amount float64, reason string) (*RefundResult, error) {
+	return nil, ErrNotSupported
+}
+
+// Close PayPal 未执行的支付会自动过期，无需关闭
+func (s *PayPalService) Close(orderNo string) error {
+	return ErrNotSupported
+}
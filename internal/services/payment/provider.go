@@ -0,0 +1,208 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"cboard-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotSupported 支付方式不支持该操作（如主动查询、退款）
+var ErrNotSupported = errors.New("该支付方式不支持此操作")
+
+// ErrRefundRejected 网关明确拒绝了退款请求（退款未执行），调用方可以释放占用的退款金额
+// Refund 返回的其他错误（超时、网络错误、网关系统繁忙）结果不确定，需要用同一退款单号重试确认
+var ErrRefundRejected = errors.New("支付网关拒绝退款")
+
+// refundRejectedError 保留原始错误信息，同时可以用 errors.Is 判断为 ErrRefundRejected
+type refundRejectedError struct {
+	err error
+}
+
+func (e *refundRejectedError) Error() string        { return e.err.Error() }
+func (e *refundRejectedError) Unwrap() error        { return e.err }
+func (e *refundRejectedError) Is(target error) bool { return target == ErrRefundRejected }
+
+// rejectRefund 将错误标记为网关明确拒绝的退款
+func rejectRefund(err error) error {
+	return &refundRejectedError{err: err}
+}
+
+// Provider 支付网关：创建支付、解析回调、查询状态、退款和关闭交易
+// 新增支付方式时实现该接口并在 init 中调用 Register 注册，下单、回调和状态查询会自动路由
+type Provider interface {
+	// CreatePayment 创建支付，返回支付链接或二维码内容
+	CreatePayment(order *models.Order, amount float64) (string, error)
+	// ParseNotify 验证并解析异步回调，验签失败时返回错误
+	ParseNotify(req *NotifyRequest) (*Notification, error)
+	// QueryStatus 主动查询交易状态，不支持时返回 ErrNotSupported
+	QueryStatus(orderNo string) (*QueryResult, error)
+	// Refund 退款，refundNo 标识一次退款请求（部分退款时需唯一，重试时复用以保证幂等），
+	// 不支持时返回 ErrNotSupported，网关明确拒绝时返回可用 errors.Is 匹配 ErrRefundRejected 的错误
+	Refund(orderNo, refundNo string, amount float64, reason string) (*RefundResult, error)
+	// Close 关闭未支付的交易，不支持时返回 ErrNotSupported
+	Close(orderNo string) error
+}
+
+// NotifyRequest 异步回调请求（表单/查询参数、原始请求体和请求头）
+type NotifyRequest struct {
+	Params map[string]string
+	Body   []byte
+	Header http.Header
+}
+
+// Notification 统一的回调解析结果
+type Notification struct {
+	OrderNo  string            // 商户订单号（订单或充值记录）
+	TradeNo  string            // 第三方交易号
+	Amount   float64           // 实付金额（元），0 表示回调中未携带金额
+	Currency string            // 币种，为空表示 CNY
+	Status   string            // 网关原始交易状态
+	Paid     bool              // 是否已支付成功
+	Raw      map[string]string // 原始回调参数，保存到交易记录
+}
+
+// QueryResult 统一的交易查询结果
+type QueryResult struct {
+	OrderNo string
+	TradeNo string
+	Amount  float64
+	Status  string
+	Paid    bool
+}
+
+// RefundResult 退款结果
+type RefundResult struct {
+	RefundNo string
+	TradeNo  string
+	Amount   float64
+}
+
+// Factory 根据支付配置创建支付网关
+type Factory func(cfg *models.PaymentConfig) (Provider, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register 注册支付网关，key 为 PaymentConfig.PayType（不区分大小写）
+func Register(payType string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(payType)] = factory
+}
+
+// Supported 是否已注册该支付方式
+func Supported(payType string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	_, ok := registry[strings.ToLower(payType)]
+	return ok
+}
+
+// PayTypes 已注册的支付方式
+func PayTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	types := make([]string, 0, len(registry))
+	for payType := range registry {
+		types = append(types, payType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewProvider 根据支付配置创建对应的支付网关
+func NewProvider(cfg *models.PaymentConfig) (Provider, error) {
+	registryMu.RLock()
+	factory, ok := registry[strings.ToLower(cfg.PayType)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("不支持的支付方式: %s", cfg.PayType)
+	}
+	return factory(cfg)
+}
+
+// ActiveConfig 查找启用的支付配置（不区分大小写，按排序取第一个）
+func ActiveConfig(db *gorm.DB, payType string) (*models.PaymentConfig, error) {
+	var cfg models.PaymentConfig
+	if err := db.Where("LOWER(pay_type) = LOWER(?) AND status = ?", payType, 1).Order("sort_order ASC").First(&cfg).Error; err != nil {
+		return nil, fmt.Errorf("未找到启用的支付配置: %s", payType)
+	}
+	return &cfg, nil
+}
+
+func init() {
+	Register("alipay", func(cfg *models.PaymentConfig) (Provider, error) {
+		svc, err := NewAlipayService(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return svc, nil
+	})
+	Register("wechat", func(cfg *models.PaymentConfig) (Provider, error) {
+		svc, err := NewWechatService(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return svc, nil
+	})
+	Register("paypal", func(cfg *models.PaymentConfig) (Provider, error) {
+		svc, err := NewPayPalService(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return svc, nil
+	})
+	Register("applepay", func(cfg *models.PaymentConfig) (Provider, error) {
+		svc, err := NewApplePayService(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return svc, nil
+	})
+	Register("stripe", func(cfg *models.PaymentConfig) (Provider, error) {
+		svc, err := NewStripeService(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return svc, nil
+	})
+	Register("crypto", func(cfg *models.PaymentConfig) (Provider, error) {
+		svc, err := NewCryptoService(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return svc, nil
+	})
+	Register("bank_transfer", func(cfg *models.PaymentConfig) (Provider, error) {
+		svc, err := NewBankTransferService(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return svc, nil
+	})
+}
+
+// parseAmount 解析回调中的金额字符串（元）
+func parseAmount(s string) float64 {
+	var amount float64
+	fmt.Sscanf(strings.TrimSpace(s), "%f", &amount)
+	return amount
+}
+
+// copyParams 复制回调参数，避免验签时修改调用方的 map
+func copyParams(params map[string]string) map[string]string {
+	out := make(map[string]string, len(params))
+	for k, v := range params {
+		out[k] = v
+	}
+	return out
+}
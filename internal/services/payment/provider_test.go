@@ -0,0 +1,62 @@
+package payment
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"cboard-go/internal/models"
+)
+
+// TestNewProvider 测试按支付类型从注册表创建支付网关
+func TestNewProvider(t *testing.T) {
+	cfg := &models.PaymentConfig{PayType: "WeChat", WechatAPIKey: sql.NullString{String: "key", Valid: true}}
+	provider, err := NewProvider(cfg)
+	if err != nil {
+		t.Fatalf("创建微信支付网关失败: %v", err)
+	}
+	if _, ok := provider.(*WechatService); !ok {
+		t.Errorf("期望 *WechatService，实际 %T", provider)
+	}
+	if _, err := NewProvider(&models.PaymentConfig{PayType: "unknown"}); err == nil {
+		t.Error("未注册的支付方式应返回错误")
+	}
+	if _, err := NewProvider(&models.PaymentConfig{PayType: "alipay"}); err == nil {
+		t.Error("支付宝配置不完整时应返回错误")
+	}
+}
+
+// TestWechatParseNotify 测试微信支付 XML 回调的验签和金额换算
+func TestWechatParseNotify(t *testing.T) {
+	svc := &WechatService{APIKey: "test-key"}
+	params := map[string]string{
+		"return_code":    "SUCCESS",
+		"result_code":    "SUCCESS",
+		"out_trade_no":   "ORD001",
+		"transaction_id": "4200001",
+		"total_fee":      "1250",
+	}
+	body := fmt.Sprintf("<xml><return_code><![CDATA[SUCCESS]]></return_code><result_code><![CDATA[SUCCESS]]></result_code>"+
+		"<out_trade_no><![CDATA[ORD001]]></out_trade_no><transaction_id><![CDATA[4200001]]></transaction_id>"+
+		"<total_fee>1250</total_fee><sign><![CDATA[%s]]></sign></xml>", svc.Sign(params))
+
+	notify, err := svc.ParseNotify(&NotifyRequest{Body: []byte(body)})
+	if err != nil {
+		t.Fatalf("解析回调失败: %v", err)
+	}
+	if !notify.Paid || notify.OrderNo != "ORD001" || notify.TradeNo != "4200001" {
+		t.Errorf("回调解析结果不正确: %+v", notify)
+	}
+	if notify.Amount != 12.5 {
+		t.Errorf("金额应换算为 12.5 元，实际 %v", notify.Amount)
+	}
+	if notify.Raw["sign"] == "" {
+		t.Error("原始回调参数应保留签名")
+	}
+
+	tampered := []byte(fmt.Sprintf("<xml><return_code>SUCCESS</return_code><result_code>SUCCESS</result_code>"+
+		"<out_trade_no>ORD001</out_trade_no><total_fee>1</total_fee><sign>%s</sign></xml>", svc.Sign(params)))
+	if _, err := svc.ParseNotify(&NotifyRequest{Body: tampered}); err == nil {
+		t.Error("篡改金额后应验签失败")
+	}
+}
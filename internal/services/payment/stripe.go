@@ -0,0 +1,469 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cboard-go/internal/models"
+)
+
+// stripeAPIBase Stripe API 地址（ConfigJSON 中的 api_base 可覆盖，用于对接本地模拟服务）
+const stripeAPIBase = "https://api.stripe.com"
+
+// stripeSignatureTolerance Webhook 签名时间戳允许的最大偏差，防止重放
+const stripeSignatureTolerance = 5 * time.Minute
+
+// stripeZeroDecimal 无小数位的币种（金额单位即为元）
+// 参考：https://docs.stripe.com/currencies#zero-decimal
+var stripeZeroDecimal = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true, "kmf": true, "krw": true, "mga": true,
+	"pyg": true, "rwf": true, "ugx": true, "vnd": true, "vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+// StripeService Stripe Checkout 支付服务
+// 订单金额均为人民币，按配置的币种和汇率（1 元人民币兑换的目标币种金额）换算后创建 Checkout Session
+type StripeService struct {
+	secretKey     string
+	webhookSecret string
+	apiBase       string
+	currency      string
+	exchangeRate  float64
+	returnURL     string
+	client        *http.Client
+}
+
+// stripeSession Checkout Session（仅使用到的字段）
+type stripeSession struct {
+	ID                string            `json:"id"`
+	URL               string            `json:"url"`
+	Status            string            `json:"status"`
+	PaymentStatus     string            `json:"payment_status"` // paid / unpaid / no_payment_required
+	PaymentIntent     string            `json:"payment_intent"`
+	AmountTotal       int64             `json:"amount_total"`
+	Currency          string            `json:"currency"`
+	ClientReferenceID string            `json:"client_reference_id"`
+	Metadata          map[string]string `json:"metadata"`
+}
+
+// stripePaymentIntent PaymentIntent（仅使用到的字段）
+type stripePaymentIntent struct {
+	ID             string            `json:"id"`
+	Status         string            `json:"status"` // succeeded / processing / requires_payment_method ...
+	AmountReceived int64             `json:"amount_received"`
+	Currency       string            `json:"currency"`
+	Metadata       map[string]string `json:"metadata"`
+}
+
+// NewStripeService 创建 Stripe 服务
+// ConfigJSON 可选项：webhook_secret（Webhook 签名密钥）、currency（默认 cny）、exchange_rate（非人民币时必填）、api_base
+func NewStripeService(paymentConfig *models.PaymentConfig) (*StripeService, error) {
+	secretKey := ""
+	if paymentConfig.StripeSecretKey.Valid {
+		secretKey = strings.TrimSpace(paymentConfig.StripeSecretKey.String)
+	}
+	if secretKey == "" {
+		return nil, fmt.Errorf("Stripe 私钥（Secret Key）未配置")
+	}
+	returnURL := ""
+	if paymentConfig.ReturnURL.Valid {
+		returnURL = strings.TrimSpace(paymentConfig.ReturnURL.String)
+	}
+	if returnURL == "" {
+		return nil, fmt.Errorf("Stripe 支付完成后的返回地址未配置，请在支付配置中设置 ReturnURL")
+	}
+
+	service := &StripeService{
+		secretKey: secretKey,
+		apiBase:   stripeAPIBase,
+		currency:  "cny",
+		returnURL: returnURL,
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}
+	if paymentConfig.ConfigJSON.Valid {
+		var configData map[string]interface{}
+		if err := json.Unmarshal([]byte(paymentConfig.ConfigJSON.String), &configData); err == nil {
+			if v, ok := configData["webhook_secret"].(string); ok {
+				service.webhookSecret = strings.TrimSpace(v)
+			}
+			if v, ok := configData["currency"].(string); ok && strings.TrimSpace(v) != "" {
+				service.currency = strings.ToLower(strings.TrimSpace(v))
+			}
+			if v, ok := configData["api_base"].(string); ok && strings.TrimSpace(v) != "" {
+				service.apiBase = strings.TrimRight(strings.TrimSpace(v), "/")
+			}
+			switch v := configData["exchange_rate"].(type) {
+			case float64:
+				service.exchangeRate = v
+			case string:
+				service.exchangeRate, _ = strconv.ParseFloat(strings.TrimSpace(v), 64)
+			}
+		}
+	}
+	if service.currency == "cny" {
+		service.exchangeRate = 1
+	}
+	if service.exchangeRate <= 0 {
+		return nil, fmt.Errorf("Stripe 币种为 %s 时需要配置汇率 exchange_rate（1 元人民币兑换的 %s 金额）",
+			strings.ToUpper(service.currency), strings.ToUpper(service.currency))
+	}
+	return service, nil
+}
+
+// toMinorUnits 将人民币金额按汇率换算为目标币种的最小货币单位（分、美分；无小数币种为元）
+func toMinorUnits(amountCNY, rate float64, currency string) int64 {
+	converted := amountCNY * rate
+	if stripeZeroDecimal[currency] {
+		return int64(math.Round(converted))
+	}
+	return int64(math.Round(converted * 100))
+}
+
+// fromMinorUnits 将最小货币单位换算回人民币金额
+func fromMinorUnits(minor int64, rate float64, currency string) float64 {
+	amount := float64(minor)
+	if !stripeZeroDecimal[currency] {
+		amount /= 100
+	}
+	if rate <= 0 {
+		return amount
+	}
+	return math.Round(amount/rate*100) / 100
+}
+
+// do 调用 Stripe API（表单编码请求，JSON 响应）
+func (s *StripeService) do(method, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, s.apiBase+path, body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.secretKey, "")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求 Stripe 失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Type    string `json:"type"`
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			return &stripeAPIError{StatusCode: resp.StatusCode, Message: apiErr.Error.Message}
+		}
+		return &stripeAPIError{StatusCode: resp.StatusCode}
+	}
+	return json.Unmarshal(data, out)
+}
+
+// stripeAPIError Stripe 返回的非 2xx 响应
+type stripeAPIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *stripeAPIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("Stripe 返回错误(%d): %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("Stripe 返回错误状态: %d", e.StatusCode)
+}
+
+// definitive 请求已被 Stripe 明确拒绝（4xx），409 表示同一幂等键的请求仍在处理中，结果不确定
+func (e *stripeAPIError) definitive() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500 && e.StatusCode != http.StatusConflict
+}
+
+// appendQuery 在返回地址后追加查询参数（session_id 占位符不能被转义）
+func appendQuery(base, query string) string {
+	if strings.Contains(base, "?") {
+		return base + "&" + query
+	}
+	return base + "?" + query
+}
+
+// CreatePayment 创建 Checkout Session，返回 Stripe 托管支付页面地址
+// 订单和充值记录共用该方法，order.OrderNo 为订单号或充值单号
+func (s *StripeService) CreatePayment(order *models.Order, amount float64) (string, error) {
+	if order == nil || order.OrderNo == "" {
+		return "", fmt.Errorf("订单号不能为空")
+	}
+	minor := toMinorUnits(amount, s.exchangeRate, s.currency)
+	if minor <= 0 {
+		return "", fmt.Errorf("支付金额必须大于0，当前金额: %.2f", amount)
+	}
+
+	amountStr := fmt.Sprintf("%.2f", amount)
+	rateStr := strconv.FormatFloat(s.exchangeRate, 'f', -1, 64)
+	orderQuery := "order_no=" + url.QueryEscape(order.OrderNo)
+
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", appendQuery(s.returnURL, orderQuery+"&session_id={CHECKOUT_SESSION_ID}"))
+	form.Set("cancel_url", appendQuery(s.returnURL, orderQuery+"&cancel=1"))
+	form.Set("client_reference_id", order.OrderNo)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", s.currency)
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(minor, 10))
+	form.Set("line_items[0][price_data][product_data][name]", fmt.Sprintf("订单支付-%s", order.OrderNo))
+	// 订单号、人民币金额和汇率同时写入 Session 和 PaymentIntent，回调和主动查询时据此核对金额
+	for _, prefix := range []string{"metadata", "payment_intent_data[metadata]"} {
+		form.Set(prefix+"[order_no]", order.OrderNo)
+		form.Set(prefix+"[amount]", amountStr)
+		form.Set(prefix+"[exchange_rate]", rateStr)
+	}
+
+	// 同一订单、同一金额重复发起支付时复用同一个 Session
+	idempotencyKey := fmt.Sprintf("checkout-%s-%s-%d", order.OrderNo, s.currency, minor)
+	var session stripeSession
+	if err := s.do(http.MethodPost, "/v1/checkout/sessions", form, idempotencyKey, &session); err != nil {
+		return "", fmt.Errorf("创建 Stripe Checkout Session 失败: %v", err)
+	}
+	if session.URL == "" {
+		return "", fmt.Errorf("Stripe 未返回支付页面地址")
+	}
+	return session.URL, nil
+}
+
+// verifySignature 验证 Stripe-Signature 请求头（t=时间戳,v1=HMAC-SHA256(时间戳.请求体)）
+func (s *StripeService) verifySignature(header string, body []byte, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return fmt.Errorf("Stripe-Signature 格式错误")
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("Stripe-Signature 时间戳无效")
+	}
+	if diff := now.Sub(time.Unix(ts, 0)); diff > stripeSignatureTolerance || diff < -stripeSignatureTolerance {
+		return fmt.Errorf("Stripe-Signature 时间戳超出允许范围")
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.webhookSecret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+	for _, sig := range signatures {
+		if decoded, err := hex.DecodeString(sig); err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Stripe-Signature 签名不匹配")
+}
+
+// ParseNotify 解析 Stripe Webhook 事件
+// 配置了 webhook_secret 时验证 Stripe-Signature；未配置时向 Stripe 重新查询 Session，不信任请求体中的数据
+func (s *StripeService) ParseNotify(req *NotifyRequest) (*Notification, error) {
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(req.Body, &event); err != nil {
+		return nil, fmt.Errorf("解析 Stripe 事件失败: %v", err)
+	}
+
+	if s.webhookSecret != "" {
+		if err := s.verifySignature(req.Header.Get("Stripe-Signature"), req.Body, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	raw := map[string]string{"event_id": event.ID, "event_type": event.Type}
+	// 只处理 Checkout 完成事件（异步支付方式在 async_payment_succeeded 时才到账），其余事件直接确认
+	if event.Type != "checkout.session.completed" && event.Type != "checkout.session.async_payment_succeeded" {
+		return &Notification{Status: event.Type, Raw: raw}, nil
+	}
+
+	var session stripeSession
+	if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+		return nil, fmt.Errorf("解析 Stripe Checkout Session 失败: %v", err)
+	}
+	if s.webhookSecret == "" {
+		if session.ID == "" {
+			return nil, fmt.Errorf("Stripe 事件缺少 Session ID")
+		}
+		var fetched stripeSession
+		if err := s.do(http.MethodGet, "/v1/checkout/sessions/"+url.PathEscape(session.ID), nil, "", &fetched); err != nil {
+			return nil, fmt.Errorf("查询 Stripe Checkout Session 失败: %v", err)
+		}
+		session = fetched
+	}
+
+	orderNo := session.Metadata["order_no"]
+	if orderNo == "" {
+		orderNo = session.ClientReferenceID
+	}
+	tradeNo := session.PaymentIntent
+	if tradeNo == "" {
+		tradeNo = session.ID
+	}
+	raw["session_id"] = session.ID
+	raw["payment_status"] = session.PaymentStatus
+	raw["amount_total"] = strconv.FormatInt(session.AmountTotal, 10)
+	raw["currency"] = session.Currency
+
+	return &Notification{
+		OrderNo:  orderNo,
+		TradeNo:  tradeNo,
+		Amount:   sessionAmount(session.Metadata, session.AmountTotal, session.Currency),
+		Currency: strings.ToUpper(session.Currency),
+		Status:   session.PaymentStatus,
+		Paid:     session.PaymentStatus == "paid",
+		Raw:      raw,
+	}, nil
+}
+
+// sessionAmount 将实付金额换算为人民币：与下单时记录的金额一致时直接返回记录的金额，
+// 避免汇率换算的舍入误差；不一致时按下单汇率换算，由回调处理核对金额
+func sessionAmount(metadata map[string]string, minor int64, currency string) float64 {
+	currency = strings.ToLower(currency)
+	recorded := parseAmount(metadata["amount"])
+	rate, _ := strconv.ParseFloat(metadata["exchange_rate"], 64)
+	if rate <= 0 {
+		rate = 1
+	}
+	if recorded > 0 && toMinorUnits(recorded, rate, currency) == minor {
+		return recorded
+	}
+	return fromMinorUnits(minor, rate, currency)
+}
+
+// findPaymentIntent 按订单号搜索 PaymentIntent，优先返回已支付成功的记录
+func (s *StripeService) findPaymentIntent(orderNo string) (*stripePaymentIntent, error) {
+	query := url.Values{}
+	query.Set("query", fmt.Sprintf("metadata['order_no']:'%s'", strings.ReplaceAll(orderNo, "'", "\\'")))
+	var result struct {
+		Data []stripePaymentIntent `json:"data"`
+	}
+	if err := s.do(http.MethodGet, "/v1/payment_intents/search?"+query.Encode(), nil, "", &result); err != nil {
+		return nil, err
+	}
+	if len(result.Data) == 0 {
+		return nil, fmt.Errorf("未找到订单 %s 的 Stripe 支付记录", orderNo)
+	}
+	for i := range result.Data {
+		if result.Data[i].Status == "succeeded" {
+			return &result.Data[i], nil
+		}
+	}
+	return &result.Data[0], nil
+}
+
+// QueryStatus 按订单号查询 PaymentIntent 状态
+func (s *StripeService) QueryStatus(orderNo string) (*QueryResult, error) {
+	intent, err := s.findPaymentIntent(orderNo)
+	if err != nil {
+		return nil, err
+	}
+	return &QueryResult{
+		OrderNo: orderNo,
+		TradeNo: intent.ID,
+		Amount:  sessionAmount(intent.Metadata, intent.AmountReceived, intent.Currency),
+		Status:  intent.Status,
+		Paid:    intent.Status == "succeeded",
+	}, nil
+}
+
+// Refund 按下单时的汇率退款，refundNo 作为幂等键，重复请求不会重复退款
+func (s *StripeService) Refund(orderNo, refundNo string, amount float64, reason string) (*RefundResult, error) {
+	if orderNo == "" || refundNo == "" {
+		return nil, rejectRefund(fmt.Errorf("订单号和退款单号不能为空"))
+	}
+	// 查询 PaymentIntent 失败时退款请求尚未发出，可以直接视为拒绝
+	intent, err := s.findPaymentIntent(orderNo)
+	if err != nil {
+		return nil, rejectRefund(err)
+	}
+	if intent.Status != "succeeded" {
+		return nil, rejectRefund(fmt.Errorf("订单 %s 在 Stripe 中未支付成功（%s），无法退款", orderNo, intent.Status))
+	}
+	rate, _ := strconv.ParseFloat(intent.Metadata["exchange_rate"], 64)
+	if rate <= 0 {
+		rate = s.exchangeRate
+	}
+	minor := toMinorUnits(amount, rate, strings.ToLower(intent.Currency))
+	if minor <= 0 || minor > intent.AmountReceived {
+		return nil, rejectRefund(fmt.Errorf("退款金额无效: %.2f", amount))
+	}
+
+	form := url.Values{}
+	form.Set("payment_intent", intent.ID)
+	form.Set("amount", strconv.FormatInt(minor, 10))
+	form.Set("reason", "requested_by_customer")
+	form.Set("metadata[order_no]", orderNo)
+	form.Set("metadata[refund_no]", refundNo)
+	if reason != "" {
+		form.Set("metadata[reason]", reason)
+	}
+	var refund struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := s.do(http.MethodPost, "/v1/refunds", form, "refund-"+refundNo, &refund); err != nil {
+		err = fmt.Errorf("Stripe 退款失败: %w", err)
+		var apiErr *stripeAPIError
+		if errors.As(err, &apiErr) && apiErr.definitive() {
+			return nil, rejectRefund(err)
+		}
+		return nil, err
+	}
+	if refund.Status == "failed" || refund.Status == "canceled" {
+		return nil, rejectRefund(fmt.Errorf("Stripe 退款失败，状态: %s", refund.Status))
+	}
+	return &RefundResult{
+		RefundNo: refundNo,
+		TradeNo:  refund.ID,
+		Amount:   amount,
+	}, nil
+}
+
+// Close Checkout Session 到期后自动失效，无需关闭
+func (s *StripeService) Close(orderNo string) error {
+	return ErrNotSupported
+}
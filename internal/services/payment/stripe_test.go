@@ -0,0 +1,206 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+)
+
+// newTestStripe 创建指向本地模拟 Stripe API 的服务
+func newTestStripe(t *testing.T, apiBase, configJSON string) *StripeService {
+	t.Helper()
+	cfg := &models.PaymentConfig{
+		PayType:         "stripe",
+		StripeSecretKey: sql.NullString{String: "sk_test_123", Valid: true},
+		ReturnURL:       sql.NullString{String: "https://example.com/orders", Valid: true},
+		ConfigJSON:      sql.NullString{String: strings.Replace(configJSON, "{API}", apiBase, 1), Valid: true},
+	}
+	svc, err := NewStripeService(cfg)
+	if err != nil {
+		t.Fatalf("创建 Stripe 服务失败: %v", err)
+	}
+	return svc
+}
+
+// signStripe 按 Stripe 规则生成 Stripe-Signature
+func signStripe(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", ts)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// TestToMinorUnits 测试币种换算（两位小数币种与无小数币种）
+func TestToMinorUnits(t *testing.T) {
+	if got := toMinorUnits(10, 0.14, "usd"); got != 140 {
+		t.Errorf("10 元按 0.14 换算应为 140 美分，实际 %d", got)
+	}
+	if got := toMinorUnits(10, 20.5, "jpy"); got != 205 {
+		t.Errorf("10 元按 20.5 换算应为 205 日元，实际 %d", got)
+	}
+	if got := sessionAmount(map[string]string{"amount": "12.34", "exchange_rate": "0.1389"}, toMinorUnits(12.34, 0.1389, "usd"), "USD"); got != 12.34 {
+		t.Errorf("金额与下单记录一致时应返回记录的人民币金额，实际 %v", got)
+	}
+	if got := sessionAmount(map[string]string{"amount": "12.34", "exchange_rate": "0.1"}, 100, "usd"); got != 10 {
+		t.Errorf("金额不一致时应按下单汇率换算，实际 %v", got)
+	}
+}
+
+// TestStripeCreatePayment 测试创建 Checkout Session 的请求参数
+func TestStripeCreatePayment(t *testing.T) {
+	var form map[string][]string
+	var idempotencyKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/checkout/sessions" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if user, _, _ := r.BasicAuth(); user != "sk_test_123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+		form = r.PostForm
+		idempotencyKey = r.Header.Get("Idempotency-Key")
+		json.NewEncoder(w).Encode(map[string]string{"id": "cs_test_1", "url": "https://checkout.stripe.com/c/pay/cs_test_1"})
+	}))
+	defer server.Close()
+
+	svc := newTestStripe(t, server.URL, `{"api_base":"{API}","currency":"USD","exchange_rate":"0.14"}`)
+	url, err := svc.CreatePayment(&models.Order{OrderNo: "ORD001"}, 100)
+	if err != nil {
+		t.Fatalf("创建支付失败: %v", err)
+	}
+	if url != "https://checkout.stripe.com/c/pay/cs_test_1" {
+		t.Errorf("支付地址不正确: %s", url)
+	}
+	checks := map[string]string{
+		"line_items[0][price_data][currency]":     "usd",
+		"line_items[0][price_data][unit_amount]":  "1400",
+		"metadata[order_no]":                      "ORD001",
+		"metadata[amount]":                        "100.00",
+		"payment_intent_data[metadata][order_no]": "ORD001",
+		"success_url":                             "https://example.com/orders?order_no=ORD001&session_id={CHECKOUT_SESSION_ID}",
+	}
+	for key, want := range checks {
+		if got := form[key]; len(got) == 0 || got[0] != want {
+			t.Errorf("%s 期望 %q，实际 %v", key, want, got)
+		}
+	}
+	if idempotencyKey == "" {
+		t.Error("创建 Session 时应携带 Idempotency-Key")
+	}
+}
+
+// TestStripeParseNotify 测试 Webhook 签名验证和事件解析
+func TestStripeParseNotify(t *testing.T) {
+	svc := newTestStripe(t, "", `{"webhook_secret":"whsec_test","currency":"usd","exchange_rate":0.14}`)
+	body := []byte(`{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_1","payment_intent":"pi_1",` +
+		`"payment_status":"paid","amount_total":1400,"currency":"usd","client_reference_id":"ORD001",` +
+		`"metadata":{"order_no":"ORD001","amount":"100.00","exchange_rate":"0.14"}}}}`)
+
+	header := http.Header{}
+	header.Set("Stripe-Signature", signStripe("whsec_test", time.Now().Unix(), body))
+	notify, err := svc.ParseNotify(&NotifyRequest{Body: body, Header: header})
+	if err != nil {
+		t.Fatalf("解析 Webhook 失败: %v", err)
+	}
+	if !notify.Paid || notify.OrderNo != "ORD001" || notify.TradeNo != "pi_1" || notify.Amount != 100 || notify.Currency != "USD" {
+		t.Errorf("Webhook 解析结果不正确: %+v", notify)
+	}
+
+	header.Set("Stripe-Signature", signStripe("whsec_wrong", time.Now().Unix(), body))
+	if _, err := svc.ParseNotify(&NotifyRequest{Body: body, Header: header}); err == nil {
+		t.Error("签名错误时应返回错误")
+	}
+	header.Set("Stripe-Signature", signStripe("whsec_test", time.Now().Add(-time.Hour).Unix(), body))
+	if _, err := svc.ParseNotify(&NotifyRequest{Body: body, Header: header}); err == nil {
+		t.Error("过期的签名时间戳应返回错误")
+	}
+
+	other := []byte(`{"id":"evt_2","type":"payment_intent.created","data":{"object":{}}}`)
+	header.Set("Stripe-Signature", signStripe("whsec_test", time.Now().Unix(), other))
+	notify, err = svc.ParseNotify(&NotifyRequest{Body: other, Header: header})
+	if err != nil || notify.Paid {
+		t.Errorf("无关事件应返回未支付的结果: %+v, %v", notify, err)
+	}
+}
+
+// TestStripeParseNotifyWithoutSecret 测试未配置签名密钥时向 Stripe 重新查询 Session
+func TestStripeParseNotifyWithoutSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/checkout/sessions/cs_1" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": "cs_1", "payment_intent": "pi_1", "payment_status": "unpaid", "amount_total": 10000, "currency": "cny",
+			"metadata": map[string]string{"order_no": "ORD001", "amount": "100.00", "exchange_rate": "1"},
+		})
+	}))
+	defer server.Close()
+
+	svc := newTestStripe(t, server.URL, `{"api_base":"{API}"}`)
+	forged := []byte(`{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_1","payment_status":"paid"}}}`)
+	notify, err := svc.ParseNotify(&NotifyRequest{Body: forged, Header: http.Header{}})
+	if err != nil {
+		t.Fatalf("解析 Webhook 失败: %v", err)
+	}
+	if notify.Paid {
+		t.Error("应以 Stripe 查询到的 Session 状态为准，不信任请求体")
+	}
+}
+
+// TestStripeRefundErrors 测试退款错误分类：4xx 为明确拒绝，5xx 结果不确定需要重试确认
+func TestStripeRefundErrors(t *testing.T) {
+	refundStatus := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/payment_intents/search":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": []map[string]interface{}{{
+				"id": "pi_1", "status": "succeeded", "amount_received": 1400, "currency": "usd",
+				"metadata": map[string]string{"exchange_rate": "0.14"},
+			}}})
+		case "/v1/refunds":
+			w.WriteHeader(refundStatus)
+			if refundStatus == http.StatusOK {
+				json.NewEncoder(w).Encode(map[string]string{"id": "re_1", "status": "succeeded"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"message": "boom"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	svc := newTestStripe(t, server.URL, `{"api_base":"{API}","currency":"USD","exchange_rate":"0.14"}`)
+
+	if result, err := svc.Refund("ORD001", "RF1", 50, ""); err != nil || result.TradeNo != "re_1" {
+		t.Fatalf("退款应成功: %+v, %v", result, err)
+	}
+	refundStatus = http.StatusBadRequest
+	if _, err := svc.Refund("ORD001", "RF2", 50, ""); !errors.Is(err, ErrRefundRejected) {
+		t.Errorf("400 应视为网关明确拒绝，实际 %v", err)
+	}
+	if _, err := svc.Refund("ORD001", "RF3", 500, ""); !errors.Is(err, ErrRefundRejected) {
+		t.Errorf("超过实收金额应在请求前拒绝，实际 %v", err)
+	}
+	for _, status := range []int{http.StatusInternalServerError, http.StatusConflict} {
+		refundStatus = status
+		_, err := svc.Refund("ORD001", "RF4", 50, "")
+		if err == nil || errors.Is(err, ErrRefundRejected) {
+			t.Errorf("状态 %d 的退款结果不确定，不应视为拒绝: %v", status, err)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package payment
 
 import (
+	"bytes"
 	"crypto/md5"
+	"encoding/xml"
 	"fmt"
+	"io"
 	"sort"
 	"strings"
 	"time"
@@ -130,3 +133,77 @@ func (s *WechatService) Sign(params map[string]string) string {
 	hash := md5.Sum([]byte(signStr.String()))
 	return strings.ToUpper(fmt.Sprintf("%x", hash))
 }
+
+// ParseNotify 验证并解析微信支付异步通知（XML 请求体，兼容表单参数）
+func (s *WechatService) ParseNotify(req *NotifyRequest) (*Notification, error) {
+	params := copyParams(req.Params)
+	if len(req.Body) > 0 && bytes.HasPrefix(bytes.TrimSpace(req.Body), []byte("<xml")) {
+		xmlParams, err := xmlToMap(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("解析微信支付回调失败: %v", err)
+		}
+		params = xmlParams
+	}
+	raw := copyParams(params)
+	if !s.VerifyNotify(params) {
+		return nil, fmt.Errorf("微信支付回调签名验证失败")
+	}
+
+	status := params["result_code"]
+	if params["return_code"] != "SUCCESS" {
+		status = params["return_code"]
+	}
+	tradeNo := params["transaction_id"]
+	if tradeNo == "" {
+		tradeNo = params["trade_no"]
+	}
+	return &Notification{
+		OrderNo: params["out_trade_no"],
+		TradeNo: tradeNo,
+		Amount:  parseAmount(params["total_fee"]) / 100, // 分转换为元
+		Status:  status,
+		Paid:    status == "SUCCESS",
+		Raw:     raw,
+	}, nil
+}
+
+// QueryStatus 微信支付暂不支持主动查询
+func (s *WechatService) QueryStatus(orderNo string) (*QueryResult, error) {
+	return nil, ErrNotSupported
+}
+
+// Refund 微信支付退款需要商户证书，暂不支持
+func (s *WechatService) Refund(orderNo, refundNo string, amount float64, reason string) (*RefundResult, error) {
+	return nil, ErrNotSupported
+}
+
+// Close 微信支付暂不支持关闭交易
+func (s *WechatService) Close(orderNo string) error {
+	return ErrNotSupported
+}
+
+// xmlToMap 将微信支付的 XML 报文转换为 map
+func xmlToMap(data []byte) (map[string]string, error) {
+	params := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var key string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return params, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			key = t.Name.Local
+		case xml.CharData:
+			if key != "" && key != "xml" {
+				params[key] = strings.TrimSpace(string(t))
+			}
+		case xml.EndElement:
+			key = ""
+		}
+	}
+}
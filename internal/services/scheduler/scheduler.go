@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strconv"
@@ -11,6 +12,10 @@ import (
 	"cboard-go/internal/services/config_update"
 	"cboard-go/internal/services/email"
 	"cboard-go/internal/services/node_health"
+	"cboard-go/internal/services/notification"
+	"cboard-go/internal/services/order"
+	"cboard-go/internal/services/payment"
+	"cboard-go/internal/services/traffic"
 	"cboard-go/internal/utils"
 
 	"gorm.io/gorm"
@@ -48,6 +53,8 @@ func (s *Scheduler) Start() {
 	go s.cleanupExpiredData()
 	go s.checkNodeHealth()
 	go s.autoUpdateNodes()
+	go s.resetSubscriptionTraffic()
+	go s.watchCryptoPayments()
 }
 
 // Stop 停止定时任务
@@ -195,6 +202,36 @@ func (s *Scheduler) sendExpirationReminders(now, targetTime time.Time, remaining
 	}
 }
 
+// resetSubscriptionTraffic 按重置周期清零订阅流量（每小时执行一次）
+func (s *Scheduler) resetSubscriptionTraffic() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	// 立即执行一次
+	s.resetSubscriptionTrafficNow()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.resetSubscriptionTrafficNow()
+		}
+	}
+}
+
+// resetSubscriptionTrafficNow 立即检查并重置到期的订阅流量
+func (s *Scheduler) resetSubscriptionTrafficNow() {
+	count, err := traffic.NewTrafficService().ResetDueSubscriptions()
+	if err != nil {
+		log.Printf("重置订阅流量失败: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Printf("已重置 %d 个订阅的流量", count)
+	}
+}
+
 // cleanupExpiredData 清理过期数据（每天执行一次）
 func (s *Scheduler) cleanupExpiredData() {
 	ticker := time.NewTicker(24 * time.Hour)
@@ -228,6 +265,11 @@ func (s *Scheduler) cleanupExpiredDataNow() {
 	// 清理已发送的邮件队列记录（30天前）
 	s.db.Where("status = ? AND sent_at < ?", "sent", thirtyDaysAgo).Delete(&models.EmailQueue{})
 
+	// 节点健康检查记录：超过保留期的原始记录汇总为小时数据
+	if err := node_health.NewNodeHealthService().CompactHistory(now); err != nil {
+		utils.LogErrorMsg("节点健康历史汇总失败: %v", err)
+	}
+
 	// 检查需要发送账户删除警告的用户（30天未登录且无有效套餐）
 	s.checkUsersForDeletionWarning(now)
 
@@ -437,10 +479,56 @@ func (s *Scheduler) checkNodeHealthNow() {
 	}
 }
 
+// watchCryptoPayments 监听加密货币支付单的链上转账（每30秒执行一次）
+func (s *Scheduler) watchCryptoPayments() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.watchCryptoPaymentsNow()
+		}
+	}
+}
+
+// watchCryptoPaymentsNow 立即检查未完成的加密货币支付单，达到确认数的订单入账
+func (s *Scheduler) watchCryptoPaymentsNow() {
+	ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
+	defer cancel()
+
+	orderService := order.NewOrderService()
+	err := payment.PollCryptoPayments(ctx, s.db, func(p *models.CryptoPayment) error {
+		return orderService.CompletePayment(order.PaymentResult{
+			OrderNo: p.OrderNo,
+			TradeNo: p.TxHash,
+			Amount:  p.AmountCNY,
+			Raw: map[string]string{
+				"chain":         p.Chain,
+				"address":       p.Address,
+				"amount":        p.Amount,
+				"tx_hash":       p.TxHash,
+				"confirmations": strconv.Itoa(p.Confirmations),
+			},
+		})
+	}, func(p *models.CryptoPayment) {
+		_ = notification.NewNotificationService().SendAdminNotification("crypto_late", map[string]interface{}{
+			"title": "USDT 逾期到账待处理",
+			"message": fmt.Sprintf("支付单已过期后收到转账，未自动入账，请核实后手动处理\n订单号：%s\n金额：%s USDT（¥%.2f）\n交易哈希：%s",
+				p.OrderNo, p.Amount, p.AmountCNY, p.TxHash),
+		})
+	})
+	if err != nil {
+		utils.LogErrorMsg("加密货币支付检查失败: %v", err)
+	}
+}
+
 // autoUpdateNodes 自动更新节点（根据配置的间隔执行）
 func (s *Scheduler) autoUpdateNodes() {
-	// 默认1小时检查一次配置
-	checkInterval := 1 * time.Hour
+	// 每5分钟检查一次（全局更新间隔和各节点源的独立拉取间隔）
+	checkInterval := 5 * time.Minute
 	ticker := time.NewTicker(checkInterval)
 	defer ticker.Stop()
 
@@ -461,6 +549,12 @@ func (s *Scheduler) autoUpdateNodes() {
 func (s *Scheduler) checkAndRunNodeUpdate() {
 	// 获取配置更新服务的配置
 	configService := config_update.NewConfigUpdateService()
+
+	// 设置了独立拉取间隔的节点源按各自间隔同步，不受全局自动更新开关影响
+	if err := configService.RunDueNodeSources(); err != nil {
+		utils.LogErrorMsg("节点源定时同步失败: %v", err)
+	}
+
 	config, err := configService.GetConfig()
 	if err != nil {
 		utils.LogErrorMsg("获取节点更新配置失败: %v", err)
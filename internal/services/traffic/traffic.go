@@ -0,0 +1,185 @@
+package traffic
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"cboard-go/internal/core/database"
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// UsageReport 节点上报的单条流量记录
+type UsageReport struct {
+	UserID         uint  `json:"user_id"`
+	SubscriptionID uint  `json:"subscription_id"`
+	Upload         int64 `json:"u"`
+	Download       int64 `json:"d"`
+}
+
+// TrafficService 流量统计服务
+type TrafficService struct {
+	db *gorm.DB
+}
+
+// NewTrafficService 创建流量统计服务
+func NewTrafficService() *TrafficService {
+	return &TrafficService{
+		db: database.GetDB(),
+	}
+}
+
+// RecordUsage 记录节点上报的流量，返回成功入账的记录数
+// 计入订阅的流量按节点倍率折算，流量日志保留原始流量和倍率
+func (s *TrafficService) RecordUsage(nodeID uint, reports []UsageReport) (int, error) {
+	if s.db == nil {
+		return 0, fmt.Errorf("数据库未初始化")
+	}
+
+	multiplier := 1.0
+	if nodeID > 0 {
+		var node models.Node
+		if err := s.db.Select("id", "multiplier").First(&node, nodeID).Error; err == nil {
+			multiplier = node.Rate()
+		}
+	}
+
+	recorded := 0
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, r := range reports {
+			if r.Upload < 0 || r.Download < 0 {
+				continue
+			}
+			if r.Upload == 0 && r.Download == 0 {
+				continue
+			}
+
+			var sub models.Subscription
+			query := tx.Model(&models.Subscription{})
+			if r.SubscriptionID > 0 {
+				query = query.Where("id = ?", r.SubscriptionID)
+			} else if r.UserID > 0 {
+				query = query.Where("user_id = ?", r.UserID)
+			} else {
+				continue
+			}
+			if err := query.First(&sub).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					continue
+				}
+				return err
+			}
+
+			if err := tx.Model(&models.Subscription{}).Where("id = ?", sub.ID).Updates(map[string]interface{}{
+				"upload_traffic":   gorm.Expr("upload_traffic + ?", ChargedTraffic(r.Upload, multiplier)),
+				"download_traffic": gorm.Expr("download_traffic + ?", ChargedTraffic(r.Download, multiplier)),
+			}).Error; err != nil {
+				return err
+			}
+
+			log := models.TrafficLog{
+				UserID:         sub.UserID,
+				SubscriptionID: sub.ID,
+				Upload:         r.Upload,
+				Download:       r.Download,
+				Multiplier:     multiplier,
+			}
+			if nodeID > 0 {
+				id := nodeID
+				log.NodeID = &id
+			}
+			if err := tx.Create(&log).Error; err != nil {
+				return err
+			}
+			recorded++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return recorded, nil
+}
+
+// ChargedTraffic 按倍率折算计费流量
+func ChargedTraffic(bytes int64, multiplier float64) int64 {
+	if multiplier <= 0 || multiplier == 1 {
+		return bytes
+	}
+	return int64(math.Round(float64(bytes) * multiplier))
+}
+
+// ResetSubscriptionTraffic 清零订阅的已用流量
+func (s *TrafficService) ResetSubscriptionTraffic(sub *models.Subscription) error {
+	if s.db == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+	now := utils.GetBeijingTime()
+	if err := s.db.Model(sub).Updates(map[string]interface{}{
+		"upload_traffic":   0,
+		"download_traffic": 0,
+		"traffic_reset_at": now,
+	}).Error; err != nil {
+		return err
+	}
+	sub.UploadTraffic = 0
+	sub.DownloadTraffic = 0
+	sub.TrafficResetAt = &now
+	return nil
+}
+
+// ResetDueSubscriptions 重置所有到达重置周期的订阅流量，返回重置数量
+func (s *TrafficService) ResetDueSubscriptions() (int, error) {
+	if s.db == nil {
+		return 0, fmt.Errorf("数据库未初始化")
+	}
+
+	var subs []models.Subscription
+	if err := s.db.Where("traffic_reset_mode IN ?", []string{utils.TrafficResetMonthly, utils.TrafficResetPeriodic}).
+		Find(&subs).Error; err != nil {
+		return 0, err
+	}
+
+	now := utils.GetBeijingTime()
+	count := 0
+	for i := range subs {
+		next, ok := NextResetTime(&subs[i])
+		if !ok || now.Before(next) {
+			continue
+		}
+		if err := s.ResetSubscriptionTraffic(&subs[i]); err != nil {
+			if utils.AppLogger != nil {
+				utils.AppLogger.Error("重置订阅流量失败: subscription_id=%d, error=%v", subs[i].ID, err)
+			}
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// NextResetTime 计算订阅下一次流量重置时间
+// monthly：每自然月1日（北京时间）重置；periodic：上次重置后每 TrafficResetDays 天重置
+func NextResetTime(sub *models.Subscription) (time.Time, bool) {
+	last := sub.CreatedAt
+	if sub.TrafficResetAt != nil {
+		last = *sub.TrafficResetAt
+	}
+	last = utils.ToBeijingTime(last)
+
+	switch sub.TrafficResetMode {
+	case utils.TrafficResetMonthly:
+		return time.Date(last.Year(), last.Month()+1, 1, 0, 0, 0, 0, utils.BeijingTZ), true
+	case utils.TrafficResetPeriodic:
+		days := sub.TrafficResetDays
+		if days <= 0 {
+			days = 30
+		}
+		return last.AddDate(0, 0, days), true
+	default:
+		return time.Time{}, false
+	}
+}
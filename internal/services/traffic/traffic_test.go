@@ -0,0 +1,158 @@
+package traffic
+
+import (
+	"testing"
+	"time"
+
+	"cboard-go/internal/models"
+	"cboard-go/internal/utils"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTrafficTestService 创建使用内存数据库的流量统计服务
+func newTrafficTestService(t *testing.T) (*TrafficService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Subscription{}, &models.Node{}, &models.TrafficLog{}); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	return &TrafficService{db: db}, db
+}
+
+// TestNextResetTime 测试流量重置周期的计算
+func TestNextResetTime(t *testing.T) {
+	beijing := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, utils.BeijingTZ)
+	}
+	cases := []struct {
+		name    string
+		mode    string
+		days    int
+		created time.Time
+		resetAt *time.Time
+		want    time.Time
+		ok      bool
+	}{
+		{"按月：月中创建", utils.TrafficResetMonthly, 0, beijing(2024, 3, 15, 10), nil, beijing(2024, 4, 1, 0), true},
+		{"按月：跨年", utils.TrafficResetMonthly, 0, beijing(2024, 12, 31, 23), nil, beijing(2025, 1, 1, 0), true},
+		{"按月：按北京时间取月份", utils.TrafficResetMonthly, 0, time.Date(2024, 1, 31, 17, 0, 0, 0, time.UTC), nil, beijing(2024, 3, 1, 0), true},
+		{"按月：以上次重置时间为准", utils.TrafficResetMonthly, 0, beijing(2023, 6, 1, 0), ptr(beijing(2024, 2, 1, 0)), beijing(2024, 3, 1, 0), true},
+		{"按周期：自定义天数", utils.TrafficResetPeriodic, 7, beijing(2024, 2, 26, 12), nil, beijing(2024, 3, 4, 12), true},
+		{"按周期：天数无效时按 30 天", utils.TrafficResetPeriodic, 0, beijing(2024, 1, 1, 0), nil, beijing(2024, 1, 31, 0), true},
+		{"按周期：以上次重置时间为准", utils.TrafficResetPeriodic, 10, beijing(2023, 1, 1, 0), ptr(beijing(2024, 5, 1, 8)), beijing(2024, 5, 11, 8), true},
+		{"不重置", "none", 0, beijing(2024, 1, 1, 0), nil, time.Time{}, false},
+	}
+	for _, c := range cases {
+		sub := &models.Subscription{TrafficResetMode: c.mode, TrafficResetDays: c.days, TrafficResetAt: c.resetAt}
+		sub.CreatedAt = c.created
+		got, ok := NextResetTime(sub)
+		if ok != c.ok || !got.Equal(c.want) {
+			t.Errorf("%s: 期望 %v (%v)，实际 %v (%v)", c.name, c.want, c.ok, got, ok)
+		}
+	}
+}
+
+// TestChargedTraffic 测试按节点倍率折算计费流量
+func TestChargedTraffic(t *testing.T) {
+	cases := []struct {
+		bytes      int64
+		multiplier float64
+		want       int64
+	}{
+		{1000, 1, 1000},
+		{1000, 0, 1000},
+		{1000, -2, 1000},
+		{1000, 2, 2000},
+		{1000, 0.5, 500},
+		{3, 0.5, 2},
+		{1 << 40, 1.5, 3 << 39},
+	}
+	for _, c := range cases {
+		if got := ChargedTraffic(c.bytes, c.multiplier); got != c.want {
+			t.Errorf("%d × %v: 期望 %d，实际 %d", c.bytes, c.multiplier, c.want, got)
+		}
+	}
+}
+
+// TestRecordUsageMultiplier 测试流量按节点倍率计入订阅，流量日志保留原始流量
+func TestRecordUsageMultiplier(t *testing.T) {
+	s, db := newTrafficTestService(t)
+	db.Create(&models.Node{ID: 1, Name: "香港 01", Type: "ss", Multiplier: 2})
+	db.Create(&models.Subscription{ID: 1, UserID: 7, SubscriptionURL: "t1", UploadTraffic: 100})
+
+	recorded, err := s.RecordUsage(1, []UsageReport{
+		{SubscriptionID: 1, Upload: 10, Download: 300},
+		{SubscriptionID: 1, Upload: -1, Download: 5},
+		{SubscriptionID: 99, Upload: 1, Download: 1},
+		{SubscriptionID: 1},
+	})
+	if err != nil {
+		t.Fatalf("记录流量失败: %v", err)
+	}
+	if recorded != 1 {
+		t.Errorf("应只入账 1 条记录，实际 %d", recorded)
+	}
+
+	var sub models.Subscription
+	db.First(&sub, 1)
+	if sub.UploadTraffic != 120 || sub.DownloadTraffic != 600 {
+		t.Errorf("计费流量错误: 上传 %d，下载 %d", sub.UploadTraffic, sub.DownloadTraffic)
+	}
+	var log models.TrafficLog
+	db.First(&log)
+	if log.Upload != 10 || log.Download != 300 || log.Multiplier != 2 || log.UserID != 7 || log.NodeID == nil || *log.NodeID != 1 {
+		t.Errorf("流量日志错误: %+v", log)
+	}
+}
+
+// TestResetDueSubscriptions 测试只重置到达重置周期的订阅
+func TestResetDueSubscriptions(t *testing.T) {
+	s, db := newTrafficTestService(t)
+	now := utils.GetBeijingTime()
+	lastMonth := now.AddDate(0, -1, 0)
+	yesterday := now.AddDate(0, 0, -1)
+	subs := []models.Subscription{
+		{ID: 1, SubscriptionURL: "monthly-due", TrafficResetMode: utils.TrafficResetMonthly, TrafficResetAt: &lastMonth, UploadTraffic: 10, DownloadTraffic: 20},
+		{ID: 2, SubscriptionURL: "periodic-due", TrafficResetMode: utils.TrafficResetPeriodic, TrafficResetDays: 1, TrafficResetAt: &yesterday, DownloadTraffic: 30},
+		{ID: 3, SubscriptionURL: "periodic-pending", TrafficResetMode: utils.TrafficResetPeriodic, TrafficResetDays: 7, TrafficResetAt: &yesterday, DownloadTraffic: 40},
+		{ID: 4, SubscriptionURL: "none", TrafficResetMode: "none", DownloadTraffic: 50},
+		{ID: 5, SubscriptionURL: "monthly-never", TrafficResetMode: utils.TrafficResetMonthly, DownloadTraffic: 60},
+	}
+	for i := range subs {
+		db.Create(&subs[i])
+	}
+	// 创建时间很早且从未重置的订阅以创建时间为准
+	db.Model(&models.Subscription{}).Where("id IN ?", []uint{4, 5}).Update("created_at", now.AddDate(-1, 0, 0))
+
+	count, err := s.ResetDueSubscriptions()
+	if err != nil {
+		t.Fatalf("重置流量失败: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("应重置 3 个订阅，实际 %d", count)
+	}
+
+	want := map[uint]int64{1: 0, 2: 0, 3: 40, 4: 50, 5: 0}
+	var got []models.Subscription
+	db.Order("id").Find(&got)
+	for _, sub := range got {
+		if sub.UsedTraffic() != want[sub.ID] {
+			t.Errorf("订阅 %d: 期望已用流量 %d，实际 %d", sub.ID, want[sub.ID], sub.UsedTraffic())
+		}
+		if want[sub.ID] == 0 && (sub.TrafficResetAt == nil || sub.TrafficResetAt.Before(now.Add(-time.Minute))) {
+			t.Errorf("订阅 %d: 重置后应更新重置时间: %v", sub.ID, sub.TrafficResetAt)
+		}
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
@@ -2,6 +2,8 @@ package utils
 
 import (
 	"encoding/base64"
+	"fmt"
+
 	"github.com/google/uuid"
 )
 
@@ -15,3 +17,16 @@ func GenerateUUID() string {
 	return uuid.New().String()
 }
 
+// FormatBytes 将字节数格式化为可读字符串（如 1.50 GB）
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -21,6 +21,7 @@ const (
 	OrderStatusPaid     = "paid"
 	OrderStatusFailed   = "failed"
 	OrderStatusCanceled = "canceled"
+	OrderStatusRefunded = "refunded"
 )
 
 // 验证码用途常量
@@ -29,3 +30,10 @@ const (
 	VerificationPurposeResetPassword = "reset_password"
 	VerificationPurposeChangeEmail   = "change_email"
 )
+
+// 流量重置策略常量
+const (
+	TrafficResetNone     = "none"     // 不重置
+	TrafficResetMonthly  = "monthly"  // 每自然月1日重置
+	TrafficResetPeriodic = "periodic" // 每隔 TrafficResetDays 天重置
+)